@@ -999,6 +999,7 @@ const en = {
     "s3:UploadPart": "Upload Part",
     
     // S3 operations - Object Operations
+    "s3:AppendObject": "Append Object",
     "s3:CopyObject": "Copy Object",
     "s3:DeleteObject": "Delete Object",
     "s3:DeleteObjects": "Delete Objects",
@@ -1127,6 +1128,7 @@ const en = {
     // S3 操作
     "s3:AbortMultipartUpload": "{actor} aborted multipart upload task",
     "s3:CompleteMultipartUpload": "{actor} completed multipart upload task and created object {target}",
+    "s3:AppendObject": "{actor} appended data to object {target}",
     "s3:CopyObject": "{actor} copied object to {target}",
     "s3:CreateMultipartUpload": "{actor} initiated multipart upload task",
     "s3:DeleteBucketCors": "{actor} deleted CORS configuration for bucket {bucket}",
@@ -1300,6 +1302,12 @@ const en = {
     useFixedLengthChunking: "Use Fixed Length Chunking",
     enableDataEncryption: "Enable Data Encryption",
     enableDataCompression: "Enable Data Compression",
+    dedupScope: "Dedup Scope",
+    dedupScopeGlobal: "Global",
+    dedupScopeAccount: "Per Account",
+    dedupScopeBucket: "Per Bucket",
+    dedupScopeHint: "Chunks are only deduplicated within the same scope, other tenants cannot observe shared data",
+    enableConvergentEncryption: "Enable Convergent Encryption (per-scope key)",
     saveConfiguration: "Save Configuration",
     saveSuccess: "Configuration saved successfully!",
     noConfigs: "No chunk configurations found",
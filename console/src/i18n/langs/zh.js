@@ -972,6 +972,7 @@ const zh = {
     "s3:UploadPart": "上传部分",
     
     // S3 操作 - 对象操作
+    "s3:AppendObject": "追加写对象",
     "s3:CopyObject": "复制对象",
     "s3:DeleteObject": "删除对象",
     "s3:DeleteObjects": "批量删除对象",
@@ -1099,6 +1100,7 @@ const zh = {
     // S3 操作
     "s3:AbortMultipartUpload": "{actor} 中止了多部分上传任务",
     "s3:CompleteMultipartUpload": "{actor} 完成了多部分上传任务，创建了对象 {target}",
+    "s3:AppendObject": "{actor} 向对象 {target} 追加了数据",
     "s3:CopyObject": "{actor} 复制了对象到 {target}",
     "s3:CreateMultipartUpload": "{actor} 启动了多部分上传任务",
     "s3:DeleteBucketCors": "{actor} 删除了存储桶 {bucket} 的CORS配置",
@@ -1272,6 +1274,12 @@ const zh = {
     useFixedLengthChunking: "使用固定长度切片",
     enableDataEncryption: "启用数据加密",
     enableDataCompression: "启用数据压缩",
+    dedupScope: "去重范围",
+    dedupScopeGlobal: "全局",
+    dedupScopeAccount: "按账户",
+    dedupScopeBucket: "按存储桶",
+    dedupScopeHint: "chunk 只在同一范围内去重，其他租户无法感知共享的数据",
+    enableConvergentEncryption: "启用收敛加密（按范围的密钥）",
     saveConfiguration: "保存配置",
     saveSuccess: "配置保存成功！",
     noConfigs: "未找到切片配置",
@@ -47,7 +47,11 @@ import (
 	sb "github.com/mageg-x/dedups3/service/bucket"
 	"github.com/mageg-x/dedups3/service/event"
 	iam2 "github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/kms"
+	"github.com/mageg-x/dedups3/service/lifecycle"
 	"github.com/mageg-x/dedups3/service/object"
+	"github.com/mageg-x/dedups3/service/replication"
+	"github.com/mageg-x/dedups3/service/site"
 	"github.com/mageg-x/dedups3/service/stats"
 	"github.com/mageg-x/dedups3/service/storage"
 )
@@ -118,7 +122,7 @@ func Prepare4Iam(w http.ResponseWriter, r *http.Request) *PrepareEnv {
 	}
 
 	accessKeyIDs := utils.MapKeys(user.AccessKeys)
-	logger.GetLogger("dedups3").Debug("account %s  user %s has access key %s", accountID, username, accessKeyIDs[0])
+	logger.GetLogger("dedups3").Debugf("account %s  user %s has access key %s", accountID, username, accessKeyIDs[0])
 
 	return &PrepareEnv{
 		username:  username,
@@ -142,7 +146,7 @@ func Prepare4S3(w http.ResponseWriter, r *http.Request, bucketName string) *Prep
 		xhttp.AdminWriteJSONError(w, r, http.StatusServiceUnavailable, "service unavailable", nil, http.StatusServiceUnavailable)
 		return nil
 	}
-	bi, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	bi, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucketName,
 		AccessKeyID: pe.accessKey,
 	})
@@ -296,6 +300,40 @@ func AdminGetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	xhttp.AdminWriteJSONError(w, r, 0, "success", _stats, http.StatusOK)
 }
 
+// AdminGetLifecycleHandler 获取生命周期服务的扫描进度和账户下各桶规则的执行统计
+func AdminGetLifecycleHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call GetLifecycleHandler] %#v", r.URL)
+	pe := Prepare4Iam(w, r)
+	if pe == nil {
+		return
+	}
+	xhttp.SetTraceAttr(r.Context(), "lifecycle", pe.accountID)
+
+	ls := lifecycle.GetLifecycleService()
+	if ls == nil {
+		logger.GetLogger("dedups3").Errorf("lifecycle service is nil")
+		xhttp.AdminWriteJSONError(w, r, http.StatusServiceUnavailable, "internal server error", nil, http.StatusServiceUnavailable)
+		return
+	}
+	progress, err := ls.GetProgress()
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get lifecycle progress: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "internal server error", nil, http.StatusInternalServerError)
+		return
+	}
+	buckets, err := ls.ListBucketStats(pe.accountID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get lifecycle stats for account %s: %v", pe.accountID, err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "internal server error", nil, http.StatusInternalServerError)
+		return
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", struct {
+		Progress *lifecycle.Progress      `json:"progress"`
+		Buckets  []*lifecycle.BucketStats `json:"buckets"`
+	}{Progress: progress, Buckets: buckets}, http.StatusOK)
+}
+
 func AdminListBucketsHandler(w http.ResponseWriter, r *http.Request) {
 	logger.GetLogger("dedups3").Debugf("[Call ListBucketHandler] %#v", r.URL)
 	pe := Prepare4Iam(w, r)
@@ -463,7 +501,7 @@ func AdminListObjectsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objects, commonPrefixes, isTruncated, nextMarker, err := pe.os.ListObjects(bucketName, pe.accessKey, prefix, marker, delimiter, 1000)
+	objects, commonPrefixes, isTruncated, nextMarker, err := pe.os.ListObjects(r.Context(), bucketName, pe.accessKey, prefix, marker, delimiter, 1000)
 	if err != nil {
 		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
 			xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "AccessDenied", nil, http.StatusForbidden)
@@ -588,6 +626,7 @@ func AdminCreateFolderHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "internal server error", nil, http.StatusInternalServerError)
 		return
 	}
+	scheduleReplication(pe.accessKey, req.BucketName, req.FolderName)
 
 	xhttp.AdminWriteJSONError(w, r, 0, "success", nil, http.StatusOK)
 }
@@ -694,6 +733,7 @@ func AdminPutObjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scheduleReplication(pe.accessKey, bucketName, objectName)
 	resp := map[string]interface{}{
 		"bucket": bucketName,
 		"key":    objectName,
@@ -718,7 +758,7 @@ func AdminDelObjectHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request body", nil, http.StatusBadRequest)
 		return
 	}
-	logger.GetLogger("dedups3").Debug("get delete request object list : %#v", req.Keys)
+	logger.GetLogger("dedups3").Debugf("get delete request object list : %#v", req.Keys)
 
 	// 验证参数
 	req.BucketName = strings.TrimSpace(req.BucketName)
@@ -750,7 +790,7 @@ func AdminDelObjectHandler(w http.ResponseWriter, r *http.Request) {
 			// 列出目录下的对象和子目录
 			marker := ""
 			for {
-				objects, _, isTruncated, nextMarker, err := pe.os.ListObjects(req.BucketName, pe.accessKey, key, marker, "", 1000)
+				objects, _, isTruncated, nextMarker, err := pe.os.ListObjects(r.Context(), req.BucketName, pe.accessKey, key, marker, "", 1000)
 				if err != nil {
 					logger.GetLogger("dedups3").Errorf("error listing objects of folder %s : %v", key, err)
 					xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "object service enum folder failed", nil, http.StatusInternalServerError)
@@ -780,7 +820,7 @@ func AdminDelObjectHandler(w http.ResponseWriter, r *http.Request) {
 	deleteKeys := make([]string, 0, len(allObjectKeys))
 	for _, objkey := range allObjectKeys {
 		// 执行删除操作
-		err := pe.os.DeleteObject(&object.BaseObjectParams{
+		_, err := pe.os.DeleteObject(&object.BaseObjectParams{
 			BucketName:  req.BucketName,
 			ObjKey:      objkey,
 			AccessKeyID: pe.accessKey,
@@ -789,6 +829,7 @@ func AdminDelObjectHandler(w http.ResponseWriter, r *http.Request) {
 			logger.GetLogger("dedups3").Errorf("failed to delete object %s: %v", objkey, err)
 		} else {
 			deleteKeys = append(deleteKeys, objkey)
+			scheduleReplication(pe.accessKey, req.BucketName, objkey)
 		}
 	}
 	// 返回成功响应
@@ -872,7 +913,7 @@ func AdminGetObjectHandler(w http.ResponseWriter, r *http.Request) {
 			// 列出目录下的对象和子目录
 			marker := ""
 			for {
-				objects, _, isTruncated, nextMarker, err := pe.os.ListObjects(req.BucketName, pe.accessKey, key, marker, "", 1000)
+				objects, _, isTruncated, nextMarker, err := pe.os.ListObjects(r.Context(), req.BucketName, pe.accessKey, key, marker, "", 1000)
 				if err != nil {
 					logger.GetLogger("dedups3").Errorf("error listing objects of folder %s : %v", key, err)
 					xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "object service enum folder failed", nil, http.StatusInternalServerError)
@@ -902,7 +943,7 @@ func AdminGetObjectHandler(w http.ResponseWriter, r *http.Request) {
 
 	if len(allObjectKeys) == 1 {
 		// 打开对象读取器
-		obj, objReader, err := pe.os.GetObject(nil, nil, &object.BaseObjectParams{
+		obj, objReader, err := pe.os.GetObject(r.Context(), nil, nil, &object.BaseObjectParams{
 			BucketName:  req.BucketName,
 			ObjKey:      allObjectKeys[0],
 			AccessKeyID: pe.accessKey,
@@ -962,7 +1003,7 @@ func AdminGetObjectHandler(w http.ResponseWriter, r *http.Request) {
 		// 遍历所有对象，添加到zip文件
 		for _, key := range allObjectKeys {
 			// 打开对象读取器
-			_, objReader, err := pe.os.GetObject(nil, nil, &object.BaseObjectParams{
+			_, objReader, err := pe.os.GetObject(r.Context(), nil, nil, &object.BaseObjectParams{
 				BucketName:  req.BucketName,
 				ObjKey:      key,
 				AccessKeyID: pe.accessKey,
@@ -988,6 +1029,205 @@ func AdminGetObjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// AdminGetReplicationHandler 获取桶的复制配置、复制目标和重新同步进度
+func AdminGetReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call adminGetReplicationHandler] %#v", r.URL)
+	query := utils.DecodeQuerys(r.URL.Query())
+	bucketName := strings.TrimSpace(query.Get("bucket"))
+
+	pe := Prepare4S3(w, r, bucketName)
+	if pe == nil {
+		return
+	}
+	xhttp.SetTraceAttr(r.Context(), "bucketName", bucketName)
+
+	// 不返回目标的密钥
+	targets := make([]meta.BucketTarget, 0)
+	if pe.bi.Targets != nil {
+		for _, target := range pe.bi.Targets.Targets {
+			target.Credentials.SecretKey = ""
+			target.Credentials.SessionToken = ""
+			targets = append(targets, target)
+		}
+	}
+
+	var resync *replication.ResyncStatus
+	var _stats *replication.Stats
+	if rs := replication.GetReplicationService(); rs != nil {
+		resync = rs.GetResyncStatus(pe.accountID, bucketName)
+		_stats = rs.GetStats()
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", struct {
+		Replication *meta.ReplicationConfiguration `json:"replication"`
+		Targets     []meta.BucketTarget            `json:"targets"`
+		Resync      *replication.ResyncStatus      `json:"resync,omitempty"`
+		Stats       *replication.Stats             `json:"stats,omitempty"`
+	}{Replication: pe.bi.Replication, Targets: targets, Resync: resync, Stats: _stats}, http.StatusOK)
+}
+
+// AdminGetSiteHandler 获取站点复制的对端状态和统计，只有管理账户可以查看
+func AdminGetSiteHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call adminGetSiteHandler] %#v", r.URL)
+	pe := Prepare4Iam(w, r)
+	if pe == nil {
+		return
+	}
+	xhttp.SetTraceAttr(r.Context(), "site", pe.accountID)
+
+	if site.Authorize(pe.accessKey) != nil {
+		logger.GetLogger("dedups3").Errorf("user %s is not allowed to get site status", pe.username)
+		xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "access denied", nil, http.StatusForbidden)
+		return
+	}
+
+	ss := site.GetSiteService()
+	xhttp.AdminWriteJSONError(w, r, 0, "success", struct {
+		Peers []site.PeerStatus `json:"peers"`
+		Stats *site.Stats       `json:"stats"`
+	}{Peers: ss.GetPeers(), Stats: ss.GetStats()}, http.StatusOK)
+}
+
+// AdminPutBucketTargetHandler 添加或修改桶的复制目标
+func AdminPutBucketTargetHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call adminPutBucketTargetHandler] %#v", r.URL)
+
+	var req struct {
+		BucketName string            `json:"bucket"`
+		Target     meta.BucketTarget `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode request: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	req.BucketName = strings.TrimSpace(req.BucketName)
+	target := &req.Target
+	target.Bucket = strings.TrimSpace(target.Bucket)
+	target.Endpoint = strings.TrimSpace(target.Endpoint)
+	if target.ID == "" {
+		target.ID = target.Bucket
+	}
+	if target.Arn == "" {
+		target.Arn = meta.ReplicationBucketArnPrefix + target.Bucket
+	}
+	if target.Region == "" {
+		target.Region = "us-east-1"
+	}
+	if target.SyncState == "" {
+		target.SyncState = "Active"
+	}
+	if target.SyncState != "Active" && target.SyncState != "Inactive" {
+		logger.GetLogger("dedups3").Errorf("invalid target sync state %s", target.SyncState)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request params", nil, http.StatusBadRequest)
+		return
+	}
+
+	pe := Prepare4S3(w, r, req.BucketName)
+	if pe == nil {
+		return
+	}
+	xhttp.SetTraceAttr(r.Context(), "bucketName", req.BucketName)
+
+	err := pe.bs.PutBucketTarget(&sb.BaseBucketParams{
+		BucketName:  req.BucketName,
+		AccessKeyID: pe.accessKey,
+	}, target)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to put bucket %s target %s: %v", req.BucketName, target.ID, err)
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "AccessDenied", nil, http.StatusForbidden)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusNotFound, "NoSuchBucket", nil, http.StatusNotFound)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidBucketState)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusConflict, "TargetInUse", nil, http.StatusConflict)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidRequest)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request params", nil, http.StatusBadRequest)
+		} else {
+			xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "internal server error", nil, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", nil, http.StatusOK)
+}
+
+// AdminDeleteBucketTargetHandler 删除桶的复制目标
+func AdminDeleteBucketTargetHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call adminDeleteBucketTargetHandler] %#v", r.URL)
+	query := utils.DecodeQuerys(r.URL.Query())
+	bucketName := strings.TrimSpace(query.Get("bucket"))
+	targetID := strings.TrimSpace(query.Get("id"))
+
+	pe := Prepare4S3(w, r, bucketName)
+	if pe == nil {
+		return
+	}
+	xhttp.SetTraceAttr(r.Context(), "bucketName", bucketName)
+
+	err := pe.bs.DeleteBucketTarget(&sb.BaseBucketParams{
+		BucketName:  bucketName,
+		AccessKeyID: pe.accessKey,
+	}, targetID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to delete bucket %s target %s: %v", bucketName, targetID, err)
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "AccessDenied", nil, http.StatusForbidden)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusNotFound, "NoSuchBucket", nil, http.StatusNotFound)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrRemoteTargetNotFoundError)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusNotFound, "NoSuchTarget", nil, http.StatusNotFound)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidBucketState)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusConflict, "TargetInUse", nil, http.StatusConflict)
+		} else {
+			xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "internal server error", nil, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", nil, http.StatusOK)
+}
+
+// AdminResyncReplicationHandler 把桶内已有对象重新加入复制队列
+func AdminResyncReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call adminResyncReplicationHandler] %#v", r.URL)
+
+	var req struct {
+		BucketName string `json:"bucket"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode request: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	req.BucketName = strings.TrimSpace(req.BucketName)
+
+	pe := Prepare4S3(w, r, req.BucketName)
+	if pe == nil {
+		return
+	}
+	xhttp.SetTraceAttr(r.Context(), "bucketName", req.BucketName)
+
+	rs := replication.GetReplicationService()
+	if rs == nil {
+		logger.GetLogger("dedups3").Errorf("replication service is nil")
+		xhttp.AdminWriteJSONError(w, r, http.StatusServiceUnavailable, "service unavailable", nil, http.StatusServiceUnavailable)
+		return
+	}
+	status, err := rs.Resync(pe.accountID, req.BucketName)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to resync bucket %s: %v", req.BucketName, err)
+		if errors.Is(err, xhttp.ToError(xhttp.ErrReplicationConfigurationNotFoundError)) {
+			xhttp.AdminWriteJSONError(w, r, http.StatusNotFound, "NoReplicationConfiguration", nil, http.StatusNotFound)
+		} else {
+			xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "internal server error", nil, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", status, http.StatusOK)
+}
+
 func AdminListUserHandler(w http.ResponseWriter, r *http.Request) {
 	logger.GetLogger("dedups3").Debugf("[call adminListUserHandler] %#v", r.URL)
 	pe := Prepare4Iam(w, r)
@@ -2085,6 +2325,252 @@ func AdminDeleteQuotaHandler(w http.ResponseWriter, r *http.Request) {
 	xhttp.AdminWriteJSONError(w, r, 0, "success", nil, http.StatusOK)
 }
 
+// AdminGetPublicAccessHandler 查询账户和全局的禁止公开访问设置
+func AdminGetPublicAccessHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminGetPublicAccessHandler] %#v", r.URL)
+	pe := Prepare4Iam(w, r)
+	if pe == nil || pe.ac == nil {
+		return
+	}
+
+	type Resp struct {
+		AccountID         string `json:"accountID"`
+		BlockPublicAccess bool   `json:"blockPublicAccess"`
+		GlobalBlock       bool   `json:"globalBlock"`
+	}
+
+	xhttp.SetTraceAttr(r.Context(), "iamPublicAccess", pe.accountID)
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", &Resp{
+		AccountID:         pe.ac.Name,
+		BlockPublicAccess: pe.ac.BlockPublicAccess,
+		GlobalBlock:       xconf.Get().Server.BlockPublicAccess,
+	}, http.StatusOK)
+}
+
+// AdminPutPublicAccessHandler 设置账户是否禁止匿名访问，只有根用户可以修改
+func AdminPutPublicAccessHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminPutPublicAccessHandler] %#v", r.URL)
+	pe := Prepare4Iam(w, r)
+	if pe == nil || pe.ac == nil {
+		return
+	}
+
+	type Req struct {
+		BlockPublicAccess bool `json:"blockPublicAccess"`
+	}
+
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode request: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+
+	xhttp.SetTraceAttr(r.Context(), "iamPublicAccess", pe.accountID)
+
+	if !pe.iam.IsRootUser(pe.accountID, pe.username) {
+		logger.GetLogger("dedups3").Errorf("user %s is not root user of account %s", pe.username, pe.accountID)
+		xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "access denied", nil, http.StatusForbidden)
+		return
+	}
+
+	if err := pe.iam.SetBlockPublicAccess(pe.accountID, req.BlockPublicAccess); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set block public access: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "set public access failed", nil, http.StatusInternalServerError)
+		return
+	}
+
+	// 返回成功响应
+	xhttp.AdminWriteJSONError(w, r, 0, "success", nil, http.StatusOK)
+}
+
+// KMSKeyInfo 返回给控制台的 KMS 密钥信息，不包含密钥材料
+type KMSKeyInfo struct {
+	KeyID       string    `json:"keyId"`
+	ARN         string    `json:"arn"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func toKMSKeyInfo(key *kms.Key) *KMSKeyInfo {
+	return &KMSKeyInfo{
+		KeyID:       key.KeyID,
+		ARN:         key.ARN(),
+		Description: key.Description,
+		Enabled:     key.Enabled,
+		Version:     key.CurrentVersion(),
+		CreatedAt:   key.CreatedAt,
+		UpdatedAt:   key.UpdatedAt,
+	}
+}
+
+// writeKMSErr 把密钥管理的错误写回控制台
+func writeKMSErr(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, kms.ErrKeyNotFound):
+		xhttp.AdminWriteJSONError(w, r, http.StatusNotFound, "kms key not found", nil, http.StatusNotFound)
+	case errors.Is(err, kms.ErrKeyExists):
+		xhttp.AdminWriteJSONError(w, r, http.StatusConflict, "kms key already exists", nil, http.StatusConflict)
+	case errors.Is(err, kms.ErrInvalidKey):
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid kms key id", nil, http.StatusBadRequest)
+	default:
+		xhttp.AdminWriteJSONError(w, r, http.StatusInternalServerError, "kms operation failed", nil, http.StatusInternalServerError)
+	}
+}
+
+// AdminListKMSKeyHandler 列出账户下的 KMS 密钥
+func AdminListKMSKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminListKMSKeyHandler] %#v", r.URL)
+	pe := Prepare4Iam(w, r)
+	if pe == nil || pe.ac == nil {
+		return
+	}
+
+	xhttp.SetTraceAttr(r.Context(), "iamKMS", "")
+
+	ks := kms.GetKMSService()
+	if ks == nil {
+		logger.GetLogger("dedups3").Errorf("kms service not initialized")
+		xhttp.AdminWriteJSONError(w, r, http.StatusServiceUnavailable, "service unavailable", nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	keys, err := ks.ListKeys(pe.accountID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to list kms keys of account %s: %v", pe.accountID, err)
+		writeKMSErr(w, r, err)
+		return
+	}
+	resp := make([]*KMSKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, toKMSKeyInfo(key))
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", resp, http.StatusOK)
+}
+
+// AdminCreateKMSKeyHandler 创建 KMS 密钥，只有根用户可以创建
+func AdminCreateKMSKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminCreateKMSKeyHandler] %#v", r.URL)
+	pe := Prepare4Iam(w, r)
+	if pe == nil || pe.ac == nil {
+		return
+	}
+
+	type Req struct {
+		KeyID       string `json:"keyId"`
+		Description string `json:"description"`
+	}
+
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode request: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	req.KeyID = strings.TrimSpace(req.KeyID)
+
+	xhttp.SetTraceAttr(r.Context(), "iamKMS", req.KeyID)
+
+	if !pe.iam.IsRootUser(pe.accountID, pe.username) {
+		logger.GetLogger("dedups3").Errorf("user %s is not root user of account %s", pe.username, pe.accountID)
+		xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "access denied", nil, http.StatusForbidden)
+		return
+	}
+
+	ks := kms.GetKMSService()
+	if ks == nil {
+		logger.GetLogger("dedups3").Errorf("kms service not initialized")
+		xhttp.AdminWriteJSONError(w, r, http.StatusServiceUnavailable, "service unavailable", nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	// 没有指定密钥ID 时随机生成
+	if req.KeyID == "" {
+		req.KeyID = utils.GenUUID()
+	}
+	key, err := ks.CreateKey(pe.accountID, req.KeyID, req.Description)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to create kms key %s: %v", req.KeyID, err)
+		writeKMSErr(w, r, err)
+		return
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", toKMSKeyInfo(key), http.StatusOK)
+}
+
+// adminUpdateKMSKey 解析请求中的密钥ID，检查根用户权限后修改 KMS 密钥
+func adminUpdateKMSKey(w http.ResponseWriter, r *http.Request, fn func(ks *kms.KMSService, accountID, keyID string) (*kms.Key, error)) {
+	pe := Prepare4Iam(w, r)
+	if pe == nil || pe.ac == nil {
+		return
+	}
+
+	type Req struct {
+		KeyID string `json:"keyId"`
+	}
+
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode request: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	req.KeyID = strings.TrimSpace(req.KeyID)
+
+	xhttp.SetTraceAttr(r.Context(), "iamKMS", req.KeyID)
+
+	if !pe.iam.IsRootUser(pe.accountID, pe.username) {
+		logger.GetLogger("dedups3").Errorf("user %s is not root user of account %s", pe.username, pe.accountID)
+		xhttp.AdminWriteJSONError(w, r, http.StatusForbidden, "access denied", nil, http.StatusForbidden)
+		return
+	}
+
+	ks := kms.GetKMSService()
+	if ks == nil {
+		logger.GetLogger("dedups3").Errorf("kms service not initialized")
+		xhttp.AdminWriteJSONError(w, r, http.StatusServiceUnavailable, "service unavailable", nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	key, err := fn(ks, pe.accountID, req.KeyID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to update kms key %s: %v", req.KeyID, err)
+		writeKMSErr(w, r, err)
+		return
+	}
+
+	xhttp.AdminWriteJSONError(w, r, 0, "success", toKMSKeyInfo(key), http.StatusOK)
+}
+
+// AdminEnableKMSKeyHandler 启用 KMS 密钥
+func AdminEnableKMSKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminEnableKMSKeyHandler] %#v", r.URL)
+	adminUpdateKMSKey(w, r, func(ks *kms.KMSService, accountID, keyID string) (*kms.Key, error) {
+		return ks.SetKeyEnabled(accountID, keyID, true)
+	})
+}
+
+// AdminDisableKMSKeyHandler 禁用 KMS 密钥，禁用后用它加密的对象都不能读取
+func AdminDisableKMSKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminDisableKMSKeyHandler] %#v", r.URL)
+	adminUpdateKMSKey(w, r, func(ks *kms.KMSService, accountID, keyID string) (*kms.Key, error) {
+		return ks.SetKeyEnabled(accountID, keyID, false)
+	})
+}
+
+// AdminRotateKMSKeyHandler 轮换 KMS 密钥，新对象使用新版本，旧对象仍然可以读取
+func AdminRotateKMSKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("[Call AdminRotateKMSKeyHandler] %#v", r.URL)
+	adminUpdateKMSKey(w, r, func(ks *kms.KMSService, accountID, keyID string) (*kms.Key, error) {
+		return ks.RotateKey(accountID, keyID)
+	})
+}
+
 func AdminListChunkConfigHandler(w http.ResponseWriter, r *http.Request) {
 	logger.GetLogger("dedups3").Debugf("[Call adminListChunkConfigHandler] %#v", r.URL)
 	pe := Prepare4Iam(w, r)
@@ -2143,6 +2629,7 @@ func AdminGetChunkConfigHandler(w http.ResponseWriter, r *http.Request) {
 		"fixSize":   _storage.Chunk.FixSize,
 		"encrypt":   _storage.Chunk.Encrypt,
 		"compress":  _storage.Chunk.Compress,
+		"verify":    _storage.Chunk.Verify,
 	}
 
 	// 返回成功响应
@@ -2156,11 +2643,14 @@ func AdminSetChunkConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	type Req struct {
-		StorageID string `json:"storageID"`
-		ChunkSize int32  `json:"chunkSize"`
-		FixSize   bool   `json:"fixSize"`
-		Encrypt   bool   `json:"encrypt"`
-		Compress  bool   `json:"compress"`
+		StorageID  string `json:"storageID"`
+		ChunkSize  int32  `json:"chunkSize"`
+		FixSize    bool   `json:"fixSize"`
+		Encrypt    bool   `json:"encrypt"`
+		Compress   bool   `json:"compress"`
+		DedupScope string `json:"dedupScope"`
+		Convergent bool   `json:"convergent"`
+		Verify     bool   `json:"verify"`
 	}
 
 	// 解析请求体
@@ -2180,12 +2670,22 @@ func AdminSetChunkConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := ss.SetChunkConfig(req.StorageID, &meta.ChunkConfig{
-		ChunkSize: req.ChunkSize,
-		FixSize:   req.FixSize,
-		Encrypt:   req.Encrypt,
-		Compress:  req.Compress,
-	})
+	chunkConf := &meta.ChunkConfig{
+		ChunkSize:  req.ChunkSize,
+		FixSize:    req.FixSize,
+		Encrypt:    req.Encrypt,
+		Compress:   req.Compress,
+		DedupScope: req.DedupScope,
+		Convergent: req.Convergent,
+		Verify:     req.Verify,
+	}
+	if err := chunkConf.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid chunk config: %v", err)
+		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	err := ss.SetChunkConfig(req.StorageID, chunkConf)
 
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to update chunk config: %v", err)
@@ -2287,7 +2787,7 @@ func AdminCreateStorageHandler(w http.ResponseWriter, r *http.Request) {
 	xhttp.SetTraceAttr(r.Context(), "iamStorage", req.StorageID)
 
 	if !meta.IsValidIAMName(req.StorageID) ||
-		(req.StorageClass != meta.STANDARD_CLASS_STORAGE && req.StorageClass != meta.STANDARD_IA_CLASS_STORAGE && req.StorageClass != meta.GLACIER_IR_CLASS_STORAGE) ||
+		(req.StorageClass != meta.STANDARD_CLASS_STORAGE && req.StorageClass != meta.STANDARD_IA_CLASS_STORAGE && req.StorageClass != meta.GLACIER_IR_CLASS_STORAGE && !meta.IsArchiveClass(req.StorageClass)) ||
 		(req.StorageType != meta.DISK_TYPE_STORAGE && req.StorageType != meta.S3_TYPE_STORAGE) {
 		logger.GetLogger("dedups3").Errorf("invalid request params %#v", req)
 		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request params", nil, http.StatusBadRequest)
@@ -2395,7 +2895,7 @@ func AdminTestStorageHandler(w http.ResponseWriter, r *http.Request) {
 	xhttp.SetTraceAttr(r.Context(), "iamStorage", req.StorageID)
 
 	if !meta.IsValidIAMName(req.StorageID) ||
-		(req.StorageClass != meta.STANDARD_CLASS_STORAGE && req.StorageClass != meta.STANDARD_IA_CLASS_STORAGE && req.StorageClass != meta.GLACIER_IR_CLASS_STORAGE) ||
+		(req.StorageClass != meta.STANDARD_CLASS_STORAGE && req.StorageClass != meta.STANDARD_IA_CLASS_STORAGE && req.StorageClass != meta.GLACIER_IR_CLASS_STORAGE && !meta.IsArchiveClass(req.StorageClass)) ||
 		(req.StorageType != meta.DISK_TYPE_STORAGE && req.StorageType != meta.S3_TYPE_STORAGE) {
 		logger.GetLogger("dedups3").Errorf("invalid request params %#v", req)
 		xhttp.AdminWriteJSONError(w, r, http.StatusBadRequest, "invalid request params", nil, http.StatusBadRequest)
@@ -17,6 +17,7 @@
 package handler
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
@@ -30,11 +31,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/gorilla/mux"
 
+	"github.com/mageg-x/dedups3/internal/checksum"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/utils"
 	"github.com/mageg-x/dedups3/meta"
 	sb "github.com/mageg-x/dedups3/service/bucket"
+	"github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/kms"
 )
 
 type ListAllMyBucketsResult struct {
@@ -62,7 +66,10 @@ func GetReqVar(r *http.Request) (string, string, string, string) {
 	// 获取accessKeyID
 	accessKeyID, ok := ctx.Value("accesskey").(string)
 	if !ok {
-		logger.GetLogger("dedups3").Errorf("Failed to get accessKeyID from context")
+		// 匿名请求没有访问密钥，服务从请求上下文中获取桶所有者账户
+		if !iam.IsAnonymous(ctx) {
+			logger.GetLogger("dedups3").Errorf("Failed to get accessKeyID from context")
+		}
 	} else {
 		logger.GetLogger("dedups3").Tracef("accessKeyID from context: %s", accessKeyID)
 	}
@@ -134,7 +141,7 @@ func GetBucketLocationHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
 		return
 	}
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		AccessKeyID: accessKeyID,
 		Location:    region,
@@ -185,7 +192,7 @@ func GetBucketPolicyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取桶信息
-	bucketInfo, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		Location:    region,
 		AccessKeyID: accessKeyID,
@@ -257,7 +264,7 @@ func GetBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取桶信息
-	bucketInfo, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		Location:    region,
 		AccessKeyID: accessKeyID,
@@ -296,8 +303,56 @@ func GetBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
 func GetBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetBucketEncryptionHandler")
-	// TODO: 实现 GET Bucket Encryption 逻辑
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 获取桶信息
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
+		BucketName:  bucket,
+		Location:    region,
+		AccessKeyID: accessKeyID,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to get bucket info: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	if expectedOwnerID != "" && expectedOwnerID != bucketInfo.Owner.ID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", expectedOwnerID, bucketInfo.Owner.ID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return
+	}
+
+	// 没有默认加密配置时返回 ServerSideEncryptionConfigurationNotFoundError
+	if !bucketInfo.SSE.IsEnabled() {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucketSSEConfig)
+		return
+	}
+
+	bucketInfo.SSE.XMLName = xml.Name{Local: "ServerSideEncryptionConfiguration"}
+	bucketInfo.SSE.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	xhttp.WriteAWSSuc(w, r, bucketInfo.SSE)
+	logger.GetLogger("dedups3").Tracef("successfully retrieved encryption configuration for bucket: %s", bucket)
 }
 
 // GetBucketObjectLockConfigHandler 处理 GET Bucket Object Lock Configuration 请求
@@ -317,7 +372,7 @@ func GetBucketObjectLockConfigHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取bucket信息
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		Location:    region,
 		AccessKeyID: accessKeyID,
@@ -354,16 +409,104 @@ func GetBucketObjectLockConfigHandler(w http.ResponseWriter, r *http.Request) {
 func GetBucketReplicationConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetBucketReplicationConfigHandler")
-	// TODO: 实现 GET Bucket Replication Configuration 逻辑
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 获取桶信息
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
+		BucketName:  bucket,
+		Location:    region,
+		AccessKeyID: accessKeyID,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to get bucket info: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	if expectedOwnerID != "" && expectedOwnerID != bucketInfo.Owner.ID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", expectedOwnerID, bucketInfo.Owner.ID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return
+	}
+
+	// 没有复制配置
+	if bucketInfo.Replication == nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrReplicationConfigurationNotFoundError)
+		return
+	}
+
+	bucketInfo.Replication.XMLName = xml.Name{Local: "ReplicationConfiguration"}
+	bucketInfo.Replication.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	xhttp.WriteAWSSuc(w, r, bucketInfo.Replication)
+	logger.GetLogger("dedups3").Tracef("successfully retrieved replication configuration for bucket: %s", bucket)
 }
 
 // GetBucketVersioningHandler 处理 GET Bucket Versioning 请求
 func GetBucketVersioningHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetBucketVersioningHandler")
-	// TODO: 实现 GET Bucket Versioning 逻辑
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求中的bucket名称、accessKeyID和region信息
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket service")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	// 获取bucket信息
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
+		BucketName:  bucket,
+		Location:    region,
+		AccessKeyID: accessKeyID,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			logger.GetLogger("dedups3").Errorf("access denied for %s", accessKeyID)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to get bucket info: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 从未设置过版本控制的桶返回空配置
+	versioning := _bucket.Versioning
+	if versioning == nil {
+		versioning = &meta.VersioningConfiguration{}
+	}
+	// 设置XML命名空间（如果为空）
+	if versioning.XMLNS == "" {
+		versioning.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	}
+
+	xhttp.WriteAWSSuc(w, r, versioning)
 }
 
 // GetBucketNotificationHandler 处理 GET Bucket Notification 请求
@@ -384,7 +527,7 @@ func GetBucketNotificationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// 获取桶信息
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		Location:    region,
 		AccessKeyID: accessKeyID,
@@ -440,7 +583,7 @@ func GetBucketACLHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取bucket信息
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:      bucket,
 		AccessKeyID:     accessKeyID,
 		ExpectedOwnerID: expectedOwner,
@@ -493,10 +636,13 @@ func PutBucketACLHandler(w http.ResponseWriter, r *http.Request) {
 	contentMD5 = strings.TrimSpace(contentMD5)
 	// TODO: 实现Content-MD5校验逻辑
 
-	// 获取x-amz-sdk-checksum-algorithm头部
-	checksumAlgorithm := r.Header.Get("x-amz-sdk-checksum-algorithm")
-	checksumAlgorithm = strings.TrimSpace(checksumAlgorithm)
-	// TODO: 实现校验和算法处理逻辑
+	// 获取x-amz-sdk-checksum-algorithm头部，带了对应的校验和时校验请求体
+	checksumSpec, err := checksum.FromRequest(r.Header, nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid checksum headers: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
 
 	// 获取并处理x-amz-acl头部
 	predefinedACL := r.Header.Get(xhttp.AmzACL)
@@ -510,6 +656,14 @@ func PutBucketACLHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrBadRequest)
 		return
 	}
+	if checksumSpec != nil {
+		cr := checksum.NewReader(bytes.NewReader(body), checksumSpec)
+		if _, err := io.Copy(io.Discard, cr); err != nil || cr.Verify() != nil {
+			logger.GetLogger("dedups3").Errorf("acl body checksum mismatch for bucket %s", bucket)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrBadDigest)
+			return
+		}
+	}
 
 	// 初始化ACL配置
 	var aclConfig meta.AccessControlPolicy
@@ -522,7 +676,7 @@ func PutBucketACLHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取当前桶信息，用于获取所有者信息
-	bucketInfo, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		Location:    region,
 		AccessKeyID: accessKeyID,
@@ -713,36 +867,289 @@ func PutBucketACLHandler(w http.ResponseWriter, r *http.Request) {
 	logger.GetLogger("dedups3").Tracef("successfully set ACL for bucket: %s", bucket)
 }
 
-// GetBucketCorsHandler 处理 GET Bucket CORS 请求 (Dummy)
+// GetBucketCorsHandler 处理 GET Bucket CORS 请求
 func GetBucketCorsHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetBucketCorsHandler")
-	// TODO: 实现 GET Bucket CORS 逻辑 (Dummy)
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 获取桶信息
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
+		BucketName:  bucket,
+		Location:    region,
+		AccessKeyID: accessKeyID,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to get bucket info: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	if expectedOwnerID != "" && expectedOwnerID != bucketInfo.Owner.ID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", expectedOwnerID, bucketInfo.Owner.ID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return
+	}
+
+	// 没有跨域配置时返回 NoSuchCORSConfiguration
+	if bucketInfo.CORS == nil || len(bucketInfo.CORS.CORSRules) == 0 {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchCORSConfiguration)
+		return
+	}
+
+	bucketInfo.CORS.XMLName = xml.Name{Local: "CORSConfiguration"}
+	bucketInfo.CORS.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	xhttp.WriteAWSSuc(w, r, bucketInfo.CORS)
+	logger.GetLogger("dedups3").Tracef("successfully retrieved cors configuration for bucket: %s", bucket)
 }
 
-// PutBucketCorsHandler 处理 PUT Bucket CORS 请求 (Dummy)
+// PutBucketCorsHandler 处理 PUT Bucket CORS 请求
 func PutBucketCorsHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: PutBucketCorsHandler")
-	// TODO: 实现 PUT Bucket CORS 逻辑 (Dummy)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// 解析XML请求体
+	var corsConfig meta.CORSConfiguration
+	if err := xml.Unmarshal(body, &corsConfig); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal cors configuration: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := corsConfig.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid bucket cors: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwner := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwner = strings.TrimSpace(expectedOwner)
+
+	err = bs.PutBucketCors(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		Location:        region,
+		AccessKeyID:     accessKeyID,
+		ExpectedOwnerID: expectedOwner,
+	}, &corsConfig)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to put bucket cors: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
 	w.WriteHeader(http.StatusOK)
+	logger.GetLogger("dedups3").Tracef("successfully set cors configuration for bucket: %s", bucket)
 }
 
-// DeleteBucketCorsHandler 处理 DELETE Bucket CORS 请求 (Dummy)
+// DeleteBucketCorsHandler 处理 DELETE Bucket CORS 请求
 func DeleteBucketCorsHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: DeleteBucketCorsHandler")
-	// TODO: 实现 DELETE Bucket CORS 逻辑 (Dummy)
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取 x-amz-expected-bucket-owner 头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 调用服务层方法清除跨域配置
+	err := bs.PutBucketCors(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		AccessKeyID:     accessKeyID,
+		Location:        region,
+		ExpectedOwnerID: expectedOwnerID,
+	}, nil)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to delete bucket cors: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetBucketWebsiteHandler 处理 GET Bucket Website 请求 (Dummy)
+// GetBucketWebsiteHandler 处理 GET Bucket Website 请求
 func GetBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetBucketWebsiteHandler")
-	// TODO: 实现 GET Bucket Website 逻辑 (Dummy)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 获取桶信息
+	bucketInfo, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
+		BucketName:  bucket,
+		Location:    region,
+		AccessKeyID: accessKeyID,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to get bucket info: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	if expectedOwnerID != "" && expectedOwnerID != bucketInfo.Owner.ID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", expectedOwnerID, bucketInfo.Owner.ID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return
+	}
+
+	// 没有静态网站配置时返回 NoSuchWebsiteConfiguration
+	if bucketInfo.Website == nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchWebsiteConfiguration)
+		return
+	}
+
+	bucketInfo.Website.XMLName = xml.Name{Local: "WebsiteConfiguration"}
+	bucketInfo.Website.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	xhttp.WriteAWSSuc(w, r, bucketInfo.Website)
+	logger.GetLogger("dedups3").Tracef("successfully retrieved website configuration for bucket: %s", bucket)
+}
+
+// PutBucketWebsiteHandler 处理 PUT Bucket Website 请求
+func PutBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+	// 打印接口名称
+	logger.GetLogger("dedups3").Infof("API called: PutBucketWebsiteHandler")
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// 解析XML请求体
+	var websiteConfig meta.WebsiteConfiguration
+	if err := xml.Unmarshal(body, &websiteConfig); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal website configuration: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := websiteConfig.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid bucket website: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwner := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwner = strings.TrimSpace(expectedOwner)
+
+	err = bs.PutBucketWebsite(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		Location:        region,
+		AccessKeyID:     accessKeyID,
+		ExpectedOwnerID: expectedOwner,
+	}, &websiteConfig)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to put bucket website: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
 	w.WriteHeader(http.StatusOK)
+	logger.GetLogger("dedups3").Tracef("successfully set website configuration for bucket: %s", bucket)
 }
 
 // GetBucketAccelerateHandler 处理 GET Bucket Accelerate 请求 (Dummy)
@@ -783,7 +1190,7 @@ func GetBucketTaggingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取桶的元数据
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		Location:    region,
 		AccessKeyID: accessKeyID,
@@ -826,17 +1233,52 @@ func GetBucketTaggingHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 写入成功响应
-	xhttp.WriteAWSSuc(w, r, result)
-	logger.GetLogger("dedups3").Tracef("successfully retrieved tagging for bucket: %s", bucket)
-}
-
-// DeleteBucketWebsiteHandler 处理 DELETE Bucket Website 请求
-func DeleteBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
-	// 打印接口名称
-	logger.GetLogger("dedups3").Infof("API called: DeleteBucketWebsiteHandler")
-	// TODO: 实现 DELETE Bucket Website 逻辑
-	w.WriteHeader(http.StatusOK)
+	// 写入成功响应
+	xhttp.WriteAWSSuc(w, r, result)
+	logger.GetLogger("dedups3").Tracef("successfully retrieved tagging for bucket: %s", bucket)
+}
+
+// DeleteBucketWebsiteHandler 处理 DELETE Bucket Website 请求
+func DeleteBucketWebsiteHandler(w http.ResponseWriter, r *http.Request) {
+	// 打印接口名称
+	logger.GetLogger("dedups3").Infof("API called: DeleteBucketWebsiteHandler")
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取 x-amz-expected-bucket-owner 头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 调用服务层方法清除静态网站配置
+	err := bs.PutBucketWebsite(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		AccessKeyID:     accessKeyID,
+		Location:        region,
+		ExpectedOwnerID: expectedOwnerID,
+	}, nil)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to delete bucket website: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // DeleteBucketTaggingHandler 处理 DELETE Bucket Tagging 请求
@@ -909,7 +1351,7 @@ func GetBucketPolicyStatusHandler(w http.ResponseWriter, r *http.Request) {
 	expectedOwner = strings.TrimSpace(expectedOwner)
 
 	// 获取桶信息
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:      bucket,
 		Location:        region,
 		AccessKeyID:     accessKeyID,
@@ -1022,16 +1464,152 @@ func PutBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
 func PutBucketReplicationConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: PutBucketReplicationConfigHandler")
-	// TODO: 实现 PUT Bucket Replication Configuration 逻辑
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// 解析XML请求体
+	var replicationConfig meta.ReplicationConfiguration
+	if err := xml.Unmarshal(body, &replicationConfig); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal replication configuration: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+
+	// 未指定ID的规则自动生成
+	for i := range replicationConfig.Rules {
+		if replicationConfig.Rules[i].ID == "" {
+			replicationConfig.Rules[i].ID = utils.GenUUID()
+		}
+	}
+	if err := replicationConfig.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid bucket replication: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidRequest)
+		return
+	}
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwner := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwner = strings.TrimSpace(expectedOwner)
+
+	// 调用service层方法设置复制配置
+	err = bs.PutBucketReplication(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		Location:        region,
+		AccessKeyID:     accessKeyID,
+		ExpectedOwnerID: expectedOwner,
+	}, &replicationConfig)
+
+	// 处理错误
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrReplicationNeedsVersioningError)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrReplicationNeedsVersioningError)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrRemoteTargetNotFoundError)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrRemoteTargetNotFoundError)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to put bucket replication: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
 	w.WriteHeader(http.StatusOK)
+	logger.GetLogger("dedups3").Tracef("successfully set replication configuration for bucket: %s", bucket)
 }
 
 // PutBucketEncryptionHandler 处理 PUT Bucket Encryption 请求
 func PutBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: PutBucketEncryptionHandler")
-	// TODO: 实现 PUT Bucket Encryption 逻辑
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// 解析XML请求体
+	var sseConfig meta.BucketSSEConfiguration
+	if err := xml.Unmarshal(body, &sseConfig); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal encryption configuration: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := sseConfig.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid bucket encryption: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	// 密钥ID 也可以是 ARN，写入对象时再解析，这里只检查格式
+	if keyID := sseConfig.KMSKeyID(); keyID != "" {
+		if _, err := kms.NormalizeKeyID(keyID); err != nil {
+			logger.GetLogger("dedups3").Errorf("invalid bucket encryption kms key id %s: %v", keyID, err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidEncryptionKeyID)
+			return
+		}
+	}
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwner := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwner = strings.TrimSpace(expectedOwner)
+
+	err = bs.PutBucketEncryption(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		Location:        region,
+		AccessKeyID:     accessKeyID,
+		ExpectedOwnerID: expectedOwner,
+	}, &sseConfig)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to put bucket encryption: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
 	w.WriteHeader(http.StatusOK)
+	logger.GetLogger("dedups3").Tracef("successfully set encryption configuration for bucket: %s", bucket)
 }
 
 // PutBucketPolicyHandler 处理 PUT Bucket Policy 请求
@@ -1197,6 +1775,10 @@ func PutBucketObjectLockConfigHandler(w http.ResponseWriter, r *http.Request) {
 			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
 			return
 		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidBucketState)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidBucketState)
+			return
+		}
 
 		logger.GetLogger("dedups3").Errorf("failed to set object lock configuration: %v", err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
@@ -1295,8 +1877,80 @@ func PutBucketTaggingHandler(w http.ResponseWriter, r *http.Request) {
 func PutBucketVersioningHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: PutBucketVersioningHandler")
-	// TODO: 实现 PUT Bucket Versioning 逻辑
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+		return
+	}
+	defer r.Body.Close()
+
+	// 解析XML请求体
+	var versioningConfig meta.VersioningConfiguration
+	if err := xml.Unmarshal(body, &versioningConfig); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal versioning config: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := versioningConfig.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid versioning config: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	// 不支持 MFA Delete
+	if versioningConfig.IsMFADeleteEnabled() {
+		logger.GetLogger("dedups3").Errorf("mfa delete is not supported for bucket: %s", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNotImplemented)
+		return
+	}
+
+	// 获取x-amz-expected-bucket-owner头部
+	expectedOwner := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwner = strings.TrimSpace(expectedOwner)
+
+	// 调用服务层设置版本控制
+	err = bs.PutBucketVersioning(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		Location:        region,
+		AccessKeyID:     accessKeyID,
+		ExpectedOwnerID: expectedOwner,
+	}, &versioningConfig)
+	if err != nil {
+		// 处理特定错误
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidBucketState)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidBucketState)
+			return
+		}
+
+		logger.GetLogger("dedups3").Errorf("failed to set versioning configuration: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	// 返回成功响应
 	w.WriteHeader(http.StatusOK)
+	logger.GetLogger("dedups3").Tracef("successfully set versioning configuration for bucket: %s", bucket)
 }
 
 // PutBucketNotificationConfigurationHandler 设置存储桶的通知配置
@@ -1441,7 +2095,7 @@ func HeadBucketHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
 		return
 	}
-	_bucket, err := bs.GetBucketInfo(&sb.BaseBucketParams{
+	_bucket, err := bs.GetBucketInfo(r.Context(), &sb.BaseBucketParams{
 		BucketName:  bucket,
 		AccessKeyID: accessKeyID,
 	})
@@ -1508,8 +2162,45 @@ func DeleteBucketPolicyHandler(w http.ResponseWriter, r *http.Request) {
 func DeleteBucketReplicationConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: DeleteBucketReplicationConfigHandler")
-	// TODO: 实现 DELETE Bucket Replication Configuration 逻辑
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取 x-amz-expected-bucket-owner 头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 调用服务层方法清除复制配置
+	err := bs.PutBucketReplication(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		AccessKeyID:     accessKeyID,
+		Location:        region,
+		ExpectedOwnerID: expectedOwnerID,
+	}, nil)
+
+	// 处理错误
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to delete bucket replication: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // DeleteBucketLifecycleHandler 处理 DELETE Bucket Lifecycle Request
@@ -1557,12 +2248,47 @@ func DeleteBucketLifecycleHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// DeleteBucketEncryptionHandler 处理 DELETE Bucket Encryption Request
+// DeleteBucketEncryptionHandler 处理 DELETE Bucket Encryption 请求
 func DeleteBucketEncryptionHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: DeleteBucketEncryptionHandler")
-	// TODO: 实现 DELETE Bucket Encryption 逻辑
-	w.WriteHeader(http.StatusOK)
+
+	// 获取请求变量
+	bucket, _, region, accessKeyID := GetReqVar(r)
+
+	// 获取 x-amz-expected-bucket-owner 头部
+	expectedOwnerID := r.Header.Get("x-amz-expected-bucket-owner")
+	expectedOwnerID = strings.TrimSpace(expectedOwnerID)
+
+	// 获取bucket服务
+	bs := sb.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("bucket service is nil: %v", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	// 调用服务层方法清除默认加密配置
+	err := bs.PutBucketEncryption(&sb.BaseBucketParams{
+		BucketName:      bucket,
+		AccessKeyID:     accessKeyID,
+		Location:        region,
+		ExpectedOwnerID: expectedOwnerID,
+	}, nil)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		} else {
+			logger.GetLogger("dedups3").Errorf("failed to delete bucket encryption: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return
+	}
+
+	// 返回成功响应
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // DeleteBucketHandler 删除存储桶
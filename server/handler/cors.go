@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/middleware"
+)
+
+// PreflightHandler 处理 CORS 预检请求（OPTIONS），预检请求不带签名
+func PreflightHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: PreflightHandler")
+	bucket := utils.DecodeVars(mux.Vars(r))["bucket"]
+	origin := r.Header.Get(xhttp.Origin)
+	method := r.Header.Get(xhttp.AccessControlRequestMethod)
+	if origin == "" || method == "" {
+		logger.GetLogger("dedups3").Errorf("invalid preflight request for bucket %s: origin %q method %q", bucket, origin, method)
+		xhttp.WriteAWSError(w, r, "BadRequest", "Insufficient information. Origin request header needed.", http.StatusBadRequest)
+		return
+	}
+
+	headers := make([]string, 0)
+	for _, v := range r.Header.Values(xhttp.AccessControlRequestHeaders) {
+		for _, header := range strings.Split(v, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+
+	cors := middleware.GetBucketCors(bucket)
+	if cors == nil {
+		logger.GetLogger("dedups3").Debugf("bucket %s has no cors configuration", bucket)
+		xhttp.WriteAWSError(w, r, "AccessForbidden", "CORSResponse: CORS is not enabled for this bucket.", http.StatusForbidden)
+		return
+	}
+	rule := cors.Match(origin, method, headers)
+	if rule == nil {
+		logger.GetLogger("dedups3").Debugf("bucket %s cors rejects origin %s method %s headers %v", bucket, origin, method, headers)
+		xhttp.WriteAWSError(w, r, "AccessForbidden", "CORSResponse: This CORS request is not allowed. This is usually because the evalution of Origin, request method / Access-Control-Request-Method or Access-Control-Request-Headers are not whitelisted by the resource's CORS spec.", http.StatusForbidden)
+		return
+	}
+
+	middleware.SetCorsHeaders(w, rule, origin)
+	if len(headers) > 0 {
+		w.Header().Set(xhttp.AccessControlAllowHeaders, strings.Join(headers, ", "))
+	}
+	w.Header().Set(xhttp.AmzRequestID, xhttp.GetRequestID(r.Context()))
+	w.WriteHeader(http.StatusOK)
+}
@@ -30,6 +30,7 @@ import (
 
 	"github.com/mageg-x/dedups3/meta"
 
+	"github.com/mageg-x/dedups3/internal/checksum"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/utils"
 	"github.com/mageg-x/dedups3/service/multipart"
@@ -67,8 +68,15 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		parts = append(parts, meta.PartETag{
 			PartNumber: part.PartNumber,
 			ETag:       part.ETag,
+			Checksum:   part.ChecksumValue(),
 		})
 	}
+	// 整个对象的校验和，分段上传时客户端可以在完成请求中带上
+	checksumSpec, err := checksum.FromRequest(r.Header, nil)
+	if err != nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
 
 	_mps := multipart.GetMultiPartService()
 	if _mps == nil {
@@ -77,6 +85,12 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+
 	obj, err := _mps.CompleteMultipartUpload(parts, &object.BaseObjectParams{
 		BucketName:  bucket,
 		ObjKey:      objectKey,
@@ -84,6 +98,8 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		UploadID:    uploadID,
 		IfMatch:     ifMatch,
 		IfNoneMatch: ifnoneMatch,
+		CustomerKey: customerKey,
+		Checksum:    checksumSpec,
 	})
 
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
@@ -94,6 +110,13 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchUpload)
 		return
 	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		return
+	}
+	if writeObjectLockErr(w, r, err) {
+		return
+	}
 	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidPart)) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidPart)
 		return
@@ -102,10 +125,17 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidPartOrder)
 		return
 	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrBadDigest)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrBadDigest)
+		return
+	}
 	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidQueryParams)) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidQueryParams)
 		return
 	}
+	if writeSSEErr(w, r, err) {
+		return
+	}
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("error completing multipart upload: %s", err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
@@ -115,6 +145,12 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 	// 构建响应
 	w.Header().Set(xhttp.ETag, fmt.Sprintf(`"%s"`, obj.ETag))
 	w.Header().Set(xhttp.LastModified, obj.LastModified.Format(http.TimeFormat))
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	setObjectSSEHeaders(w, obj)
+	setSSECHeaders(w, r.Header)
+	scheduleReplication(accessKeyID, bucket, objectKey)
 	resp := multipart.CompleteMultipartUploadResult{
 		XMLNS:    "http://s3.amazonaws.com/doc/2006-03-01/",
 		Location: fmt.Sprintf("http://%s/%s", r.Host, utils.TrimLeadingSlash(objectKey)),
@@ -122,6 +158,10 @@ func CompleteMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		Key:      objectKey,
 		ETag:     obj.ETag,
 	}
+	if obj.Checksum != nil {
+		resp.ChecksumCRC32, resp.ChecksumCRC32C, resp.ChecksumSHA1, resp.ChecksumSHA256, resp.ChecksumCRC64NVME = obj.Checksum.Values()
+		resp.ChecksumType = obj.Checksum.Type
+	}
 	xhttp.WriteAWSSuc(w, r, resp)
 }
 
@@ -170,6 +210,16 @@ func NewMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrPreconditionFailed)
 		return
 	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidChecksum)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
+	if writeObjectLockErr(w, r, err) {
+		return
+	}
+	if writeSSEErr(w, r, err) {
+		return
+	}
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("Error creating multipart upload: %s", err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
@@ -183,6 +233,12 @@ func NewMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
 		UploadId: upload.UploadID,
 	}
 
+	setSSEHeaders(w, upload.Encryption.Type, upload.Encryption.KMSKey, upload.Owner.ID)
+	setSSECHeaders(w, r.Header)
+	if upload.ChecksumAlgorithm != "" {
+		w.Header().Set(xhttp.AmzChecksumAlgo, upload.ChecksumAlgorithm)
+		w.Header().Set(xhttp.AmzChecksumType, upload.ChecksumType)
+	}
 	xhttp.WriteAWSSuc(w, r, resp)
 }
 
@@ -327,6 +383,9 @@ func ListMultipartUploadsHandler(w http.ResponseWriter, r *http.Request) {
 			Initiated:    u.Created.Format(time.RFC3339),
 			Initiator:    u.Initiator,
 			Owner:        u.Owner,
+			// 没有声明校验和的上传两个字段都为空
+			ChecksumAlgorithm: u.ChecksumAlgorithm,
+			ChecksumType:      u.ChecksumType,
 		})
 	}
 	result.Upload = xmlUploads
@@ -418,6 +477,18 @@ func CopyObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 	SourceIfModifiedSince := r.Header.Get(xhttp.AmzCopySourceIfModifiedSince)
 	SourceIfUnmodifiedSince := r.Header.Get(xhttp.AmzCopySourceIfUnmodifiedSince)
 
+	// SSE-C 上传的客户密钥和源对象的客户密钥
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+	srcCustomerKey, err := object.ParseCopySourceCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+
 	// 获取MultiPartService实例
 	_mps := multipart.GetMultiPartService()
 	if _mps == nil {
@@ -436,6 +507,8 @@ func CopyObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 		SourceIfNoneMatch:       SourceIfNoneMatch,
 		SourceIfUnmodifiedSince: SourceIfUnmodifiedSince,
 		SourceIfModifiedSince:   SourceIfModifiedSince,
+		CustomerKey:             customerKey,
+		SourceCustomerKey:       srcCustomerKey,
 	})
 
 	if err != nil {
@@ -443,6 +516,17 @@ func CopyObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 			xhttp.WriteAWSErr(w, r, xhttp.ErrAdminBucketQuotaExceeded)
 			return
 		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidObjectState)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectState)
+			return
+		}
+		if writeSSEErr(w, r, err) {
+			return
+		}
 
 		logger.GetLogger("dedups3").Errorf("%s/%s/%s/%d copy object part  failed : %v", bucket, objectKey, uploadID, partNumber, err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
@@ -455,6 +539,10 @@ func CopyObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 		ETag:         part.ETag,
 		LastModified: part.LastModified,
 	}
+	if part.Checksum != nil {
+		resp.ChecksumCRC32, resp.ChecksumCRC32C, resp.ChecksumSHA1, resp.ChecksumSHA256, resp.ChecksumCRC64NVME = part.Checksum.Values()
+	}
+	setSSECHeaders(w, r.Header)
 	xhttp.WriteAWSSuc(w, r, &resp)
 }
 
@@ -513,6 +601,17 @@ func PutObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+	checksumSpec, err := checksum.FromRequest(r.Header, r.Trailer)
+	if err != nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
+
 	part, err := _mps.UploadPart(body, &object.BaseObjectParams{
 		BucketName:  bucket,
 		ObjKey:      objectKey,
@@ -521,8 +620,18 @@ func PutObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 		AccessKeyID: accessKeyID,
 		ContentLen:  contentLength,
 		ContentMd5:  contentMd5,
+		CustomerKey: customerKey,
+		Checksum:    checksumSpec,
 	})
 
+	if errors.Is(err, xhttp.ToError(xhttp.ErrBadDigest)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrBadDigest)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidChecksum)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrAdminBucketQuotaExceeded)
 		return
@@ -548,6 +657,9 @@ func PutObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
 		return
 	}
+	if writeSSEErr(w, r, err) {
+		return
+	}
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("upload %s : %d failed: %s", uploadID, partNumber, err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
@@ -556,6 +668,10 @@ func PutObjectPartHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 设置响应头
 	w.Header().Set(xhttp.ETag, fmt.Sprintf(`"%s"`, part.ETag))
+	if part.Checksum != nil {
+		w.Header().Set(checksum.HeaderKey(part.Checksum.Algorithm), part.Checksum.Value)
+	}
+	setSSECHeaders(w, r.Header)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -634,16 +750,18 @@ func ListObjectPartsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := multipart.ListPartsResult{
-		XMLName:          xml.Name{Local: "ListPartsResult"},
-		XMLNS:            "http://s3.amazonaws.com/doc/2006-03-01/",
-		Bucket:           upload.Bucket,
-		Key:              upload.Key,
-		UploadId:         upload.UploadID,
-		Initiator:        upload.Initiator,
-		Owner:            upload.Owner,
-		StorageClass:     upload.StorageClass,
-		PartNumberMarker: partNumberMarker,
-		MaxParts:         maxParts,
+		XMLName:           xml.Name{Local: "ListPartsResult"},
+		XMLNS:             "http://s3.amazonaws.com/doc/2006-03-01/",
+		Bucket:            upload.Bucket,
+		Key:               upload.Key,
+		UploadId:          upload.UploadID,
+		Initiator:         upload.Initiator,
+		Owner:             upload.Owner,
+		StorageClass:      upload.StorageClass,
+		PartNumberMarker:  partNumberMarker,
+		MaxParts:          maxParts,
+		ChecksumAlgorithm: upload.ChecksumAlgorithm,
+		ChecksumType:      upload.ChecksumType,
 	}
 	if len(parts) > maxParts {
 		resp.IsTruncated = true
@@ -657,6 +775,7 @@ func ListObjectPartsHandler(w http.ResponseWriter, r *http.Request) {
 			Size:         p.Size,
 			LastModified: p.LastModified,
 		}
+		partInfo.ChecksumCRC32, partInfo.ChecksumCRC32C, partInfo.ChecksumSHA1, partInfo.ChecksumSHA256, partInfo.ChecksumCRC64NVME = p.Checksum.Values()
 		resp.Part = append(resp.Part, &partInfo)
 	}
 
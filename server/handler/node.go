@@ -102,3 +102,40 @@ func ReadBlockHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.GetLogger("dedups3").Debugf("Successfully preparing block %s for response, size: %d bytes", blockID, len(data))
 }
+
+// StatBlockHandler 返回本节点磁盘上块的大小，不读取块数据
+func StatBlockHandler(w http.ResponseWriter, r *http.Request) {
+	vars := utils.DecodeVars(mux.Vars(r))
+	blockID := strings.TrimSpace(vars["blockID"])
+	logger.GetLogger("dedups3").Debugf("API called: StatBlockHandler blockID %s", blockID)
+	if !utils.IsValidUUID(blockID) {
+		logger.GetLogger("dedups3").Errorf("Missing or invalid block_id in stat request: %s", blockID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
+		return
+	}
+
+	query := utils.DecodeQuerys(r.URL.Query())
+	storageID := strings.TrimSpace(query.Get("storageid"))
+	if storageID == "" {
+		logger.GetLogger("dedups3").Errorf("Missing or invalid storageid in stat request: %s", storageID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
+		return
+	}
+
+	localStore := node.NodeService{}
+	size, err := localStore.LocalBlockSize(storageID, blockID)
+	if err != nil {
+		logger.GetLogger("dedups3").Infof("LocalBlockSize %s failed: %v", blockID, err)
+		if errors.Is(err, block.ErrBlockNotFound) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+			return
+		}
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	w.Header().Set(xhttp.ContentType, "application/octet-stream")
+	w.Header().Set(xhttp.ContentLength, fmt.Sprintf("%d", size))
+	w.Header().Set(xhttp.AmzRequestID, xhttp.GetRequestID(r.Context()))
+	w.WriteHeader(http.StatusOK)
+}
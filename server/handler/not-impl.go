@@ -50,21 +50,11 @@ var RejectedBucketAPIs = []rejectedAPI{
 		Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete},
 		Queries: []string{"inventory", ""},
 	},
-	{
-		Api:     "cors",
-		Methods: []string{http.MethodPut, http.MethodDelete},
-		Queries: []string{"cors", ""},
-	},
 	{
 		Api:     "metrics",
 		Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete},
 		Queries: []string{"metrics", ""},
 	},
-	{
-		Api:     "website",
-		Methods: []string{http.MethodPut},
-		Queries: []string{"website", ""},
-	},
 	{
 		Api:     "logging",
 		Methods: []string{http.MethodPut, http.MethodDelete},
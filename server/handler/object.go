@@ -27,15 +27,21 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mageg-x/dedups3/internal/aws"
 	"github.com/mageg-x/dedups3/meta"
 
+	"github.com/mageg-x/dedups3/internal/checksum"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/service/kms"
 	"github.com/mageg-x/dedups3/service/object"
+	"github.com/mageg-x/dedups3/service/replication"
+	"github.com/mageg-x/dedups3/service/site"
 
 	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/s3select"
 )
 
 func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +61,12 @@ func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
 	ifnoneMatch := r.Header.Get(xhttp.IfNoneMatch)
 	ifnoneMatch = strings.Trim(ifnoneMatch, "\"")
 	ifmodifiedSince := r.Header.Get(xhttp.IfModifiedSince)
+	versionID := r.URL.Query().Get(xhttp.VersionID)
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
 
 	_os := object.GetObjectService()
 	if _os == nil {
@@ -63,13 +75,14 @@ func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objInfo, err := _os.HeadObject(&object.BaseObjectParams{
+	objInfo, err := _os.HeadObject(r.Context(), &object.BaseObjectParams{
 		BucketName:      bucket,
 		ObjKey:          objectKey,
 		AccessKeyID:     accessKeyID,
 		IfMatch:         ifMatch,
 		IfNoneMatch:     ifnoneMatch,
 		IfModifiedSince: ifmodifiedSince,
+		VersionID:       versionID,
 	})
 	if err != nil {
 		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
@@ -80,6 +93,17 @@ func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
 			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
 			return
 		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			// 指定的版本是删除标记
+			w.Header().Set(xhttp.AmzDeleteMarker, "true")
+			w.Header().Set(xhttp.AmzVersionID, versionID)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
 		logger.GetLogger("dedups3").Errorf("object %s not found err: %v", objectKey, err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
 		return
@@ -92,6 +116,14 @@ func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
 
 	logger.GetLogger("dedups3").Debugf("headObject object %#v", objInfo)
 
+	// SSE-C 对象需要提供匹配的客户密钥
+	if err := object.CheckCustomerKey(objInfo.SSE, customerKey); err != nil {
+		if !writeSSEErr(w, r, err) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		}
+		return
+	}
+
 	// If-Match
 	if ifMatch != "" && string(objInfo.ETag) != ifMatch {
 		logger.GetLogger("dedups3").Errorf("Object %s is not matched with If-Match ETag %s:%s", objectKey, ifMatch, objInfo.ETag)
@@ -122,6 +154,19 @@ func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(xhttp.ContentLength, strconv.FormatInt(objInfo.Size, 10))
 	w.Header().Set(xhttp.ETag, fmt.Sprintf("\"%s\"", objInfo.ETag))
 	w.Header().Set(xhttp.LastModified, objInfo.LastModified.Format(http.TimeFormat))
+	if objInfo.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, objInfo.VersionID)
+	}
+	setObjectStorageHeaders(w, objInfo)
+	setObjectLockHeaders(w, objInfo)
+	setObjectSSEHeaders(w, objInfo)
+	setSSECHeaders(w, r.Header)
+	if strings.EqualFold(r.Header.Get(xhttp.AmzChecksumMode), "ENABLED") {
+		setChecksumHeaders(w, objInfo.Checksum)
+	}
+	if objInfo.ReplicationStatus != "" {
+		w.Header().Set(xhttp.AmzBucketReplicationStatus, objInfo.ReplicationStatus)
+	}
 
 	if objInfo.ContentEncoding != "" {
 		w.Header().Set(xhttp.ContentEncoding, objInfo.ContentEncoding)
@@ -153,8 +198,91 @@ func HeadObjectHandler(w http.ResponseWriter, r *http.Request) {
 func GetObjectAttributesHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetObjectAttributesHandler")
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	attrs, err := object.ParseObjectAttributes(r.Header.Values(xhttp.AmzObjectAttributes))
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object attributes: %v", r.Header.Values(xhttp.AmzObjectAttributes))
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidAttributeName)
+		return
+	}
+	maxParts := object.MaxObjectAttributesParts
+	if v := r.Header.Get(xhttp.AmzMaxParts); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			logger.GetLogger("dedups3").Errorf("invalid max parts: %s", v)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidMaxParts)
+			return
+		}
+		maxParts = min(n, object.MaxObjectAttributesParts)
+	}
+	partNumberMarker := 0
+	if v := r.Header.Get(xhttp.AmzPartNumberMarker); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			logger.GetLogger("dedups3").Errorf("invalid part number marker: %s", v)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidPartNumberMarker)
+			return
+		}
+		partNumberMarker = n
+	}
+	versionID := r.URL.Query().Get(xhttp.VersionID)
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	objInfo, err := _os.HeadObject(r.Context(), &object.BaseObjectParams{
+		BucketName:  bucket,
+		ObjKey:      objectKey,
+		AccessKeyID: accessKeyID,
+		VersionID:   versionID,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			// 指定的版本是删除标记
+			w.Header().Set(xhttp.AmzDeleteMarker, "true")
+			w.Header().Set(xhttp.AmzVersionID, versionID)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
+		for _, code := range []xhttp.APIErrorCode{xhttp.ErrAccessDenied, xhttp.ErrNoSuchKey, xhttp.ErrNoSuchVersion} {
+			if errors.Is(err, xhttp.ToError(code)) {
+				xhttp.WriteAWSErr(w, r, code)
+				return
+			}
+		}
+		logger.GetLogger("dedups3").Errorf("get object %s attributes failed: %v", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	// SSE-C 对象需要提供匹配的客户密钥
+	if err := object.CheckCustomerKey(objInfo.SSE, customerKey); err != nil {
+		if !writeSSEErr(w, r, err) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		}
+		return
+	}
+
+	w.Header().Set(xhttp.LastModified, objInfo.LastModified.Format(http.TimeFormat))
+	if objInfo.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, objInfo.VersionID)
+	}
+	xhttp.WriteAWSSuc(w, r, object.ObjectAttributes(objInfo, attrs, maxParts, partNumberMarker))
 }
 
 // GetObjectACLHandler 处理 GET Object ACL 请求
@@ -185,7 +313,7 @@ func GetObjectACLHandler(w http.ResponseWriter, r *http.Request) {
 		AccessKeyID: accessKeyID,
 	}
 
-	obj, err := _os.HeadObject(params)
+	obj, err := _os.HeadObject(r.Context(), params)
 	if err != nil {
 		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
 			logger.GetLogger("dedups3").Errorf("object %s/%s does not exist", bucket, objectKey)
@@ -235,7 +363,7 @@ func PutObjectACLHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	obj, err := _os.HeadObject(&object.BaseObjectParams{
+	obj, err := _os.HeadObject(r.Context(), &object.BaseObjectParams{
 		BucketName:  bucket,
 		ObjKey:      objectKey,
 		AccessKeyID: accessKeyID,
@@ -432,7 +560,7 @@ func GetObjectTaggingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	obj, err := _os.HeadObject(&object.BaseObjectParams{
+	obj, err := _os.HeadObject(r.Context(), &object.BaseObjectParams{
 		BucketName:  bucket,
 		ObjKey:      objectKey,
 		AccessKeyID: accessKeyID,
@@ -605,24 +733,204 @@ func DeleteObjectTaggingHandler(w http.ResponseWriter, r *http.Request) {
 func SelectObjectContentHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: SelectObjectContentHandler")
-	// TODO: 实现 SELECT Object Content 逻辑
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	// 先解析请求和 SQL，错误按普通的 XML 错误返回
+	req, err := s3select.ParseRequest(r.Body)
+	if err == nil {
+		var sel *s3select.Select
+		if sel, err = s3select.NewSelect(req); err == nil {
+			selectObjectContent(w, r, bucket, objectKey, accessKeyID, sel)
+			return
+		}
+	}
+	var apiErr xhttp.APIError
+	if errors.As(err, &apiErr) {
+		logger.GetLogger("dedups3").Errorf("invalid select request: %v", err)
+		xhttp.WriteAWSError(w, r, apiErr.Code, err.Error(), apiErr.HTTPStatusCode)
+		return
+	}
+	logger.GetLogger("dedups3").Errorf("failed to parse select request: %v", err)
+	xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+}
+
+// selectObjectContent 读出对象数据执行查询，结果按 event stream 流式返回
+func selectObjectContent(w http.ResponseWriter, r *http.Request, bucket, objectKey, accessKeyID string, sel *s3select.Select) {
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+
+	_, reader, err := _os.GetObject(r.Context(), nil, r.Header, &object.BaseObjectParams{
+		BucketName:  bucket,
+		ObjKey:      objectKey,
+		AccessKeyID: accessKeyID,
+		VersionID:   r.URL.Query().Get(xhttp.VersionID),
+		CustomerKey: customerKey,
+	})
+	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidObjectState)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectState)
+		return
+	}
+	if writeSSEErr(w, r, err) {
+		return
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+	defer reader.Close()
+
+	setSSECHeaders(w, r.Header)
+	w.Header().Set(xhttp.ContentType, "application/octet-stream")
 	w.WriteHeader(http.StatusOK)
+	if err := sel.Run(r.Context(), reader, w); err != nil {
+		logger.GetLogger("dedups3").Errorf("select object %s/%s failed: %v", bucket, objectKey, err)
+	}
 }
 
 // GetObjectRetentionHandler 处理 GET Object Retention 请求
 func GetObjectRetentionHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetObjectRetentionHandler")
-	// TODO: 实现 GET Object Retention 逻辑
-	w.WriteHeader(http.StatusOK)
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	retention, err := _os.GetObjectRetention(&object.BaseObjectParams{
+		BucketName:  bucket,
+		ObjKey:      objectKey,
+		AccessKeyID: accessKeyID,
+		VersionID:   r.URL.Query().Get(xhttp.VersionID),
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("failed to %s object %s: %v", "%OP%", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	retention.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	xhttp.WriteAWSSuc(w, r, retention)
 }
 
 // GetObjectLegalHoldHandler 处理 GET Object Legal Hold 请求
 func GetObjectLegalHoldHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: GetObjectLegalHoldHandler")
-	// TODO: 实现 GET Object Legal Hold 逻辑
-	w.WriteHeader(http.StatusOK)
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	legalHold, err := _os.GetObjectLegalHold(&object.BaseObjectParams{
+		BucketName:  bucket,
+		ObjKey:      objectKey,
+		AccessKeyID: accessKeyID,
+		VersionID:   r.URL.Query().Get(xhttp.VersionID),
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("failed to %s object %s: %v", "%OP%", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	legalHold.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	xhttp.WriteAWSSuc(w, r, legalHold)
 }
 
 // GetObjectLambdaHandler 处理 GET Object with Lambda ARN 请求
@@ -660,11 +968,20 @@ func GetObjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	obj, reader, err := _os.GetObject(r.Body, r.Header, &object.BaseObjectParams{
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+
+	versionID := r.URL.Query().Get(xhttp.VersionID)
+	obj, reader, err := _os.GetObject(r.Context(), r.Body, r.Header, &object.BaseObjectParams{
 		BucketName:  bucket,
 		ObjKey:      objectKey,
 		AccessKeyID: accessKeyID,
 		Range:       rangeHead,
+		VersionID:   versionID,
+		CustomerKey: customerKey,
 	})
 
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
@@ -675,6 +992,24 @@ func GetObjectHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
 		return
 	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+		// 指定的版本是删除标记
+		w.Header().Set(xhttp.AmzDeleteMarker, "true")
+		w.Header().Set(xhttp.AmzVersionID, versionID)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidObjectState)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectState)
+		return
+	}
+	if writeSSEErr(w, r, err) {
+		return
+	}
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objectKey, err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
@@ -689,6 +1024,20 @@ func GetObjectHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(xhttp.ContentType, obj.ContentType)
 	w.Header().Set(xhttp.ETag, fmt.Sprintf("\"%s\"", obj.ETag))
 	w.Header().Set(xhttp.LastModified, obj.LastModified.Format(http.TimeFormat))
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	setObjectStorageHeaders(w, obj)
+	setObjectLockHeaders(w, obj)
+	setObjectSSEHeaders(w, obj)
+	setSSECHeaders(w, r.Header)
+	// 范围读取时校验和对应的不是返回的内容，不返回
+	if rangeHead == nil && strings.EqualFold(r.Header.Get(xhttp.AmzChecksumMode), "ENABLED") {
+		setChecksumHeaders(w, obj.Checksum)
+	}
+	if obj.ReplicationStatus != "" {
+		w.Header().Set(xhttp.AmzBucketReplicationStatus, obj.ReplicationStatus)
+	}
 	if obj.ContentEncoding != "" {
 		w.Header().Set(xhttp.ContentEncoding, obj.ContentEncoding)
 	}
@@ -735,6 +1084,8 @@ func GetObjectHandler(w http.ResponseWriter, r *http.Request) {
 			logger.GetLogger("dedups3").Infof("client disconnected during download: %v", err)
 		} else {
 			logger.GetLogger("dedups3").Errorf("write response body failed: %v", err)
+			// 状态码已经发出，中断连接让客户端知道数据不完整
+			panic(http.ErrAbortHandler)
 		}
 		return
 	}
@@ -763,8 +1114,13 @@ func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 获取源桶 和对象
 	cpSrcPath := r.Header.Get(xhttp.AmzCopySource)
+	srcVersionID := r.Header.Get(xhttp.AmzCopySourceVersionID)
 	if u, err := url.Parse(cpSrcPath); err == nil {
 		cpSrcPath = u.EscapedPath()
+		// x-amz-copy-source 可以带 ?versionId= 指定源版本
+		if v := u.Query().Get(xhttp.VersionID); v != "" {
+			srcVersionID = v
+		}
 	}
 	cpSrcPath = strings.TrimPrefix(cpSrcPath, "/")
 	parts := strings.SplitN(cpSrcPath, "/", 2) // 只分割一次
@@ -783,6 +1139,28 @@ func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	dstSc := r.Header.Get(xhttp.AmzStorageClass)
+	// 目标对象的锁定设置
+	retention, legalHold, err := object.ParseObjectLockHeaders(r.Header)
+	if err != nil {
+		writeObjectLockErr(w, r, err)
+		return
+	}
+	// 目标对象的服务端加密方式
+	sseReq, err := object.ParseSSEHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+	customerKey, err := object.ParseCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
+	srcCustomerKey, err := object.ParseCopySourceCustomerKeyHeaders(r.Header)
+	if err != nil {
+		writeSSEErr(w, r, err)
+		return
+	}
 
 	_os := object.GetObjectService()
 	if _os == nil {
@@ -802,6 +1180,12 @@ func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
 		SourceIfNoneMatch:       SourceIfNoneMatch,
 		SourceIfModifiedSince:   SourceIfModifiedSince,
 		SourceIfUnmodifiedSince: SourceIfUnmodifiedSince,
+		SourceVersionID:         srcVersionID,
+		ObjectLockRetention:     retention,
+		ObjectLockLegalHold:     legalHold,
+		ServerSideEncryption:    sseReq,
+		CustomerKey:             customerKey,
+		SourceCustomerKey:       srcCustomerKey,
 	})
 
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)) {
@@ -824,6 +1208,20 @@ func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
 		return
 	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidObjectState)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectState)
+		return
+	}
+	if writeObjectLockErr(w, r, err) {
+		return
+	}
+	if writeSSEErr(w, r, err) {
+		return
+	}
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to copy object %s: %v", objectKey, err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
@@ -837,6 +1235,15 @@ func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
 		ETag:         obj.ETag,
 		LastModified: obj.LastModified.Format("2006-01-02T15:04:05.000Z"),
 	}
+	if srcVersionID != "" {
+		w.Header().Set(xhttp.AmzCopySourceVersionID, srcVersionID)
+	}
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	setObjectSSEHeaders(w, obj)
+	setSSECHeaders(w, r.Header)
+	scheduleReplication(accessKeyID, bucket, objectKey)
 	xhttp.WriteAWSSuc(w, r, result)
 }
 
@@ -844,24 +1251,353 @@ func CopyObjectHandler(w http.ResponseWriter, r *http.Request) {
 func PutObjectRetentionHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: PutObjectRetentionHandler")
-	// TODO: 实现 PUT Object Retention 逻辑
-	w.WriteHeader(http.StatusOK)
-}
-
-// PutObjectLegalHoldHandler 处理 PUT Object Legal Hold 请求
-func PutObjectLegalHoldHandler(w http.ResponseWriter, r *http.Request) {
-	// 打印接口名称
-	logger.GetLogger("dedups3").Infof("API called: PutObjectLegalHoldHandler")
-	// TODO: 实现 PUT Object Legal Hold 逻辑
-	w.WriteHeader(http.StatusOK)
-}
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
 
-// PutObjectExtractHandler 处理 PUT Object with auto-extract 请求
-func PutObjectExtractHandler(w http.ResponseWriter, r *http.Request) {
-	// 打印接口名称
-	logger.GetLogger("dedups3").Infof("API called: PutObjectExtractHandler")
-	// TODO: 实现 PUT Object with auto-extract 逻辑
-	w.WriteHeader(http.StatusOK)
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+		return
+	}
+	defer r.Body.Close()
+
+	var retention meta.Retention
+	if err := xml.Unmarshal(body, &retention); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal retention: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := retention.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid retention: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	obj, err := _os.PutObjectRetention(&object.BaseObjectParams{
+		BucketName:       bucket,
+		ObjKey:           objectKey,
+		AccessKeyID:      accessKeyID,
+		VersionID:        r.URL.Query().Get(xhttp.VersionID),
+		BypassGovernance: strings.EqualFold(r.Header.Get(xhttp.AmzObjectLockBypassGovernance), "true"),
+	}, &retention)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("failed to %s object %s: %v", "%OP%", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PutObjectLegalHoldHandler 处理 PUT Object Legal Hold 请求
+func PutObjectLegalHoldHandler(w http.ResponseWriter, r *http.Request) {
+	// 打印接口名称
+	logger.GetLogger("dedups3").Infof("API called: PutObjectLegalHoldHandler")
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+		return
+	}
+	defer r.Body.Close()
+
+	var legalHold meta.LegalHold
+	if err := xml.Unmarshal(body, &legalHold); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal legal hold: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := legalHold.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid legal hold: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	obj, err := _os.PutObjectLegalHold(&object.BaseObjectParams{
+		BucketName:  bucket,
+		ObjKey:      objectKey,
+		AccessKeyID: accessKeyID,
+		VersionID:   r.URL.Query().Get(xhttp.VersionID),
+	}, &legalHold)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("failed to %s object %s: %v", "%OP%", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeObjectLockErr 写入对象锁定相关的错误应答，不是对象锁定错误时返回 false
+func writeObjectLockErr(w http.ResponseWriter, r *http.Request, err error) bool {
+	codes := []xhttp.APIErrorCode{
+		xhttp.ErrObjectLocked,
+		xhttp.ErrObjectLockInvalidHeaders,
+		xhttp.ErrUnknownWORMModeDirective,
+		xhttp.ErrInvalidRetentionDate,
+		xhttp.ErrPastObjectLockRetainDate,
+		xhttp.ErrInvalidBucketObjectLockConfiguration,
+		xhttp.ErrNoSuchObjectLockConfiguration,
+		xhttp.ErrInvalidRequest,
+	}
+	for _, code := range codes {
+		if errors.Is(err, xhttp.ToError(code)) {
+			xhttp.WriteAWSErr(w, r, code)
+			return true
+		}
+	}
+	return false
+}
+
+// writeSSEErr 把服务端加密相关的错误写回客户端，返回是否已处理
+func writeSSEErr(w http.ResponseWriter, r *http.Request, err error) bool {
+	codes := []xhttp.APIErrorCode{
+		xhttp.ErrInvalidEncryptionMethod,
+		xhttp.ErrInvalidEncryptionKeyID,
+		xhttp.ErrInvalidEncryptionAlgorithmError,
+		xhttp.ErrKMSNotConfigured,
+		xhttp.ErrKMSNotFoundException,
+		xhttp.ErrKMSDisabledException,
+		xhttp.ErrIncompatibleEncryptionMethod,
+		xhttp.ErrInvalidEncryptionParameters,
+		xhttp.ErrInvalidSSECustomerAlgorithm,
+		xhttp.ErrInvalidSSECustomerKey,
+		xhttp.ErrMissingSSECustomerKey,
+		xhttp.ErrMissingSSECustomerKeyMD5,
+		xhttp.ErrSSECustomerKeyMD5Mismatch,
+		xhttp.ErrSSEEncryptedObject,
+		xhttp.ErrSSEMultipartEncrypted,
+	}
+	for _, code := range codes {
+		if errors.Is(err, xhttp.ToError(code)) {
+			xhttp.WriteAWSErr(w, r, code)
+			return true
+		}
+	}
+	return false
+}
+
+// setSSEHeaders 设置服务端加密相关的应答头
+func setSSEHeaders(w http.ResponseWriter, algorithm, kmsKeyID, accountID string) {
+	if algorithm == "" {
+		return
+	}
+	w.Header().Set(xhttp.AmzServerSideEncryption, algorithm)
+	if algorithm == xhttp.AmzEncryptionKMS && kmsKeyID != "" {
+		w.Header().Set(xhttp.AmzServerSideEncryptionKmsID, kms.KeyARN(accountID, kmsKeyID))
+	}
+}
+
+// setSSECHeaders 请求使用 SSE-C 时返回客户密钥的算法和 MD5，客户密钥已经在处理请求时校验过
+func setSSECHeaders(w http.ResponseWriter, headers http.Header) {
+	if algorithm := headers.Get(xhttp.AmzServerSideEncryptionCustomerAlgorithm); algorithm != "" {
+		w.Header().Set(xhttp.AmzServerSideEncryptionCustomerAlgorithm, algorithm)
+		w.Header().Set(xhttp.AmzServerSideEncryptionCustomerKeyMD5, headers.Get(xhttp.AmzServerSideEncryptionCustomerKeyMD5))
+	}
+}
+
+// setChecksumHeaders 设置对象的附加校验和应答头，对象没有校验和时不设置
+func setChecksumHeaders(w http.ResponseWriter, c *meta.Checksum) {
+	if c == nil || c.Value == "" {
+		return
+	}
+	w.Header().Set(checksum.HeaderKey(c.Algorithm), c.Value)
+	if c.Type != "" {
+		w.Header().Set(xhttp.AmzChecksumType, c.Type)
+	}
+}
+
+// setObjectSSEHeaders 设置对象的服务端加密应答头
+func setObjectSSEHeaders(w http.ResponseWriter, obj *meta.Object) {
+	setSSEHeaders(w, obj.EncryptionType, obj.KMSKeyID, obj.Owner.ID)
+}
+
+// setObjectStorageHeaders 设置对象的存储类别和归档恢复状态应答头，标准存储不返回存储类别
+func setObjectStorageHeaders(w http.ResponseWriter, obj *meta.Object) {
+	if obj.StorageClass != "" && obj.StorageClass != meta.STANDARD_CLASS_STORAGE {
+		w.Header().Set(xhttp.AmzStorageClass, obj.StorageClass)
+	}
+	if obj.RestoreStatus != "" {
+		w.Header().Set(xhttp.AmzRestore, obj.RestoreStatus)
+	}
+}
+
+// setObjectLockHeaders 设置对象锁定相关的应答头
+func setObjectLockHeaders(w http.ResponseWriter, obj *meta.Object) {
+	if obj.LockMode != "" {
+		w.Header().Set(xhttp.AmzObjectLockMode, obj.LockMode)
+		w.Header().Set(xhttp.AmzObjectLockRetainUntilDate, obj.LockRetainUntil.UTC().Format(time.RFC3339))
+	}
+	if obj.LegalHold {
+		w.Header().Set(xhttp.AmzObjectLockLegalHold, meta.LegalHoldOn)
+	}
+}
+
+// scheduleReplication 对象写入或删除成功后，按桶的复制规则加入复制队列，同时同步到其他站点
+func scheduleReplication(accessKeyID, bucket string, keys ...string) {
+	rs := replication.GetReplicationService()
+	ss := site.GetSiteService()
+	for _, key := range keys {
+		if rs != nil {
+			rs.Schedule(accessKeyID, bucket, key)
+		}
+		if ss != nil {
+			ss.Schedule(accessKeyID, bucket, key)
+		}
+	}
+}
+
+// PutObjectExtractHandler 处理 PUT Object with auto-extract 请求
+// 请求体是 tar、tar.gz 或 zip 压缩包，解压到目标 key 所在目录下，每个文件写成一个对象
+func PutObjectExtractHandler(w http.ResponseWriter, r *http.Request) {
+	// 打印接口名称
+	logger.GetLogger("dedups3").Infof("API called: PutObjectExtractHandler")
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("Invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	sc := strings.TrimSpace(r.Header.Get(xhttp.AmzStorageClass))
+	if sc != "" {
+		if err := utils.CheckValidStorageClass(sc); err != nil {
+			logger.GetLogger("dedups3").Errorf("Invalid storage class: %s", sc)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidStorageClass)
+			return
+		}
+	}
+
+	// 包装 body
+	body, err := aws.NewReader(r)
+	if err != nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+		return
+	}
+	defer body.Close()
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("Object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	result, err := _os.PutObjectExtract(body, r.Header, &object.BaseObjectParams{
+		BucketName:   bucket,
+		ObjKey:       objectKey,
+		AccessKeyID:  accessKeyID,
+		StorageClass: sc,
+	}, func(obj *meta.Object) {
+		scheduleReplication(accessKeyID, bucket, obj.Key)
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAdminBucketQuotaExceeded)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMalformedRequestBody)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrEntityTooLarge)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrEntityTooLarge)
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("Error extracting object: %s", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	xhttp.WriteAWSSuc(w, r, result)
 }
 
 // PutObjectHandler 上传对象
@@ -910,6 +1646,13 @@ func PutObjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer body.Close()
 
+	// 附加校验和可以在请求头中，也可以在 aws-chunked 的 trailer 中
+	checksumSpec, err := checksum.FromRequest(r.Header, r.Trailer)
+	if err != nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
+
 	contentLenStr := r.Header.Get(xhttp.AmzDecodedContentLength)
 	if contentLenStr == "" {
 		contentLenStr = r.Header.Get(xhttp.ContentLength)
@@ -949,9 +1692,18 @@ func PutObjectHandler(w http.ResponseWriter, r *http.Request) {
 		IfMatch:         ifMatch,
 		IfNoneMatch:     ifnoneMatch,
 		IfModifiedSince: ifmodifiedSince,
+		Checksum:        checksumSpec,
 	})
 
 	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrBadDigest)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrBadDigest)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidChecksum)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+			return
+		}
 		if errors.Is(err, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)) {
 			xhttp.WriteAWSErr(w, r, xhttp.ErrAdminBucketQuotaExceeded)
 			return
@@ -964,12 +1716,143 @@ func PutObjectHandler(w http.ResponseWriter, r *http.Request) {
 			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
 			return
 		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		if writeSSEErr(w, r, err) {
+			return
+		}
 		logger.GetLogger("dedups3").Errorf("Error putting object: %s", err)
 		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
 		return
 	}
 
 	w.Header().Set(xhttp.ETag, fmt.Sprintf("\"%s\"", obj.ETag))
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	setObjectSSEHeaders(w, obj)
+	setSSECHeaders(w, r.Header)
+	setChecksumHeaders(w, obj.Checksum)
+	scheduleReplication(accessKeyID, bucket, objectKey)
+	w.WriteHeader(http.StatusOK)
+}
+
+// AppendObjectHandler 追加写对象，x-amz-write-offset-bytes 必须等于对象当前的大小
+func AppendObjectHandler(w http.ResponseWriter, r *http.Request) {
+	// 打印接口名称
+	logger.GetLogger("dedups3").Infof("API called: AppendObjectHandler")
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("Invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSpace(r.Header.Get(xhttp.AmzWriteOffsetBytes)), 10, 64)
+	if err != nil || offset < 0 {
+		logger.GetLogger("dedups3").Errorf("Invalid write offset: %s", r.Header.Get(xhttp.AmzWriteOffsetBytes))
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
+		return
+	}
+
+	// content-type
+	ct := r.Header.Get(xhttp.ContentType)
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	contentMd5 := strings.Trim(r.Header.Get(xhttp.ContentMD5), "\"")
+
+	sc := strings.TrimSpace(r.Header.Get(xhttp.AmzStorageClass))
+	if sc != "" {
+		if err := utils.CheckValidStorageClass(sc); err != nil {
+			logger.GetLogger("dedups3").Errorf("Invalid storage class: %s", sc)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidStorageClass)
+			return
+		}
+	}
+
+	// 包装 body
+	body, err := aws.NewReader(r)
+	if err != nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+		return
+	}
+	defer body.Close()
+
+	// 附加校验和可以在请求头中，也可以在 aws-chunked 的 trailer 中
+	checksumSpec, err := checksum.FromRequest(r.Header, r.Trailer)
+	if err != nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidChecksum)
+		return
+	}
+
+	contentLenStr := r.Header.Get(xhttp.AmzDecodedContentLength)
+	if contentLenStr == "" {
+		contentLenStr = r.Header.Get(xhttp.ContentLength)
+	}
+	contentLength := r.ContentLength
+	if contentLenStr != "" {
+		contentLength, err = strconv.ParseInt(contentLenStr, 10, 64)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("Invalid X-Amz-Decoded-Content-Length: %s", contentLenStr)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidDigest)
+			return
+		}
+	}
+	if contentLength < 0 {
+		logger.GetLogger("dedups3").Errorf("Negative content length: %d", contentLength)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidDigest)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("Object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	obj, err := _os.AppendObject(body, r.Header, &object.BaseObjectParams{
+		BucketName:   bucket,
+		ObjKey:       objectKey,
+		ContentType:  ct,
+		ContentMd5:   contentMd5,
+		ContentLen:   contentLength,
+		AccessKeyID:  accessKeyID,
+		StorageClass: sc,
+		Checksum:     checksumSpec,
+	}, offset)
+	if err != nil {
+		for _, code := range []xhttp.APIErrorCode{
+			xhttp.ErrAdminBucketQuotaExceeded, xhttp.ErrAccessDenied, xhttp.ErrNoSuchBucket, xhttp.ErrInvalidWriteOffset,
+			xhttp.ErrInvalidObjectState, xhttp.ErrInvalidRequest, xhttp.ErrBadDigest,
+			xhttp.ErrInvalidChecksum,
+		} {
+			if errors.Is(err, xhttp.ToError(code)) {
+				xhttp.WriteAWSErr(w, r, code)
+				return
+			}
+		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		if writeSSEErr(w, r, err) {
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("Error appending object: %s", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	w.Header().Set(xhttp.ETag, fmt.Sprintf("\"%s\"", obj.ETag))
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	setObjectSSEHeaders(w, obj)
+	setSSECHeaders(w, r.Header)
+	setChecksumHeaders(w, obj.Checksum)
+	scheduleReplication(accessKeyID, bucket, objectKey)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -993,10 +1876,15 @@ func DeleteObjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := _os.DeleteObject(&object.BaseObjectParams{
-		BucketName:  bucket,
-		ObjKey:      objectKey,
-		AccessKeyID: accessKeyID,
+	// 治理模式的保留期可以通过 bypass 请求头跳过
+	bypassGovernance := strings.EqualFold(r.Header.Get(xhttp.AmzObjectLockBypassGovernance), "true")
+	versionID := r.URL.Query().Get(xhttp.VersionID)
+	obj, err := _os.DeleteObject(&object.BaseObjectParams{
+		BucketName:       bucket,
+		ObjKey:           objectKey,
+		AccessKeyID:      accessKeyID,
+		VersionID:        versionID,
+		BypassGovernance: bypassGovernance,
 	})
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
@@ -1006,6 +1894,28 @@ func DeleteObjectHandler(w http.ResponseWriter, r *http.Request) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
 		return
 	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+		return
+	}
+	if writeObjectLockErr(w, r, err) {
+		return
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to delete object %s: %v", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	if obj.DeleteMarker {
+		w.Header().Set(xhttp.AmzDeleteMarker, "true")
+	}
+	// 删除指定版本不复制
+	if versionID == "" {
+		scheduleReplication(accessKeyID, bucket, objectKey)
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1053,18 +1963,37 @@ func DeleteMultipleObjectsHandler(w http.ResponseWriter, r *http.Request) {
 	if deleteReq.Quiet != nil {
 		quiet = *deleteReq.Quiet
 	}
+	bypassGovernance := strings.EqualFold(r.Header.Get(xhttp.AmzObjectLockBypassGovernance), "true")
 	// 遍历所有要删除的对象
 	for _, obj := range deleteReq.Objects {
 		// 执行删除操作
-		err := _os.DeleteObject(&object.BaseObjectParams{
-			BucketName:  bucket,
-			ObjKey:      obj.Key,
-			AccessKeyID: accessKeyID,
+		versionID := ""
+		if obj.VersionId != nil {
+			versionID = *obj.VersionId
+		}
+		deleted, err := _os.DeleteObject(&object.BaseObjectParams{
+			BucketName:       bucket,
+			ObjKey:           obj.Key,
+			AccessKeyID:      accessKeyID,
+			VersionID:        versionID,
+			BypassGovernance: bypassGovernance,
 		})
 		if err == nil {
+			if versionID == "" {
+				scheduleReplication(accessKeyID, bucket, obj.Key)
+			}
 			// 删除成功
 			if !quiet {
-				result.Deleted = append(result.Deleted, object.DeletedObject{Key: obj.Key})
+				item := object.DeletedObject{Key: obj.Key, VersionId: obj.VersionId}
+				if deleted.DeleteMarker {
+					isMarker := true
+					item.DeleteMarker = &isMarker
+					if versionID == "" {
+						// 新建的删除标记
+						item.DeleteMarkerVersionId = &deleted.VersionID
+					}
+				}
+				result.Deleted = append(result.Deleted, item)
 			}
 			logger.GetLogger("dedups3").Tracef("Successfully deleted object: %s", obj.Key)
 		} else {
@@ -1079,11 +2008,19 @@ func DeleteMultipleObjectsHandler(w http.ResponseWriter, r *http.Request) {
 				} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
 					errorCode = "NoSuchKey"
 					errorMessage = "The specified key does not exist"
+				} else if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+					errorCode = "NoSuchVersion"
+					errorMessage = "The specified version does not exist"
+				} else if errors.Is(err, xhttp.ToError(xhttp.ErrObjectLocked)) {
+					apiErr := xhttp.ToApiErr(xhttp.ErrObjectLocked)
+					errorCode = apiErr.Code
+					errorMessage = apiErr.Description
 				}
 				result.Errors = append(result.Errors, object.DeletedObjectErrors{
-					Key:     &obj.Key,
-					Code:    errorCode,
-					Message: errorMessage,
+					Key:       &obj.Key,
+					VersionId: obj.VersionId,
+					Code:      errorCode,
+					Message:   errorMessage,
 				})
 			}
 		}
@@ -1091,11 +2028,90 @@ func DeleteMultipleObjectsHandler(w http.ResponseWriter, r *http.Request) {
 	xhttp.WriteAWSSuc(w, r, result)
 }
 
-// PostRestoreObjectHandler 处理 POST Restore Object 请求
+// RestoreObjectHandler 处理 POST Restore Object 请求，把归档对象恢复为可读取的临时副本
 func RestoreObjectHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: PostRestoreObjectHandler")
-	// TODO: 实现 POST Restore Object 逻辑
+	bucket, objectKey, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+
+	// 读取请求体
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read request body: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedRequestBody)
+		return
+	}
+	defer r.Body.Close()
+
+	var req meta.RestoreRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to unmarshal restore request: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid restore request: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedXML)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	accepted, err := _os.RestoreObject(&object.BaseObjectParams{
+		BucketName:  bucket,
+		ObjKey:      objectKey,
+		AccessKeyID: accessKeyID,
+		VersionID:   r.URL.Query().Get(xhttp.VersionID),
+	}, &req)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchVersion)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMethodNotAllowed)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidObjectState)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectState)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrObjectRestoreAlreadyInProgress)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrObjectRestoreAlreadyInProgress)
+			return
+		}
+		logger.GetLogger("dedups3").Errorf("failed to restore object %s: %v", objectKey, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	// 新建恢复任务返回 202，已经恢复的对象只更新过期时间返回 200
+	if accepted {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -1147,7 +2163,7 @@ func ListObjectsV1Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objects, commonPrefixes, isTruncated, nextMarker, err := _os.ListObjects(bucket, accessKeyID, prefix, marker, delimiter, maxkeys)
+	objects, commonPrefixes, isTruncated, nextMarker, err := _os.ListObjects(r.Context(), bucket, accessKeyID, prefix, marker, delimiter, maxkeys)
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
 		return
@@ -1289,7 +2305,7 @@ func ListObjectsV2Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objects, commonPrefixes, isTruncated, nextToken, err := _os.ListObjectsV2(bucket, accessKeyID, prefix, continuationToken, startAfter, delimiter, maxkeys)
+	objects, commonPrefixes, isTruncated, nextToken, err := _os.ListObjectsV2(r.Context(), bucket, accessKeyID, prefix, continuationToken, startAfter, delimiter, maxkeys)
 	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
 		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
 		return
@@ -1377,16 +2393,161 @@ func ListObjectsV2Handler(w http.ResponseWriter, r *http.Request) {
 func ListObjectVersionsMHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: ListObjectVersionsMHandler")
-	// TODO: 实现 List Object Versions with metadata 逻辑
-	w.WriteHeader(http.StatusOK)
+	listObjectVersions(w, r, true)
 }
 
 // ListObjectVersionsHandler 处理 List Object Versions 请求
 func ListObjectVersionsHandler(w http.ResponseWriter, r *http.Request) {
 	// 打印接口名称
 	logger.GetLogger("dedups3").Infof("API called: ListObjectVersionsHandler")
-	// TODO: 实现 List Object Versions 逻辑
-	w.WriteHeader(http.StatusOK)
+	listObjectVersions(w, r, false)
+}
+
+// listObjectVersions 列出对象的所有版本，withMeta 为 true 时附带用户元数据
+func listObjectVersions(w http.ResponseWriter, r *http.Request, withMeta bool) {
+	bucket, _, _, accessKeyID := GetReqVar(r)
+	if err := utils.CheckValidBucketName(bucket); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid bucket name: %s", bucket)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidBucketName)
+		return
+	}
+	query := utils.DecodeQuerys(r.URL.Query())
+	maxkeys := 1000
+	if query.Get("max-keys") != "" {
+		var err error
+		if maxkeys, err = strconv.Atoi(query.Get("max-keys")); err != nil || maxkeys < 0 {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidMaxKeys)
+			return
+		}
+	}
+
+	prefix := query.Get("prefix")
+	keyMarker := query.Get("key-marker")
+	versionIDMarker := query.Get("version-id-marker")
+	delimiter := query.Get("delimiter")
+	encodingType := query.Get("encoding-type")
+	if prefix != "" {
+		if err := utils.CheckValidObjectNamePrefix(prefix); err != nil {
+			logger.GetLogger("dedups3").Errorf("invalid prefix: %s", prefix)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+			return
+		}
+	}
+	// version-id-marker 必须和 key-marker 一起使用
+	if versionIDMarker != "" && keyMarker == "" {
+		logger.GetLogger("dedups3").Errorf("version-id-marker %s without key-marker", versionIDMarker)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
+		return
+	}
+
+	if encodingType != "" {
+		if !strings.EqualFold(encodingType, "url") {
+			logger.GetLogger("dedups3").Errorf("invalid encoding-type: %s", encodingType)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidEncodingMethod)
+			return
+		}
+		encodingType = "url"
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+
+	versions, latest, commonPrefixes, isTruncated, nextKeyMarker, nextVersionIDMarker, err := _os.ListObjectVersions(r.Context(), bucket, accessKeyID, prefix, keyMarker, versionIDMarker, delimiter, maxkeys)
+	if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		return
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("error listing object versions: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+
+	resp := object.ListVersionsResult{
+		XMLName:             xml.Name{Local: "ListVersionsResult"},
+		XMLNS:               "http://s3.amazonaws.com/doc/2006-03-01/",
+		Name:                bucket,
+		Prefix:              prefix,
+		KeyMarker:           keyMarker,
+		VersionIdMarker:     versionIDMarker,
+		NextKeyMarker:       nextKeyMarker,
+		NextVersionIdMarker: nextVersionIDMarker,
+		MaxKeys:             maxkeys,
+		Delimiter:           delimiter,
+		IsTruncated:         isTruncated,
+		EncodingType:        encodingType,
+		Versions:            make([]object.ObjectVersion, 0, len(versions)),
+		DeleteMarkers:       make([]object.DeleteMarkerEntry, 0),
+		CommonPrefixes:      make([]object.CommonPrefix, 0, len(commonPrefixes)),
+	}
+
+	for _, o := range versions {
+		owner := &meta.Owner{
+			ID:          o.Owner.ID,
+			DisplayName: o.Owner.DisplayName,
+		}
+		if o.DeleteMarker {
+			resp.DeleteMarkers = append(resp.DeleteMarkers, object.DeleteMarkerEntry{
+				Key:          o.Key,
+				VersionId:    o.GetVersionID(),
+				IsLatest:     latest[o],
+				LastModified: o.LastModified.UTC(),
+				Owner:        owner,
+			})
+			continue
+		}
+		version := object.ObjectVersion{
+			Key:          o.Key,
+			VersionId:    o.GetVersionID(),
+			IsLatest:     latest[o],
+			LastModified: o.LastModified.UTC(),
+			ETag:         o.ETag,
+			Size:         o.Size,
+			StorageClass: o.StorageClass,
+			Owner:        owner,
+		}
+		if withMeta {
+			version.UserMetadata = o.UserMetadata
+		}
+		resp.Versions = append(resp.Versions, version)
+	}
+
+	for _, cp := range commonPrefixes {
+		resp.CommonPrefixes = append(resp.CommonPrefixes, object.CommonPrefix{
+			Prefix: cp,
+		})
+	}
+
+	// 如果 encoding-type=url，对所有字符串进行 URL 编码
+	if encodingType == "url" {
+		encode := func(s string) string {
+			return url.QueryEscape(s)
+		}
+
+		resp.Prefix = encode(resp.Prefix)
+		resp.KeyMarker = encode(resp.KeyMarker)
+		resp.NextKeyMarker = encode(resp.NextKeyMarker)
+		resp.Delimiter = encode(resp.Delimiter)
+		for i := range resp.Versions {
+			resp.Versions[i].Key = encode(resp.Versions[i].Key)
+		}
+		for i := range resp.DeleteMarkers {
+			resp.DeleteMarkers[i].Key = encode(resp.DeleteMarkers[i].Key)
+		}
+		for i := range resp.CommonPrefixes {
+			resp.CommonPrefixes[i].Prefix = encode(resp.CommonPrefixes[i].Prefix)
+		}
+	}
+
+	xhttp.WriteAWSSuc(w, r, resp)
 }
 
 // RenameObjectHandler 处理 PUT Object rename 请求
@@ -1448,9 +2609,13 @@ func RenameObjectHandler(w http.ResponseWriter, r *http.Request) {
 		SourceIfUnmodifiedSince: sourceIfUnmodifiedSince,
 		SourceIfModifiedSince:   sourceIfModifiedSince,
 		ClientToken:             clientToken,
+		BypassGovernance:        strings.EqualFold(r.Header.Get(xhttp.AmzObjectLockBypassGovernance), "true"),
 	})
 
 	if err != nil {
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
 		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
 			logger.GetLogger("dedups3").Errorf("object %s/%s does not exist", bucket, objectKey)
 			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchKey)
@@ -1460,6 +2625,9 @@ func RenameObjectHandler(w http.ResponseWriter, r *http.Request) {
 		} else if errors.Is(err, xhttp.ToError(xhttp.ErrPreconditionFailed)) {
 			logger.GetLogger("dedups3").Errorf("object %s/%s condition failed", bucket, objectKey)
 			xhttp.WriteAWSErr(w, r, xhttp.ErrPreconditionFailed)
+		} else if errors.Is(err, xhttp.ToError(xhttp.ErrNotImplemented)) {
+			logger.GetLogger("dedups3").Errorf("rename object is not supported in versioned bucket %s", bucket)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNotImplemented)
 		} else {
 			logger.GetLogger("dedups3").Errorf("failed to get object: %v", err)
 			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
@@ -1467,5 +2635,6 @@ func RenameObjectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scheduleReplication(accessKeyID, bucket, objectKey, renameSource)
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,343 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/middleware"
+	"github.com/mageg-x/dedups3/service/object"
+)
+
+const (
+	// maxPostFormSize 文件之前的表单字段总大小上限
+	maxPostFormSize = 20 * 1024
+	// postInlinePeekSize 小于该大小的文件按确定长度上传，可以走元数据内联
+	postInlinePeekSize = 8 * 1024
+)
+
+// PostResponse success_action_status 为 201 时返回的内容
+type PostResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// postFileReader 统计文件大小，并按策略的 content-length-range 限制大小
+type postFileReader struct {
+	r       io.Reader
+	n       int64
+	minSize int64
+	maxSize int64
+	limited bool
+}
+
+func (p *postFileReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if p.limited {
+		if p.n > p.maxSize {
+			return n, xhttp.ToError(xhttp.ErrEntityTooLarge)
+		}
+		if err == io.EOF && p.n < p.minSize {
+			return n, xhttp.ToError(xhttp.ErrEntityTooSmall)
+		}
+	}
+	return n, err
+}
+
+// PostObjectHandler 浏览器表单上传对象，签名和策略都在表单字段中，由本接口自行鉴权
+func PostObjectHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Infof("API called: PostObjectHandler")
+	bucket, _, _, _ := GetReqVar(r)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid multipart form: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedPOSTRequest)
+		return
+	}
+
+	// 读取文件之前的表单字段，文件之后的字段忽略
+	form := make(map[string]string)
+	var filePart *multipart.Part
+	formSize := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to read multipart form: %v", err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedPOSTRequest)
+			return
+		}
+		name := strings.ToLower(part.FormName())
+		if name == "file" {
+			filePart = part
+			break
+		}
+		value, err := io.ReadAll(io.LimitReader(part, int64(maxPostFormSize-formSize+1)))
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to read form field %s: %v", name, err)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedPOSTRequest)
+			return
+		}
+		formSize += len(name) + len(value)
+		if formSize > maxPostFormSize {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrMaxPostPreDataLengthExceededError)
+			return
+		}
+		form[name] = string(value)
+	}
+	if filePart == nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrPOSTFileRequired)
+		return
+	}
+	defer filePart.Close()
+
+	objectKey := form["key"]
+	if objectKey == "" {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrUserKeyMustBeSpecified)
+		return
+	}
+	objectKey = strings.ReplaceAll(objectKey, "${filename}", filePart.FileName())
+	form["key"] = objectKey
+	if err := utils.CheckValidObjectName(objectKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("Invalid object name: %s", objectKey)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidObjectName)
+		return
+	}
+	// 策略条件中的 bucket 指请求的桶
+	if form["bucket"] != "" && form["bucket"] != bucket {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidPolicyDocument)
+		return
+	}
+	form["bucket"] = bucket
+
+	// 校验签名
+	if form["x-amz-algorithm"] != "AWS4-HMAC-SHA256" {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrSignatureVersionNotSupported)
+		return
+	}
+	if form["x-amz-credential"] == "" || form["x-amz-date"] == "" || form["x-amz-signature"] == "" || form["policy"] == "" {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMissingFields)
+		return
+	}
+	ak, code := middleware.VerifyPostSignature(form["x-amz-credential"], form["x-amz-date"], form["policy"], form["x-amz-signature"])
+	if code != xhttp.ErrNone {
+		xhttp.WriteAWSErr(w, r, code)
+		return
+	}
+
+	// 校验策略
+	policyBytes, err := base64.StdEncoding.DecodeString(form["policy"])
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid base64 policy: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedPOSTRequest)
+		return
+	}
+	policy, err := meta.ParsePostPolicy(policyBytes)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid post policy: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedPOSTRequest)
+		return
+	}
+	if err := policy.Check(form, time.Now().UTC()); err != nil {
+		logger.GetLogger("dedups3").Errorf("post policy check failed: %v", err)
+		if errors.Is(err, meta.ErrPostPolicyExpired) {
+			xhttp.WriteAWSError(w, r, "AccessDenied", "Invalid according to Policy: Policy expired.", http.StatusForbidden)
+			return
+		}
+		xhttp.WriteAWSError(w, r, "AccessDenied", "Invalid according to Policy: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 校验写权限
+	allow, code := middleware.IsAllowed(ak.AccessKeyID, ak.AccountID, ak.Username, bucket, objectKey, "s3:PutObject")
+	if !allow {
+		if code == xhttp.ErrNone {
+			code = xhttp.ErrAccessDenied
+		}
+		xhttp.WriteAWSErr(w, r, code)
+		return
+	}
+
+	// 表单字段转换为对象的请求头
+	headers := make(http.Header)
+	for name, value := range form {
+		switch {
+		case name == "x-amz-algorithm" || name == "x-amz-credential" || name == "x-amz-date" || name == "x-amz-signature":
+		case name == "content-type" || name == "cache-control" || name == "content-disposition" ||
+			name == "content-encoding" || name == "content-language" || name == "expires" || strings.HasPrefix(name, "x-amz-"):
+			headers.Set(name, value)
+		}
+	}
+	ct := headers.Get(xhttp.ContentType)
+	if ct == "" {
+		ct = filePart.Header.Get(xhttp.ContentType)
+	}
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	headers.Set(xhttp.ContentType, ct)
+
+	sc := strings.TrimSpace(headers.Get(xhttp.AmzStorageClass))
+	if sc != "" {
+		if err := utils.CheckValidStorageClass(sc); err != nil {
+			logger.GetLogger("dedups3").Errorf("Invalid storage class: %s", sc)
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidStorageClass)
+			return
+		}
+	}
+
+	// 小文件读完后按确定长度上传，大文件长度未知，直接流式切分
+	fr := &postFileReader{r: filePart}
+	fr.minSize, fr.maxSize, fr.limited = policy.ContentLengthRange()
+	peek := make([]byte, postInlinePeekSize)
+	n, err := io.ReadFull(fr, peek)
+	var body io.Reader
+	size := int64(-1)
+	switch {
+	case err == nil:
+		body = io.MultiReader(bytes.NewReader(peek), fr)
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		body = bytes.NewReader(peek[:n])
+		size = int64(n)
+	default:
+		writePostFileErr(w, r, err)
+		return
+	}
+
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("Object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	obj, err := _os.PutObject(body, headers, &object.BaseObjectParams{
+		BucketName:   bucket,
+		ObjKey:       objectKey,
+		ContentType:  ct,
+		ContentLen:   size,
+		AccessKeyID:  ak.AccessKeyID,
+		StorageClass: sc,
+	})
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAdminBucketQuotaExceeded)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+			return
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+			return
+		}
+		if writeObjectLockErr(w, r, err) {
+			return
+		}
+		if writeSSEErr(w, r, err) {
+			return
+		}
+		writePostFileErr(w, r, err)
+		return
+	}
+	scheduleReplication(ak.AccessKeyID, bucket, objectKey)
+
+	etag := fmt.Sprintf("\"%s\"", obj.ETag)
+	w.Header().Set(xhttp.ETag, etag)
+	if obj.VersionID != "" {
+		w.Header().Set(xhttp.AmzVersionID, obj.VersionID)
+	}
+	setObjectSSEHeaders(w, obj)
+	setSSECHeaders(w, headers)
+
+	// 优先跳转到 success_action_redirect，并带上桶、对象和 ETag
+	if redirect := form["success_action_redirect"]; redirect != "" {
+		if u, err := url.Parse(redirect); err == nil && u.Scheme != "" {
+			query := u.Query()
+			query.Set("bucket", bucket)
+			query.Set("key", objectKey)
+			query.Set("etag", etag)
+			u.RawQuery = query.Encode()
+			http.Redirect(w, r, u.String(), http.StatusSeeOther)
+			return
+		}
+		logger.GetLogger("dedups3").Warnf("invalid success_action_redirect %s", redirect)
+	}
+
+	status, _ := strconv.Atoi(form["success_action_status"])
+	switch status {
+	case http.StatusOK:
+		w.WriteHeader(http.StatusOK)
+	case http.StatusCreated:
+		location := websiteProtocol(r) + "://" + r.Host + r.URL.Path
+		if !strings.HasSuffix(location, "/") {
+			location += "/"
+		}
+		location += utils.EncodePath(objectKey)
+		w.Header().Set(xhttp.Location, location)
+		w.Header().Set(xhttp.ContentType, "application/xml")
+		w.Header().Set(xhttp.AmzRequestID, xhttp.GetRequestID(r.Context()))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(xml.Header))
+		if err := xml.NewEncoder(w).Encode(PostResponse{
+			Location: location,
+			Bucket:   bucket,
+			Key:      objectKey,
+			ETag:     etag,
+		}); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to write post response: %v", err)
+		}
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writePostFileErr 文件大小不满足策略时返回对应的错误
+func writePostFileErr(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, xhttp.ToError(xhttp.ErrEntityTooLarge)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrEntityTooLarge)
+		return
+	}
+	if errors.Is(err, xhttp.ToError(xhttp.ErrEntityTooSmall)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrEntityTooSmall)
+		return
+	}
+	logger.GetLogger("dedups3").Errorf("Error posting object: %s", err)
+	xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/bucket"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/object"
+	"github.com/mageg-x/dedups3/service/site"
+)
+
+// prepare4Site 校验站点复制请求的调用者，返回调用者的密钥
+func prepare4Site(w http.ResponseWriter, r *http.Request) (string, bool) {
+	accessKeyID, ok := r.Context().Value("accesskey").(string)
+	if !ok || accessKeyID == "" {
+		logger.GetLogger("dedups3").Errorf("site request without access key")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		return "", false
+	}
+	if err := site.Authorize(accessKeyID); err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+		} else {
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		}
+		return "", false
+	}
+	return accessKeyID, true
+}
+
+// writeSiteJSON 返回站点复制接口的 JSON 响应
+func writeSiteJSON(w http.ResponseWriter, r *http.Request, data any) {
+	w.Header().Set(xhttp.ContentType, "application/json")
+	w.Header().Set(xhttp.AmzRequestID, xhttp.GetRequestID(r.Context()))
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to write site response: %v", err)
+	}
+}
+
+// writeSiteErr 把站点复制接口的错误映射为 S3 错误
+func writeSiteErr(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)):
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+	case errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)):
+		xhttp.WriteAWSErr(w, r, xhttp.ErrAccessDenied)
+	case errors.Is(err, xhttp.ToError(xhttp.ErrInvalidStorageClass)):
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidStorageClass)
+	case errors.Is(err, chunk.ErrChunkMissing), errors.Is(err, site.ErrChunkHashMismatch):
+		// 发送端重新查询缺少的chunk后重试
+		xhttp.WriteAWSErr(w, r, xhttp.ErrPreconditionFailed)
+	default:
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+	}
+}
+
+// SiteCheckChunksHandler 返回本站点缺少的chunk
+func SiteCheckChunksHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: SiteCheckChunksHandler")
+	if _, ok := prepare4Site(w, r); !ok {
+		return
+	}
+	var req site.CheckChunksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode check chunks request: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedJSON)
+		return
+	}
+
+	objSvc := object.GetObjectService()
+	cs := chunk.GetChunkService()
+	if objSvc == nil || cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get object or chunk service")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	storageID, err := objSvc.GetStorageID(req.StorageClass)
+	if err != nil {
+		writeSiteErr(w, r, err)
+		return
+	}
+	missing, err := cs.MissingChunks(storageID, req.Hashes)
+	if err != nil {
+		writeSiteErr(w, r, err)
+		return
+	}
+	logger.GetLogger("dedups3").Debugf("site check %d chunks, %d missing", len(req.Hashes), len(missing))
+	writeSiteJSON(w, r, &site.CheckChunksResponse{Missing: missing})
+}
+
+// SitePutObjectHandler 写入对端复制过来的对象
+func SitePutObjectHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: SitePutObjectHandler")
+	if _, ok := prepare4Site(w, r); !ok {
+		return
+	}
+	header, err := site.ReadObjectHeader(r.Body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to read site object header: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidRequest)
+		return
+	}
+
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get object service")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	obj := header.Object
+	err = objSvc.PutReplica(header.AccountID, obj, site.NewChunkReader(r.Body, obj.Chunks, obj.DedupScope))
+	if errors.Is(err, chunk.ErrReplicaStale) {
+		writeSiteJSON(w, r, &site.ApplyResponse{Applied: false})
+		return
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to put site object %s/%s: %v", obj.Bucket, obj.Key, err)
+		writeSiteErr(w, r, err)
+		return
+	}
+	writeSiteJSON(w, r, &site.ApplyResponse{Applied: true})
+}
+
+// SiteDeleteObjectHandler 同步删除对象
+func SiteDeleteObjectHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: SiteDeleteObjectHandler")
+	if _, ok := prepare4Site(w, r); !ok {
+		return
+	}
+	var req site.DeleteObjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode site delete request: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedJSON)
+		return
+	}
+
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get object service")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	applied, err := objSvc.DeleteReplica(req.AccountID, req.Bucket, req.Key, req.DeletedAt)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to delete site object %s/%s: %v", req.Bucket, req.Key, err)
+		writeSiteErr(w, r, err)
+		return
+	}
+	writeSiteJSON(w, r, &site.ApplyResponse{Applied: applied})
+}
+
+// SitePutBucketHandler 同步桶配置
+func SitePutBucketHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: SitePutBucketHandler")
+	if _, ok := prepare4Site(w, r); !ok {
+		return
+	}
+	var bm meta.BucketMetadata
+	if err := json.NewDecoder(r.Body).Decode(&bm); err != nil || bm.Name == "" || bm.Owner.ID == "" {
+		logger.GetLogger("dedups3").Errorf("failed to decode site bucket: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedJSON)
+		return
+	}
+
+	bs := bucket.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket service")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	applied, err := bs.ApplySiteBucket(&bm)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to apply site bucket %s: %v", bm.Name, err)
+		writeSiteErr(w, r, err)
+		return
+	}
+	writeSiteJSON(w, r, &site.ApplyResponse{Applied: applied})
+}
+
+// SitePutIamHandler 同步 IAM 数据
+func SitePutIamHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: SitePutIamHandler")
+	accessKeyID, ok := prepare4Site(w, r)
+	if !ok {
+		return
+	}
+	var snapshot iam.IamSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decode site iam snapshot: %v", err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedJSON)
+		return
+	}
+
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	applied, err := iamService.ImportSnapshot(&snapshot, accessKeyID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to import site iam snapshot: %v", err)
+		writeSiteErr(w, r, err)
+		return
+	}
+	writeSiteJSON(w, r, &site.ApplyResponse{Applied: applied})
+}
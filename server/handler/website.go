@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/bucket"
+	"github.com/mageg-x/dedups3/service/object"
+)
+
+// WebsiteHandler 静态网站访问入口，以匿名身份读取桶内对象
+func WebsiteHandler(w http.ResponseWriter, r *http.Request) {
+	logger.GetLogger("dedups3").Debugf("API called: WebsiteHandler")
+	bucketName := mux.Vars(r)["bucket"]
+	key := strings.TrimPrefix(r.URL.Path, "/")
+
+	bs := bucket.GetBucketService()
+	_os := object.GetObjectService()
+	if bs == nil || _os == nil {
+		logger.GetLogger("dedups3").Errorf("bucket or object service not initialized")
+		xhttp.WriteAWSErr(w, r, xhttp.ErrServerNotInitialized)
+		return
+	}
+	// 网站请求没有签名，通过桶名全局索引确定桶所属的账户
+	bm, err := bs.LookupBucket(bucketName)
+	if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchBucket)
+		return
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to lookup bucket %s: %v", bucketName, err)
+		xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
+		return
+	}
+	website := bm.Website
+	if website == nil {
+		xhttp.WriteAWSErr(w, r, xhttp.ErrNoSuchWebsiteConfiguration)
+		return
+	}
+
+	protocol := websiteProtocol(r)
+	if redirect := website.RedirectAllRequestsTo; redirect != nil {
+		if redirect.Protocol != "" {
+			protocol = redirect.Protocol
+		}
+		http.Redirect(w, r, protocol+"://"+redirect.HostName+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+
+	// 目录请求返回索引文档
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += website.IndexDocument.Suffix
+	}
+	if rule := website.MatchRoutingRule(key, 0); rule != nil {
+		location, code := rule.Location(key, r.Host, protocol)
+		http.Redirect(w, r, location, code)
+		return
+	}
+
+	code := serveWebsiteObject(w, r, bm, key, http.StatusOK)
+	if code == http.StatusOK {
+		return
+	}
+
+	// 没有以 / 结尾的目录请求，如果目录下存在索引文档则重定向到目录
+	if code == http.StatusNotFound && !strings.HasSuffix(key, website.IndexDocument.Suffix) {
+		indexKey := key + "/" + website.IndexDocument.Suffix
+		if obj, _, err := _os.GetWebsiteObject(bm.Owner.ID, bm.Name, indexKey, nil, false); err == nil && obj != nil {
+			http.Redirect(w, r, "/"+key+"/", http.StatusFound)
+			return
+		}
+	}
+
+	if rule := website.MatchRoutingRule(key, code); rule != nil {
+		location, redirectCode := rule.Location(key, r.Host, protocol)
+		http.Redirect(w, r, location, redirectCode)
+		return
+	}
+	// 返回自定义错误文档，错误文档本身不可读时返回默认错误页
+	if website.ErrorDocument != nil && website.ErrorDocument.Key != key {
+		if serveWebsiteObject(w, r, bm, website.ErrorDocument.Key, code) == http.StatusOK {
+			return
+		}
+	}
+	writeWebsiteError(w, r, code)
+}
+
+// serveWebsiteObject 返回对象内容，status 为成功时使用的状态码，返回 200 表示已经写出响应，否则返回错误状态码
+func serveWebsiteObject(w http.ResponseWriter, r *http.Request, bm *meta.BucketMetadata, key string, status int) int {
+	// 静态网站只能访问桶策略公开的对象
+	if !bm.Policy.IsPublicAllowed("s3:GetObject", meta.BuildResourceARN(bm.Name, key), nil) {
+		return http.StatusForbidden
+	}
+
+	var rangeHead *xhttp.HTTPRangeSpec
+	if status == http.StatusOK {
+		if rangeHeadStr := r.Header.Get(xhttp.Range); rangeHeadStr != "" {
+			if rng, err := xhttp.ParseRequestRangeSpec(rangeHeadStr); err == nil {
+				rangeHead = rng
+			}
+		}
+	}
+
+	_os := object.GetObjectService()
+	withData := r.Method != http.MethodHead
+	obj, reader, err := _os.GetWebsiteObject(bm.Owner.ID, bm.Name, key, rangeHead, withData)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchKey)) {
+			return http.StatusNotFound
+		}
+		if errors.Is(err, xhttp.ToError(xhttp.ErrInvalidRange)) {
+			return http.StatusRequestedRangeNotSatisfiable
+		}
+		logger.GetLogger("dedups3").Errorf("failed to read website object %s/%s: %v", bm.Name, key, err)
+		return http.StatusInternalServerError
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	w.Header().Set(xhttp.AcceptRanges, "bytes")
+	w.Header().Set(xhttp.ContentType, obj.ContentType)
+	w.Header().Set(xhttp.ETag, fmt.Sprintf("\"%s\"", obj.ETag))
+	w.Header().Set(xhttp.LastModified, obj.LastModified.Format(http.TimeFormat))
+	if obj.ContentEncoding != "" {
+		w.Header().Set(xhttp.ContentEncoding, obj.ContentEncoding)
+	}
+	if obj.ContentLanguage != "" {
+		w.Header().Set(xhttp.ContentLanguage, obj.ContentLanguage)
+	}
+	if obj.ContentDisposition != "" {
+		w.Header().Set(xhttp.ContentDisposition, obj.ContentDisposition)
+	}
+	if obj.CacheControl != "" {
+		w.Header().Set(xhttp.CacheControl, obj.CacheControl)
+	}
+	if rangeHead != nil {
+		start, length, _ := rangeHead.GetOffsetLength(obj.Size)
+		w.Header().Set(xhttp.ContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, obj.Size))
+		w.Header().Set(xhttp.ContentLength, strconv.FormatInt(length, 10))
+		status = http.StatusPartialContent
+	} else {
+		w.Header().Set(xhttp.ContentLength, strconv.FormatInt(obj.Size, 10))
+	}
+	w.WriteHeader(status)
+
+	if reader != nil {
+		if _, err := io.Copy(w, reader); err != nil {
+			logger.GetLogger("dedups3").Infof("write website object %s/%s failed: %v", bm.Name, key, err)
+		}
+	}
+	return http.StatusOK
+}
+
+// websiteProtocol 当前请求使用的协议，支持反向代理设置的 X-Forwarded-Proto
+func websiteProtocol(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// writeWebsiteError 返回默认的 HTML 错误页
+func writeWebsiteError(w http.ResponseWriter, r *http.Request, code int) {
+	apiCode := xhttp.ErrInternalError
+	switch code {
+	case http.StatusNotFound:
+		apiCode = xhttp.ErrNoSuchKey
+	case http.StatusForbidden:
+		apiCode = xhttp.ErrAccessDenied
+	case http.StatusRequestedRangeNotSatisfiable:
+		apiCode = xhttp.ErrInvalidRange
+	}
+	apiErr := xhttp.ToApiErr(apiCode)
+	w.Header().Set(xhttp.ContentType, "text/html; charset=utf-8")
+	w.Header().Set(xhttp.AmzRequestID, xhttp.GetRequestID(r.Context()))
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintf(w, "<html>\n<head><title>%d %s</title></head>\n<body>\n<h1>%d %s</h1>\n<ul>\n<li>Code: %s</li>\n<li>Message: %s</li>\n<li>RequestId: %s</li>\n</ul>\n</body>\n</html>\n",
+		code, http.StatusText(code), code, http.StatusText(code),
+		html.EscapeString(apiErr.Code), html.EscapeString(apiErr.Description), html.EscapeString(xhttp.GetRequestID(r.Context())))
+}
@@ -0,0 +1,380 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package checksum
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"strings"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+)
+
+// 支持的校验和算法
+const (
+	CRC32     = "CRC32"
+	CRC32C    = "CRC32C"
+	SHA1      = "SHA1"
+	SHA256    = "SHA256"
+	CRC64NVME = "CRC64NVME"
+)
+
+var (
+	algorithms = []string{CRC32, CRC32C, SHA1, SHA256, CRC64NVME}
+
+	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+	// CRC64NVME 的反射多项式
+	crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+)
+
+// Spec 请求中声明的校验和
+// Value 为空时只计算不校验；Trailer 不为空时期望值在 aws-chunked 的 trailer 里，读完数据后才能拿到
+type Spec struct {
+	Algorithm string
+	Value     string
+	Trailer   string
+	trailers  http.Header
+}
+
+// Valid 是否是支持的算法
+func Valid(algo string) bool {
+	for _, a := range algorithms {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize 算法名统一为大写
+func Normalize(algo string) string {
+	return strings.ToUpper(strings.TrimSpace(algo))
+}
+
+// IsCRC CRC 类的算法可以把分段的值合并为整个对象的值
+func IsCRC(algo string) bool {
+	return algo == CRC32 || algo == CRC32C || algo == CRC64NVME
+}
+
+// HeaderKey 算法对应的请求和应答头
+func HeaderKey(algo string) string {
+	return "x-amz-checksum-" + strings.ToLower(algo)
+}
+
+// NewHash 创建算法对应的哈希器，不支持的算法返回 nil
+func NewHash(algo string) hash.Hash {
+	switch algo {
+	case CRC32:
+		return crc32.NewIEEE()
+	case CRC32C:
+		return crc32.New(crc32cTable)
+	case SHA1:
+		return sha1.New()
+	case SHA256:
+		return sha256.New()
+	case CRC64NVME:
+		return crc64.New(crc64NVMETable)
+	}
+	return nil
+}
+
+// decode 解码 base64 的校验和，并检查长度
+func decode(algo, value string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if h := NewHash(algo); h == nil || len(raw) != h.Size() {
+		return nil, fmt.Errorf("invalid %s checksum length %d", algo, len(raw))
+	}
+	return raw, nil
+}
+
+// FromRequest 解析请求头中的校验和，trailer 为 aws-chunked 解码时填充的 trailer
+// 请求没有带校验和时返回 nil；只声明了算法时只计算不校验
+func FromRequest(headers, trailer http.Header) (*Spec, error) {
+	algo := Normalize(headers.Get(xhttp.AmzSdkChecksumAlgo))
+	if algo == "" {
+		algo = Normalize(headers.Get(xhttp.AmzChecksumAlgo))
+	}
+	if algo != "" && !Valid(algo) {
+		logger.GetLogger("dedups3").Errorf("invalid checksum algorithm %s", algo)
+		return nil, xhttp.ToError(xhttp.ErrInvalidChecksum)
+	}
+
+	var spec *Spec
+	for _, a := range algorithms {
+		value := headers.Get(HeaderKey(a))
+		if value == "" {
+			continue
+		}
+		if spec != nil {
+			logger.GetLogger("dedups3").Errorf("multiple checksum headers %s %s", spec.Algorithm, a)
+			return nil, xhttp.ToError(xhttp.ErrInvalidChecksum)
+		}
+		if _, err := decode(a, value); err != nil {
+			logger.GetLogger("dedups3").Errorf("invalid checksum header %s: %v", HeaderKey(a), err)
+			return nil, xhttp.ToError(xhttp.ErrInvalidChecksum)
+		}
+		spec = &Spec{Algorithm: a, Value: value}
+	}
+	for _, names := range headers.Values(xhttp.AmzTrailer) {
+		for _, name := range strings.Split(names, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !strings.HasPrefix(name, "x-amz-checksum-") {
+				continue
+			}
+			a := Normalize(strings.TrimPrefix(name, "x-amz-checksum-"))
+			if !Valid(a) || spec != nil {
+				logger.GetLogger("dedups3").Errorf("invalid checksum trailer %s", name)
+				return nil, xhttp.ToError(xhttp.ErrInvalidChecksum)
+			}
+			spec = &Spec{Algorithm: a, Trailer: name, trailers: trailer}
+		}
+	}
+
+	if spec == nil {
+		if algo == "" {
+			return nil, nil
+		}
+		return &Spec{Algorithm: algo}, nil
+	}
+	if algo != "" && algo != spec.Algorithm {
+		logger.GetLogger("dedups3").Errorf("checksum algorithm %s not match %s", algo, spec.Algorithm)
+		return nil, xhttp.ToError(xhttp.ErrInvalidChecksum)
+	}
+	return spec, nil
+}
+
+// expected 期望的校验和，trailer 中的值在读完数据后才有
+func (s *Spec) expected() string {
+	if s.Trailer != "" && s.trailers != nil {
+		return s.trailers.Get(s.Trailer)
+	}
+	return s.Value
+}
+
+// Reader 一边读一边计算校验和，读到 EOF 时和期望值比较，不一致返回 BadDigest
+type Reader struct {
+	r    io.Reader
+	spec *Spec
+	hash hash.Hash
+	size int64
+	err  error
+}
+
+// NewReader spec 为 nil 时只透传数据
+func NewReader(r io.Reader, spec *Spec) *Reader {
+	cr := &Reader{r: r, spec: spec}
+	if spec != nil {
+		cr.hash = NewHash(spec.Algorithm)
+	}
+	return cr
+}
+
+func (cr *Reader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if cr.hash != nil && n > 0 {
+		cr.hash.Write(p[:n])
+	}
+	cr.size += int64(n)
+	if err == io.EOF {
+		if e := cr.Verify(); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// Sum 当前已读数据的校验和，base64 编码
+func (cr *Reader) Sum() string {
+	if cr.hash == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(cr.hash.Sum(nil))
+}
+
+// Verify 比较已读数据的校验和和期望值，数据读完后调用
+func (cr *Reader) Verify() error {
+	if cr.err != nil || cr.spec == nil {
+		return cr.err
+	}
+	want, got := cr.spec.expected(), cr.Sum()
+	if want != "" && want != got {
+		logger.GetLogger("dedups3").Errorf("%s checksum mismatch: %s:%s", cr.spec.Algorithm, want, got)
+		cr.err = fmt.Errorf("%w: %s checksum mismatch", xhttp.ToError(xhttp.ErrBadDigest), cr.spec.Algorithm)
+	}
+	return cr.err
+}
+
+// Err 校验失败的错误
+func (cr *Reader) Err() error {
+	return cr.err
+}
+
+// Checksum 整个数据的校验和，请求没有带校验和时返回 nil
+func (cr *Reader) Checksum() *meta.Checksum {
+	if cr.hash == nil {
+		return nil
+	}
+	return &meta.Checksum{Algorithm: cr.spec.Algorithm, Type: xhttp.AmzChecksumTypeFullObject, Value: cr.Sum()}
+}
+
+// Size 已读数据的字节数
+func (cr *Reader) Size() int64 {
+	return cr.size
+}
+
+// Composite 各分段校验和的原始字节拼接后再计算一次，结果带上分段数
+func Composite(algo string, parts []string) (string, error) {
+	h := NewHash(algo)
+	if h == nil {
+		return "", fmt.Errorf("unsupported checksum algorithm %s", algo)
+	}
+	for _, part := range parts {
+		raw, err := decode(algo, part)
+		if err != nil {
+			return "", err
+		}
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts)), nil
+}
+
+// Combine 把两段连续数据的 CRC 合并为整段数据的 CRC，size2 为第二段数据的字节数
+func Combine(algo, crc1, crc2 string, size2 int64) (string, error) {
+	poly, width := crcPoly(algo)
+	if width == 0 {
+		return "", fmt.Errorf("checksum algorithm %s can not be combined", algo)
+	}
+	raw1, err := decode(algo, crc1)
+	if err != nil {
+		return "", err
+	}
+	raw2, err := decode(algo, crc2)
+	if err != nil {
+		return "", err
+	}
+	sum := combineCRC(poly, width, toUint(raw1), toUint(raw2), size2)
+	out := make([]byte, width/8)
+	if width == 32 {
+		binary.BigEndian.PutUint32(out, uint32(sum))
+	} else {
+		binary.BigEndian.PutUint64(out, sum)
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// FullObject 把各分段的 CRC 合并为整个对象的 CRC
+func FullObject(algo string, parts []string, sizes []int64) (string, error) {
+	if len(parts) == 0 || len(parts) != len(sizes) {
+		return "", fmt.Errorf("invalid parts %d:%d", len(parts), len(sizes))
+	}
+	sum := parts[0]
+	for i := 1; i < len(parts); i++ {
+		var err error
+		if sum, err = Combine(algo, sum, parts[i], sizes[i]); err != nil {
+			return "", err
+		}
+	}
+	return sum, nil
+}
+
+// crcPoly CRC 算法的反射多项式和位宽，非 CRC 算法位宽为 0
+func crcPoly(algo string) (uint64, int) {
+	switch algo {
+	case CRC32:
+		return crc32.IEEE, 32
+	case CRC32C:
+		return crc32.Castagnoli, 32
+	case CRC64NVME:
+		return 0x9a6c9329ac4bc9b5, 64
+	}
+	return 0, 0
+}
+
+func toUint(raw []byte) uint64 {
+	if len(raw) == 4 {
+		return uint64(binary.BigEndian.Uint32(raw))
+	}
+	return binary.BigEndian.Uint64(raw)
+}
+
+// combineCRC 和 zlib 的 crc32_combine 一样，在 GF(2) 上把 crc1 移过 len2 个零字节后和 crc2 异或
+func combineCRC(poly uint64, width int, crc1, crc2 uint64, len2 int64) uint64 {
+	if len2 <= 0 {
+		return crc1
+	}
+	even := make([]uint64, width)
+	odd := make([]uint64, width)
+	// 移动一位的算子
+	odd[0] = poly
+	row := uint64(1)
+	for n := 1; n < width; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	// 移动两位、四位的算子
+	gf2Square(even, odd)
+	gf2Square(odd, even)
+	for {
+		// 每轮算子平方一次，对应 len2 的一个二进制位
+		gf2Square(even, odd)
+		if len2&1 != 0 {
+			crc1 = gf2Times(even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2Square(odd, even)
+		if len2&1 != 0 {
+			crc1 = gf2Times(odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2Times(mat []uint64, vec uint64) uint64 {
+	var sum uint64
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2Square(square, mat []uint64) {
+	for n := range mat {
+		square[n] = gf2Times(mat, mat[n])
+	}
+}
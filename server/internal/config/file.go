@@ -239,6 +239,9 @@ type ServerConfig struct {
 	SendBufSize         int           `mapstructure:"send_buf_size" json:"sendBufSize" env:"DEDUPS3_SERVER_SEND_BUF_SIZE" default:"8388608"`
 	RecvBufSize         int           `mapstructure:"recv_buf_size" json:"recvBufSize" env:"DEDUPS3_SERVER_RECV_BUF_SIZE" default:"8388608"`
 	Domains             []string      `mapstructure:"domains" json:"domains" env:"DEDUPS3_DOMAINS" `
+	WebsiteDomains      []string      `mapstructure:"website_domains" json:"websiteDomains" env:"DEDUPS3_WEBSITE_DOMAINS" `                              // 静态网站访问的域名，{bucket}.{domain}
+	BlockPublicAccess   bool          `mapstructure:"block_public_access" json:"blockPublicAccess" env:"DEDUPS3_BLOCK_PUBLIC_ACCESS" default:"false"`    // 禁止所有匿名访问
+	MaxExtractSize      int64         `mapstructure:"max_extract_size" json:"maxExtractSize" env:"DEDUPS3_SERVER_MAX_EXTRACT_SIZE" default:"5368709120"` // 自动解压上传的 zip 压缩包需要先落盘，限制其大小
 }
 
 // LogConfig represents log configuration
@@ -258,6 +261,8 @@ type BlockConfig struct {
 	MaxSize          int           `mapstructure:"max_size" json:"maxSize" env:"DEDUPS3_BLOCK_MAX_SIZE" default:"67108864"`
 	MaxHeadSize      int           `mapstructure:"max_head_size" json:"maxHeadSize" env:"DEDUPS3_BLOCK_MAX_HEAD_SIZE" default:"204800"`
 	CacheSize        int           `mapstructure:"cache_size" json:"cacheSize" env:"DEDUPS3_BLOCK_CACHE_SIZE" default:"2147483648"`
+	SegmentSize      int           `mapstructure:"segment_size" json:"segmentSize" env:"DEDUPS3_BLOCK_SEGMENT_SIZE" default:"262144"` // 块内独立压缩加密的分段大小，0 表示整块压缩加密
+	PrefetchNum      int           `mapstructure:"prefetch_num" json:"prefetchNum" env:"DEDUPS3_BLOCK_PREFETCH_NUM" default:"4"`      // 读对象时并发预读的块数
 }
 
 type NodeConfig struct {
@@ -266,6 +271,32 @@ type NodeConfig struct {
 	Region    string `mapstructure:"region" json:"region" env:"DEDUPS3_REGION" default:"us-east-1"`
 }
 
+// SitePeerConfig 站点复制的对端集群
+type SitePeerConfig struct {
+	Name      string `mapstructure:"name" json:"name"`
+	Endpoint  string `mapstructure:"endpoint" json:"endpoint"`
+	Region    string `mapstructure:"region" json:"region" default:"us-east-1"`
+	AccessKey string `mapstructure:"access_key" json:"accessKey"` // 对端管理账户根用户的密钥
+	SecretKey string `mapstructure:"secret_key" json:"secretKey"`
+}
+
+// SiteConfig 集群间站点复制配置，没有对端时不启用
+type SiteConfig struct {
+	Name         string           `mapstructure:"name" json:"name" env:"DEDUPS3_SITE_NAME"`
+	Workers      int              `mapstructure:"workers" json:"workers" env:"DEDUPS3_SITE_WORKERS" default:"4"`
+	SyncInterval time.Duration    `mapstructure:"sync_interval" json:"syncInterval" env:"DEDUPS3_SITE_SYNC_INTERVAL" default:"30s"`
+	Peers        []SitePeerConfig `mapstructure:"peers" json:"peers"`
+}
+
+// KMSConfig 块加密的主密钥配置，主密钥格式为 keyID:base64(32 字节)
+// 优先级：环境变量 DEDUPS3_KMS_MASTER_KEY > master_key_file > master_key
+type KMSConfig struct {
+	MasterKey      string        `mapstructure:"master_key" json:"-"`
+	MasterKeyFile  string        `mapstructure:"master_key_file" json:"masterKeyFile" env:"DEDUPS3_KMS_MASTER_KEY_FILE"`
+	OldMasterKeys  []string      `mapstructure:"old_master_keys" json:"-"` // 轮换下来的旧主密钥，只用于解开旧的数据密钥
+	RewrapInterval time.Duration `mapstructure:"rewrap_interval" json:"rewrapInterval" env:"DEDUPS3_KMS_REWRAP_INTERVAL" default:"1h"`
+}
+
 type PlugConfig struct {
 	Driver    string `mapstructure:"driver" json:"driver"  default:"sqlite"`
 	DSN       string `mapstructure:"dsn" json:"dsn"  default:"./data/sqlite/dedups3.db"`
@@ -283,6 +314,8 @@ type Config struct {
 	Conf   PlugConfig       `mapstructure:"config" json:"config"`
 	Audit  PlugConfig       `mapstructure:"audit" json:"audit"`
 	Event  PlugConfig       `mapstructure:"event" json:"event"`
+	Site   SiteConfig       `mapstructure:"site" json:"site"`
+	KMS    KMSConfig        `mapstructure:"kms" json:"kms"`
 }
 
 // DefaultConfig 创建带默认值的配置实例
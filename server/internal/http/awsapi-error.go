@@ -102,6 +102,7 @@ const (
 	ErrInvalidCopyDest
 	ErrInvalidPolicyDocument
 	ErrInvalidObjectState
+	ErrInvalidWriteOffset
 	ErrMalformedXML
 	ErrMissingContentLength
 	ErrMissingContentMD5
@@ -692,6 +693,11 @@ var errorCodes = errorCodeMap{
 		Description:    "The operation is not valid for the current state of the object.",
 		HTTPStatusCode: http.StatusForbidden,
 	},
+	ErrInvalidWriteOffset: {
+		Code:           "InvalidWriteOffset",
+		Description:    "The write offset value that you specified does not match the current object size.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
 	ErrInvalidPayer: {
 		Code:           "InvalidPayer",
 		Description:    "All access to this object has been disabled. For further assistance, see Contact Us.",
@@ -2177,7 +2183,7 @@ var errorCodes = errorCodeMap{
 	},
 	ErrInvalidCompressionFormat: {
 		Code:           "InvalidCompressionFormat",
-		Description:    "The file is not in a supported compression format. Only GZIP is supported at this time.",
+		Description:    "The file is not in a supported compression format. Only GZIP and BZIP2 are supported at this time.",
 		HTTPStatusCode: http.StatusBadRequest,
 	},
 	ErrInvalidFileHeaderInfo: {
@@ -2417,7 +2423,7 @@ var errorCodes = errorCodeMap{
 	},
 	ErrParseSelectMissingFrom: {
 		Code:           "ParseSelectMissingFrom",
-		Description:    "GROUP is not supported in the SQL expression.",
+		Description:    "The SQL expression contains a missing FROM after SELECT list.",
 		HTTPStatusCode: http.StatusBadRequest,
 	},
 	ErrParseExpectedIdentForGroupName: {
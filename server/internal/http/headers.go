@@ -41,6 +41,20 @@ const (
 	Range              = "Range"
 )
 
+// CORS related
+const (
+	Origin                        = "Origin"
+	Vary                          = "Vary"
+	AccessControlRequestMethod    = "Access-Control-Request-Method"
+	AccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	AccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	AccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	AccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	AccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	AccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	AccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
 // Non standard S3 HTTP response constants
 const (
 	XCache       = "X-Cache"
@@ -156,6 +170,7 @@ const (
 
 	// Content Checksums
 	AmzChecksumAlgo           = "x-amz-checksum-algorithm"
+	AmzSdkChecksumAlgo        = "x-amz-sdk-checksum-algorithm"
 	AmzChecksumCRC32          = "x-amz-checksum-crc32"
 	AmzChecksumCRC32C         = "x-amz-checksum-crc32c"
 	AmzChecksumSHA1           = "x-amz-checksum-sha1"
@@ -18,6 +18,7 @@ package http
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"net/http"
 )
@@ -72,3 +73,21 @@ func (rw *RespWriter) Flush() {
 		flusher.Flush()
 	}
 }
+
+// ReadFrom implements io.ReaderFrom so that io.Copy from a file can use sendfile
+func (rw *RespWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, src)
+	}
+	rw.bytes += n
+	return n, err
+}
+
+// writerOnly hides the ReadFrom method to avoid io.Copy recursion
+type writerOnly struct {
+	io.Writer
+}
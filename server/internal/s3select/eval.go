@@ -0,0 +1,563 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+)
+
+// expr 可以在一条记录上求值的表达式
+type expr interface {
+	eval(rec record) (Value, error)
+}
+
+type literalExpr struct {
+	v Value
+}
+
+func (e *literalExpr) eval(record) (Value, error) {
+	return e.v, nil
+}
+
+// columnExpr 列引用，聚合结果求值时记录为空
+type columnExpr struct {
+	path []pathElem
+}
+
+func (e *columnExpr) eval(rec record) (Value, error) {
+	if rec == nil {
+		return nullValue, nil
+	}
+	return rec.get(e.path), nil
+}
+
+// logicExpr AND/OR，按 SQL 的三值逻辑处理 NULL
+type logicExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e *logicExpr) eval(rec record) (Value, error) {
+	lv, err := e.l.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	lb, lok := lv.toBool()
+	// 短路求值
+	if lok && ((e.op == "AND" && !lb) || (e.op == "OR" && lb)) {
+		return boolValue(lb), nil
+	}
+	rv, err := e.r.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	rb, rok := rv.toBool()
+	if rok && ((e.op == "AND" && !rb) || (e.op == "OR" && rb)) {
+		return boolValue(rb), nil
+	}
+	if !lok || !rok {
+		return nullValue, nil
+	}
+	return boolValue(rb), nil
+}
+
+type notExpr struct {
+	x expr
+}
+
+func (e *notExpr) eval(rec record) (Value, error) {
+	v, err := e.x.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	b, ok := v.toBool()
+	if !ok {
+		return nullValue, nil
+	}
+	return boolValue(!b), nil
+}
+
+type compareExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e *compareExpr) eval(rec record) (Value, error) {
+	lv, err := e.l.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	rv, err := e.r.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	c, ok := compareValues(lv, rv)
+	if !ok {
+		return nullValue, nil
+	}
+	switch e.op {
+	case "=":
+		return boolValue(c == 0), nil
+	case "!=", "<>":
+		return boolValue(c != 0), nil
+	case "<":
+		return boolValue(c < 0), nil
+	case "<=":
+		return boolValue(c <= 0), nil
+	case ">":
+		return boolValue(c > 0), nil
+	default:
+		return boolValue(c >= 0), nil
+	}
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+func (e *isNullExpr) eval(rec record) (Value, error) {
+	v, err := e.x.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	return boolValue(v.IsNull() != e.not), nil
+}
+
+type betweenExpr struct {
+	x, lo, hi expr
+	not       bool
+}
+
+func (e *betweenExpr) eval(rec record) (Value, error) {
+	v, err := e.x.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	lo, err := e.lo.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	hi, err := e.hi.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	c1, ok1 := compareValues(v, lo)
+	c2, ok2 := compareValues(v, hi)
+	if !ok1 || !ok2 {
+		return nullValue, nil
+	}
+	return boolValue((c1 >= 0 && c2 <= 0) != e.not), nil
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+func (e *inExpr) eval(rec record) (Value, error) {
+	v, err := e.x.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if v.IsNull() {
+		return nullValue, nil
+	}
+	unknown := false
+	for _, item := range e.list {
+		iv, err := item.eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		c, ok := compareValues(v, iv)
+		if !ok {
+			unknown = true
+			continue
+		}
+		if c == 0 {
+			return boolValue(!e.not), nil
+		}
+	}
+	if unknown {
+		return nullValue, nil
+	}
+	return boolValue(e.not), nil
+}
+
+type likeExpr struct {
+	x, pattern, escape expr
+	not                bool
+}
+
+func (e *likeExpr) eval(rec record) (Value, error) {
+	v, err := e.x.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	pv, err := e.pattern.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if v.IsNull() || pv.IsNull() {
+		return nullValue, nil
+	}
+	escape := rune(0)
+	if e.escape != nil {
+		ev, err := e.escape.eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		s := ev.String()
+		if utf8.RuneCountInString(s) != 1 {
+			return nullValue, selectErr(xhttp.ErrLikeInvalidInputs, "LIKE escape must be a single character")
+		}
+		escape, _ = utf8.DecodeRuneInString(s)
+	}
+	return boolValue(likeMatch([]rune(v.String()), []rune(pv.String()), escape) != e.not), nil
+}
+
+// likeMatch LIKE 匹配，% 匹配任意多个字符，_ 匹配一个字符
+func likeMatch(s, p []rune, escape rune) bool {
+	// 回溯到最近的 % 继续匹配，避免指数级的递归
+	si, pi := 0, 0
+	starP, starS := -1, 0
+	for si < len(s) {
+		if pi < len(p) {
+			c := p[pi]
+			if escape != 0 && c == escape && pi+1 < len(p) {
+				if s[si] == p[pi+1] {
+					si++
+					pi += 2
+					continue
+				}
+			} else if c == '%' {
+				starP, starS = pi, si
+				pi++
+				continue
+			} else if c == '_' || c == s[si] {
+				si++
+				pi++
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starS++
+		si = starS
+		pi = starP + 1
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+type arithExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e *arithExpr) eval(rec record) (Value, error) {
+	lv, err := e.l.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	rv, err := e.r.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	return arith(e.op, lv, rv)
+}
+
+func arith(op string, lv, rv Value) (Value, error) {
+	if lv.IsNull() || rv.IsNull() {
+		return nullValue, nil
+	}
+	a, ok1 := lv.toNumber()
+	b, ok2 := rv.toNumber()
+	if !ok1 || !ok2 {
+		return nullValue, selectErr(xhttp.ErrIncorrectSQLFunctionArgumentType, "cannot apply %s to %q and %q", op, lv.String(), rv.String())
+	}
+	if a.kind == kindInt && b.kind == kindInt {
+		switch op {
+		case "+":
+			return intValue(a.i + b.i), nil
+		case "-":
+			return intValue(a.i - b.i), nil
+		case "*":
+			return intValue(a.i * b.i), nil
+		case "/", "%":
+			if b.i == 0 {
+				return nullValue, selectErr(xhttp.ErrEvaluatorInvalidArguments, "division by zero")
+			}
+			if op == "/" {
+				return intValue(a.i / b.i), nil
+			}
+			return intValue(a.i % b.i), nil
+		}
+	}
+	x, y := a.float(), b.float()
+	switch op {
+	case "+":
+		return floatValue(x + y), nil
+	case "-":
+		return floatValue(x - y), nil
+	case "*":
+		return floatValue(x * y), nil
+	case "/":
+		if y == 0 {
+			return nullValue, selectErr(xhttp.ErrEvaluatorInvalidArguments, "division by zero")
+		}
+		return floatValue(x / y), nil
+	default:
+		if y == 0 {
+			return nullValue, selectErr(xhttp.ErrEvaluatorInvalidArguments, "division by zero")
+		}
+		return floatValue(math.Mod(x, y)), nil
+	}
+}
+
+type concatExpr struct {
+	l, r expr
+}
+
+func (e *concatExpr) eval(rec record) (Value, error) {
+	lv, err := e.l.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	rv, err := e.r.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if lv.IsNull() || rv.IsNull() {
+		return nullValue, nil
+	}
+	return stringValue(lv.String() + rv.String()), nil
+}
+
+type castExpr struct {
+	x   expr
+	typ string
+}
+
+func (e *castExpr) eval(rec record) (Value, error) {
+	v, err := e.x.eval(rec)
+	if err != nil || v.IsNull() {
+		return nullValue, err
+	}
+	switch e.typ {
+	case "INT", "INTEGER", "BIGINT", "SMALLINT":
+		n, ok := v.toNumber()
+		if !ok {
+			return nullValue, selectErr(xhttp.ErrCastFailed, "cannot cast %q to %s", v.String(), e.typ)
+		}
+		if n.kind == kindFloat {
+			return intValue(int64(n.f)), nil
+		}
+		return n, nil
+	case "FLOAT", "DOUBLE", "REAL", "DECIMAL", "NUMERIC":
+		n, ok := v.toNumber()
+		if !ok {
+			return nullValue, selectErr(xhttp.ErrCastFailed, "cannot cast %q to %s", v.String(), e.typ)
+		}
+		return floatValue(n.float()), nil
+	case "BOOL", "BOOLEAN":
+		if n, ok := v.toNumber(); ok && v.isNumber() {
+			return boolValue(n.float() != 0), nil
+		}
+		b, ok := v.toBool()
+		if !ok {
+			return nullValue, selectErr(xhttp.ErrCastFailed, "cannot cast %q to %s", v.String(), e.typ)
+		}
+		return boolValue(b), nil
+	default:
+		return stringValue(v.String()), nil
+	}
+}
+
+// scalarFunc 标量函数，maxArgs 为 -1 时参数个数不限
+type scalarFunc struct {
+	minArgs, maxArgs int
+	call             func(args []Value) (Value, error)
+}
+
+var scalarFuncs = map[string]*scalarFunc{
+	"LOWER": {1, 1, func(args []Value) (Value, error) {
+		return mapString(args[0], strings.ToLower), nil
+	}},
+	"UPPER": {1, 1, func(args []Value) (Value, error) {
+		return mapString(args[0], strings.ToUpper), nil
+	}},
+	"TRIM": {1, 1, func(args []Value) (Value, error) {
+		return mapString(args[0], strings.TrimSpace), nil
+	}},
+	"CHAR_LENGTH":      {1, 1, charLength},
+	"CHARACTER_LENGTH": {1, 1, charLength},
+	"SUBSTRING": {2, 3, func(args []Value) (Value, error) {
+		if args[0].IsNull() || args[1].IsNull() {
+			return nullValue, nil
+		}
+		s := []rune(args[0].String())
+		start, ok := args[1].toNumber()
+		if !ok {
+			return nullValue, selectErr(xhttp.ErrIncorrectSQLFunctionArgumentType, "SUBSTRING start must be a number")
+		}
+		// SQL 的下标从 1 开始
+		from := int(start.float()) - 1
+		to := len(s)
+		if len(args) == 3 {
+			n, ok := args[2].toNumber()
+			if !ok || n.float() < 0 {
+				return nullValue, selectErr(xhttp.ErrIncorrectSQLFunctionArgumentType, "SUBSTRING length must be a non-negative number")
+			}
+			to = from + int(n.float())
+		}
+		from = max(from, 0)
+		to = min(to, len(s))
+		if from >= to {
+			return stringValue(""), nil
+		}
+		return stringValue(string(s[from:to])), nil
+	}},
+	"COALESCE": {1, -1, func(args []Value) (Value, error) {
+		for _, v := range args {
+			if !v.IsNull() {
+				return v, nil
+			}
+		}
+		return nullValue, nil
+	}},
+	"NULLIF": {2, 2, func(args []Value) (Value, error) {
+		if c, ok := compareValues(args[0], args[1]); ok && c == 0 {
+			return nullValue, nil
+		}
+		return args[0], nil
+	}},
+}
+
+func mapString(v Value, f func(string) string) Value {
+	if v.IsNull() {
+		return nullValue
+	}
+	return stringValue(f(v.String()))
+}
+
+func charLength(args []Value) (Value, error) {
+	if args[0].IsNull() {
+		return nullValue, nil
+	}
+	return intValue(int64(utf8.RuneCountInString(args[0].String()))), nil
+}
+
+type funcExpr struct {
+	name string
+	fn   *scalarFunc
+	args []expr
+}
+
+func (e *funcExpr) eval(rec record) (Value, error) {
+	args := make([]Value, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		args[i] = v
+	}
+	return e.fn.call(args)
+}
+
+// aggExpr 聚合函数，每条匹配的记录调用 update，全部处理完后 eval 返回结果
+type aggExpr struct {
+	name  string
+	arg   expr
+	star  bool
+	count int64
+	acc   Value
+}
+
+func (e *aggExpr) update(rec record) error {
+	if e.star {
+		e.count++
+		return nil
+	}
+	v, err := e.arg.eval(rec)
+	if err != nil || v.IsNull() {
+		return err
+	}
+	switch e.name {
+	case "COUNT":
+	case "SUM", "AVG":
+		n, ok := v.toNumber()
+		if !ok {
+			return selectErr(xhttp.ErrIncorrectSQLFunctionArgumentType, "%s of non-numeric value %q", e.name, v.String())
+		}
+		if e.count == 0 {
+			e.acc = n
+		} else if e.acc, err = arith("+", e.acc, n); err != nil {
+			return err
+		}
+	case "MIN", "MAX":
+		if n, ok := v.toNumber(); ok {
+			v = n
+		}
+		if e.count == 0 {
+			e.acc = v
+		} else if c, ok := compareValues(v, e.acc); ok && ((e.name == "MIN" && c < 0) || (e.name == "MAX" && c > 0)) {
+			e.acc = v
+		}
+	}
+	e.count++
+	return nil
+}
+
+func (e *aggExpr) eval(record) (Value, error) {
+	switch e.name {
+	case "COUNT":
+		return intValue(e.count), nil
+	case "AVG":
+		if e.count == 0 {
+			return nullValue, nil
+		}
+		return floatValue(e.acc.float() / float64(e.count)), nil
+	default:
+		if e.count == 0 {
+			return nullValue, nil
+		}
+		return e.acc, nil
+	}
+}
+
+// parseIndexName 把 _N 形式的列名转换为下标，不是这种形式时返回 -1
+func parseIndexName(name string) int {
+	if len(name) < 2 || name[0] != '_' {
+		return -1
+	}
+	n, err := strconv.Atoi(name[1:])
+	if err != nil || n < 1 {
+		return -1
+	}
+	return n - 1
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+)
+
+// eventWriter 按 AWS event stream 格式写消息
+// 消息格式：总长度(4) + 头部长度(4) + 前导 CRC(4) + 头部 + 负载 + 消息 CRC(4)，CRC 为 CRC32 IEEE
+type eventWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	// returned 已经返回给客户端的记录字节数
+	returned int64
+}
+
+// header 事件头，值都是字符串类型
+type header struct {
+	name, value string
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{w: w}
+}
+
+func (ew *eventWriter) writeMessage(headers []header, payload []byte) error {
+	ew.buf.Reset()
+	var hb bytes.Buffer
+	for _, h := range headers {
+		hb.WriteByte(byte(len(h.name)))
+		hb.WriteString(h.name)
+		hb.WriteByte(7) // 字符串类型
+		var l [2]byte
+		binary.BigEndian.PutUint16(l[:], uint16(len(h.value)))
+		hb.Write(l[:])
+		hb.WriteString(h.value)
+	}
+
+	var prelude [8]byte
+	binary.BigEndian.PutUint32(prelude[0:4], uint32(12+hb.Len()+len(payload)+4))
+	binary.BigEndian.PutUint32(prelude[4:8], uint32(hb.Len()))
+	ew.buf.Write(prelude[:])
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(prelude[:]))
+	ew.buf.Write(crc[:])
+	ew.buf.Write(hb.Bytes())
+	ew.buf.Write(payload)
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(ew.buf.Bytes()))
+	ew.buf.Write(crc[:])
+
+	if _, err := ew.w.Write(ew.buf.Bytes()); err != nil {
+		return err
+	}
+	if f, ok := ew.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func eventHeaders(eventType, contentType string) []header {
+	headers := []header{{":event-type", eventType}}
+	if contentType != "" {
+		headers = append(headers, header{":content-type", contentType})
+	}
+	return append(headers, header{":message-type", "event"})
+}
+
+// writeRecords 写入查询结果
+func (ew *eventWriter) writeRecords(data []byte) error {
+	ew.returned += int64(len(data))
+	return ew.writeMessage(eventHeaders("Records", "application/octet-stream"), data)
+}
+
+// writeCont 长时间没有结果时保持连接
+func (ew *eventWriter) writeCont() error {
+	return ew.writeMessage(eventHeaders("Cont", ""), nil)
+}
+
+func (ew *eventWriter) writeProgress(scanned, processed int64) error {
+	payload := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><Progress><BytesScanned>%d</BytesScanned><BytesProcessed>%d</BytesProcessed><BytesReturned>%d</BytesReturned></Progress>`,
+		scanned, processed, ew.returned)
+	return ew.writeMessage(eventHeaders("Progress", "text/xml"), []byte(payload))
+}
+
+func (ew *eventWriter) writeStats(scanned, processed int64) error {
+	payload := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><Stats><BytesScanned>%d</BytesScanned><BytesProcessed>%d</BytesProcessed><BytesReturned>%d</BytesReturned></Stats>`,
+		scanned, processed, ew.returned)
+	return ew.writeMessage(eventHeaders("Stats", "text/xml"), []byte(payload))
+}
+
+func (ew *eventWriter) writeEnd() error {
+	return ew.writeMessage(eventHeaders("End", ""), nil)
+}
+
+// writeError 查询过程中出错，错误消息之后不再有其他消息
+func (ew *eventWriter) writeError(code, message string) error {
+	return ew.writeMessage([]header{
+		{":error-code", code},
+		{":error-message", message},
+		{":message-type", "error"},
+	}, nil)
+}
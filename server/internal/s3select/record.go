@@ -0,0 +1,526 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+)
+
+// pathElem 列引用的一段，index >= 0 时是数组下标
+type pathElem struct {
+	name   string
+	quoted bool
+	index  int
+}
+
+// field 记录中的一个字段，用于 SELECT *
+type field struct {
+	name  string
+	value Value
+}
+
+// record 输入的一条记录
+type record interface {
+	// get 按路径取值，不存在时返回 NULL
+	get(path []pathElem) Value
+	// fields 按顺序返回所有字段
+	fields() []field
+}
+
+// recordReader 按顺序读出记录，结束时返回 io.EOF
+type recordReader interface {
+	next() (record, error)
+}
+
+// csvHeader CSV 的列名，未加引号的列名不区分大小写
+type csvHeader struct {
+	names []string
+	exact map[string]int
+	fold  map[string]int
+}
+
+func newCSVHeader(names []string) *csvHeader {
+	h := &csvHeader{names: names, exact: make(map[string]int, len(names)), fold: make(map[string]int, len(names))}
+	for i, name := range names {
+		if _, ok := h.exact[name]; !ok {
+			h.exact[name] = i
+		}
+		if _, ok := h.fold[strings.ToLower(name)]; !ok {
+			h.fold[strings.ToLower(name)] = i
+		}
+	}
+	return h
+}
+
+type csvRecord struct {
+	values []string
+	header *csvHeader
+}
+
+func (r *csvRecord) get(path []pathElem) Value {
+	if len(path) != 1 || path[0].index >= 0 {
+		return nullValue
+	}
+	name := path[0].name
+	idx := -1
+	if r.header != nil {
+		if i, ok := r.header.exact[name]; ok {
+			idx = i
+		} else if i, ok := r.header.fold[strings.ToLower(name)]; ok && !path[0].quoted {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		idx = parseIndexName(name)
+	}
+	if idx < 0 || idx >= len(r.values) {
+		return nullValue
+	}
+	return stringValue(r.values[idx])
+}
+
+func (r *csvRecord) fields() []field {
+	out := make([]field, len(r.values))
+	for i, v := range r.values {
+		name := "_" + strconv.Itoa(i+1)
+		if r.header != nil && i < len(r.header.names) {
+			name = r.header.names[i]
+		}
+		out[i] = field{name: name, value: stringValue(v)}
+	}
+	return out
+}
+
+// csvReader 逐字符解析 CSV，支持自定义的字段分隔符、记录分隔符、引号、转义字符和注释
+type csvReader struct {
+	r           *bufio.Reader
+	fieldDelim  rune
+	quote       rune
+	escape      rune
+	comment     rune
+	recordDelim []rune
+	header      *csvHeader
+}
+
+func newCSVReader(r io.Reader, conf *CSVInput) (*csvReader, error) {
+	cr := &csvReader{
+		r:           bufio.NewReaderSize(r, 256<<10),
+		fieldDelim:  []rune(conf.FieldDelimiter)[0],
+		quote:       []rune(conf.QuoteCharacter)[0],
+		recordDelim: []rune(conf.RecordDelimiter),
+	}
+	cr.escape = cr.quote
+	if conf.QuoteEscapeCharacter != "" {
+		cr.escape = []rune(conf.QuoteEscapeCharacter)[0]
+	}
+	if conf.Comments != "" {
+		cr.comment = []rune(conf.Comments)[0]
+	}
+	if conf.FileHeaderInfo == "NONE" {
+		return cr, nil
+	}
+	names, err := cr.readRecord()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if conf.FileHeaderInfo == "USE" && names != nil {
+		cr.header = newCSVHeader(names)
+	}
+	return cr, nil
+}
+
+func (cr *csvReader) next() (record, error) {
+	values, err := cr.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	return &csvRecord{values: values, header: cr.header}, nil
+}
+
+// isRecordDelim 判断 c 是否是记录分隔符的开始，两个字符的分隔符匹配时消耗第二个字符
+func (cr *csvReader) isRecordDelim(c rune) bool {
+	if c != cr.recordDelim[0] {
+		return false
+	}
+	if len(cr.recordDelim) == 1 {
+		return true
+	}
+	n, _, err := cr.r.ReadRune()
+	if err != nil {
+		return false
+	}
+	if n == cr.recordDelim[1] {
+		return true
+	}
+	_ = cr.r.UnreadRune()
+	return false
+}
+
+// readRecord 读出一条记录的所有字段，跳过空行和注释行
+func (cr *csvReader) readRecord() ([]string, error) {
+	for {
+		fields, empty, err := cr.readLine()
+		if err != nil && (err != io.EOF || empty) {
+			return nil, err
+		}
+		if !empty {
+			return fields, nil
+		}
+	}
+}
+
+func (cr *csvReader) readLine() ([]string, bool, error) {
+	var fields []string
+	var buf strings.Builder
+	inQuotes, quoted, started := false, false, false
+	endField := func() {
+		s := buf.String()
+		buf.Reset()
+		fields = append(fields, s)
+		quoted = false
+	}
+	for {
+		c, _, err := cr.r.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				return nil, false, err
+			}
+			if inQuotes {
+				return nil, false, selectErr(xhttp.ErrInvalidRequestParameter, "unterminated quoted field in CSV")
+			}
+			if !started {
+				return nil, true, io.EOF
+			}
+			endField()
+			return cr.trimCR(fields, quoted), false, io.EOF
+		}
+		if !started && cr.comment != 0 && c == cr.comment {
+			// 注释行一直跳到记录分隔符
+			for {
+				c, _, err := cr.r.ReadRune()
+				if err != nil {
+					return nil, true, err
+				}
+				if cr.isRecordDelim(c) {
+					break
+				}
+			}
+			return nil, true, nil
+		}
+
+		if inQuotes {
+			switch {
+			case c == cr.escape && cr.escape != cr.quote:
+				n, _, err := cr.r.ReadRune()
+				if err == nil && (n == cr.quote || n == cr.escape) {
+					buf.WriteRune(n)
+					continue
+				}
+				if err == nil {
+					_ = cr.r.UnreadRune()
+				}
+				buf.WriteRune(c)
+			case c == cr.quote:
+				n, _, err := cr.r.ReadRune()
+				if err == nil && n == cr.quote && cr.escape == cr.quote {
+					buf.WriteRune(c)
+					continue
+				}
+				if err == nil {
+					_ = cr.r.UnreadRune()
+				}
+				inQuotes = false
+			default:
+				buf.WriteRune(c)
+			}
+			continue
+		}
+
+		switch {
+		case c == cr.quote && buf.Len() == 0:
+			inQuotes, quoted, started = true, true, true
+		case c == cr.fieldDelim:
+			started = true
+			endField()
+		case cr.isRecordDelim(c):
+			if !started && buf.Len() == 0 {
+				return nil, true, nil
+			}
+			endField()
+			return cr.trimCR(fields, quoted), false, nil
+		default:
+			started = true
+			buf.WriteRune(c)
+		}
+	}
+}
+
+// trimCR 记录分隔符是 \n 时兼容 \r\n 结尾的文件
+func (cr *csvReader) trimCR(fields []string, quoted bool) []string {
+	if len(cr.recordDelim) == 1 && cr.recordDelim[0] == '\n' && !quoted && len(fields) > 0 {
+		last := len(fields) - 1
+		fields[last] = strings.TrimSuffix(fields[last], "\r")
+	}
+	return fields
+}
+
+// orderedObject 保持字段顺序的 JSON 对象
+type orderedObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *orderedObject) lookup(name string, quoted bool) (any, bool) {
+	if v, ok := o.values[name]; ok {
+		return v, true
+	}
+	if quoted {
+		return nil, false
+	}
+	for _, k := range o.keys {
+		if strings.EqualFold(k, name) {
+			return o.values[k], true
+		}
+	}
+	return nil, false
+}
+
+type jsonRecord struct {
+	root any
+}
+
+func (r *jsonRecord) get(path []pathElem) Value {
+	cur := r.root
+	for _, p := range path {
+		switch t := cur.(type) {
+		case *orderedObject:
+			if p.index >= 0 {
+				return nullValue
+			}
+			v, ok := t.lookup(p.name, p.quoted)
+			if !ok {
+				return nullValue
+			}
+			cur = v
+		case []any:
+			if p.index < 0 || p.index >= len(t) {
+				return nullValue
+			}
+			cur = t[p.index]
+		default:
+			return nullValue
+		}
+	}
+	return jsonValue(cur)
+}
+
+func (r *jsonRecord) fields() []field {
+	obj, ok := r.root.(*orderedObject)
+	if !ok {
+		return []field{{name: "_1", value: jsonValue(r.root)}}
+	}
+	out := make([]field, len(obj.keys))
+	for i, k := range obj.keys {
+		out[i] = field{name: k, value: jsonValue(obj.values[k])}
+	}
+	return out
+}
+
+// jsonReader 读出 JSON 记录，DOCUMENT 顶层的数组按元素拆分为多条记录
+type jsonReader struct {
+	dec      *json.Decoder
+	document bool
+	pending  []any
+}
+
+func newJSONReader(r io.Reader, conf *JSONInput) *jsonReader {
+	dec := json.NewDecoder(bufio.NewReaderSize(r, 256<<10))
+	dec.UseNumber()
+	return &jsonReader{dec: dec, document: conf.Type == "DOCUMENT"}
+}
+
+func (jr *jsonReader) next() (record, error) {
+	for len(jr.pending) == 0 {
+		v, err := decodeOrdered(jr.dec)
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, selectErr(xhttp.ErrInvalidRequestParameter, "invalid JSON input: %v", err)
+		}
+		if arr, ok := v.([]any); ok && jr.document {
+			jr.pending = arr
+			continue
+		}
+		return &jsonRecord{root: v}, nil
+	}
+	v := jr.pending[0]
+	jr.pending = jr.pending[1:]
+	return &jsonRecord{root: v}, nil
+}
+
+// decodeOrdered 解码下一个 JSON 值，对象保持字段顺序
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		obj := &orderedObject{values: make(map[string]any)}
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := kt.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid object key %v", kt)
+			}
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			if _, dup := obj.values[key]; !dup {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.values[key] = v
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return obj, nil
+	case '[':
+		arr := make([]any, 0)
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			arr = append(arr, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("unexpected delimiter %v", delim)
+}
+
+// unexpectedEOF 值中间遇到结束说明数据被截断，不能当成正常结束
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeJSON 把 JSON 值编码到 buf，对象保持字段顺序
+func writeJSON(buf *bytes.Buffer, x any) {
+	switch t := x.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case json.Number:
+		buf.WriteString(t.String())
+	case string:
+		writeJSONString(buf, t)
+	case *orderedObject:
+		buf.WriteByte('{')
+		for i, k := range t.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, k)
+			buf.WriteByte(':')
+			writeJSON(buf, t.values[k])
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, v := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSON(buf, v)
+		}
+		buf.WriteByte(']')
+	default:
+		data, _ := json.Marshal(t)
+		buf.Write(data)
+	}
+}
+
+// writeJSONString 编码 JSON 字符串，不转义 HTML 字符
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(c)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// writeValueJSON 把 Value 编码为 JSON
+func writeValueJSON(buf *bytes.Buffer, v Value) {
+	switch v.kind {
+	case kindNull:
+		buf.WriteString("null")
+	case kindFloat:
+		if math.IsInf(v.f, 0) || math.IsNaN(v.f) {
+			buf.WriteString("null")
+			return
+		}
+		buf.WriteString(formatFloat(v.f))
+	case kindString:
+		writeJSONString(buf, v.s)
+	case kindObject:
+		writeJSON(buf, v.raw)
+	default:
+		buf.WriteString(v.String())
+	}
+}
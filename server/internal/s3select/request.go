@@ -0,0 +1,217 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+)
+
+const (
+	// maxRequestSize SelectObjectContent 请求体的上限
+	maxRequestSize = 1 << 20
+	// maxExpressionSize SQL 表达式的上限
+	maxExpressionSize = 256 << 10
+)
+
+// Request SelectObjectContent 的请求体 (AWS S3 规范)
+type Request struct {
+	XMLName             xml.Name            `xml:"SelectObjectContentRequest"`
+	Expression          string              `xml:"Expression"`
+	ExpressionType      string              `xml:"ExpressionType"`
+	InputSerialization  InputSerialization  `xml:"InputSerialization"`
+	OutputSerialization OutputSerialization `xml:"OutputSerialization"`
+	RequestProgress     struct {
+		Enabled bool `xml:"Enabled"`
+	} `xml:"RequestProgress"`
+	ScanRange *struct {
+		Start *int64 `xml:"Start"`
+		End   *int64 `xml:"End"`
+	} `xml:"ScanRange"`
+}
+
+// InputSerialization 对象数据的格式
+type InputSerialization struct {
+	CompressionType string     `xml:"CompressionType"` // NONE | GZIP | BZIP2
+	CSV             *CSVInput  `xml:"CSV"`
+	JSON            *JSONInput `xml:"JSON"`
+	Parquet         *struct{}  `xml:"Parquet"`
+}
+
+// CSVInput CSV 输入格式
+type CSVInput struct {
+	FileHeaderInfo             string `xml:"FileHeaderInfo"` // NONE | USE | IGNORE
+	RecordDelimiter            string `xml:"RecordDelimiter"`
+	FieldDelimiter             string `xml:"FieldDelimiter"`
+	QuoteCharacter             string `xml:"QuoteCharacter"`
+	QuoteEscapeCharacter       string `xml:"QuoteEscapeCharacter"`
+	Comments                   string `xml:"Comments"`
+	AllowQuotedRecordDelimiter bool   `xml:"AllowQuotedRecordDelimiter"`
+}
+
+// JSONInput JSON 输入格式
+type JSONInput struct {
+	Type string `xml:"Type"` // DOCUMENT | LINES
+}
+
+// OutputSerialization 结果的格式
+type OutputSerialization struct {
+	CSV  *CSVOutput  `xml:"CSV"`
+	JSON *JSONOutput `xml:"JSON"`
+}
+
+// CSVOutput CSV 输出格式
+type CSVOutput struct {
+	QuoteFields          string `xml:"QuoteFields"` // ALWAYS | ASNEEDED
+	RecordDelimiter      string `xml:"RecordDelimiter"`
+	FieldDelimiter       string `xml:"FieldDelimiter"`
+	QuoteCharacter       string `xml:"QuoteCharacter"`
+	QuoteEscapeCharacter string `xml:"QuoteEscapeCharacter"`
+}
+
+// JSONOutput JSON 输出格式
+type JSONOutput struct {
+	RecordDelimiter string `xml:"RecordDelimiter"`
+}
+
+// selectErr 带 S3 Select 错误码的错误，detail 说明具体原因
+func selectErr(code xhttp.APIErrorCode, format string, args ...any) error {
+	return fmt.Errorf("%w: %s", xhttp.ToError(code), fmt.Sprintf(format, args...))
+}
+
+// ParseRequest 解析并校验请求体，填充各个格式的默认值
+func ParseRequest(r io.Reader) (*Request, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxRequestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read select request failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, xhttp.ToError(xhttp.ErrEmptyRequestBody)
+	}
+	if len(data) > maxRequestSize {
+		return nil, xhttp.ToError(xhttp.ErrExpressionTooLong)
+	}
+	req := &Request{}
+	if err := xml.Unmarshal(data, req); err != nil {
+		return nil, selectErr(xhttp.ErrMalformedXML, "%v", err)
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (req *Request) validate() error {
+	if strings.TrimSpace(req.Expression) == "" {
+		return selectErr(xhttp.ErrMissingRequiredParameter, "missing Expression")
+	}
+	if len(req.Expression) > maxExpressionSize {
+		return xhttp.ToError(xhttp.ErrExpressionTooLong)
+	}
+	if !strings.EqualFold(req.ExpressionType, "SQL") {
+		return xhttp.ToError(xhttp.ErrInvalidExpressionType)
+	}
+	if req.ScanRange != nil {
+		return selectErr(xhttp.ErrUnsupportedRangeHeader, "ScanRange is not supported")
+	}
+
+	in := &req.InputSerialization
+	in.CompressionType = strings.ToUpper(in.CompressionType)
+	switch in.CompressionType {
+	case "":
+		in.CompressionType = "NONE"
+	case "NONE", "GZIP", "BZIP2":
+	default:
+		return xhttp.ToError(xhttp.ErrInvalidCompressionFormat)
+	}
+	formats := 0
+	if in.CSV != nil {
+		formats++
+	}
+	if in.JSON != nil {
+		formats++
+	}
+	if in.Parquet != nil {
+		return xhttp.ToError(xhttp.ErrInvalidDataSource)
+	}
+	if formats != 1 {
+		return xhttp.ToError(xhttp.ErrObjectSerializationConflict)
+	}
+	if in.CSV != nil {
+		c := in.CSV
+		c.FileHeaderInfo = strings.ToUpper(c.FileHeaderInfo)
+		switch c.FileHeaderInfo {
+		case "":
+			c.FileHeaderInfo = "NONE"
+		case "NONE", "USE", "IGNORE":
+		default:
+			return xhttp.ToError(xhttp.ErrInvalidFileHeaderInfo)
+		}
+		c.RecordDelimiter = defaultString(c.RecordDelimiter, "\n")
+		c.FieldDelimiter = defaultString(c.FieldDelimiter, ",")
+		c.QuoteCharacter = defaultString(c.QuoteCharacter, `"`)
+		if len([]rune(c.FieldDelimiter)) != 1 || len([]rune(c.QuoteCharacter)) != 1 || len([]rune(c.Comments)) > 1 {
+			return selectErr(xhttp.ErrInvalidRequestParameter, "CSV delimiters must be a single character")
+		}
+		if len(c.RecordDelimiter) > 2 {
+			return selectErr(xhttp.ErrInvalidRequestParameter, "CSV RecordDelimiter must be one or two characters")
+		}
+	}
+	if in.JSON != nil {
+		in.JSON.Type = strings.ToUpper(in.JSON.Type)
+		switch in.JSON.Type {
+		case "DOCUMENT", "LINES":
+		default:
+			return xhttp.ToError(xhttp.ErrInvalidJSONType)
+		}
+	}
+
+	out := &req.OutputSerialization
+	if (out.CSV == nil) == (out.JSON == nil) {
+		return xhttp.ToError(xhttp.ErrObjectSerializationConflict)
+	}
+	if out.CSV != nil {
+		c := out.CSV
+		c.QuoteFields = strings.ToUpper(c.QuoteFields)
+		switch c.QuoteFields {
+		case "":
+			c.QuoteFields = "ASNEEDED"
+		case "ALWAYS", "ASNEEDED":
+		default:
+			return xhttp.ToError(xhttp.ErrInvalidQuoteFields)
+		}
+		c.RecordDelimiter = defaultString(c.RecordDelimiter, "\n")
+		c.FieldDelimiter = defaultString(c.FieldDelimiter, ",")
+		c.QuoteCharacter = defaultString(c.QuoteCharacter, `"`)
+		c.QuoteEscapeCharacter = defaultString(c.QuoteEscapeCharacter, c.QuoteCharacter)
+	}
+	if out.JSON != nil {
+		out.JSON.RecordDelimiter = defaultString(out.JSON.RecordDelimiter, "\n")
+	}
+	return nil
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+)
+
+const (
+	// recordsBatchSize 结果攒够这么多字节发送一个 Records 消息
+	recordsBatchSize = 128 << 10
+	// keepAliveInterval 没有结果时定期发送 Progress 或者 Cont 消息，防止客户端超时
+	keepAliveInterval = 2 * time.Second
+)
+
+// Select 解析好的查询
+type Select struct {
+	req *Request
+	q   *query
+}
+
+// NewSelect 解析请求中的 SQL，语法错误在开始输出前返回
+func NewSelect(req *Request) (*Select, error) {
+	q, err := parseQuery(req.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return &Select{req: req, q: q}, nil
+}
+
+// countingReader 统计读出的字节数
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Run 在对象数据 r 上流式执行查询，结果按 event stream 写入 w
+// 开始输出后的错误写成 error 消息，同时返回给调用者记录日志
+func (s *Select) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	ew := newEventWriter(w)
+	err := s.run(ctx, r, ew)
+	if err != nil {
+		code, message := "InternalError", err.Error()
+		var apiErr xhttp.APIError
+		if errors.As(err, &apiErr) {
+			code = apiErr.Code
+		}
+		_ = ew.writeError(code, message)
+	}
+	return err
+}
+
+func (s *Select) run(ctx context.Context, r io.Reader, ew *eventWriter) error {
+	scanned := &countingReader{r: r}
+	var data io.Reader = scanned
+	switch s.req.InputSerialization.CompressionType {
+	case "GZIP":
+		gz, err := gzip.NewReader(scanned)
+		if err != nil {
+			return selectErr(xhttp.ErrInvalidCompressionFormat, "%v", err)
+		}
+		defer gz.Close()
+		data = gz
+	case "BZIP2":
+		data = bzip2.NewReader(scanned)
+	}
+	processed := &countingReader{r: data}
+
+	var rr recordReader
+	if in := s.req.InputSerialization.CSV; in != nil {
+		cr, err := newCSVReader(processed, in)
+		if err != nil {
+			return inputErr(err)
+		}
+		rr = cr
+	} else {
+		rr = newJSONReader(processed, s.req.InputSerialization.JSON)
+	}
+
+	out := newOutputWriter(&s.req.OutputSerialization)
+	var batch bytes.Buffer
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		err := ew.writeRecords(batch.Bytes())
+		batch.Reset()
+		return err
+	}
+
+	q := s.q
+	lastEvent := time.Now()
+	returned := int64(0)
+	for n := 0; ; n++ {
+		if q.limit >= 0 && returned >= q.limit && len(q.aggs) == 0 {
+			break
+		}
+		if n%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if time.Since(lastEvent) >= keepAliveInterval {
+				var err error
+				if s.req.RequestProgress.Enabled {
+					err = ew.writeProgress(scanned.n.Load(), processed.n.Load())
+				} else {
+					err = ew.writeCont()
+				}
+				if err != nil {
+					return err
+				}
+				lastEvent = time.Now()
+			}
+		}
+
+		rec, err := rr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return inputErr(err)
+		}
+		if q.where != nil {
+			v, err := q.where.eval(rec)
+			if err != nil {
+				return err
+			}
+			if b, ok := v.toBool(); !ok || !b {
+				continue
+			}
+		}
+		if len(q.aggs) > 0 {
+			for _, agg := range q.aggs {
+				if err := agg.update(rec); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := s.writeRow(out, &batch, rec); err != nil {
+			return err
+		}
+		returned++
+		if batch.Len() >= recordsBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			lastEvent = time.Now()
+		}
+	}
+
+	// 聚合查询只输出一行结果
+	if len(q.aggs) > 0 && q.limit != 0 {
+		if err := s.writeRow(out, &batch, nil); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if s.req.RequestProgress.Enabled {
+		if err := ew.writeProgress(scanned.n.Load(), processed.n.Load()); err != nil {
+			return err
+		}
+	}
+	if err := ew.writeStats(scanned.n.Load(), processed.n.Load()); err != nil {
+		return err
+	}
+	logger.GetLogger("dedups3").Debugf("select finished, scanned %d processed %d returned %d bytes", scanned.n.Load(), processed.n.Load(), ew.returned)
+	return ew.writeEnd()
+}
+
+// writeRow 计算一行的投影并写入 buf
+func (s *Select) writeRow(out *outputWriter, buf *bytes.Buffer, rec record) error {
+	if s.q.star {
+		out.write(buf, rec.fields())
+		return nil
+	}
+	row := make([]field, len(s.q.projections))
+	for i, p := range s.q.projections {
+		v, err := p.expr.eval(rec)
+		if err != nil {
+			return err
+		}
+		row[i] = field{name: p.name, value: v}
+	}
+	out.write(buf, row)
+	return nil
+}
+
+// inputErr 读对象数据的错误，已经带错误码的原样返回
+func inputErr(err error) error {
+	var apiErr xhttp.APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	if errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || strings.HasPrefix(err.Error(), "bzip2 data invalid") {
+		return selectErr(xhttp.ErrInvalidCompressionFormat, "%v", err)
+	}
+	return fmt.Errorf("read object data failed: %w", err)
+}
+
+// outputWriter 按输出格式编码结果行
+type outputWriter struct {
+	csv  *CSVOutput
+	json *JSONOutput
+}
+
+func newOutputWriter(conf *OutputSerialization) *outputWriter {
+	return &outputWriter{csv: conf.CSV, json: conf.JSON}
+}
+
+func (o *outputWriter) write(buf *bytes.Buffer, row []field) {
+	if o.json != nil {
+		buf.WriteByte('{')
+		for i, f := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, f.name)
+			buf.WriteByte(':')
+			writeValueJSON(buf, f.value)
+		}
+		buf.WriteByte('}')
+		buf.WriteString(o.json.RecordDelimiter)
+		return
+	}
+
+	c := o.csv
+	for i, f := range row {
+		if i > 0 {
+			buf.WriteString(c.FieldDelimiter)
+		}
+		s := f.value.String()
+		if c.QuoteFields == "ALWAYS" || (s != "" && strings.ContainsAny(s, c.FieldDelimiter+c.QuoteCharacter+c.RecordDelimiter+"\r\n")) {
+			buf.WriteString(c.QuoteCharacter)
+			buf.WriteString(strings.ReplaceAll(s, c.QuoteCharacter, c.QuoteEscapeCharacter+c.QuoteCharacter))
+			buf.WriteString(c.QuoteCharacter)
+		} else {
+			buf.WriteString(s)
+		}
+	}
+	buf.WriteString(c.RecordDelimiter)
+}
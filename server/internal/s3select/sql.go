@@ -0,0 +1,679 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex 把 SQL 表达式切分为 token
+func lex(sql string) ([]token, error) {
+	tokens := make([]token, 0, 32)
+	runes := []rune(sql)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					for j < len(runes) && unicode.IsDigit(runes[j]) {
+						j++
+					}
+					i = j
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), pos: start})
+		case c == '\'' || c == '"':
+			// 字符串用单引号，带引号的标识符用双引号，引号重复表示转义
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == c {
+					if i+1 < len(runes) && runes[i+1] == c {
+						sb.WriteRune(c)
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, selectErr(xhttp.ErrLexerInvalidLiteral, "unterminated quote at %d", start)
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokQuotedIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: sb.String(), pos: start})
+		default:
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "<=", ">=", "<>", "!=", "||":
+					tokens = append(tokens, token{kind: tokOp, text: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("=<>+-*/%(),.[];", c) {
+				tokens = append(tokens, token{kind: tokOp, text: string(c), pos: i})
+				i++
+				continue
+			}
+			return nil, selectErr(xhttp.ErrLexerInvalidChar, "invalid character %q at %d", c, i)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// projection SELECT 列表中的一项
+type projection struct {
+	expr expr
+	name string
+}
+
+// query 解析后的 SELECT 语句
+type query struct {
+	star        bool
+	projections []projection
+	where       expr
+	limit       int64
+	aggs        []*aggExpr
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	columns []*columnExpr
+	aggs    []*aggExpr
+	inAgg   bool
+	// aggAllowed 只有 SELECT 列表可以使用聚合函数
+	aggAllowed bool
+	// bareColumn 当前 SELECT 项中聚合函数之外的列引用数
+	bareColumn int
+}
+
+// parseQuery 解析 SQL：SELECT <列表> FROM S3Object [别名] [WHERE 条件] [LIMIT n]
+func parseQuery(sql string) (*query, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q := &query{limit: -1}
+
+	if !p.acceptKeyword("SELECT") {
+		return nil, selectErr(xhttp.ErrParseUnsupportedSelect, "expression must start with SELECT")
+	}
+	if p.acceptOp("*") {
+		q.star = true
+	} else {
+		p.aggAllowed = true
+		hasBare := false
+		for {
+			p.bareColumn = 0
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			hasBare = hasBare || p.bareColumn > 0
+			proj := projection{expr: e}
+			if p.acceptKeyword("AS") {
+				if proj.name, err = p.parseName(); err != nil {
+					return nil, err
+				}
+			} else if t := p.peek(); (t.kind == tokIdent && !isReserved(t.text)) || t.kind == tokQuotedIdent {
+				proj.name = t.text
+				p.pos++
+			}
+			q.projections = append(q.projections, proj)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		p.aggAllowed = false
+		if len(q.projections) == 0 {
+			return nil, xhttp.ToError(xhttp.ErrParseEmptySelect)
+		}
+		if len(p.aggs) > 0 && hasBare {
+			return nil, selectErr(xhttp.ErrParseUnsupportedSyntax, "cannot mix aggregate and non-aggregate projections")
+		}
+	}
+
+	if !p.acceptKeyword("FROM") {
+		return nil, selectErr(xhttp.ErrParseSelectMissingFrom, "missing FROM clause")
+	}
+	alias, err := p.parseTable()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if q.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if t.kind != tokNumber || err != nil || n < 0 {
+			return nil, selectErr(xhttp.ErrParseExpectedNumber, "invalid LIMIT %q", t.text)
+		}
+		q.limit = n
+	}
+	p.acceptOp(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, selectErr(xhttp.ErrParseUnexpectedToken, "unexpected %q at %d", t.text, t.pos)
+	}
+
+	// 列引用可以带上表名或者表的别名，去掉后按记录中的字段查找
+	for _, c := range p.columns {
+		if len(c.path) > 1 && !c.path[0].quoted && c.path[0].index < 0 &&
+			(strings.EqualFold(c.path[0].name, "S3Object") || (alias != "" && strings.EqualFold(c.path[0].name, alias))) {
+			c.path = c.path[1:]
+		}
+	}
+	for i := range q.projections {
+		if q.projections[i].name == "" {
+			if c, ok := q.projections[i].expr.(*columnExpr); ok && c.path[len(c.path)-1].index < 0 {
+				q.projections[i].name = c.path[len(c.path)-1].name
+			} else {
+				q.projections[i].name = "_" + strconv.Itoa(i+1)
+			}
+		}
+	}
+	q.aggs = p.aggs
+	return q, nil
+}
+
+// parseTable 解析 FROM 子句，只支持 S3Object，返回别名
+func (p *parser) parseTable() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent || !strings.EqualFold(t.text, "S3Object") {
+		return "", selectErr(xhttp.ErrUnsupportedSQLStructure, "only S3Object is supported in FROM")
+	}
+	// S3Object[*] 与 S3Object 等价
+	if p.acceptOp("[") {
+		if !p.acceptOp("*") || !p.acceptOp("]") {
+			return "", selectErr(xhttp.ErrUnsupportedSQLStructure, "unsupported FROM path")
+		}
+	}
+	if p.peek().kind == tokOp && p.peek().text == "." {
+		return "", selectErr(xhttp.ErrUnsupportedSQLStructure, "unsupported FROM path")
+	}
+	if p.acceptKeyword("AS") {
+		return p.parseName()
+	}
+	if t := p.peek(); (t.kind == tokIdent && !isReserved(t.text)) || t.kind == tokQuotedIdent {
+		p.pos++
+		return t.text, nil
+	}
+	return "", nil
+}
+
+func (p *parser) parseName() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent && t.kind != tokQuotedIdent {
+		return "", selectErr(xhttp.ErrParseExpectedIdentForAlias, "expected identifier at %d", t.pos)
+	}
+	return t.text, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptOp(op string) bool {
+	t := p.peek()
+	if t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		t := p.peek()
+		return selectErr(xhttp.ErrParseExpectedTokenType, "expected %q at %d", op, t.pos)
+	}
+	return nil
+}
+
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "LIMIT": true, "AS": true, "AND": true, "OR": true,
+	"NOT": true, "LIKE": true, "ESCAPE": true, "IS": true, "NULL": true, "BETWEEN": true, "IN": true,
+	"TRUE": true, "FALSE": true, "MISSING": true, "CAST": true,
+}
+
+func isReserved(s string) bool {
+	return reservedWords[strings.ToUpper(s)]
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicExpr{op: "OR", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicExpr{op: "AND", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.pos++
+			r, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &compareExpr{op: t.text, l: l, r: r}, nil
+		}
+		return l, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") && !p.acceptKeyword("MISSING") {
+			return nil, selectErr(xhttp.ErrParseExpectedKeyword, "expected NULL after IS at %d", p.peek().pos)
+		}
+		return &isNullExpr{x: l, not: not}, nil
+	}
+
+	not := false
+	if p.isKeyword("NOT") {
+		if n := p.tokens[p.pos+1]; n.kind == tokIdent && (strings.EqualFold(n.text, "LIKE") || strings.EqualFold(n.text, "BETWEEN") || strings.EqualFold(n.text, "IN")) {
+			p.pos++
+			not = true
+		}
+	}
+	switch {
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		e := &likeExpr{x: l, pattern: pattern, not: not}
+		if p.acceptKeyword("ESCAPE") {
+			if e.escape, err = p.parseAdditive(); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	case p.acceptKeyword("BETWEEN"):
+		lo, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AND") {
+			return nil, selectErr(xhttp.ErrParseExpectedKeyword, "expected AND in BETWEEN at %d", p.peek().pos)
+		}
+		hi, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{x: l, lo: lo, hi: hi, not: not}, nil
+	case p.acceptKeyword("IN"):
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		e := &inExpr{x: l, not: not}
+		for {
+			item, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			e.list = append(e.list, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	l, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-" && t.text != "||") {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "||" {
+			l = &concatExpr{l: l, r: r}
+		} else {
+			l = &arithExpr{op: t.text, l: l, r: r}
+		}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &arithExpr{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.acceptOp("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithExpr{op: "-", l: &literalExpr{v: intValue(0)}, r: x}, nil
+	}
+	if p.acceptOp("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.pos++
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literalExpr{v: intValue(i)}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, selectErr(xhttp.ErrLexerInvalidLiteral, "invalid number %q", t.text)
+		}
+		return &literalExpr{v: floatValue(f)}, nil
+	case tokString:
+		p.pos++
+		return &literalExpr{v: stringValue(t.text)}, nil
+	case tokOp:
+		if t.text == "(" {
+			p.pos++
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+		return nil, selectErr(xhttp.ErrParseUnexpectedOperator, "unexpected %q at %d", t.text, t.pos)
+	case tokQuotedIdent:
+		return p.parsePath()
+	case tokIdent:
+		switch strings.ToUpper(t.text) {
+		case "TRUE", "FALSE":
+			p.pos++
+			return &literalExpr{v: boolValue(strings.EqualFold(t.text, "TRUE"))}, nil
+		case "NULL", "MISSING":
+			p.pos++
+			return &literalExpr{v: nullValue}, nil
+		}
+		if n := p.tokens[p.pos+1]; n.kind == tokOp && n.text == "(" {
+			return p.parseCall()
+		}
+		if isReserved(t.text) {
+			return nil, selectErr(xhttp.ErrParseUnexpectedKeyword, "unexpected keyword %s at %d", t.text, t.pos)
+		}
+		return p.parsePath()
+	}
+	return nil, selectErr(xhttp.ErrParseExpectedExpression, "expected expression at %d", t.pos)
+}
+
+// parsePath 解析列引用：name、alias.name、_1 或者 JSON 路径 a.b[0].c
+func (p *parser) parsePath() (expr, error) {
+	c := &columnExpr{}
+	t := p.next()
+	c.path = append(c.path, pathElem{name: t.text, quoted: t.kind == tokQuotedIdent, index: -1})
+	for {
+		if p.acceptOp(".") {
+			t := p.next()
+			if t.kind != tokIdent && t.kind != tokQuotedIdent {
+				return nil, selectErr(xhttp.ErrParseExpectedMember, "expected member name at %d", t.pos)
+			}
+			c.path = append(c.path, pathElem{name: t.text, quoted: t.kind == tokQuotedIdent, index: -1})
+			continue
+		}
+		if p.acceptOp("[") {
+			t := p.next()
+			idx, err := strconv.Atoi(t.text)
+			if t.kind != tokNumber || err != nil || idx < 0 {
+				return nil, selectErr(xhttp.ErrInvalidKeyPath, "invalid array index at %d", t.pos)
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			c.path = append(c.path, pathElem{index: idx})
+			continue
+		}
+		break
+	}
+	if !p.inAgg {
+		p.bareColumn++
+	}
+	p.columns = append(p.columns, c)
+	return c, nil
+}
+
+// parseCall 解析函数调用，包括聚合函数和 CAST
+func (p *parser) parseCall() (expr, error) {
+	name := strings.ToUpper(p.next().text)
+	p.pos++ // (
+	switch name {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		if !p.aggAllowed || p.inAgg {
+			return nil, selectErr(xhttp.ErrParseUnsupportedSyntax, "aggregate function %s is not allowed here", name)
+		}
+		agg := &aggExpr{name: name}
+		if name == "COUNT" && p.acceptOp("*") {
+			agg.star = true
+		} else {
+			p.inAgg = true
+			arg, err := p.parseExpr()
+			p.inAgg = false
+			if err != nil {
+				return nil, err
+			}
+			agg.arg = arg
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		p.aggs = append(p.aggs, agg)
+		return agg, nil
+	case "CAST":
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AS") {
+			return nil, selectErr(xhttp.ErrParseExpectedKeyword, "expected AS in CAST at %d", p.peek().pos)
+		}
+		t := p.next()
+		if t.kind != tokIdent {
+			return nil, selectErr(xhttp.ErrParseExpectedTypeName, "expected type name at %d", t.pos)
+		}
+		typ := strings.ToUpper(t.text)
+		switch typ {
+		case "INT", "INTEGER", "BIGINT", "SMALLINT", "FLOAT", "DOUBLE", "REAL", "DECIMAL", "NUMERIC",
+			"STRING", "VARCHAR", "CHAR", "BOOL", "BOOLEAN":
+		default:
+			return nil, selectErr(xhttp.ErrParseInvalidTypeParam, "unsupported type %s", t.text)
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return &castExpr{x: x, typ: typ}, nil
+	}
+
+	fn, ok := scalarFuncs[name]
+	if !ok {
+		return nil, selectErr(xhttp.ErrUnsupportedFunction, "unsupported function %s", name)
+	}
+	call := &funcExpr{name: name, fn: fn}
+	if !p.acceptOp(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			// SUBSTRING(x FROM a FOR b) 和 SUBSTRING(x, a, b) 等价
+			if name == "SUBSTRING" && (p.acceptKeyword("FROM") || p.acceptKeyword("FOR")) {
+				continue
+			}
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+		return nil, selectErr(xhttp.ErrEvaluatorInvalidArguments, "wrong number of arguments for %s", name)
+	}
+	return call, nil
+}
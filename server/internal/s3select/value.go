@@ -0,0 +1,184 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3select
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type valueKind int
+
+const (
+	kindNull valueKind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindString
+	kindObject // JSON 对象或者数组，只能原样输出
+)
+
+// Value SQL 表达式的值
+type Value struct {
+	kind valueKind
+	b    bool
+	i    int64
+	f    float64
+	s    string
+	raw  any
+}
+
+var nullValue = Value{}
+
+func boolValue(b bool) Value     { return Value{kind: kindBool, b: b} }
+func intValue(i int64) Value     { return Value{kind: kindInt, i: i} }
+func floatValue(f float64) Value { return Value{kind: kindFloat, f: f} }
+func stringValue(s string) Value { return Value{kind: kindString, s: s} }
+func (v Value) IsNull() bool     { return v.kind == kindNull }
+func (v Value) isNumber() bool   { return v.kind == kindInt || v.kind == kindFloat }
+func (v Value) isBool() bool     { return v.kind == kindBool }
+
+// jsonValue 把 JSON 解码出来的值转换为 Value
+func jsonValue(x any) Value {
+	switch t := x.(type) {
+	case nil:
+		return nullValue
+	case bool:
+		return boolValue(t)
+	case string:
+		return stringValue(t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return intValue(i)
+		}
+		if f, err := t.Float64(); err == nil {
+			return floatValue(f)
+		}
+		return stringValue(t.String())
+	default:
+		return Value{kind: kindObject, raw: t}
+	}
+}
+
+// toNumber 转换为数值，字符串按数字解析，CSV 的字段都是字符串
+func (v Value) toNumber() (Value, bool) {
+	switch v.kind {
+	case kindInt, kindFloat:
+		return v, true
+	case kindString:
+		s := strings.TrimSpace(v.s)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return intValue(i), true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return floatValue(f), true
+		}
+	}
+	return nullValue, false
+}
+
+func (v Value) float() float64 {
+	if v.kind == kindInt {
+		return float64(v.i)
+	}
+	return v.f
+}
+
+// toBool 转换为布尔值，字符串 true/false 不区分大小写
+func (v Value) toBool() (bool, bool) {
+	switch v.kind {
+	case kindBool:
+		return v.b, true
+	case kindString:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v.s)); err == nil {
+			return b, true
+		}
+	}
+	return false, false
+}
+
+// String 值的文本形式，用于 CSV 输出和字符串运算
+func (v Value) String() string {
+	switch v.kind {
+	case kindBool:
+		return strconv.FormatBool(v.b)
+	case kindInt:
+		return strconv.FormatInt(v.i, 10)
+	case kindFloat:
+		return formatFloat(v.f)
+	case kindString:
+		return v.s
+	case kindObject:
+		var buf bytes.Buffer
+		writeJSON(&buf, v.raw)
+		return buf.String()
+	}
+	return ""
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// compareValues 比较两个值，ok 为 false 时两个值不能比较（包括 NULL）
+func compareValues(a, b Value) (int, bool) {
+	if a.IsNull() || b.IsNull() {
+		return 0, false
+	}
+	if a.isNumber() || b.isNumber() {
+		na, ok1 := a.toNumber()
+		nb, ok2 := b.toNumber()
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		if na.kind == kindInt && nb.kind == kindInt {
+			return cmpOrdered(na.i, nb.i), true
+		}
+		return cmpOrdered(na.float(), nb.float()), true
+	}
+	if a.isBool() || b.isBool() {
+		ba, ok1 := a.toBool()
+		bb, ok2 := b.toBool()
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		if ba == bb {
+			return 0, true
+		}
+		if !ba {
+			return -1, true
+		}
+		return 1, true
+	}
+	return strings.Compare(a.String(), b.String()), true
+}
+
+func cmpOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -18,6 +18,7 @@ package utils
 
 import (
 	"bufio"
+	"io"
 	"io/fs"
 	"os"
 )
@@ -75,3 +76,19 @@ func WriteFile(filename string, chunks [][]byte, perm fs.FileMode) error {
 	// }
 	return nil
 }
+
+// WriteFileFrom 从 r 读出数据写入文件，数据不需要全部在内存中
+func WriteFileFrom(filename string, r io.Reader, perm fs.FileMode) (int64, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, 8*1024*1024)
+	n, err := io.Copy(writer, r)
+	if err != nil {
+		return n, err
+	}
+	return n, writer.Flush()
+}
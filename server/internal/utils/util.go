@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
@@ -27,6 +28,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	mrand "math/rand"
 	"net"
 	"net/url"
@@ -345,12 +347,96 @@ func IsCompressible(data []byte, sampleSize int, thresholdRatio float64) bool {
 	return ratio < thresholdRatio
 }
 
-// Encrypt 加密函数 - 使用AES-GCM
+// SampleEntropy 从数据的开头、中间和结尾各采样 sampleSize 字节，计算字节分布的香农熵（比特/字节）
+// 已经压缩或加密的数据接近 8，文本一般在 5 以下
+func SampleEntropy(data []byte, sampleSize int) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	total := 0
+	sample := func(b []byte) {
+		for _, c := range b {
+			counts[c]++
+		}
+		total += len(b)
+	}
+	if len(data) <= 3*sampleSize {
+		sample(data)
+	} else {
+		mid := len(data)/2 - sampleSize/2
+		sample(data[:sampleSize])
+		sample(data[mid : mid+sampleSize])
+		sample(data[len(data)-sampleSize:])
+	}
+
+	entropy := 0.0
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(total)
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// compressedTypes 本身已经压缩过的内容类型，再压缩基本没有效果
+var compressedTypes = map[string]bool{
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/gif":                    true,
+	"image/webp":                   true,
+	"image/avif":                   true,
+	"image/heic":                   true,
+	"image/heif":                   true,
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zstd":             true,
+	"application/x-zstd":           true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-lz4":            true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/java-archive":     true,
+}
+
+// IsCompressedContentType 内容类型是否是已经压缩过的格式，包括常见的图片、音视频和压缩包
+func IsCompressedContentType(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(contentType))
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = strings.TrimSpace(ct[:i])
+	}
+	if compressedTypes[ct] {
+		return true
+	}
+	// 未压缩的 wav 音频除外
+	if strings.HasPrefix(ct, "video/") || (strings.HasPrefix(ct, "audio/") && !strings.Contains(ct, "wav")) {
+		return true
+	}
+	return false
+}
+
+// Encrypt 加密函数 - 使用AES-GCM，密钥由 key 派生，只用于兼容旧数据
 func Encrypt(data []byte, key string) ([]byte, error) {
-	keyBytes := GenKey(key, 16)
+	return EncryptWithKey(data, GenKey(key, 16), nil)
+}
 
+// Decrypt  解密函数
+func Decrypt(data []byte, key string) ([]byte, error) {
+	return DecryptWithKey(data, GenKey(key, 16), nil)
+}
+
+// EncryptOverhead EncryptWithKey 输出比明文多出的长度（nonce + 认证标签）
+const EncryptOverhead = 12 + 16
+
+// EncryptWithKey 使用 AES-GCM 加密，key 长度为 16/24/32 字节，aad 为附加认证数据
+// 输出为 nonce + 密文
+func EncryptWithKey(data, key, aad []byte) ([]byte, error) {
 	// 创建 AES cipher
-	block, err := aes.NewCipher(keyBytes)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -368,16 +454,33 @@ func Encrypt(data []byte, key string) ([]byte, error) {
 	}
 
 	// 加密
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	ciphertext := gcm.Seal(nonce, nonce, data, aad)
 
 	return ciphertext, nil
 }
 
-// Decrypt  解密函数
-func Decrypt(data []byte, key string) ([]byte, error) {
-	keyBytes := GenKey(key, 16)
+// EncryptConvergent 收敛加密，nonce 由密钥和明文的 HMAC 派生，相同密钥下相同明文得到相同密文
+// 输出格式和 EncryptWithKey 相同，用 DecryptWithKey 解密
+func EncryptConvergent(data, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// nonce 的 HMAC 密钥从数据密钥派生，不直接复用加密密钥
+	macKey := sha256.Sum256(append([]byte("dedups3 convergent nonce:"), key...))
+	mac := hmac.New(sha256.New, macKey[:])
+	mac.Write(data)
+	nonce := mac.Sum(nil)[:gcm.NonceSize()]
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
 
-	block, err := aes.NewCipher(keyBytes)
+// DecryptWithKey 解密 EncryptWithKey 的输出
+func DecryptWithKey(data, key, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -395,7 +498,7 @@ func Decrypt(data []byte, key string) ([]byte, error) {
 	nonce, encryptedData := data[:nonceSize], data[nonceSize:]
 
 	// 解密（自动验证认证标签）
-	plaintext, err := gcm.Open(nil, nonce, encryptedData, nil)
+	plaintext, err := gcm.Open(nil, nonce, encryptedData, aad)
 	if err != nil {
 		return nil, errors.New("decryption failed: invalid key or corrupted data")
 	}
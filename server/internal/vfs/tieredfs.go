@@ -17,6 +17,7 @@
 package vfs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -56,6 +57,7 @@ var (
 	ErrInvalidPath     = errors.New("invalid path")
 	ErrSystemClosed    = errors.New("filesystem closed")
 	ErrInvalidMetadata = errors.New("invalid metadata")
+	ErrNotOnDisk       = errors.New("file not on disk")
 )
 
 // FileMetadata 用于序列化的文件元数据
@@ -358,6 +360,18 @@ func (fs *TieredFs) AddSyncTargetor(storageID string, targetor SyncTargetor) err
 
 // WriteFile 写入文件（优化版）
 func (fs *TieredFs) WriteFile(storageID, blockID string, chunks [][]byte, ver int32) error {
+	// 计算总长度
+	var totalLen int64
+	readers := make([]io.Reader, 0, len(chunks))
+	for _, chunk := range chunks {
+		totalLen += int64(len(chunk))
+		readers = append(readers, bytes.NewReader(chunk))
+	}
+	return fs.WriteFrom(storageID, blockID, io.MultiReader(readers...), totalLen, ver)
+}
+
+// WriteFrom 从 r 读出 size 字节直接写入内存映射区域，不需要先在内存中拼出整个文件
+func (fs *TieredFs) WriteFrom(storageID, blockID string, r io.Reader, size int64, ver int32) error {
 	if atomic.LoadInt32(&fs.closed) == 1 {
 		return ErrSystemClosed
 	}
@@ -371,46 +385,48 @@ func (fs *TieredFs) WriteFile(storageID, blockID string, chunks [][]byte, ver in
 		return fmt.Errorf("too many files")
 	}
 
-	// 计算总长度
-	var totalLen int64
-	for _, chunk := range chunks {
-		totalLen += int64(len(chunk))
-	}
-
-	if totalLen == 0 {
+	if size == 0 {
 		logger.GetLogger("dedups3").Errorf("write 0 bytes to file %s", blockID)
 		return fs.Remove(storageID, blockID) // 空文件视为删除
 	}
 
-	if totalLen > fs.mmapSize {
+	if size > fs.mmapSize {
 		return ErrFileTooLarge
 	}
 
 	// 分配空间
-	offset, err := fs.freeManager.BestFitAlloc(totalLen)
+	offset, err := fs.freeManager.BestFitAlloc(size)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("no space for alloc: %v", err)
 		return fmt.Errorf("no space for alloc %w", err)
 	}
 
 	// 边界检查
-	if offset+totalLen > fs.mmapSize {
-		fs.freeManager.Free(offset, totalLen)
+	if offset+size > fs.mmapSize {
+		fs.freeManager.Free(offset, size)
 		return ErrOutOfBounds
 	}
 
+	// 先写入数据再更新文件映射，读取数据失败时不会留下不完整的文件
+	if _, err := io.ReadFull(r, fs.mmapData[offset:offset+size]); err != nil {
+		fs.freeManager.Free(offset, size)
+		logger.GetLogger("dedups3").Errorf("read data of file %s failed: %v", blockID, err)
+		return fmt.Errorf("read data of file %s failed: %w", blockID, err)
+	}
+
 	fs.mu.Lock()
-	//logger.GetLogger("dedups3").Errorf("block %s get write region [%d-%d]", path, offset, offset+totalLen)
+	//logger.GetLogger("dedups3").Errorf("block %s get write region [%d-%d]", path, offset, offset+size)
 	oldRegion := fs.files[blockID]
 	if oldRegion != nil && ver < oldRegion.Ver {
 		// 现有的版本更新
-		fs.freeManager.Free(offset, totalLen)
+		fs.mu.Unlock()
+		fs.freeManager.Free(offset, size)
 		return nil
 	}
 
 	// 更新文件映射
 	newRegion := &FileRegion{
-		Region:    Region{Start: offset, End: offset + totalLen},
+		Region:    Region{Start: offset, End: offset + size},
 		StorageID: storageID,
 		BlockID:   blockID,
 		Ver:       ver,
@@ -425,14 +441,6 @@ func (fs *TieredFs) WriteFile(storageID, blockID string, chunks [][]byte, ver in
 		fs.discardRegion(oldRegion)
 	}
 
-	// 拷贝写入
-	dest := fs.mmapData[offset : offset+totalLen]
-	written := 0
-	for _, chunk := range chunks {
-		n := copy(dest[written:], chunk)
-		written += n
-	}
-
 	fs.saveMetadata()
 	if fs.mmapData != nil {
 		// 异步同步，不阻塞业务
@@ -442,7 +450,7 @@ func (fs *TieredFs) WriteFile(storageID, blockID string, chunks [][]byte, ver in
 	// 更新统计
 	fs.stats.mu.Lock()
 	fs.stats.WriteCount++
-	fs.stats.BytesWritten += totalLen
+	fs.stats.BytesWritten += size
 	fs.stats.mu.Unlock()
 
 	// 异步同步
@@ -457,6 +465,34 @@ func (fs *TieredFs) WriteFile(storageID, blockID string, chunks [][]byte, ver in
 	return nil
 }
 
+// WriteThrough 文件不经过内存映射区域，由 write 直接写入同步目标，先丢弃缓存中的旧版本
+// 和刷盘使用同一把锁，避免正在上传的旧版本覆盖新数据
+func (fs *TieredFs) WriteThrough(storageID, blockID string, write func() error) error {
+	if atomic.LoadInt32(&fs.closed) == 1 {
+		return ErrSystemClosed
+	}
+
+	if err := fs.validatePath(blockID); err != nil {
+		return err
+	}
+
+	return utils.WithLockKey(blockID, func() error {
+		fs.mu.Lock()
+		region, exists := fs.files[blockID]
+		if exists {
+			delete(fs.files, blockID)
+		}
+		fs.mu.Unlock()
+
+		if exists {
+			fs.freeManager.Free(region.Start, region.Size())
+			fs.discardRegion(region)
+			fs.saveMetadata()
+		}
+		return write()
+	})
+}
+
 // ReadFile 读取文件（支持偏移量读取）
 func (fs *TieredFs) ReadFile(storageID, blockID string, offset, length int64) ([]byte, error) {
 	if atomic.LoadInt32(&fs.closed) == 1 {
@@ -573,6 +609,89 @@ func (fs *TieredFs) ReadFile(storageID, blockID string, offset, length int64) ([
 	return data, nil
 }
 
+// ReadAt 从文件 off 处读出 len(p) 字节，数据不够时返回读到的字节数和 io.EOF
+func (fs *TieredFs) ReadAt(storageID, blockID string, p []byte, off int64) (int, error) {
+	if atomic.LoadInt32(&fs.closed) == 1 {
+		return 0, ErrSystemClosed
+	}
+
+	if err := fs.validatePath(blockID); err != nil {
+		return 0, err
+	}
+
+	if off < 0 {
+		return 0, errors.New("invalid offset: must be >= 0")
+	}
+
+	n := 0
+	err := utils.WrapFunction(func() error {
+		fs.mu.RLock()
+		region, exists := fs.files[blockID]
+		if exists {
+			defer fs.mu.RUnlock()
+			if off >= region.Size() {
+				return io.EOF
+			}
+			// 从内存映射区域读取
+			n = copy(p, fs.mmapData[region.Start+off:region.End])
+			if n < len(p) {
+				return io.EOF
+			}
+			return nil
+		}
+		// 及时释放锁
+		fs.mu.RUnlock()
+
+		diskPath := fs.diskPath(storageID, blockID)
+		if diskPath == "" {
+			return fmt.Errorf("file not found for %s %s", storageID, blockID)
+		}
+		f, err := os.Open(diskPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err = f.ReadAt(p, off)
+		return err
+	})
+
+	// 更新统计信息
+	fs.stats.mu.Lock()
+	fs.stats.ReadCount++
+	fs.stats.BytesRead += int64(n)
+	fs.stats.mu.Unlock()
+
+	return n, err
+}
+
+// Size 文件大小
+func (fs *TieredFs) Size(storageID, blockID string) (int64, error) {
+	if atomic.LoadInt32(&fs.closed) == 1 {
+		return 0, ErrSystemClosed
+	}
+
+	if err := fs.validatePath(blockID); err != nil {
+		return 0, err
+	}
+
+	fs.mu.RLock()
+	region, exists := fs.files[blockID]
+	fs.mu.RUnlock()
+	if exists {
+		return region.Size(), nil
+	}
+
+	diskPath := fs.diskPath(storageID, blockID)
+	if diskPath == "" {
+		return 0, ErrFileNotFound
+	}
+	info, err := os.Stat(diskPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
 // Remove 删除文件（优化版）
 func (fs *TieredFs) Remove(storageID, blockID string) error {
 	if atomic.LoadInt32(&fs.closed) == 1 {
@@ -690,6 +809,30 @@ func (fs *TieredFs) Exists(strorageID, blockID string) bool {
 	return false
 }
 
+// OpenFile 打开已经刷到磁盘上的文件，文件还在内存映射区域时返回 ErrNotOnDisk
+// 返回的文件由调用者关闭，用于直接从文件发送数据
+func (fs *TieredFs) OpenFile(storageID, blockID string) (*os.File, error) {
+	if atomic.LoadInt32(&fs.closed) == 1 {
+		return nil, ErrSystemClosed
+	}
+	if err := fs.validatePath(blockID); err != nil {
+		return nil, err
+	}
+
+	fs.mu.RLock()
+	_, exists := fs.files[blockID]
+	fs.mu.RUnlock()
+	if exists {
+		return nil, ErrNotOnDisk
+	}
+
+	diskPath := fs.diskPath(storageID, blockID)
+	if diskPath == "" {
+		return nil, ErrFileNotFound
+	}
+	return os.Open(diskPath)
+}
+
 // ListFiles 列出所有文件
 func (fs *TieredFs) ListFiles() []string {
 	if atomic.LoadInt32(&fs.closed) == 1 {
@@ -42,8 +42,16 @@ import (
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/vfs"
 	"github.com/mageg-x/dedups3/router"
+	block2 "github.com/mageg-x/dedups3/service/block"
+	chunk2 "github.com/mageg-x/dedups3/service/chunk"
 	gc2 "github.com/mageg-x/dedups3/service/gc"
 	"github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/kms"
+	lifecycle2 "github.com/mageg-x/dedups3/service/lifecycle"
+	multipart2 "github.com/mageg-x/dedups3/service/multipart"
+	object2 "github.com/mageg-x/dedups3/service/object"
+	replication2 "github.com/mageg-x/dedups3/service/replication"
+	"github.com/mageg-x/dedups3/service/site"
 	"github.com/mageg-x/dedups3/service/storage"
 )
 
@@ -253,6 +261,12 @@ func main() {
 		panic(err)
 	}
 
+	// 初始化块加密的主密钥，主密钥配置错误时不能启动
+	if kms.GetKMSService() == nil {
+		logger.GetLogger("dedups3").Error("failed to init kms service")
+		panic("failed to init kms service")
+	}
+
 	// 缺省账户信息
 	iamService := iam.GetIamService()
 	account, err := iamService.CreateAccount(cfg.Admin.Username, cfg.Admin.Password)
@@ -290,6 +304,36 @@ func main() {
 		panic(err)
 	}
 
+	// 启动归档对象恢复后台任务，执行恢复请求并回收过期的临时副本
+	objectService := object2.GetObjectService()
+	if objectService == nil {
+		logger.GetLogger("dedups3").Error("failed to init object service")
+		panic("failed to init object service")
+	}
+	objectService.StartRestore()
+
+	// 启动数据密钥重新包装后台任务，主密钥轮换后把旧主密钥包装的数据密钥改用新主密钥
+	blockService := block2.GetBlockService()
+	if blockService == nil {
+		logger.GetLogger("dedups3").Error("failed to init block service")
+		panic("failed to init block service")
+	}
+
+	// 块以外由主密钥包装的 KMS 密钥、去重范围密钥和对象数据密钥也要重新包装，全部完成后旧主密钥才能下线
+	kmsService := kms.GetKMSService()
+	chunkService := chunk2.GetChunkService()
+	multipartService := multipart2.GetMultiPartService()
+	if kmsService == nil || chunkService == nil || multipartService == nil {
+		logger.GetLogger("dedups3").Error("failed to init kms, chunk or multipart service")
+		panic("failed to init kms, chunk or multipart service")
+	}
+	blockService.StartRewrap(
+		block2.RewrapTask{Name: "kms key", Run: kmsService.RewrapKeys},
+		block2.RewrapTask{Name: "dedup scope", Run: chunkService.RewrapScopeKeys},
+		block2.RewrapTask{Name: "object", Run: objectService.RewrapObjectKeys},
+		block2.RewrapTask{Name: "multipart upload", Run: multipartService.RewrapUploadKeys},
+	)
+
 	// 初始化数据统计后台服务
 	stats := stats2.GetStatsService()
 	if stats == nil {
@@ -301,6 +345,39 @@ func main() {
 		panic(err)
 	}
 
+	// 初始化生命周期后台服务
+	lifecycle := lifecycle2.GetLifecycleService()
+	if lifecycle == nil {
+		logger.GetLogger("dedups3").Error("failed to init lifecycle service")
+		panic(err)
+	}
+	if err = lifecycle.Start(); err != nil {
+		logger.GetLogger("dedups3").Error("failed to start lifecycle service", zap.Error(err))
+		panic(err)
+	}
+
+	// 初始化桶复制后台服务
+	replication := replication2.GetReplicationService()
+	if replication == nil {
+		logger.GetLogger("dedups3").Error("failed to init replication service")
+		panic(err)
+	}
+	if err = replication.Start(); err != nil {
+		logger.GetLogger("dedups3").Error("failed to start replication service", zap.Error(err))
+		panic(err)
+	}
+
+	// 初始化站点复制后台服务
+	siteService := site.GetSiteService()
+	if siteService == nil {
+		logger.GetLogger("dedups3").Error("failed to init site replication service")
+		panic(err)
+	}
+	if err = siteService.Start(); err != nil {
+		logger.GetLogger("dedups3").Error("failed to start site replication service", zap.Error(err))
+		panic(err)
+	}
+
 	// 创建一个通道来接收操作系统的中断信号
 	quit := make(chan os.Signal, 1)
 	// 注册中断信号
@@ -317,6 +394,9 @@ func main() {
 			logger.GetLogger("dedups3").Errorf("stop server failed: %v", err)
 		}
 	}
+	// 复制队列落盘
+	replication.Stop()
+	siteService.Stop()
 
 	logger.GetLogger("dedups3").Infof("server ended")
 }
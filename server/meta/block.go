@@ -34,23 +34,40 @@ type BlockChunk struct {
 	Hash string `json:"hash" msgpack:"hash"` // 块哈希
 	Size int32  `json:"size" msgpack:"size"` // 块大小
 	Data []byte `json:"-" msgpack:"data"`
+	// 来自已经压缩过的内容类型，写块时不尝试压缩，随待刷盘的块一起保存
+	Incompressible bool `json:"incompressible,omitempty" msgpack:"incompressible,omitempty"`
+}
+
+// BlockSegment 块中独立压缩加密的一段数据，由连续的若干 chunk 组成，范围读取时只需要读出用到的段
+type BlockSegment struct {
+	Offset     int64  `json:"off" msgpack:"off"`   // 明文在块数据中的偏移
+	Size       int32  `json:"size" msgpack:"size"` // 明文大小
+	Pos        int64  `json:"pos" msgpack:"pos"`   // 存储数据相对 Data 起始的偏移
+	Len        int32  `json:"len" msgpack:"len"`   // 存储数据大小
+	Compressed bool   `json:"z,omitempty" msgpack:"z,omitempty"`
+	Crc        uint32 `json:"crc" msgpack:"crc"` // 存储数据的 crc32
 }
 
 // BlockHeader BlockData ，存放在磁盘上只包含头信息，不含 Data
 type BlockHeader struct {
-	ID         string       `json:"id" msgpack:"id"`
-	Ver        int32        `json:"ver" msgpack:"ver" default:"0"`
-	Etag       [16]byte     `json:"etag" msgpack:"etag"`
-	TotalSize  int64        `json:"total_size" msgpack:"total_size"`
-	RealSize   int64        `json:"real_size" msgpack:"real_size"`             // 实际占用大小
-	Compressed bool         `json:"compressed" msgpack:"compressed"`           // 是否压缩
-	Encrypted  bool         `json:"encrypted" msgpack:"encrypted"`             // 是否加密
-	Location   string       `json:"location" xml:"Location"`                   // 所在的的Address
-	ChunkList  []BlockChunk `json:"chunk_list" msgpack:"chunk_list"`           // 切片列表
-	Finally    bool         `json:"finally" msgpack:"finally" default:"false"` // 是否结束不再增加内容
-	StorageID  string       `json:"storage_id" msgpack:"storage_id"`           // 存储后端ID
-	CreatedAt  time.Time    `json:"created_at" msgpack:"created_at"`           // 创建时间
-	UpdatedAt  time.Time    `json:"updated_at" msgpack:"updated_at"`           // 更新时间
+	ID         string         `json:"id" msgpack:"id"`
+	Ver        int32          `json:"ver" msgpack:"ver" default:"0"`
+	Etag       [16]byte       `json:"etag" msgpack:"etag"`
+	TotalSize  int64          `json:"total_size" msgpack:"total_size"`
+	RealSize   int64          `json:"real_size" msgpack:"real_size"`                         // 实际占用大小
+	Compressed bool           `json:"compressed" msgpack:"compressed"`                       // 是否压缩
+	Encrypted  bool           `json:"encrypted" msgpack:"encrypted"`                         // 是否加密
+	KeyID      string         `json:"key_id,omitempty" msgpack:"key_id,omitempty"`           // 包装数据密钥的主密钥ID，为空表示旧版本由块ID派生密钥
+	DataKey    []byte         `json:"data_key,omitempty" msgpack:"data_key,omitempty"`       // 主密钥包装后的数据密钥
+	Location   string         `json:"location" xml:"Location"`                               // 所在的的Address
+	ChunkList  []BlockChunk   `json:"chunk_list" msgpack:"chunk_list"`                       // 切片列表
+	Segments   []BlockSegment `json:"segments,omitempty" msgpack:"segments,omitempty"`       // 分段索引，为空表示整块压缩加密的旧格式
+	DataOffset int64          `json:"data_offset,omitempty" msgpack:"data_offset,omitempty"` // Data 在块文件中的偏移
+	SkipSize   int64          `json:"skip_size,omitempty" msgpack:"skip_size,omitempty"`     // 开启压缩时没有压缩存储的明文大小
+	Finally    bool           `json:"finally" msgpack:"finally" default:"false"`             // 是否结束不再增加内容
+	StorageID  string         `json:"storage_id" msgpack:"storage_id"`                       // 存储后端ID
+	CreatedAt  time.Time      `json:"created_at" msgpack:"created_at"`                       // 创建时间
+	UpdatedAt  time.Time      `json:"updated_at" msgpack:"updated_at"`                       // 更新时间
 }
 
 // BlockData BlockData: 完整结构（包含 Data）
@@ -93,6 +110,7 @@ func (b *Block) Clone(cloneData bool) *Block {
 	cp := &Block{}
 	*cp = *b // 浅拷贝
 	cp.ChunkList = make([]BlockChunk, len(b.ChunkList))
+	cp.Segments = append([]BlockSegment(nil), b.Segments...)
 
 	// 复制 ChunkList 中的每个元素
 	for i, chunk := range b.ChunkList {
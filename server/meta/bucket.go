@@ -38,6 +38,9 @@ type BucketMetadata struct {
 	Quota        *BucketQuota                    `json:"quota,omitempty" xml:"Quota"`
 	Replication  *ReplicationConfiguration       `json:"replication,omitempty" xml:"ReplicationConfiguration"`
 	Targets      *BucketTargets                  `json:"targets,omitempty" xml:"Targets"`
+	CORS         *CORSConfiguration              `json:"cors,omitempty" xml:"CORSConfiguration"`
+	Website      *WebsiteConfiguration           `json:"website,omitempty" xml:"WebsiteConfiguration"`
+	UpdatedAt    time.Time                       `json:"updatedAt,omitempty" xml:"-"` // 桶配置最后修改时间，用于站点间同步
 }
 
 func FormatBucketARN(accountID, bucketName string) string {
@@ -48,6 +51,12 @@ func GenBucketKey(accountID, bucketID string) string {
 	return "aws:bucket:" + accountID + ":" + bucketID
 }
 
+// GenBucketIndexKey 生成桶名全局索引的存储key，值为桶所有者的账户ID
+// 桶名全局唯一，没有签名的请求通过索引确定桶所属的账户
+func GenBucketIndexKey(bucketName string) string {
+	return "aws:bucketindex:" + bucketName
+}
+
 func (bm *BucketMetadata) GenBucketKey() string {
 	return GenBucketKey(bm.Owner.ID, bm.Name)
 }
@@ -76,6 +85,18 @@ func (bm *BucketMetadata) EnableVersioning() {
 	bm.Versioning.Status = "Enabled"
 }
 
+// NewVersionID 根据桶的版本控制状态为新写入的对象生成版本ID
+// 未开启版本控制返回空字符串，暂停时返回 null
+func (bm *BucketMetadata) NewVersionID() string {
+	if bm.Versioning.IsEnabled() {
+		return GenVersionID()
+	}
+	if bm.Versioning.IsSuspended() {
+		return NullVersionID
+	}
+	return ""
+}
+
 // 添加生命周期规则
 func (bm *BucketMetadata) AddLifecycleRule(rule LifecycleRule) {
 	if bm.Lifecycle == nil {
@@ -29,11 +29,12 @@ const (
 
 // Chunk 表示数据块
 type Chunk struct {
-	Hash     string `json:"hash"`      // 内容的哈希
-	Size     int32  `json:"size"`      // 块大小(字节)
-	RefCount int32  `json:"ref_count"` // 引用计数
-	BlockID  string `json:"block_id"`  // 所属BlockID
-	Data     []byte `json:"-"`         // 仅用于内存操作，不持久化
+	Hash     string `json:"hash"`            // 内容的哈希
+	Size     int32  `json:"size"`            // 块大小(字节)
+	RefCount int32  `json:"ref_count"`       // 引用计数
+	BlockID  string `json:"block_id"`        // 所属BlockID
+	Scope    string `json:"scope,omitempty"` // 去重范围，为空时全局去重
+	Data     []byte `json:"-"`               // 仅用于内存操作，不持久化
 }
 
 // NewChunk 从数据创建新块
@@ -53,17 +54,43 @@ func NewChunk(data []byte) *Chunk {
 	c.Hash = c.CalcChunkHash()
 	return &c
 }
+
+// NewScopedChunk 创建属于去重范围 scope 的块，hash 由范围派生的密钥计算，不同范围的相同数据 hash 不同
+func NewScopedChunk(data []byte, scope string) *Chunk {
+	if len(data) == 0 {
+		return nil
+	}
+	c := &Chunk{Size: int32(len(data)), Scope: scope, Data: data}
+	c.CalcChunkHash()
+	return c
+}
+
 func GenChunkKey(strorageID, Hash string) string {
 	return "aws:chunk:" + strorageID + ":" + Hash
 }
 
 // CalcChunkHash 计算数据的哈希
 func (c *Chunk) CalcChunkHash() string {
-	fp := blake3.Sum256(c.Data)
-	c.Hash = hex.EncodeToString(fp[:20])
+	c.Hash = chunkHash(c.Data, c.Scope)
 	return c.Hash
 }
 
+// Verify 校验 data 的哈希和 chunk 的 Hash 是否一致，读取数据时检查存储是否损坏
+func (c *Chunk) Verify(data []byte) bool {
+	return chunkHash(data, c.Scope) == c.Hash
+}
+
+func chunkHash(data []byte, scope string) string {
+	if scope == "" {
+		fp := blake3.Sum256(data)
+		return hex.EncodeToString(fp[:20])
+	}
+	key := blake3.Sum256([]byte("dedups3 dedup scope " + scope))
+	h := blake3.New(32, key[:])
+	_, _ = h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)[:20])
+}
+
 // Clone 创建 Chunk 的深拷贝
 // 该方法创建一个新的 Chunk 实例，并复制所有字段的值
 // 特别注意：对于 Data 字段([]byte)，会创建新的切片并复制内容，确保是真正的深拷贝
@@ -78,6 +105,7 @@ func (c *Chunk) Clone() *Chunk {
 		Size:     c.Size,
 		RefCount: c.RefCount,
 		BlockID:  c.BlockID,
+		Scope:    c.Scope,
 	}
 
 	// 深拷贝 Data 字段
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package meta
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CORSConfiguration 表示存储桶的跨域配置
+type CORSConfiguration struct {
+	XMLName   xml.Name   `xml:"CORSConfiguration" json:"corsConfiguration"`
+	XMLNS     string     `xml:"xmlns,attr" json:"xmlns"` // 固定值为http://s3.amazonaws.com/doc/2006-03-01/
+	CORSRules []CORSRule `xml:"CORSRule" json:"corsRules"`
+
+	CreatedAt time.Time `xml:"-" json:"createdAt"`
+	UpdatedAt time.Time `xml:"-" json:"updatedAt"`
+}
+
+// CORSRule 表示一条跨域规则
+type CORSRule struct {
+	ID             string   `xml:"ID,omitempty" json:"id"`
+	AllowedHeaders []string `xml:"AllowedHeader,omitempty" json:"allowedHeaders"`
+	AllowedMethods []string `xml:"AllowedMethod" json:"allowedMethods"`
+	AllowedOrigins []string `xml:"AllowedOrigin" json:"allowedOrigins"`
+	ExposeHeaders  []string `xml:"ExposeHeader,omitempty" json:"exposeHeaders"`
+	MaxAgeSeconds  *int     `xml:"MaxAgeSeconds,omitempty" json:"maxAgeSeconds"`
+}
+
+// corsMethods CORS 规则允许的方法
+var corsMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPut:    true,
+	http.MethodHead:   true,
+	http.MethodPost:   true,
+	http.MethodDelete: true,
+}
+
+// Validate 验证跨域配置
+func (c *CORSConfiguration) Validate() error {
+	if c == nil {
+		return errors.New("cors configuration is nil")
+	}
+	if len(c.CORSRules) == 0 {
+		return errors.New("cors configuration must have at least one rule")
+	}
+	// 验证规则数量不超过100个
+	if len(c.CORSRules) > 100 {
+		return errors.New("cors configuration cannot have more than 100 rules")
+	}
+
+	ruleIDs := make(map[string]bool)
+	for i, rule := range c.CORSRules {
+		if rule.ID != "" {
+			if len(rule.ID) > 255 {
+				return fmt.Errorf("rule %d: ID cannot be longer than 255 characters", i)
+			}
+			if ruleIDs[rule.ID] {
+				return fmt.Errorf("duplicate rule ID '%s'", rule.ID)
+			}
+			ruleIDs[rule.ID] = true
+		}
+		if len(rule.AllowedMethods) == 0 {
+			return fmt.Errorf("rule %d: at least one AllowedMethod is required", i)
+		}
+		for _, method := range rule.AllowedMethods {
+			if !corsMethods[method] {
+				return fmt.Errorf("rule %d: unsupported AllowedMethod '%s'", i, method)
+			}
+		}
+		if len(rule.AllowedOrigins) == 0 {
+			return fmt.Errorf("rule %d: at least one AllowedOrigin is required", i)
+		}
+		// 来源和请求头中最多只能有一个通配符
+		for _, origin := range rule.AllowedOrigins {
+			if strings.Count(origin, "*") > 1 {
+				return fmt.Errorf("rule %d: AllowedOrigin '%s' can contain at most one wildcard", i, origin)
+			}
+		}
+		for _, header := range rule.AllowedHeaders {
+			if strings.Count(header, "*") > 1 {
+				return fmt.Errorf("rule %d: AllowedHeader '%s' can contain at most one wildcard", i, header)
+			}
+		}
+		if rule.MaxAgeSeconds != nil && *rule.MaxAgeSeconds < 0 {
+			return fmt.Errorf("rule %d: MaxAgeSeconds cannot be negative", i)
+		}
+	}
+	return nil
+}
+
+// Match 按顺序查找第一条匹配来源、方法和请求头的规则，没有匹配时返回 nil
+func (c *CORSConfiguration) Match(origin, method string, headers []string) *CORSRule {
+	if c == nil || origin == "" {
+		return nil
+	}
+	for i := range c.CORSRules {
+		rule := &c.CORSRules[i]
+		if rule.matchOrigin(origin) && rule.matchMethod(method) && rule.matchHeaders(headers) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (r *CORSRule) matchOrigin(origin string) bool {
+	for _, allowed := range r.AllowedOrigins {
+		if wildcardMatch(allowed, origin, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CORSRule) matchMethod(method string) bool {
+	for _, allowed := range r.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHeaders 预检请求中的每个请求头都必须被允许，请求头不区分大小写
+func (r *CORSRule) matchHeaders(headers []string) bool {
+	for _, header := range headers {
+		found := false
+		for _, allowed := range r.AllowedHeaders {
+			if wildcardMatch(allowed, header, true) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowAnyOrigin 规则是否允许任意来源
+func (r *CORSRule) AllowAnyOrigin() bool {
+	for _, allowed := range r.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch 匹配最多包含一个 * 的模式
+func wildcardMatch(pattern, s string, ignoreCase bool) bool {
+	if ignoreCase {
+		pattern = strings.ToLower(pattern)
+		s = strings.ToLower(s)
+	}
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return pattern == s
+	}
+	return len(s) >= len(prefix)+len(suffix) && strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix)
+}
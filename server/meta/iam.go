@@ -94,6 +94,8 @@ type IamAccount struct {
 	Roles     StringSet    `json:"roles"`     // IAM 角色 (key: 角色名)
 	Policies  StringSet    `json:"policies"`  // IAM 策略 (key: 策略名)
 	Quota     *QuotaConfig `json:"quota"`     // 配额限制
+
+	BlockPublicAccess bool `json:"blockPublicAccess"` // 禁止匿名访问账户下的桶
 }
 
 // IamUser 表示 IAM 用户
@@ -189,6 +191,9 @@ func FormatPolicyARN(accountID, policyName string) string {
 	return "arn:aws:iam::" + accountID + ":policy/" + policyName
 }
 
+// AnonymousUser 匿名请求的访问主体名称
+const AnonymousUser = "anonymous"
+
 func (a *AccessKey) IsExpired() bool {
 	if a.ExpiredAt.IsZero() || a.ExpiredAt.Equal(TimeSentinel) {
 		return false
@@ -127,79 +127,126 @@ func (l *LifecycleConfiguration) AddRule(rule LifecycleRule) error {
 
 // CheckExpiration 检查对象是否应过期
 func (l *LifecycleConfiguration) CheckExpiration(objectKey string, tags map[string]string, createTime time.Time, isDeleteMarker bool) (bool, time.Time) {
-	if l == nil {
+	rule := l.FindExpirationRule(objectKey, tags, createTime, isDeleteMarker)
+	if rule == nil {
 		return false, time.Time{}
 	}
+	_, expirationTime := rule.CheckExpiration(objectKey, tags, createTime, isDeleteMarker)
+	return true, expirationTime
+}
 
-	now := time.Now().UTC()
+// CheckTransition 检查对象是否应转换存储类型
+func (l *LifecycleConfiguration) CheckTransition(objectKey string, tags map[string]string, createTime time.Time) (bool, string, time.Time) {
+	rule := l.FindTransitionRule(objectKey, tags, createTime)
+	if rule == nil {
+		return false, "", time.Time{}
+	}
+	_, transitionTime := rule.CheckTransition(objectKey, tags, createTime)
+	return true, rule.Transition.StorageClass, transitionTime
+}
 
-	for _, rule := range l.Rules {
-		if rule.Status != "Enabled" {
-			continue
+// FindExpirationRule 返回第一条使对象过期的规则，没有则返回 nil
+func (l *LifecycleConfiguration) FindExpirationRule(objectKey string, tags map[string]string, createTime time.Time, isDeleteMarker bool) *LifecycleRule {
+	if l == nil {
+		return nil
+	}
+	for i := range l.Rules {
+		if ok, _ := l.Rules[i].CheckExpiration(objectKey, tags, createTime, isDeleteMarker); ok {
+			return &l.Rules[i]
 		}
+	}
+	return nil
+}
 
-		if !rule.Filter.Matches(objectKey, tags) {
-			continue
+// FindTransitionRule 返回第一条需要转换对象存储类型的规则，没有则返回 nil
+func (l *LifecycleConfiguration) FindTransitionRule(objectKey string, tags map[string]string, createTime time.Time) *LifecycleRule {
+	if l == nil {
+		return nil
+	}
+	for i := range l.Rules {
+		if ok, _ := l.Rules[i].CheckTransition(objectKey, tags, createTime); ok {
+			return &l.Rules[i]
 		}
+	}
+	return nil
+}
 
-		if rule.Expiration != nil {
-			// 处理删除标记过期
-			if isDeleteMarker && rule.Expiration.ExpiredObjectDeleteMarker {
-				return true, now
-			}
-
-			// 基于天数的过期
-			if rule.Expiration.Days > 0 {
-				expirationTime := createTime.AddDate(0, 0, rule.Expiration.Days)
-				if now.After(expirationTime) {
-					return true, expirationTime
-				}
-			}
-
-			// 基于日期的过期
-			if rule.Expiration.Date != nil && now.After(*rule.Expiration.Date) {
-				return true, *rule.Expiration.Date
-			}
+// FindAbortUploadRule 返回第一条需要中止分段上传的规则，没有则返回 nil
+func (l *LifecycleConfiguration) FindAbortUploadRule(objectKey string, initiated time.Time) *LifecycleRule {
+	if l == nil {
+		return nil
+	}
+	for i := range l.Rules {
+		if l.Rules[i].CheckAbortUpload(objectKey, initiated) {
+			return &l.Rules[i]
 		}
 	}
-
-	return false, time.Time{}
+	return nil
 }
 
-// CheckTransition 检查对象是否应转换存储类型
-func (l *LifecycleConfiguration) CheckTransition(objectKey string, tags map[string]string, createTime time.Time) (bool, string, time.Time) {
-	if l == nil {
-		return false, "", time.Time{}
+// CheckExpiration 检查对象是否被该规则过期
+func (r *LifecycleRule) CheckExpiration(objectKey string, tags map[string]string, createTime time.Time, isDeleteMarker bool) (bool, time.Time) {
+	if r.Status != "Enabled" || r.Expiration == nil || !r.Filter.Matches(objectKey, tags) {
+		return false, time.Time{}
 	}
 
 	now := time.Now().UTC()
+	// 处理删除标记过期
+	if isDeleteMarker && r.Expiration.ExpiredObjectDeleteMarker {
+		return true, now
+	}
 
-	for _, rule := range l.Rules {
-		if rule.Status != "Enabled" {
-			continue
+	// 基于天数的过期
+	if r.Expiration.Days > 0 {
+		expirationTime := createTime.AddDate(0, 0, r.Expiration.Days)
+		if now.After(expirationTime) {
+			return true, expirationTime
 		}
+	}
 
-		if !rule.Filter.Matches(objectKey, tags) {
-			continue
-		}
+	// 基于日期的过期
+	if r.Expiration.Date != nil && now.After(*r.Expiration.Date) {
+		return true, *r.Expiration.Date
+	}
+	return false, time.Time{}
+}
 
-		if rule.Transition != nil {
-			// 基于天数的转换
-			if rule.Transition.Days > 0 {
-				transitionTime := createTime.AddDate(0, 0, rule.Transition.Days)
-				if now.After(transitionTime) {
-					return true, rule.Transition.StorageClass, transitionTime
-				}
-			}
+// CheckTransition 检查对象是否需要被该规则转换存储类型
+func (r *LifecycleRule) CheckTransition(objectKey string, tags map[string]string, createTime time.Time) (bool, time.Time) {
+	if r.Status != "Enabled" || r.Transition == nil || !r.Filter.Matches(objectKey, tags) {
+		return false, time.Time{}
+	}
 
-			// 基于日期的转换
-			if rule.Transition.Date != nil && now.After(*rule.Transition.Date) {
-				return true, rule.Transition.StorageClass, *rule.Transition.Date
-			}
+	now := time.Now().UTC()
+	// 基于天数的转换
+	if r.Transition.Days > 0 {
+		transitionTime := createTime.AddDate(0, 0, r.Transition.Days)
+		if now.After(transitionTime) {
+			return true, transitionTime
 		}
 	}
 
-	return false, "", time.Time{}
+	// 基于日期的转换
+	if r.Transition.Date != nil && now.After(*r.Transition.Date) {
+		return true, *r.Transition.Date
+	}
+	return false, time.Time{}
+}
+
+// CheckAbortUpload 检查分段上传是否已超过该规则允许的天数
+// 分段上传没有标签，只按前缀匹配
+func (r *LifecycleRule) CheckAbortUpload(objectKey string, initiated time.Time) bool {
+	if r.Status != "Enabled" || r.AbortIncompleteMultipartUpload == nil || r.Filter == nil {
+		return false
+	}
+	if r.Filter.Tag != nil || (r.Filter.And != nil && len(r.Filter.And.Tags) > 0) {
+		return false
+	}
+	if !r.Filter.Matches(objectKey, nil) {
+		return false
+	}
+	deadline := initiated.AddDate(0, 0, r.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+	return time.Now().UTC().After(deadline)
 }
 
 // Matches 检查对象是否匹配过滤规则
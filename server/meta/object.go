@@ -56,6 +56,14 @@ type BaseObject struct {
 	// 数据位置（实际存储系统中使用）
 	DataLocation string `json:"dataLocation" xml:"-"` // 对象数据存储位置，不序列化到 XML
 	ObjType      int    `json:"-" xml:"-"`            // 辅助字段，仅仅存在内存中
+	SSEKey       []byte `json:"-" xml:"-"`            // 对象数据密钥明文，不为空时chunk在去重前加密，仅仅存在内存中
+	// 对象的内容类型是已经压缩过的格式，写块时不尝试压缩它的 chunk，仅仅存在内存中
+	Incompressible bool `json:"-" xml:"-"`
+	// 去重范围，为空时chunk全局去重；DedupKey 不为空时 chunk 用范围密钥做了收敛加密
+	DedupScope string     `json:"dedupScope,omitempty" xml:"-"`
+	DedupKey   *ObjectSSE `json:"dedupKey,omitempty" xml:"-"`
+	// 附加校验和，上传时没有带校验和为空
+	Checksum *Checksum `json:"checksum,omitempty" xml:"-"`
 }
 
 // Object 表示存储桶中的一个对象
@@ -63,6 +71,7 @@ type Object struct {
 	// 对象标识信息
 	BaseObject                // 必须匿名嵌入，且是第一个字段
 	VersionID    string       `json:"versionId" xml:"VersionId"`      // 版本ID（如果启用版本控制）
+	DeleteMarker bool         `json:"deleteMarker,omitempty" xml:"-"` // 是否是删除标记
 	ChunksInline *InlineChunk `json:"chunk_inline" xml:"ChunkInline"` // inline chunk
 
 	// 内容信息
@@ -73,13 +82,17 @@ type Object struct {
 	CacheControl       string `json:"cacheControl" xml:"CacheControl"`             // 缓存控制
 
 	// 加密信息
-	EncryptionType string `json:"encryptionType" xml:"EncryptionType"` // 加密类型 (AES256, aws:kms)
-	KMSKeyID       string `json:"kmsKeyId" xml:"KMSKeyID"`             // KMS密钥ID
+	EncryptionType string     `json:"encryptionType" xml:"EncryptionType"` // 加密类型 (AES256, aws:kms)
+	KMSKeyID       string     `json:"kmsKeyId" xml:"KMSKeyID"`             // KMS密钥ID
+	SSE            *ObjectSSE `json:"sse,omitempty" xml:"-"`               // 对象数据密钥
 
 	// 存储信息
 	StorageClass  string `json:"storageClass" xml:"StorageClass"`   // 存储类别
 	RestoreStatus string `json:"restoreStatus" xml:"RestoreStatus"` // 恢复状态
 
+	// 复制信息
+	ReplicationStatus string `json:"replicationStatus,omitempty" xml:"-"` // 复制状态 (PENDING, COMPLETED, FAILED)
+
 	// 元数据信息
 	UserMetadata map[string]string `json:"userMetadata" xml:"-"` // 用户自定义元数据
 	Tags         map[string]string `json:"tags" xml:"-"`         // 对象标签
@@ -89,11 +102,49 @@ type Object struct {
 	LockRetainUntil time.Time `json:"lockRetainUntil" xml:"LockRetainUntil"` // 锁定保留截止时间
 	LegalHold       bool      `json:"legalHold" xml:"LegalHold"`             // 法律保留状态
 
+	// 分段信息，只有分段上传的对象才有
+	Parts []ObjectPart `json:"parts,omitempty" xml:"-"`
+
 	// 所有者信息
 	Owner Owner                `json:"owner" xml:"Owner"` // 对象所有者
 	ACL   *AccessControlPolicy `json:"acl" xml:"Acl"`     // 访问控制列表
 }
 
+// ObjectPart 分段上传完成后对象中每个分段的边界
+type ObjectPart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       Etag   `json:"etag"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum,omitempty"` // 分段的校验和，算法和对象的相同
+}
+
+// Checksum 对象或分段的附加校验和
+type Checksum struct {
+	Algorithm string `json:"algorithm"` // CRC32、CRC32C、SHA1、SHA256、CRC64NVME
+	Type      string `json:"type"`      // FULL_OBJECT 或 COMPOSITE
+	Value     string `json:"value"`     // base64 编码，COMPOSITE 的值带 -分段数 后缀
+}
+
+// Values 按 CRC32、CRC32C、SHA1、SHA256、CRC64NVME 的顺序返回校验和，只有对象使用的算法有值
+func (c *Checksum) Values() (crc32, crc32c, sha1, sha256, crc64nvme string) {
+	if c == nil {
+		return
+	}
+	switch c.Algorithm {
+	case "CRC32":
+		crc32 = c.Value
+	case "CRC32C":
+		crc32c = c.Value
+	case "SHA1":
+		sha1 = c.Value
+	case "SHA256":
+		sha256 = c.Value
+	case "CRC64NVME":
+		crc64nvme = c.Value
+	}
+	return
+}
+
 // Owner 表示对象所有者信息
 type Owner struct {
 	ID          string `json:"id" xml:"ID,omitempty"`                   // 所有者ID
@@ -139,6 +190,27 @@ func BuildResourceARN(bucketName, objectKey string) string {
 	return "arn:aws:s3:::" + bucketName
 }
 
+// GetVersionID 获取对外展示的版本ID，未开启版本控制时写入的对象版本ID为 null
+func (o *Object) GetVersionID() string {
+	if o.VersionID == "" {
+		return NullVersionID
+	}
+	return o.VersionID
+}
+
+// GetRetention 获取对象的保留设置，未设置时返回 nil
+func (o *Object) GetRetention() *Retention {
+	if o.LockMode == "" {
+		return nil
+	}
+	return &Retention{Mode: o.LockMode, RetainUntilDate: o.LockRetainUntil}
+}
+
+// IsLocked 检查对象是否处于保留期或法律保留中，不能被删除或覆盖
+func (o *Object) IsLocked(bypassGovernance bool) bool {
+	return o.LegalHold || !o.GetRetention().IsDeletionAllowed(bypassGovernance)
+}
+
 // MarshalXML 实现：输出 <ETag>"actual-etag"</ETag>
 func (e Etag) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
 	// 我们要输出的是字符串内容为 "actual-etag" 的文本节点
@@ -337,6 +409,16 @@ func (o *Object) Clone() *Object {
 	cp.Chunks = make([]string, len(o.Chunks))
 	copy(cp.Chunks, o.Chunks)
 
+	if o.Parts != nil {
+		cp.Parts = make([]ObjectPart, len(o.Parts))
+		copy(cp.Parts, o.Parts)
+	}
+
+	if o.Checksum != nil {
+		checksum := *o.Checksum
+		cp.Checksum = &checksum
+	}
+
 	if o.ChunksInline != nil {
 		cp.ChunksInline = &InlineChunk{
 			Compress: o.ChunksInline.Compress,
@@ -22,6 +22,16 @@ import (
 	"time"
 )
 
+const (
+	// RetentionGovernance 治理模式，拥有 bypass 权限的用户可以提前删除或缩短保留期
+	RetentionGovernance = "GOVERNANCE"
+	// RetentionCompliance 合规模式，保留期内任何用户都不能删除对象或缩短保留期
+	RetentionCompliance = "COMPLIANCE"
+
+	LegalHoldOn  = "ON"
+	LegalHoldOff = "OFF"
+)
+
 // ObjectLockConfiguration 表示对象锁定配置
 type ObjectLockConfiguration struct {
 	XMLName           xml.Name        `xml:"ObjectLockConfiguration" json:"objectLockConfiguration"`
@@ -47,13 +57,17 @@ type DefaultRetention struct {
 
 // Retention 表示对象保留设置
 type Retention struct {
-	Mode            string    `xml:"Mode"` // GOVERNANCE | COMPLIANCE
+	XMLName         xml.Name  `xml:"Retention"`
+	XMLNS           string    `xml:"xmlns,attr,omitempty"`
+	Mode            string    `xml:"Mode,omitempty"` // GOVERNANCE | COMPLIANCE
 	RetainUntilDate time.Time `xml:"RetainUntilDate"`
 }
 
 // LegalHold 表示法律保留设置
 type LegalHold struct {
-	Status string `xml:"Status"` // ON | OFF
+	XMLName xml.Name `xml:"LegalHold"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status"` // ON | OFF
 }
 
 // Enable 启用对象锁定
@@ -119,6 +133,61 @@ func (r *Retention) IsDeletionAllowed(bypassGovernance bool) bool {
 	return true
 }
 
+// IsUpdateAllowed 检查是否允许把保留设置修改为 next，next 为 nil 表示移除保留设置
+// 延长保留期总是允许的；合规模式不能缩短、移除或降级为治理模式；治理模式需要 bypass 才能缩短或移除
+func (r *Retention) IsUpdateAllowed(next *Retention, bypassGovernance bool) bool {
+	if r == nil || !time.Now().UTC().Before(r.RetainUntilDate) {
+		return true
+	}
+
+	weaken := next == nil || next.RetainUntilDate.Before(r.RetainUntilDate)
+	if r.Mode == RetentionCompliance {
+		return !weaken && next.Mode == RetentionCompliance
+	}
+	if weaken {
+		return bypassGovernance
+	}
+	return true
+}
+
+// Validate 验证对象保留设置，Mode 和 RetainUntilDate 都为空表示移除保留设置
+func (r *Retention) Validate() error {
+	if r == nil {
+		return errors.New("retention not initialized")
+	}
+	if r.Mode == "" && r.RetainUntilDate.IsZero() {
+		return nil
+	}
+	if r.Mode != RetentionGovernance && r.Mode != RetentionCompliance {
+		return errors.New("invalid retention mode, must be 'GOVERNANCE' or 'COMPLIANCE'")
+	}
+	if r.RetainUntilDate.IsZero() {
+		return errors.New("retain until date must be specified")
+	}
+	return nil
+}
+
+// IsEmpty 检查是否是移除保留设置的请求
+func (r *Retention) IsEmpty() bool {
+	return r == nil || (r.Mode == "" && r.RetainUntilDate.IsZero())
+}
+
+// Validate 验证法律保留设置
+func (l *LegalHold) Validate() error {
+	if l == nil {
+		return errors.New("legal hold not initialized")
+	}
+	if l.Status != LegalHoldOn && l.Status != LegalHoldOff {
+		return errors.New("invalid legal hold status, must be 'ON' or 'OFF'")
+	}
+	return nil
+}
+
+// RetainUntil 根据默认保留规则计算保留截止时间
+func (d *DefaultRetention) RetainUntil(from time.Time) time.Time {
+	return from.AddDate(d.Years, 0, d.Days)
+}
+
 // IsLegalHoldActive 检查法律保留是否激活
 func (l *LegalHold) IsLegalHoldActive() bool {
 	return l != nil && l.Status == "ON"
@@ -135,10 +204,10 @@ func (o *ObjectLockConfiguration) Validate() error {
 		return errors.New("invalid xmlns for object lock configuration")
 	}
 
-	// 如果启用了对象锁定，需要验证规则
+	// 如果启用了对象锁定，需要验证规则，没有规则表示不设置默认保留
 	if o.ObjectLockEnabled == "Enabled" {
 		if o.Rule == nil {
-			return errors.New("rule must be specified when object lock is enabled")
+			return nil
 		}
 
 		// 验证规则中的默认保留设置
@@ -46,10 +46,11 @@ type PartInfo struct {
 	LastModified time.Time `json:"lastModified" xml:"LastModified"`
 
 	// Checksum 字段（可选）
-	ChecksumCRC32  string `json:"checksumCrc32,omitempty" xml:"ChecksumCRC32,omitempty"`
-	ChecksumCRC32C string `json:"checksumCrc32c,omitempty" xml:"ChecksumCRC32C,omitempty"`
-	ChecksumSHA1   string `json:"checksumSha1,omitempty" xml:"ChecksumSHA1,omitempty"`
-	ChecksumSHA256 string `json:"checksumSha256,omitempty" xml:"ChecksumSHA256,omitempty"`
+	ChecksumCRC32     string `json:"checksumCrc32,omitempty" xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `json:"checksumCrc32c,omitempty" xml:"ChecksumCRC32C,omitempty"`
+	ChecksumSHA1      string `json:"checksumSha1,omitempty" xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `json:"checksumSha256,omitempty" xml:"ChecksumSHA256,omitempty"`
+	ChecksumCRC64NVME string `json:"checksumCrc64nvme,omitempty" xml:"ChecksumCRC64NVME,omitempty"`
 }
 
 // MultipartUpload 表示一个分段上传任务
@@ -67,11 +68,17 @@ type MultipartUpload struct {
 	ContentDisposition string            `json:"contentDisposition,omitempty" xml:"ContentDisposition,omitempty"` // 内容处置
 	UserMetadata       map[string]string `json:"userMetadata,omitempty" xml:"UserMetadata,omitempty"`             // 用户自定义元数据
 	Encryption         EncryptionInfo    `json:"encryption,omitempty" xml:"Encryption,omitempty"`                 // 加密信息
+	SSE                *ObjectSSE        `json:"sse,omitempty" xml:"-"`                                           // 各分段共用的对象数据密钥
 	ACL                string            `json:"acl,omitempty" xml:"ACL,omitempty"`                               // 访问控制列表
 	Tags               map[string]string `json:"tags,omitempty" xml:"Tags,omitempty"`                             // 对象标签
 	Parts              []PartInfo        `json:"parts,omitempty" xml:"Parts>Part,omitempty"`                      // 已上传的分段列表
 	Created            time.Time         `json:"created" xml:"Created"`                                           // 创建时间
 	DataLocation       string            `json:"dataLocation" xml:"DataLocation,omitempty"`                       // 数据存储位置
+	LockMode           string            `json:"lockMode,omitempty" xml:"-"`                                      // 锁定模式
+	LockRetainUntil    time.Time         `json:"lockRetainUntil,omitempty" xml:"-"`                               // 锁定保留截止时间
+	LegalHold          bool              `json:"legalHold,omitempty" xml:"-"`                                     // 法律保留状态
+	ChecksumAlgorithm  string            `json:"checksumAlgorithm,omitempty" xml:"-"`                             // 各分段使用的校验和算法
+	ChecksumType       string            `json:"checksumType,omitempty" xml:"-"`                                  // 对象校验和的类型，FULL_OBJECT 或 COMPOSITE
 }
 
 // Initiator 表示任务发起者
@@ -88,8 +95,9 @@ type EncryptionInfo struct {
 
 // PartETag 表示分段ETag信息（用于完成上传）
 type PartETag struct {
-	PartNumber int  `json:"partNumber" xml:"PartNumber"`
-	ETag       Etag `json:"etag" xml:"ETag"`
+	PartNumber int    `json:"partNumber" xml:"PartNumber"`
+	ETag       Etag   `json:"etag" xml:"ETag"`
+	Checksum   string `json:"checksum,omitempty" xml:"-"` // 客户端提供的分段校验和，为空时不校验
 }
 
 // CompleteMultipartUpload 表示完成分段上传的请求体
@@ -111,6 +119,16 @@ type CompletePart struct {
 	ChecksumCRC64NVME string   `xml:"ChecksumCRC64NVME,omitempty"`
 }
 
+// ChecksumValue 分段的校验和，客户端只会带上传时声明的那一种算法
+func (p *CompletePart) ChecksumValue() string {
+	for _, v := range []string{p.ChecksumCRC32, p.ChecksumCRC32C, p.ChecksumSHA1, p.ChecksumSHA256, p.ChecksumCRC64NVME} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // 转换函数
 func PartToBaseObject(obj *PartObject) *BaseObject {
 	return (*BaseObject)(unsafe.Pointer(obj))
@@ -124,6 +142,10 @@ func (p *PartObject) Clone() *PartObject {
 	cp := &PartObject{}
 	*cp = *p // 浅拷贝所有字段
 	cp.Chunks = append([]string(nil), p.Chunks...)
+	if p.Checksum != nil {
+		checksum := *p.Checksum
+		cp.Checksum = &checksum
+	}
 
 	return cp
 }
@@ -57,6 +57,46 @@ type Principal struct {
 	CanonicalUser StringOrArray `json:"CanonicalUser,omitempty"` // 规范用户ID
 }
 
+// UnmarshalJSON 自定义JSON解析，支持 "Principal": "*" 的写法
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		if str != "*" {
+			return fmt.Errorf("invalid principal %q", str)
+		}
+		*p = Principal{AWS: StringOrArray{"*"}}
+		return nil
+	}
+	type alias Principal
+	var v alias
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Principal(v)
+	return nil
+}
+
+// IsEmpty 主体是否为空
+func (p *Principal) IsEmpty() bool {
+	return p == nil || (len(p.AWS) == 0 && len(p.Federated) == 0 && len(p.Service) == 0 && len(p.CanonicalUser) == 0)
+}
+
+// IsPublic 主体是否包含所有用户 (*)
+func (p *Principal) IsPublic() bool {
+	if p == nil {
+		return false
+	}
+	for _, v := range p.AWS {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
 // ConditionBlock 表示条件块
 type ConditionBlock map[string]map[string]StringOrArray
 
@@ -116,6 +156,44 @@ func (p *BucketPolicy) IsAllowed(principalARN, action, resource string, context
 	return result, nil
 }
 
+// IsPublicAllowed 检查匿名访问者是否被允许执行操作
+// 只有主体显式为所有用户 (*) 的 Allow 声明才授权匿名访问，匹配的 Deny 声明优先
+func (p *BucketPolicy) IsPublicAllowed(action, resource string, context map[string]string) bool {
+	if p == nil {
+		return false
+	}
+	result := false
+	for _, stmt := range p.Statements {
+		matches, err := stmt.Matches("*", action, resource, context)
+		if err != nil || !matches {
+			continue
+		}
+		if stmt.Effect == "Deny" {
+			return false
+		}
+		if stmt.Effect == "Allow" && stmt.Principal.IsPublic() {
+			result = true
+		}
+	}
+	return result
+}
+
+// IsPublicDenied 判断桶策略是否显式拒绝匿名主体执行操作
+func (p *BucketPolicy) IsPublicDenied(action, resource string, context map[string]string) bool {
+	if p == nil {
+		return false
+	}
+	for _, stmt := range p.Statements {
+		if stmt.Effect != "Deny" {
+			continue
+		}
+		if matches, err := stmt.Matches("*", action, resource, context); err == nil && matches {
+			return true
+		}
+	}
+	return false
+}
+
 // Matches 检查声明是否匹配给定参数
 func (s *Statement) Matches(principalARN, action, resource string, context map[string]string) (bool, error) {
 	// 检查主体
@@ -144,7 +222,7 @@ func (s *Statement) Matches(principalARN, action, resource string, context map[s
 // principalMatches 检查主体匹配
 func (s *Statement) principalMatches(principalARN string) bool {
 	// 处理NotPrincipal
-	if len(s.NotPrincipal.AWS) > 0 {
+	if s.NotPrincipal != nil {
 		for _, np := range s.NotPrincipal.AWS {
 			if matchARN(np, principalARN) {
 				return false
@@ -153,10 +231,7 @@ func (s *Statement) principalMatches(principalARN string) bool {
 	}
 
 	// 如果Principal为空，则匹配所有主体
-	if len(s.Principal.AWS) == 0 &&
-		len(s.Principal.Federated) == 0 &&
-		len(s.Principal.Service) == 0 &&
-		len(s.Principal.CanonicalUser) == 0 {
+	if s.Principal.IsEmpty() {
 		return true
 	}
 
@@ -448,10 +523,7 @@ func (p *BucketPolicy) Validate() error {
 
 		// 检查互斥字段
 		// Principal和NotPrincipal不能同时存在
-		if (len(stmt.Principal.AWS) > 0 || len(stmt.Principal.Federated) > 0 ||
-			len(stmt.Principal.Service) > 0 || len(stmt.Principal.CanonicalUser) > 0) &&
-			(len(stmt.NotPrincipal.AWS) > 0 || len(stmt.NotPrincipal.Federated) > 0 ||
-				len(stmt.NotPrincipal.Service) > 0 || len(stmt.NotPrincipal.CanonicalUser) > 0) {
+		if !stmt.Principal.IsEmpty() && !stmt.NotPrincipal.IsEmpty() {
 			return fmt.Errorf("Principal and NotPrincipal cannot both be specified in statement %d", i)
 		}
 
@@ -620,17 +692,8 @@ func (p *BucketPolicy) IsPolicyPublic() bool {
 			continue
 		}
 
-		// 检查主体是否是所有用户 (*)
-		publicPrincipal := false
-		for _, p := range stmt.Principal.AWS {
-			if p == "*" {
-				publicPrincipal = true
-				break
-			}
-		}
-
 		// 如果不是面向所有用户，跳过
-		if !publicPrincipal {
+		if !stmt.Principal.IsPublic() {
 			continue
 		}
 
@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package meta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// POST 策略支持的条件
+const (
+	PostPolicyEq                 = "eq"
+	PostPolicyStartsWith         = "starts-with"
+	PostPolicyContentLengthRange = "content-length-range"
+)
+
+var ErrPostPolicyExpired = errors.New("policy expired")
+
+// postPolicyExemptFields 不需要在策略条件中声明的表单字段
+var postPolicyExemptFields = map[string]bool{
+	"file":            true,
+	"policy":          true,
+	"x-amz-signature": true,
+}
+
+// PostPolicy 浏览器表单上传的 POST 策略
+type PostPolicy struct {
+	Expiration time.Time
+	Conditions []PostPolicyCondition
+}
+
+// PostPolicyCondition 表示一条策略条件，Field 为不带 $ 前缀的小写字段名
+type PostPolicyCondition struct {
+	Operator string
+	Field    string
+	Value    string
+	Min      int64
+	Max      int64
+}
+
+// ParsePostPolicy 解析 base64 解码后的 POST 策略
+func ParsePostPolicy(data []byte) (*PostPolicy, error) {
+	var raw struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	if raw.Expiration == "" {
+		return nil, errors.New("policy expiration is required")
+	}
+	expiration, err := time.Parse(time.RFC3339Nano, raw.Expiration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy expiration '%s'", raw.Expiration)
+	}
+
+	policy := &PostPolicy{Expiration: expiration}
+	for _, item := range raw.Conditions {
+		// {"bucket": "name"} 形式等价于 ["eq", "$bucket", "name"]
+		var exact map[string]string
+		if err := json.Unmarshal(item, &exact); err == nil {
+			for field, value := range exact {
+				policy.Conditions = append(policy.Conditions, PostPolicyCondition{
+					Operator: PostPolicyEq,
+					Field:    strings.ToLower(field),
+					Value:    value,
+				})
+			}
+			continue
+		}
+
+		var list []any
+		if err := json.Unmarshal(item, &list); err != nil || len(list) != 3 {
+			return nil, fmt.Errorf("invalid policy condition %s", string(item))
+		}
+		operator, _ := list[0].(string)
+		operator = strings.ToLower(operator)
+		switch operator {
+		case PostPolicyEq, PostPolicyStartsWith:
+			field, ok1 := list[1].(string)
+			value, ok2 := list[2].(string)
+			if !ok1 || !ok2 || !strings.HasPrefix(field, "$") {
+				return nil, fmt.Errorf("invalid policy condition %s", string(item))
+			}
+			policy.Conditions = append(policy.Conditions, PostPolicyCondition{
+				Operator: operator,
+				Field:    strings.ToLower(strings.TrimPrefix(field, "$")),
+				Value:    value,
+			})
+		case PostPolicyContentLengthRange:
+			minSize, ok1 := list[1].(float64)
+			maxSize, ok2 := list[2].(float64)
+			if !ok1 || !ok2 || minSize < 0 || minSize > maxSize {
+				return nil, fmt.Errorf("invalid content-length-range %s", string(item))
+			}
+			policy.Conditions = append(policy.Conditions, PostPolicyCondition{
+				Operator: operator,
+				Min:      int64(minSize),
+				Max:      int64(maxSize),
+			})
+		default:
+			return nil, fmt.Errorf("unknown policy condition %s", string(item))
+		}
+	}
+	return policy, nil
+}
+
+// Check 检查表单字段是否满足策略，form 的 key 为小写字段名
+// 除了签名、策略和 x-ignore- 开头的字段，每个表单字段都必须有对应的条件
+func (p *PostPolicy) Check(form map[string]string, now time.Time) error {
+	if now.After(p.Expiration) {
+		return ErrPostPolicyExpired
+	}
+
+	covered := make(map[string]bool)
+	for _, cond := range p.Conditions {
+		if cond.Operator == PostPolicyContentLengthRange {
+			continue
+		}
+		covered[cond.Field] = true
+		value := form[cond.Field]
+		switch cond.Operator {
+		case PostPolicyEq:
+			if value != cond.Value {
+				return fmt.Errorf("policy condition failed: [\"eq\", \"$%s\", \"%s\"]", cond.Field, cond.Value)
+			}
+		case PostPolicyStartsWith:
+			if !postPolicyStartsWith(cond.Field, value, cond.Value) {
+				return fmt.Errorf("policy condition failed: [\"starts-with\", \"$%s\", \"%s\"]", cond.Field, cond.Value)
+			}
+		}
+	}
+
+	for field := range form {
+		if postPolicyExemptFields[field] || strings.HasPrefix(field, "x-ignore-") || covered[field] {
+			continue
+		}
+		return fmt.Errorf("extra input fields: %s", field)
+	}
+	return nil
+}
+
+// postPolicyStartsWith Content-Type 可以是逗号分隔的多个值，每个值都需要满足前缀条件
+func postPolicyStartsWith(field, value, prefix string) bool {
+	if field != "content-type" {
+		return strings.HasPrefix(value, prefix)
+	}
+	for _, v := range strings.Split(value, ",") {
+		if !strings.HasPrefix(strings.TrimSpace(v), prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContentLengthRange 返回策略限制的文件大小范围，没有限制时 ok 为 false
+func (p *PostPolicy) ContentLengthRange() (minSize, maxSize int64, ok bool) {
+	for _, cond := range p.Conditions {
+		if cond.Operator == PostPolicyContentLengthRange {
+			return cond.Min, cond.Max, true
+		}
+	}
+	return 0, 0, false
+}
@@ -19,10 +19,22 @@ package meta
 import (
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
+const (
+	// 对象的复制状态，通过 x-amz-replication-status 返回
+	ReplicationStatusPending   = "PENDING"
+	ReplicationStatusCompleted = "COMPLETED"
+	ReplicationStatusFailed    = "FAILED"
+
+	// ReplicationBucketArnPrefix 复制目标桶 ARN 的前缀
+	ReplicationBucketArnPrefix = "arn:aws:s3:::"
+)
+
 // ReplicationConfiguration 表示跨区域复制配置
 type ReplicationConfiguration struct {
 	XMLName xml.Name `xml:"ReplicationConfiguration" json:"replicationConfiguration"`
@@ -134,15 +146,55 @@ func (r *ReplicationConfiguration) AddRule(rule Rule) error {
 	return nil
 }
 
+// Validate 校验复制配置
+func (r *ReplicationConfiguration) Validate() error {
+	if r == nil {
+		return errors.New("replication configuration is nil")
+	}
+	if r.Role == "" {
+		return errors.New("replication role is required")
+	}
+	if len(r.Rules) == 0 || len(r.Rules) > 1000 {
+		return fmt.Errorf("replication configuration must have 1 to 1000 rules, got %d", len(r.Rules))
+	}
+
+	ruleIDs := make(map[string]bool)
+	for i, rule := range r.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule ID is required for rule %d", i)
+		}
+		if ruleIDs[rule.ID] {
+			return fmt.Errorf("duplicate rule ID '%s'", rule.ID)
+		}
+		ruleIDs[rule.ID] = true
+
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return fmt.Errorf("invalid rule status '%s' in rule %s", rule.Status, rule.ID)
+		}
+		if !strings.HasPrefix(rule.Destination.Bucket, ReplicationBucketArnPrefix) ||
+			len(rule.Destination.Bucket) == len(ReplicationBucketArnPrefix) {
+			return fmt.Errorf("invalid destination bucket '%s' in rule %s", rule.Destination.Bucket, rule.ID)
+		}
+		if rule.DeleteMarkerReplication != nil &&
+			rule.DeleteMarkerReplication.Status != "Enabled" && rule.DeleteMarkerReplication.Status != "Disabled" {
+			return fmt.Errorf("invalid delete marker replication status '%s' in rule %s", rule.DeleteMarkerReplication.Status, rule.ID)
+		}
+	}
+	return nil
+}
+
 // ShouldReplicate 检查对象是否应被复制
 func (r *ReplicationConfiguration) ShouldReplicate(objectKey string, tags map[string]string, isSSEKMS bool, isDeleteMarker bool) (bool, Destination) {
 	if r == nil || r.Role == "" {
 		return false, Destination{}
 	}
 
-	// 按优先级排序规则
-	rules := r.Rules
-	// 实际实现中需要按优先级排序
+	// 按优先级排序规则，Priority 越大优先级越高
+	rules := make([]Rule, len(r.Rules))
+	copy(rules, r.Rules)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
 
 	for _, rule := range rules {
 		if rule.Status != "Enabled" {
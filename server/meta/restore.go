@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package meta
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	RESTORE_PREKEY = "aws:restore:"
+
+	RestoreTierExpedited = "Expedited"
+	RestoreTierStandard  = "Standard"
+	RestoreTierBulk      = "Bulk"
+)
+
+// RestoreRequest 表示 RestoreObject 请求
+type RestoreRequest struct {
+	XMLName              xml.Name              `xml:"RestoreRequest"`
+	XMLNS                string                `xml:"xmlns,attr,omitempty"`
+	Days                 int                   `xml:"Days,omitempty"`
+	GlacierJobParameters *GlacierJobParameters `xml:"GlacierJobParameters,omitempty"`
+	Type                 string                `xml:"Type,omitempty"` // SELECT，不支持
+	Tier                 string                `xml:"Tier,omitempty"`
+	Description          string                `xml:"Description,omitempty"`
+}
+
+// GlacierJobParameters 表示恢复任务的参数
+type GlacierJobParameters struct {
+	Tier string `xml:"Tier"` // Expedited | Standard | Bulk
+}
+
+// Restore 归档对象版本的恢复任务，以及恢复出来的临时副本
+// 副本的数据写在 DataLocation 存储点，过期后回收
+type Restore struct {
+	AccountID    string    `json:"accountId"`
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	VersionID    string    `json:"versionId"`
+	ETag         Etag      `json:"etag"`         // 源对象版本的 ETag，用于检查源对象是否被修改
+	LastModified time.Time `json:"lastModified"` // 源对象版本的修改时间
+	Tier         string    `json:"tier"`
+	Days         int       `json:"days"`
+	Ongoing      bool      `json:"ongoing"`    // 恢复任务是否还在进行
+	RequestAt    time.Time `json:"requestAt"`  // 发起恢复的时间
+	ExpiryDate   time.Time `json:"expiryDate"` // 临时副本的过期时间
+	DataLocation string    `json:"dataLocation"`
+	Chunks       []string  `json:"chunks"`
+}
+
+// IsArchiveClass 归档存储类别的对象需要先恢复才能读取
+func IsArchiveClass(storageClass string) bool {
+	return storageClass == GLACIER_CLASS_STORAGE || storageClass == DEEP_ARCHIVE_CLASS_STORAGE
+}
+
+// GenRestoreKey 生成对象版本恢复任务的 key
+func GenRestoreKey(accountID, bucket, key, versionID string) string {
+	return RESTORE_PREKEY + accountID + ":" + bucket + "/" + key + "\x00" + versionID
+}
+
+// RestoreExpiry 临时副本保留 days 天，和 S3 一样向后取整到 UTC 零点
+func RestoreExpiry(from time.Time, days int) time.Time {
+	t := from.UTC().AddDate(0, 0, days)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if midnight.Before(t) {
+		midnight = midnight.AddDate(0, 0, 1)
+	}
+	return midnight
+}
+
+// GetTier 获取恢复速度，未指定时为 Standard
+func (r *RestoreRequest) GetTier() string {
+	if r.GlacierJobParameters != nil && r.GlacierJobParameters.Tier != "" {
+		return r.GlacierJobParameters.Tier
+	}
+	if r.Tier != "" {
+		return r.Tier
+	}
+	return RestoreTierStandard
+}
+
+// Validate 检查恢复请求，只支持把对象恢复为临时副本
+func (r *RestoreRequest) Validate() error {
+	if r.Type != "" {
+		return fmt.Errorf("restore request type %s is not supported", r.Type)
+	}
+	if r.Days < 1 {
+		return errors.New("restore days must be a positive integer")
+	}
+	switch r.GetTier() {
+	case RestoreTierExpedited, RestoreTierStandard, RestoreTierBulk:
+	default:
+		return fmt.Errorf("invalid restore tier %s", r.GetTier())
+	}
+	return nil
+}
+
+// Matches 检查恢复任务是否属于对象的这个版本，对象被覆盖后旧的恢复副本不能再使用
+func (r *Restore) Matches(obj *Object) bool {
+	return r.VersionID == obj.GetVersionID() && r.ETag == obj.ETag && r.LastModified.Equal(obj.LastModified)
+}
+
+// IsExpired 临时副本是否已经过期
+func (r *Restore) IsExpired(now time.Time) bool {
+	return !r.Ongoing && !now.Before(r.ExpiryDate)
+}
+
+// Status 返回 x-amz-restore 头的值
+func (r *Restore) Status() string {
+	if r.Ongoing {
+		return `ongoing-request="true"`
+	}
+	return fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`, r.ExpiryDate.UTC().Format(http.TimeFormat))
+}
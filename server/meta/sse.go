@@ -19,6 +19,7 @@ package meta
 import (
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -88,6 +89,29 @@ func (s *BucketSSEConfiguration) ApplyDefaultEncryption(algorithm, kmsKeyID stri
 	return nil
 }
 
+// Validate 检查加密配置，只支持 AES256 和 aws:kms，KMSMasterKeyID 只能和 aws:kms 一起使用
+func (s *BucketSSEConfiguration) Validate() error {
+	if len(s.Rules) == 0 {
+		return errors.New("missing encryption rule")
+	}
+	for _, rule := range s.Rules {
+		def := rule.ApplyServerSideEncryptionByDefault
+		if def == nil {
+			return errors.New("missing ApplyServerSideEncryptionByDefault")
+		}
+		switch def.SSEAlgorithm {
+		case "AES256":
+			if def.KMSMasterKeyID != "" {
+				return errors.New("KMSMasterKeyID is only allowed with aws:kms")
+			}
+		case "aws:kms":
+		default:
+			return fmt.Errorf("unsupported encryption algorithm %s", def.SSEAlgorithm)
+		}
+	}
+	return nil
+}
+
 // IsEnabled 检查加密是否启用
 func (s *BucketSSEConfiguration) IsEnabled() bool {
 	if s == nil || len(s.Rules) == 0 {
@@ -160,3 +184,20 @@ func (s *BucketSSEConfiguration) UnmarshalXML(d *xml.Decoder, start xml.StartEle
 	}
 	return nil
 }
+
+// ObjectSSE 对象数据加密信息，对象的数据密钥随机生成，包装后和对象元数据一起保存
+// SSE-S3 由主密钥包装，KeyID 为主密钥ID；SSE-KMS 由账户的 KMS 密钥包装，KeyID 为 KMS 密钥ID
+// SSE-C 由客户提供的密钥包装，服务端只保存客户密钥加盐后的 HMAC，用来校验读取时的密钥
+type ObjectSSE struct {
+	KeyID             string `json:"keyId"`
+	KeyVersion        int    `json:"keyVersion,omitempty"`        // KMS 密钥版本
+	DataKey           []byte `json:"dataKey"`                     // 包装后的数据密钥
+	CustomerAlgorithm string `json:"customerAlgorithm,omitempty"` // SSE-C 加密算法
+	KeySalt           []byte `json:"keySalt,omitempty"`           // SSE-C 客户密钥 HMAC 的盐
+	KeyHMAC           []byte `json:"keyHmac,omitempty"`           // SSE-C 客户密钥的 HMAC
+}
+
+// IsCustomerKey 是否使用客户提供的密钥加密
+func (s *ObjectSSE) IsCustomerKey() bool {
+	return s != nil && s.CustomerAlgorithm != ""
+}
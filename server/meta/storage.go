@@ -18,6 +18,7 @@
 package meta
 
 import (
+	"errors"
 	"fmt"
 	"github.com/mageg-x/dedups3/plugs/block"
 
@@ -77,6 +78,14 @@ const (
 	// 适用场景：需要快速访问的长期备份、合规归档
 	GLACIER_IR_CLASS_STORAGE = "GLACIER_IR"
 
+	// GLACIER（S3 Glacier Flexible Retrieval）
+	// 归档存储类，数据不能直接读取，需要先 restore 出临时副本。
+	// 特点：
+	//   - 检索时间从数分钟到数小时
+	//   - 最小存储 90 天
+	// 适用场景：一年访问一两次的备份、灾备数据
+	GLACIER_CLASS_STORAGE = "GLACIER"
+
 	// DEEP_ARCHIVE（S3 Glacier Deep Archive）
 	// 深度归档存储类，成本最低，适合极少访问的数据。
 	// 特点：
@@ -112,10 +121,34 @@ type Storage struct {
 }
 
 type ChunkConfig struct {
-	ChunkSize int32 `json:"chunkSize"`
-	FixSize   bool  `json:"fixSize"`
-	Encrypt   bool  `json:"encrypt"`
-	Compress  bool  `json:"compress"`
+	ChunkSize  int32  `json:"chunkSize"`
+	FixSize    bool   `json:"fixSize"`
+	Encrypt    bool   `json:"encrypt"`
+	Compress   bool   `json:"compress"`
+	DedupScope string `json:"dedupScope,omitempty"` // 去重范围 global/account/bucket，为空时全局去重
+	Convergent bool   `json:"convergent,omitempty"` // chunk 用去重范围的密钥做收敛加密，只能和 account/bucket 范围一起使用
+	Verify     bool   `json:"verify,omitempty"`     // 读取对象时用 hash 校验每个 chunk
+}
+
+// 去重范围，chunk 只和同一范围内的 chunk 去重，不同范围的相同数据互相不可见
+const (
+	DEDUP_SCOPE_GLOBAL  = "global"
+	DEDUP_SCOPE_ACCOUNT = "account"
+	DEDUP_SCOPE_BUCKET  = "bucket"
+)
+
+// Validate 检查去重范围配置
+func (c *ChunkConfig) Validate() error {
+	switch c.DedupScope {
+	case "", DEDUP_SCOPE_GLOBAL:
+		if c.Convergent {
+			return errors.New("convergent encryption requires account or bucket dedup scope")
+		}
+	case DEDUP_SCOPE_ACCOUNT, DEDUP_SCOPE_BUCKET:
+	default:
+		return fmt.Errorf("invalid dedup scope %s", c.DedupScope)
+	}
+	return nil
 }
 
 func (s *Storage) String() string {
@@ -119,6 +119,21 @@ func (b *BucketTargets) GetTarget(id string) (BucketTarget, bool) {
 	return BucketTarget{}, false
 }
 
+// GetTargetByArn 按 ARN 获取存储桶目标，复制规则的 Destination.Bucket 与之对应
+func (b *BucketTargets) GetTargetByArn(arn string) (BucketTarget, bool) {
+	if b == nil {
+		return BucketTarget{}, false
+	}
+
+	for _, target := range b.Targets {
+		if target.Arn == arn {
+			return target, true
+		}
+	}
+
+	return BucketTarget{}, false
+}
+
 // ActivateTarget 激活存储桶目标
 func (b *BucketTargets) ActivateTarget(id string) error {
 	if b == nil {
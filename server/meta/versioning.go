@@ -17,11 +17,20 @@
 package meta
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"math"
 	"time"
 )
 
+const (
+	// NullVersionID 未开启版本控制或版本控制暂停时写入的对象版本ID
+	NullVersionID = "null"
+)
+
 // VersioningConfiguration 表示版本控制配置
 type VersioningConfiguration struct {
 	XMLName   xml.Name  `xml:"VersioningConfiguration" json:"versioningConfiguration"`
@@ -79,7 +88,63 @@ func (v *VersioningConfiguration) IsEnabled() bool {
 	return v != nil && v.Status == "Enabled"
 }
 
+// IsSuspended 检查版本控制是否暂停
+func (v *VersioningConfiguration) IsSuspended() bool {
+	return v != nil && v.Status == "Suspended"
+}
+
+// Validate 验证版本控制配置
+func (v *VersioningConfiguration) Validate() error {
+	if v == nil {
+		return errors.New("versioning config not initialized")
+	}
+	if v.Status != "Enabled" && v.Status != "Suspended" {
+		return errors.New("invalid versioning status, must be 'Enabled' or 'Suspended'")
+	}
+	if v.MfaDelete != "" && v.MfaDelete != "Enabled" && v.MfaDelete != "Disabled" {
+		return errors.New("invalid mfa delete status, must be 'Enabled' or 'Disabled'")
+	}
+	return nil
+}
+
 // IsMFADeleteEnabled 检查MFA删除是否启用
 func (v *VersioningConfiguration) IsMFADeleteEnabled() bool {
 	return v != nil && v.MfaDelete == "Enabled"
 }
+
+// GenVersionID 生成新的版本ID
+// 前16位是倒序的时间戳，保证同一个对象新版本的存储key排在旧版本前面
+func GenVersionID() string {
+	ts := uint64(math.MaxInt64 - time.Now().UTC().UnixNano())
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%016x%s", ts, hex.EncodeToString(suffix))
+}
+
+// GenVersionPrefix 生成某个桶下历史版本的存储前缀
+func GenVersionPrefix(accountID, bucket string) string {
+	return "aws:version:" + accountID + ":" + bucket + "/"
+}
+
+// GenVersionKey 生成历史版本的存储key
+// 对象key和版本ID之间用 \x00 分隔，保证同一个对象的所有版本在扫描时连续且排在其他对象之前
+func GenVersionKey(accountID, bucket, key, versionID string) string {
+	return GenVersionPrefix(accountID, bucket) + key + "\x00" + versionID
+}
+
+// GenNullVersionKey 生成对象 null 版本指针的存储key
+// null 版本的存储key带有修改时间，指针记录其完整存储key，避免查找时扫描该对象的所有版本
+func GenNullVersionKey(accountID, bucket, key string) string {
+	return "aws:nullversion:" + accountID + ":" + bucket + "/" + key
+}
+
+// GenVersionSortKey 生成历史版本存储key中版本ID部分
+// null 版本本身不带时间，用修改时间生成倒序时间戳作为前缀，保证和其他版本一起按从新到旧排列
+// 生成的版本ID只包含十六进制字符，以 null 结尾的一定是 null 版本
+func GenVersionSortKey(versionID string, modTime time.Time) string {
+	if versionID != NullVersionID {
+		return versionID
+	}
+	ts := uint64(math.MaxInt64 - modTime.UTC().UnixNano())
+	return fmt.Sprintf("%016x%s", ts, NullVersionID)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package meta
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebsiteConfiguration 表示存储桶的静态网站配置
+type WebsiteConfiguration struct {
+	XMLName               xml.Name               `xml:"WebsiteConfiguration" json:"websiteConfiguration"`
+	XMLNS                 string                 `xml:"xmlns,attr" json:"xmlns"` // 固定值为http://s3.amazonaws.com/doc/2006-03-01/
+	IndexDocument         *IndexDocument         `xml:"IndexDocument,omitempty" json:"indexDocument,omitempty"`
+	ErrorDocument         *ErrorDocument         `xml:"ErrorDocument,omitempty" json:"errorDocument,omitempty"`
+	RedirectAllRequestsTo *RedirectAllRequestsTo `xml:"RedirectAllRequestsTo,omitempty" json:"redirectAllRequestsTo,omitempty"`
+	RoutingRules          []RoutingRule          `xml:"RoutingRules>RoutingRule,omitempty" json:"routingRules,omitempty"`
+
+	CreatedAt time.Time `xml:"-" json:"createdAt"`
+	UpdatedAt time.Time `xml:"-" json:"updatedAt"`
+}
+
+// IndexDocument 目录请求时返回的索引文档
+type IndexDocument struct {
+	Suffix string `xml:"Suffix" json:"suffix"`
+}
+
+// ErrorDocument 发生 4XX 错误时返回的错误文档
+type ErrorDocument struct {
+	Key string `xml:"Key" json:"key"`
+}
+
+// RedirectAllRequestsTo 把所有请求重定向到另一个主机
+type RedirectAllRequestsTo struct {
+	HostName string `xml:"HostName" json:"hostName"`
+	Protocol string `xml:"Protocol,omitempty" json:"protocol,omitempty"` // http | https
+}
+
+// RoutingRule 重定向规则
+type RoutingRule struct {
+	Condition *RoutingCondition `xml:"Condition,omitempty" json:"condition,omitempty"`
+	Redirect  RoutingRedirect   `xml:"Redirect" json:"redirect"`
+}
+
+// RoutingCondition 重定向规则的匹配条件
+type RoutingCondition struct {
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty" json:"keyPrefixEquals,omitempty"`
+	HttpErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty" json:"httpErrorCodeReturnedEquals,omitempty"`
+}
+
+// RoutingRedirect 重定向的目标
+type RoutingRedirect struct {
+	HostName             string `xml:"HostName,omitempty" json:"hostName,omitempty"`
+	HttpRedirectCode     string `xml:"HttpRedirectCode,omitempty" json:"httpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty" json:"protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty" json:"replaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty" json:"replaceKeyWith,omitempty"`
+}
+
+// Validate 验证静态网站配置
+func (c *WebsiteConfiguration) Validate() error {
+	if c == nil {
+		return errors.New("website configuration is nil")
+	}
+
+	if c.RedirectAllRequestsTo != nil {
+		// 重定向所有请求时不能有其他配置
+		if c.IndexDocument != nil || c.ErrorDocument != nil || len(c.RoutingRules) > 0 {
+			return errors.New("RedirectAllRequestsTo cannot be specified with other website configuration")
+		}
+		if c.RedirectAllRequestsTo.HostName == "" {
+			return errors.New("RedirectAllRequestsTo requires HostName")
+		}
+		return validateProtocol(c.RedirectAllRequestsTo.Protocol)
+	}
+
+	if c.IndexDocument == nil || c.IndexDocument.Suffix == "" {
+		return errors.New("IndexDocument Suffix is required")
+	}
+	if strings.Contains(c.IndexDocument.Suffix, "/") {
+		return errors.New("IndexDocument Suffix cannot contain '/'")
+	}
+	if c.ErrorDocument != nil && c.ErrorDocument.Key == "" {
+		return errors.New("ErrorDocument Key is required")
+	}
+
+	// 验证规则数量不超过50个
+	if len(c.RoutingRules) > 50 {
+		return errors.New("website configuration cannot have more than 50 routing rules")
+	}
+	for i, rule := range c.RoutingRules {
+		if rule.Condition != nil && rule.Condition.HttpErrorCodeReturnedEquals != "" {
+			code, err := strconv.Atoi(rule.Condition.HttpErrorCodeReturnedEquals)
+			if err != nil || code < 400 || code > 599 {
+				return fmt.Errorf("rule %d: invalid HttpErrorCodeReturnedEquals '%s'", i, rule.Condition.HttpErrorCodeReturnedEquals)
+			}
+		}
+		redirect := rule.Redirect
+		if redirect.ReplaceKeyPrefixWith != "" && redirect.ReplaceKeyWith != "" {
+			return fmt.Errorf("rule %d: ReplaceKeyPrefixWith and ReplaceKeyWith cannot both be specified", i)
+		}
+		if redirect.HttpRedirectCode != "" {
+			code, err := strconv.Atoi(redirect.HttpRedirectCode)
+			if err != nil || code < 300 || code > 399 {
+				return fmt.Errorf("rule %d: invalid HttpRedirectCode '%s'", i, redirect.HttpRedirectCode)
+			}
+		}
+		if err := validateProtocol(redirect.Protocol); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateProtocol(protocol string) error {
+	if protocol != "" && protocol != "http" && protocol != "https" {
+		return fmt.Errorf("invalid protocol '%s'", protocol)
+	}
+	return nil
+}
+
+// MatchRoutingRule 查找第一条匹配的重定向规则
+// errorCode 为 0 时只匹配没有错误码条件的规则，否则只匹配错误码相同的规则
+func (c *WebsiteConfiguration) MatchRoutingRule(key string, errorCode int) *RoutingRule {
+	if c == nil {
+		return nil
+	}
+	for i := range c.RoutingRules {
+		rule := &c.RoutingRules[i]
+		prefix, code := "", ""
+		if rule.Condition != nil {
+			prefix, code = rule.Condition.KeyPrefixEquals, rule.Condition.HttpErrorCodeReturnedEquals
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if errorCode == 0 && code == "" {
+			return rule
+		}
+		if errorCode != 0 && code == strconv.Itoa(errorCode) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Location 计算重定向的地址和状态码，host 和 protocol 是当前请求的主机和协议
+func (r *RoutingRule) Location(key, host, protocol string) (string, int) {
+	redirect := r.Redirect
+	if redirect.HostName != "" {
+		host = redirect.HostName
+	}
+	if redirect.Protocol != "" {
+		protocol = redirect.Protocol
+	}
+	switch {
+	case redirect.ReplaceKeyWith != "":
+		key = redirect.ReplaceKeyWith
+	case redirect.ReplaceKeyPrefixWith != "":
+		prefix := ""
+		if r.Condition != nil {
+			prefix = r.Condition.KeyPrefixEquals
+		}
+		key = redirect.ReplaceKeyPrefixWith + strings.TrimPrefix(key, prefix)
+	}
+	code := 301
+	if redirect.HttpRedirectCode != "" {
+		if v, err := strconv.Atoi(redirect.HttpRedirectCode); err == nil {
+			code = v
+		}
+	}
+	return protocol + "://" + host + "/" + key, code
+}
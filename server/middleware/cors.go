@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/bucket"
+)
+
+// CorsMiddleware 带 Origin 头的跨域请求按桶的 CORS 规则加上 Access-Control-* 响应头
+// 预检请求由 PreflightHandler 处理
+func CorsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(xhttp.Origin)
+		if origin == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bucketName := utils.DecodeVars(mux.Vars(r))["bucket"]
+		if bucketName == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cors := GetBucketCors(bucketName); cors != nil {
+			if rule := cors.Match(origin, r.Method, nil); rule != nil {
+				SetCorsHeaders(w, rule, origin)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetBucketCors 获取桶的跨域配置，桶不存在或者没有配置时返回 nil
+func GetBucketCors(bucketName string) *meta.CORSConfiguration {
+	bs := bucket.GetBucketService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket service")
+		return nil
+	}
+	bm, err := bs.LookupBucket(bucketName)
+	if err != nil || bm == nil {
+		return nil
+	}
+	return bm.CORS
+}
+
+// SetCorsHeaders 按匹配的规则设置跨域响应头
+func SetCorsHeaders(w http.ResponseWriter, rule *meta.CORSRule, origin string) {
+	h := w.Header()
+	if rule.AllowAnyOrigin() {
+		h.Set(xhttp.AccessControlAllowOrigin, "*")
+	} else {
+		h.Set(xhttp.AccessControlAllowOrigin, origin)
+		h.Set(xhttp.AccessControlAllowCredentials, "true")
+	}
+	h.Add(xhttp.Vary, xhttp.Origin)
+	h.Set(xhttp.AccessControlAllowMethods, strings.Join(rule.AllowedMethods, ", "))
+	if len(rule.ExposeHeaders) > 0 {
+		h.Set(xhttp.AccessControlExposeHeaders, strings.Join(rule.ExposeHeaders, ", "))
+	}
+	if rule.MaxAgeSeconds != nil {
+		h.Set(xhttp.AccessControlMaxAge, strconv.Itoa(*rule.MaxAgeSeconds))
+	}
+}
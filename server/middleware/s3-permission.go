@@ -17,12 +17,14 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gorilla/mux"
 
+	"github.com/mageg-x/dedups3/internal/config"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/utils"
@@ -32,13 +34,61 @@ import (
 	"github.com/mageg-x/dedups3/service/object"
 )
 
+// actionAliases 同一个操作的特殊请求形式，路由名称不是 IAM 中的操作，按对应的操作鉴权
+var actionAliases = map[string]string{
+	"s3:AppendObject":     "s3:PutObject",
+	"s3:PutObjectExtract": "s3:PutObject",
+}
+
 // S3AuthorizationMiddleware 提供S3 API的通用鉴权中间件，按照S3标准综合评估权限
 func S3AuthorizationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.GetLogger("dedups3").Debugf("s3 authorization check for %s %s", r.Method, r.URL.Path)
 
+		// 从请求中获取bucket和object信息
+		vars := utils.DecodeVars(mux.Vars(r))
+		bucketName := vars["bucket"]
+		objectKey := vars["object"]
+
+		// 获取 S3 API操作名称
+		var s3Action string
+		route := mux.CurrentRoute(r)
+		if route != nil {
+			s3Action = route.GetName()
+		}
+
+		logger.GetLogger("dedups3").Debugf("s3 action: %s, bucket: %s, object: %s", s3Action, bucketName, objectKey)
+		if s3Action == "" {
+			logger.GetLogger("dedups3").Errorf("s3 action not found")
+			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
+			return
+		}
+		authAction := s3Action
+		if alias, ok := actionAliases[s3Action]; ok {
+			authAction = alias
+		}
+
 		// 从请求上下文获取访问密钥信息
 		ctx := r.Context()
+		if iam.IsAnonymous(ctx) {
+			// 匿名请求只能读取桶策略或 ACL 公开的数据，鉴权通过后以桶所有者的账户访问
+			ownerID, errCode := IsAnonymousAllowed(bucketName, objectKey, authAction)
+			if errCode != xhttp.ErrNone {
+				logger.GetLogger("dedups3").Errorf("anonymous %s on %s/%s denied: %v", s3Action, bucketName, objectKey, xhttp.ToError(errCode))
+				xhttp.WriteAWSErr(w, r, errCode)
+				return
+			}
+
+			nr, tc := TraceContext(r)
+			tc.Attributes["accountId"] = ownerID
+			tc.Attributes["username"] = meta.AnonymousUser
+			tc.Attributes["bucketName"] = bucketName
+			tc.Attributes["objectKey"] = objectKey
+			tc.Attributes["apiName"] = s3Action
+
+			next.ServeHTTP(w, nr.WithContext(iam.WithAnonymous(nr.Context(), ownerID)))
+			return
+		}
 		accessKeyID, ok := ctx.Value("accesskey").(string)
 		if !ok || accessKeyID == "" {
 			logger.GetLogger("dedups3").Errorf("no access key in context")
@@ -74,27 +124,8 @@ func S3AuthorizationMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// 从请求中获取bucket和object信息
-		vars := utils.DecodeVars(mux.Vars(r))
-		bucketName := vars["bucket"]
-		objectKey := vars["object"]
-
-		// 获取 S3 API操作名称
-		var s3Action string
-		route := mux.CurrentRoute(r)
-		if route != nil {
-			s3Action = route.GetName()
-		}
-
-		logger.GetLogger("dedups3").Debugf("s3 action: %s, bucket: %s, object: %s", s3Action, bucketName, objectKey)
-		if s3Action == "" {
-			logger.GetLogger("dedups3").Errorf("s3 action not found")
-			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
-			return
-		}
-
 		// 鉴权
-		allow, errCode := IsAllowed(accessKeyID, ak.AccountID, ak.Username, bucketName, objectKey, s3Action)
+		allow, errCode := IsAllowed(accessKeyID, ak.AccountID, ak.Username, bucketName, objectKey, authAction)
 		if errCode != xhttp.ErrNone || !allow {
 			logger.GetLogger("dedups3").Errorf("evaluate permission failed: %v", xhttp.ToError(errCode))
 			xhttp.WriteAWSErr(w, r, errCode)
@@ -159,7 +190,7 @@ func IsAllowed(accessKeyID, accountID, userName, bucketName, objKey, s3Action st
 		return false, xhttp.ErrInternalError
 	}
 
-	bucketInfo, err := bs.GetBucketInfo(&bucket.BaseBucketParams{
+	bucketInfo, err := bs.GetBucketInfo(context.Background(), &bucket.BaseBucketParams{
 		BucketName:  bucketName,
 		AccessKeyID: accessKeyID,
 	})
@@ -232,7 +263,7 @@ func IsAllowed(accessKeyID, accountID, userName, bucketName, objKey, s3Action st
 
 	// 9. 对于对象操作，检查对象ACL
 	if objKey != "" && !isListBucketAction(s3Action) {
-		allowedByObjectACL, err := checkObjectACL(bucketName, objKey, accessKeyID, currentUser, requiredPermission)
+		allowedByObjectACL, err := checkObjectACL(context.Background(), bucketName, objKey, accessKeyID, currentUser, requiredPermission)
 		if err != nil {
 			logger.GetLogger("dedups3").Debugf("object ACL check error: %v", err)
 		} else if allowedByObjectACL {
@@ -246,6 +277,90 @@ func IsAllowed(accessKeyID, accountID, userName, bucketName, objKey, s3Action st
 	return false, xhttp.ErrAccessDenied
 }
 
+// anonymousActions 匿名请求允许的操作，值为评估桶策略时使用的 IAM 操作
+var anonymousActions = map[string]string{
+	"s3:GetObject":                      "s3:GetObject",
+	"s3:HeadObject":                     "s3:GetObject",
+	"s3:HeadBucket":                     "s3:ListBucket",
+	"s3:ListObjects":                    "s3:ListBucket",
+	"s3:ListObjectsV2":                  "s3:ListBucket",
+	"s3:ListObjectsV2WithMetadata":      "s3:ListBucket",
+	"s3:ListObjectVersions":             "s3:ListBucketVersions",
+	"s3:ListObjectVersionsWithMetadata": "s3:ListBucketVersions",
+}
+
+// IsAnonymousAllowed 评估匿名请求的权限，允许时返回桶所有者的账户ID
+// 1、全局或桶所有者账户开启了禁止公开访问时拒绝
+// 2、桶策略对 Principal "*" 的显式拒绝
+// 3、桶策略对 Principal "*" 的显式允许
+// 4、桶 ACL 授予 AllUsers 读权限时允许列举，对象 ACL 授予 AllUsers 读权限时允许读取对象
+// 5、默认拒绝
+func IsAnonymousAllowed(bucketName, objKey, s3Action string) (string, xhttp.APIErrorCode) {
+	policyAction, ok := anonymousActions[s3Action]
+	if !ok || bucketName == "" {
+		return "", xhttp.ErrAccessDenied
+	}
+	if config.Get().Server.BlockPublicAccess {
+		logger.GetLogger("dedups3").Debugf("public access is blocked globally")
+		return "", xhttp.ErrAccessDenied
+	}
+
+	bs := bucket.GetBucketService()
+	iamService := iam.GetIamService()
+	if bs == nil || iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket or iam service")
+		return "", xhttp.ErrInternalError
+	}
+	// 桶名全局唯一，通过桶名索引确定桶所属的账户
+	bucketInfo, err := bs.LookupBucket(bucketName)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			return "", xhttp.ErrNoSuchBucket
+		}
+		logger.GetLogger("dedups3").Errorf("failed to lookup bucket %s: %v", bucketName, err)
+		return "", xhttp.ErrInternalError
+	}
+	ownerID := bucketInfo.Owner.ID
+	ac, err := iamService.GetAccount(ownerID)
+	if err != nil || ac == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account %s: %v", ownerID, err)
+		return "", xhttp.ErrInternalError
+	}
+	if ac.BlockPublicAccess {
+		logger.GetLogger("dedups3").Debugf("public access is blocked by account %s", ownerID)
+		return "", xhttp.ErrAccessDenied
+	}
+
+	// 桶策略中的显式拒绝优先于 ACL
+	resourceARN := meta.BuildResourceARN(bucketName, objKey)
+	if bucketInfo.Policy != nil {
+		if bucketInfo.Policy.IsPublicAllowed(policyAction, resourceARN, nil) {
+			logger.GetLogger("dedups3").Debugf("anonymous allowed by bucket policy")
+			return ownerID, xhttp.ErrNone
+		}
+		if bucketInfo.Policy.IsPublicDenied(policyAction, resourceARN, nil) {
+			return "", xhttp.ErrAccessDenied
+		}
+	}
+
+	// public-read 和 public-read-write 的桶只允许匿名列举，读取对象由对象自身的 ACL 决定
+	allUsers := meta.Grantee{Type: "Group", URI: meta.AllUsersGroup}
+	if isListBucketAction(policyAction) && bucketInfo.ACL != nil && bucketInfo.ACL.HasPermission(allUsers, meta.PermissionRead) {
+		logger.GetLogger("dedups3").Debugf("anonymous allowed by bucket ACL")
+		return ownerID, xhttp.ErrNone
+	}
+	if objKey != "" && policyAction == "s3:GetObject" {
+		allowed, err := checkObjectACL(iam.WithAnonymous(context.Background(), ownerID), bucketName, objKey, "", allUsers, meta.PermissionRead)
+		if err != nil {
+			logger.GetLogger("dedups3").Debugf("object ACL check error: %v", err)
+		} else if allowed {
+			logger.GetLogger("dedups3").Debugf("anonymous allowed by object ACL")
+			return ownerID, xhttp.ErrNone
+		}
+	}
+	return "", xhttp.ErrAccessDenied
+}
+
 // isListBucketAction 检查是否是列表桶操作
 func isListBucketAction(s3Action string) bool {
 	return s3Action == "s3:ListBucket" || s3Action == "s3:ListBucketVersions"
@@ -268,13 +383,13 @@ func getRequiredACLPermission(s3Action string) string {
 }
 
 // checkObjectACL 检查对象ACL权限
-func checkObjectACL(bucketName, objKey, accessKeyID string, currentUser meta.Grantee, requiredPermission string) (bool, error) {
+func checkObjectACL(ctx context.Context, bucketName, objKey, accessKeyID string, currentUser meta.Grantee, requiredPermission string) (bool, error) {
 	os := object.GetObjectService()
 	if os == nil {
 		return false, errors.New("object service not available")
 	}
 
-	obj, err := os.HeadObject(&object.BaseObjectParams{
+	obj, err := os.HeadObject(ctx, &object.BaseObjectParams{
 		BucketName:  bucketName,
 		ObjKey:      objKey,
 		AccessKeyID: accessKeyID,
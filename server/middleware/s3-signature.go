@@ -28,12 +28,14 @@ import (
 	"net/http"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
 	"github.com/mageg-x/dedups3/service/iam"
 )
 
@@ -42,6 +44,9 @@ var (
 	spaceRegex = regexp.MustCompile(`\s+`)
 )
 
+// maxPresignExpires 预签名 URL 的最长有效期，单位秒
+const maxPresignExpires = 7 * 24 * 60 * 60
+
 // AWS4SigningMiddleware 提供AWS4签名验证的中间件
 func AWS4SigningMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -59,96 +64,39 @@ func AWS4SigningMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// 1. 从请求头中提取签名信息
-		authHeader := r.Header.Get(xhttp.Authorization)
-		if authHeader == "" {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrMissingAuthenticationToken)
-			return
-		}
-
-		// 解析Authorization头
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "AWS4-HMAC-SHA256" {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrAuthentication)
-			logger.GetLogger("dedups3").Errorf("Invalid AWS Authorization header")
+		// 不带签名的匿名请求，由 S3AuthorizationMiddleware 按桶策略和 ACL 鉴权
+		if r.Header.Get(xhttp.Authorization) == "" && !IsPresignedRequest(r) {
+			ctx := context.WithValue(r.Context(), "anonymous", true)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		// 解析凭证部分
-		var credential, signedHeadersStr, signature string
-		for _, part := range strings.Split(parts[1], ",") {
-			part = strings.TrimSpace(part)
-			if strings.HasPrefix(part, "Credential=") {
-				credential = strings.TrimPrefix(part, "Credential=")
-			} else if strings.HasPrefix(part, "SignedHeaders=") {
-				signedHeadersStr = strings.TrimPrefix(part, "SignedHeaders=")
-			} else if strings.HasPrefix(part, "Signature=") {
-				signature = strings.TrimPrefix(part, "Signature=")
-			}
-		}
-
-		if credential == "" || signedHeadersStr == "" || signature == "" {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
-			logger.GetLogger("dedups3").Errorf("Invalid AWS Authorization header credential : %s, signedHeadersStr : %s, signature :%s", credential, signedHeadersStr, signature)
-			return
-		}
-
-		// 提取访问密钥ID
-		credentialParts := strings.Split(credential, "/")
-		if len(credentialParts) < 5 {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrInvalidArgument)
-			logger.GetLogger("dedups3").Errorf("Invalid AWS Authorization header")
-			return
-		}
-
-		accessKeyID := credentialParts[0]
-		date := credentialParts[1]
-		region := credentialParts[2]
-		service := credentialParts[3]
-
-		// 3. 检查时间有效性
-		amzDate := r.Header.Get(xhttp.AmzDate)
-		if amzDate == "" {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrMissingDateHeader)
-			logger.GetLogger("dedups3").Errorf("No Amz Date header found")
-			return
-		}
-
-		// 验证时间格式
-		if len(amzDate) != 16 {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrMalformedDate)
-			logger.GetLogger("dedups3").Errorf("Invalid Amz Date header")
-			return
-		}
-
-		parsedTime, err := time.Parse("20060102T150405Z", amzDate)
-		if err != nil {
-			xhttp.WriteAWSError(w, r, "MalformedDate", "Invalid X-Amz-Date format", http.StatusBadRequest)
-			logger.GetLogger("dedups3").Errorf("Invalid X-Amz-Date format")
-			return
+		// 1. 提取签名信息，支持 Authorization 头和预签名 URL 两种方式
+		var sv *signV4Values
+		var code xhttp.APIErrorCode
+		if IsPresignedRequest(r) {
+			sv, code = parsePresignedV4(r)
+		} else {
+			sv, code = parseHeaderV4(r)
 		}
-
-		// 时间窗口：15分钟
-		timeWindow := 15 * time.Minute
-		now := time.Now().UTC()
-		if diff := now.Sub(parsedTime); diff < -timeWindow || diff > timeWindow {
-			xhttp.WriteAWSErr(w, r, xhttp.ErrRequestExpired)
-			logger.GetLogger("dedups3").Errorf("Invalid X-Amz-Date header")
+		if code != xhttp.ErrNone {
+			xhttp.WriteAWSErr(w, r, code)
 			return
 		}
+		accessKeyID, region := sv.accessKeyID, sv.region
 
-		// 4. 构建规范请求
-		canonicalRequest, payloadHash, err := buildCanonicalRequest(r, signedHeadersStr)
+		// 2. 构建规范请求
+		canonicalRequest, payloadHash, err := buildCanonicalRequest(r, sv.signedHeaders, sv.presigned)
 		if err != nil {
 			logger.GetLogger("dedups3").Errorf("Failed to build canonical request: %v", err)
 			xhttp.WriteAWSErr(w, r, xhttp.ErrInternalError)
 			return
 		}
 
-		// 5. 构建字符串到签
-		stringToSign := buildStringToSign(amzDate, date, region, service, canonicalRequest)
+		// 3. 构建字符串到签
+		stringToSign := buildStringToSign(sv.amzDate, sv.date, sv.region, sv.service, canonicalRequest)
 
-		// 6. 计算签名
+		// 4. 计算签名
 		// 获取秘密访问密钥
 		iamService := iam.GetIamService()
 		if iamService == nil {
@@ -171,10 +119,10 @@ func AWS4SigningMiddleware(next http.Handler) http.Handler {
 		}
 
 		// 计算签名
-		computedSignature := calculateSignature(ak.SecretKey, date, region, service, stringToSign)
+		computedSignature := calculateSignature(ak.SecretKey, sv.date, sv.region, sv.service, stringToSign)
 
-		if !hmac.Equal([]byte(computedSignature), []byte(signature)) {
-			logger.GetLogger("dedups3").Warnf("signature mismatch %s : %s with ak %#v ", computedSignature, signature, ak)
+		if !hmac.Equal([]byte(computedSignature), []byte(sv.signature)) {
+			logger.GetLogger("dedups3").Warnf("signature mismatch %s : %s with ak %#v ", computedSignature, sv.signature, ak)
 			xhttp.WriteAWSErr(w, r, xhttp.ErrSignatureDoesNotMatch)
 			return
 		}
@@ -206,8 +154,198 @@ func AWS4SigningMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// signV4Values 从 Authorization 头或预签名 URL 中解析出的签名信息
+type signV4Values struct {
+	accessKeyID   string
+	date          string
+	region        string
+	service       string
+	amzDate       string
+	signedHeaders string
+	signature     string
+	presigned     bool
+}
+
+// IsPresignedRequest 请求是否为查询字符串签名（预签名 URL）
+func IsPresignedRequest(r *http.Request) bool {
+	return r.URL.Query().Get(xhttp.AmzAlgorithm) != ""
+}
+
+// parseCredential 解析 Credential，格式为 AccessKeyID/date/region/service/aws4_request
+func parseCredential(sv *signV4Values, credential string) bool {
+	credentialParts := strings.Split(credential, "/")
+	if len(credentialParts) < 5 {
+		return false
+	}
+	sv.accessKeyID = credentialParts[0]
+	sv.date = credentialParts[1]
+	sv.region = credentialParts[2]
+	sv.service = credentialParts[3]
+	return true
+}
+
+// parseHeaderV4 解析 Authorization 头中的签名信息
+func parseHeaderV4(r *http.Request) (*signV4Values, xhttp.APIErrorCode) {
+	authHeader := r.Header.Get(xhttp.Authorization)
+	if authHeader == "" {
+		return nil, xhttp.ErrMissingAuthenticationToken
+	}
+
+	// 解析Authorization头
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "AWS4-HMAC-SHA256" {
+		logger.GetLogger("dedups3").Errorf("Invalid AWS Authorization header")
+		return nil, xhttp.ErrAuthentication
+	}
+
+	// 解析凭证部分
+	var credential string
+	sv := &signV4Values{}
+	for _, part := range strings.Split(parts[1], ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "Credential=") {
+			credential = strings.TrimPrefix(part, "Credential=")
+		} else if strings.HasPrefix(part, "SignedHeaders=") {
+			sv.signedHeaders = strings.TrimPrefix(part, "SignedHeaders=")
+		} else if strings.HasPrefix(part, "Signature=") {
+			sv.signature = strings.TrimPrefix(part, "Signature=")
+		}
+	}
+
+	if credential == "" || sv.signedHeaders == "" || sv.signature == "" {
+		logger.GetLogger("dedups3").Errorf("Invalid AWS Authorization header credential : %s, signedHeadersStr : %s, signature :%s", credential, sv.signedHeaders, sv.signature)
+		return nil, xhttp.ErrInvalidArgument
+	}
+
+	// 提取访问密钥ID
+	if !parseCredential(sv, credential) {
+		logger.GetLogger("dedups3").Errorf("Invalid AWS Authorization header")
+		return nil, xhttp.ErrInvalidArgument
+	}
+
+	// 检查时间有效性
+	sv.amzDate = r.Header.Get(xhttp.AmzDate)
+	if sv.amzDate == "" {
+		logger.GetLogger("dedups3").Errorf("No Amz Date header found")
+		return nil, xhttp.ErrMissingDateHeader
+	}
+
+	// 验证时间格式
+	if len(sv.amzDate) != 16 {
+		logger.GetLogger("dedups3").Errorf("Invalid Amz Date header")
+		return nil, xhttp.ErrMalformedDate
+	}
+
+	parsedTime, err := time.Parse("20060102T150405Z", sv.amzDate)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("Invalid X-Amz-Date format")
+		return nil, xhttp.ErrMalformedDate
+	}
+
+	// 时间窗口：15分钟
+	timeWindow := 15 * time.Minute
+	now := time.Now().UTC()
+	if diff := now.Sub(parsedTime); diff < -timeWindow || diff > timeWindow {
+		logger.GetLogger("dedups3").Errorf("Invalid X-Amz-Date header")
+		return nil, xhttp.ErrRequestExpired
+	}
+	return sv, xhttp.ErrNone
+}
+
+// parsePresignedV4 解析预签名 URL 查询参数中的签名信息，并检查 X-Amz-Expires 有效期
+func parsePresignedV4(r *http.Request) (*signV4Values, xhttp.APIErrorCode) {
+	query := r.URL.Query()
+	if query.Get(xhttp.AmzAlgorithm) != "AWS4-HMAC-SHA256" {
+		logger.GetLogger("dedups3").Errorf("invalid presigned algorithm %s", query.Get(xhttp.AmzAlgorithm))
+		return nil, xhttp.ErrInvalidQuerySignatureAlgo
+	}
+
+	sv := &signV4Values{
+		amzDate:       query.Get(xhttp.AmzDate),
+		signedHeaders: query.Get(xhttp.AmzSignedHeaders),
+		signature:     query.Get(xhttp.AmzSignature),
+		presigned:     true,
+	}
+	credential := query.Get(xhttp.AmzCredential)
+	expires := query.Get(xhttp.AmzExpires)
+	if credential == "" || sv.amzDate == "" || sv.signedHeaders == "" || sv.signature == "" || expires == "" {
+		logger.GetLogger("dedups3").Errorf("missing presigned query params: %s", r.URL.RawQuery)
+		return nil, xhttp.ErrInvalidQueryParams
+	}
+	if !parseCredential(sv, credential) {
+		logger.GetLogger("dedups3").Errorf("invalid presigned credential %s", credential)
+		return nil, xhttp.ErrCredMalformed
+	}
+
+	signedAt, err := time.Parse("20060102T150405Z", sv.amzDate)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid presigned date %s", sv.amzDate)
+		return nil, xhttp.ErrMalformedPresignedDate
+	}
+
+	// X-Amz-Expires 以秒为单位，最长 7 天
+	expireSeconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid presigned expires %s", expires)
+		return nil, xhttp.ErrMalformedExpires
+	}
+	if expireSeconds < 0 {
+		return nil, xhttp.ErrNegativeExpires
+	}
+	if expireSeconds > maxPresignExpires {
+		return nil, xhttp.ErrMaximumExpires
+	}
+
+	now := time.Now().UTC()
+	if signedAt.Sub(now) > 15*time.Minute {
+		logger.GetLogger("dedups3").Errorf("presigned request not ready yet, signed at %s", sv.amzDate)
+		return nil, xhttp.ErrRequestNotReadyYet
+	}
+	if now.After(signedAt.Add(time.Duration(expireSeconds) * time.Second)) {
+		logger.GetLogger("dedups3").Errorf("presigned request expired, signed at %s expires %s", sv.amzDate, expires)
+		return nil, xhttp.ErrExpiredPresignRequest
+	}
+	return sv, xhttp.ErrNone
+}
+
+// VerifyPostSignature 校验浏览器表单上传的签名，待签字符串为 base64 编码的策略文档
+func VerifyPostSignature(credential, amzDate, policy, signature string) (*meta.AccessKey, xhttp.APIErrorCode) {
+	sv := &signV4Values{amzDate: amzDate, signature: signature}
+	if !parseCredential(sv, credential) {
+		logger.GetLogger("dedups3").Errorf("invalid post credential %s", credential)
+		return nil, xhttp.ErrCredMalformed
+	}
+	if _, err := time.Parse("20060102T150405Z", amzDate); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid post date %s", amzDate)
+		return nil, xhttp.ErrMalformedDate
+	}
+
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("Failed to get IAM service")
+		return nil, xhttp.ErrServerNotInitialized
+	}
+	ak, err := iamService.GetAccessKey(sv.accessKeyID)
+	if ak == nil || err != nil {
+		logger.GetLogger("dedups3").Errorf("get access key failed: %v", err)
+		return nil, xhttp.ErrInvalidAccessKeyID
+	}
+	if !ak.Status || ak.ExpiredAt.Before(time.Now().UTC()) {
+		logger.GetLogger("dedups3").Errorf("access key %s is inactive", sv.accessKeyID)
+		return nil, xhttp.ErrAccessKeyDisabled
+	}
+
+	computedSignature := calculateSignature(ak.SecretKey, sv.date, sv.region, sv.service, policy)
+	if !hmac.Equal([]byte(computedSignature), []byte(sv.signature)) {
+		logger.GetLogger("dedups3").Warnf("post signature mismatch %s : %s", computedSignature, sv.signature)
+		return nil, xhttp.ErrSignatureDoesNotMatch
+	}
+	return ak, xhttp.ErrNone
+}
+
 // 辅助函数：构建规范请求
-func buildCanonicalRequest(r *http.Request, signedHeadersStr string) (string, string, error) {
+// presigned 为 true 时查询字符串不包含 X-Amz-Signature，未指定 x-amz-content-sha256 时载荷为 UNSIGNED-PAYLOAD
+func buildCanonicalRequest(r *http.Request, signedHeadersStr string, presigned bool) (string, string, error) {
 	// 1. 请求方法
 	method := r.Method
 
@@ -215,7 +353,11 @@ func buildCanonicalRequest(r *http.Request, signedHeadersStr string) (string, st
 	canonicalURI := encodePath(r.URL.Path)
 
 	// 3. 规范查询字符串
-	canonicalQueryString := utils.QueryEncode(r.URL.Query())
+	query := r.URL.Query()
+	if presigned {
+		query.Del(xhttp.AmzSignature)
+	}
+	canonicalQueryString := utils.QueryEncode(query)
 
 	// 4. 规范请求头
 	canonicalHeaders, err := buildCanonicalHeaders(r, signedHeadersStr)
@@ -231,7 +373,10 @@ func buildCanonicalRequest(r *http.Request, signedHeadersStr string) (string, st
 	var bodyBytes []byte
 	var errRead error
 
-	if payloadHash == "" {
+	if payloadHash == "" && presigned {
+		// 预签名 URL 无法对请求体签名
+		payloadHash = "UNSIGNED-PAYLOAD"
+	} else if payloadHash == "" {
 		// 对于GET、HEAD、DELETE等没有请求体的方法，使用UNSIGNED-PAYLOAD
 		if r.Method == "GET" || r.Method == "HEAD" || r.Method == "DELETE" || r.Method == "OPTIONS" {
 			payloadHash = "UNSIGNED-PAYLOAD"
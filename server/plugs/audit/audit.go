@@ -191,6 +191,7 @@ func getResource(traceCtxt *xhttp.TraceCtxt) []Resource {
 		"iamAudit":     "AWS::IAM::Logs",
 		"iamEvent":     "AWS::IAM::Logs",
 		"iamStats":     "AWS::IAM::User",
+		"iamKMS":       "AWS::KMS::Key",
 	}
 
 	var resources []Resource
@@ -17,9 +17,10 @@
 package block
 
 import (
+	"bytes"
 	"context"
-	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -76,9 +77,12 @@ func (d *DiskStore) Type() string {
 }
 
 func (d *DiskStore) WriteBlock(ctx context.Context, blockID string, data []byte, ver int32) error {
-	//d.mu.Lock()
-	//defer d.mu.Unlock()
-	logger.GetLogger("dedups3").Debugf("[DiskStore WriteBlock] blockID=%s, ver=%d, size=%d KB", blockID, ver, len(data)/1024)
+	return d.PutBlock(ctx, blockID, bytes.NewReader(data), int64(len(data)), ver)
+}
+
+// PutBlock 从 r 流式写入块，先写入缓存文件系统，缓存区放不下时直接写入磁盘文件
+func (d *DiskStore) PutBlock(ctx context.Context, blockID string, r io.Reader, size int64, ver int32) error {
+	logger.GetLogger("dedups3").Debugf("[DiskStore PutBlock] blockID=%s, ver=%d, size=%d KB", blockID, ver, size/1024)
 
 	vfile, err := GetTieredFs()
 	if err != nil || vfile == nil {
@@ -86,31 +90,11 @@ func (d *DiskStore) WriteBlock(ctx context.Context, blockID string, data []byte,
 		return fmt.Errorf("failed to get tiered vfs: %v", err)
 	}
 
-	// 检查文件缓存区的剩余空间
-	if vfile.FreeSpace() < int64(2*len(data)) {
-		logger.GetLogger("dedups3").Errorf("vfile is leave too small to free space")
-		return fmt.Errorf("vfile is leave too small to free space")
-	}
-
-	oldVer := int32(-1)
-	if vfile.Exists(d.ID, blockID) {
-		if v, err := vfile.ReadFile(d.ID, blockID, 0, 4); err == nil && v != nil {
-			oldVer = int32(binary.BigEndian.Uint32(v[:]))
-			logger.GetLogger("dedups3").Debugf("get block %s old ver %d", blockID, oldVer)
-		}
-	}
-
-	if ver <= oldVer {
-		return nil
-	}
-
-	// 创建新数据：4字节版本号 + 序列化数据
-	versionBuf := make([]byte, 4)
-	binary.BigEndian.PutUint32(versionBuf, uint32(ver))
-
-	if err := vfile.WriteFile(d.ID, blockID, [][]byte{versionBuf, data}, ver); err != nil {
-		logger.GetLogger("dedups3").Errorf("failed to write block %s: %v", blockID, err)
-		return fmt.Errorf("failed to write block %s: %w", blockID, err)
+	err = putCached(vfile, d.ID, blockID, r, size, ver, func(body io.Reader, _ int64) error {
+		return d.writeBlockFile(blockID, body)
+	})
+	if err != nil {
+		return err
 	}
 
 	logger.GetLogger("dedups3").Debugf("Successfully wrote block: %s", blockID)
@@ -119,6 +103,11 @@ func (d *DiskStore) WriteBlock(ctx context.Context, blockID string, data []byte,
 
 func (s *DiskStore) WriteBlockDirect(ctx context.Context, blockID string, data []byte) error {
 	logger.GetLogger("dedups3").Debugf("[DiskStore WriteBlockDirect] blockID=%s", blockID)
+	return s.writeBlockFile(blockID, bytes.NewReader(data))
+}
+
+// writeBlockFile 把 r 的数据原子写入块文件
+func (s *DiskStore) writeBlockFile(blockID string, r io.Reader) error {
 	path := s.BlockPath(blockID)
 	// 确保目录存在
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
@@ -128,7 +117,8 @@ func (s *DiskStore) WriteBlockDirect(ctx context.Context, blockID string, data [
 	// 原子写入
 	tmpPath := path + ".tmp"
 
-	if err := utils.WriteFile(tmpPath, [][]byte{data}, 0655); err != nil {
+	if _, err := utils.WriteFileFrom(tmpPath, r, 0655); err != nil {
+		_ = os.Remove(tmpPath)
 		return fmt.Errorf("write %s data failed: %w", path, err)
 	}
 
@@ -181,6 +171,69 @@ func (d *DiskStore) ReadLocalBlock(blockID string, offset, length int64) ([]byte
 	return data, nil
 }
 
+// LocalBlockSize 本节点磁盘上块的大小，不包括开头 4 字节的版本号
+func (d *DiskStore) LocalBlockSize(blockID string) (int64, error) {
+	vfile, err := GetTieredFs()
+	if err != nil || vfile == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get tiered vfs: %v", err)
+		return 0, fmt.Errorf("failed to get tiered vfs: %v", err)
+	}
+	if !vfile.Exists(d.ID, blockID) {
+		logger.GetLogger("dedups3").Errorf("Block %s does not exist", blockID)
+		return 0, ErrBlockNotFound
+	}
+	size, err := vfile.Size(d.ID, blockID)
+	if err != nil {
+		return 0, err
+	}
+	return size - 4, nil
+}
+
+// OpenBlock 打开块按偏移读取，块在其他节点上时通过节点接口读取
+func (d *DiskStore) OpenBlock(location, blockID string) (BlockReader, error) {
+	rLocation := strings.TrimSpace(location)
+	if rLocation != "" && rLocation != xconf.Get().Node.LocalNode {
+		return &rangeReader{
+			read: func(offset, length int64) ([]byte, error) {
+				return d.ReadRemoteBlock(location, blockID, offset, length)
+			},
+			size: func() (int64, error) {
+				return d.StatRemoteBlock(location, blockID)
+			},
+		}, nil
+	}
+
+	vfile, err := GetTieredFs()
+	if err != nil || vfile == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get tiered vfs: %v", err)
+		return nil, fmt.Errorf("failed to get tiered vfs: %v", err)
+	}
+	if !vfile.Exists(d.ID, blockID) {
+		logger.GetLogger("dedups3").Errorf("Block %s does not exist", blockID)
+		return nil, ErrBlockNotFound
+	}
+	return &cacheBlockReader{vfile: vfile, storageID: d.ID, blockID: blockID}, nil
+}
+
+// OpenBlockFile 打开本节点磁盘上的块文件，块文件开头是 4 字节的版本号
+func (d *DiskStore) OpenBlockFile(location, blockID string) (*os.File, int64, error) {
+	rLocation := strings.TrimSpace(location)
+	if rLocation != "" && rLocation != xconf.Get().Node.LocalNode {
+		return nil, 0, fmt.Errorf("block %s is on remote node %s", blockID, rLocation)
+	}
+
+	vfile, err := GetTieredFs()
+	if err != nil || vfile == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get tiered vfs: %v", err)
+		return nil, 0, fmt.Errorf("failed to get tiered vfs: %v", err)
+	}
+	f, err := vfile.OpenFile(d.ID, blockID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, 4, nil
+}
+
 // DeleteBlock 删除块
 func (d *DiskStore) DeleteBlock(blockID string) error {
 	//d.mu.Lock()
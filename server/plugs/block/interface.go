@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -56,6 +57,34 @@ type BlockStore interface {
 	BlockExists(blockID string) (bool, error)
 }
 
+// BlockReader 按偏移读取块文件，偏移 0 和 ReadBlock 的偏移 0 相同
+type BlockReader interface {
+	io.ReaderAt
+	io.Closer
+	// Size 块文件大小
+	Size() (int64, error)
+}
+
+// StreamBlockStore 流式读写的存储后端接口，读写都不需要把整个块放在内存中
+// 存储后端可以逐步迁移到这个接口，没有实现的由 AsStreamStore 适配
+type StreamBlockStore interface {
+	Type() string
+	// PutBlock 从 r 读出 size 字节写成块，ver 不比已有的版本新时不写
+	PutBlock(ctx context.Context, blockID string, r io.Reader, size int64, ver int32) error
+	// OpenBlock 打开块按偏移读取，返回的 BlockReader 由调用者关闭
+	OpenBlock(location, blockID string) (BlockReader, error)
+	DeleteBlock(blockID string) error
+	List() (<-chan string, <-chan error)
+	Location(blockID string) string
+	BlockExists(blockID string) (bool, error)
+}
+
+// BlockFileOpener 块以本地文件存放的存储可以实现这个接口，读取不压缩不加密的块时直接从文件发送数据
+type BlockFileOpener interface {
+	// OpenBlockFile 打开本节点上的块文件，返回文件和 ReadBlock 偏移 0 在文件中的位置
+	OpenBlockFile(location, blockID string) (*os.File, int64, error)
+}
+
 type BaseBlockStore struct {
 	ID    string
 	Class string
@@ -92,6 +121,34 @@ func GetTieredFs() (*vfs.TieredFs, error) {
 	return mmfile, nil
 }
 
+// StatRemoteBlock 查询远程节点上数据块的大小
+func (b *BaseBlockStore) StatRemoteBlock(nodeURL string, blockID string) (int64, error) {
+	reqURL := fmt.Sprintf("%s/dedups3/node/%s?readBlock=&storageid=%s", strings.TrimSuffix(nodeURL, "/"), blockID, b.ID)
+	req, err := http.NewRequest(http.MethodHead, reqURL, nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("Failed to create request for block %s: %v", blockID, err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("x-amz-dedups3-node-api", "stat-block")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("Request to node %s for block %s failed: %v", nodeURL, blockID, err)
+		return 0, fmt.Errorf("request to node failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, &types.NotFound{}
+	}
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		logger.GetLogger("dedups3").Errorf("Node %s returned status %d size %d for block %s", nodeURL, resp.StatusCode, resp.ContentLength, blockID)
+		return 0, fmt.Errorf("node returned status %d size %d", resp.StatusCode, resp.ContentLength)
+	}
+	return resp.ContentLength, nil
+}
+
 // ReadBlockFromNode 从远程节点读取数据块
 func (b *BaseBlockStore) ReadRemoteBlock(nodeURL string, blockID string, offset, size int64) ([]byte, error) {
 	logger.GetLogger("dedups3").Debugf("Reading block %s from node %s with offset=%d, size=%d", blockID, nodeURL, offset, size)
@@ -133,7 +133,12 @@ func (s *S3Store) Type() string {
 
 // WriteBlock 写入块到S3
 func (s *S3Store) WriteBlock(ctx context.Context, blockID string, data []byte, ver int32) error {
-	logger.GetLogger("dedups3").Debugf("[S3Store WriteBlock] blockID=%s, ver=%d, size=%d KB", blockID, ver, len(data)/1024)
+	return s.PutBlock(ctx, blockID, bytes.NewReader(data), int64(len(data)), ver)
+}
+
+// PutBlock 从 r 流式写入块，先写入缓存文件系统异步上传，缓存区放不下时直接分片上传到S3
+func (s *S3Store) PutBlock(ctx context.Context, blockID string, r io.Reader, size int64, ver int32) error {
+	logger.GetLogger("dedups3").Debugf("[S3Store PutBlock] blockID=%s, ver=%d, size=%d KB", blockID, ver, size/1024)
 
 	vfile, err := GetTieredFs()
 	if err != nil || vfile == nil {
@@ -141,31 +146,11 @@ func (s *S3Store) WriteBlock(ctx context.Context, blockID string, data []byte, v
 		return fmt.Errorf("failed to get tiered vfs: %v", err)
 	}
 
-	oldVer := int32(-1)
-	if vfile.Exists(s.ID, blockID) {
-		if v, err := vfile.ReadFile(s.ID, blockID, 0, 4); err == nil && v != nil {
-			oldVer = int32(binary.BigEndian.Uint32(v[:]))
-			logger.GetLogger("dedups3").Debugf("get block %s old ver %d", blockID, oldVer)
-		}
-	}
-
-	// 检查文件缓存区的剩余空间
-	if vfile.FreeSpace() < int64(2*len(data)) {
-		logger.GetLogger("dedups3").Errorf("vfile is leave too small to free space")
-		return fmt.Errorf("vfile is leave too small to free space")
-	}
-
-	if ver <= oldVer {
-		return nil
-	}
-
-	// 创建新数据：4字节版本号 + 序列化数据
-	versionBuf := make([]byte, 4)
-	binary.BigEndian.PutUint32(versionBuf, uint32(ver))
-
-	if err := vfile.WriteFile(s.ID, blockID, [][]byte{versionBuf, data}, ver); err != nil {
-		logger.GetLogger("dedups3").Errorf("failed to write block %s: %v", blockID, err)
-		return fmt.Errorf("failed to write block %s: %w", blockID, err)
+	err = putCached(vfile, s.ID, blockID, r, size, ver, func(body io.Reader, size int64) error {
+		return s.WriteBlockFrom(ctx, blockID, body, size)
+	})
+	if err != nil {
+		return err
 	}
 
 	logger.GetLogger("dedups3").Debugf("Successfully wrote block: %s", blockID)
@@ -173,14 +158,21 @@ func (s *S3Store) WriteBlock(ctx context.Context, blockID string, data []byte, v
 }
 
 func (s *S3Store) WriteBlockDirect(ctx context.Context, blockID string, data []byte) error {
+	return s.WriteBlockFrom(ctx, blockID, bytes.NewReader(data), int64(len(data)))
+}
+
+// WriteBlockFrom 把 4 字节版本号 + 块数据上传到S3，超过分片大小时由 uploader 分片上传，内存中只保留正在上传的分片
+func (s *S3Store) WriteBlockFrom(ctx context.Context, blockID string, r io.Reader, size int64) error {
 	key := s.BlockPath(blockID)
 
-	if len(data) <= 4 {
-		return fmt.Errorf("invalid block size: %d", len(data))
+	if size <= 4 {
+		return fmt.Errorf("invalid block size: %d", size)
 	}
 
-	verBuf := data[:4]
-	data = data[4:]
+	verBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, verBuf); err != nil {
+		return fmt.Errorf("read block %s version failed: %w", blockID, err)
+	}
 	ver := int32(binary.BigEndian.Uint32(verBuf[:]))
 
 	//_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
@@ -192,8 +184,8 @@ func (s *S3Store) WriteBlockDirect(ctx context.Context, blockID string, data []b
 	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket:        aws.String(s.conf.Bucket),
 		Key:           aws.String(key),
-		Body:          bytes.NewReader(data),
-		ContentLength: aws.Int64(int64(len(data))), // 明确指定长度，禁用 aws-chunked
+		Body:          r,
+		ContentLength: aws.Int64(size - 4), // 明确指定长度，禁用 aws-chunked
 		// 可以添加额外的元数据标识版本
 		Metadata: map[string]string{
 			"block-version": fmt.Sprintf("%d", ver),
@@ -202,7 +194,7 @@ func (s *S3Store) WriteBlockDirect(ctx context.Context, blockID string, data []b
 	})
 
 	if err != nil {
-		logger.GetLogger("dedups3").Errorf("Failed to write block %s  %s  %s len :%d to S3 failed error is %v, config is %#v", s.conf.Bucket, key, blockID, len(data), err, s.conf)
+		logger.GetLogger("dedups3").Errorf("Failed to write block %s  %s  %s len :%d to S3 failed error is %v, config is %#v", s.conf.Bucket, key, blockID, size-4, err, s.conf)
 		return fmt.Errorf("failed to write block %s to S3: %w", blockID, err)
 	}
 
@@ -235,6 +227,24 @@ func (s *S3Store) ReadS3Block(blockID string, offset, length int64) ([]byte, err
 	ctx, cancel := context.WithCancel(s.ctx)
 	defer cancel()
 
+	body, err := s.getS3Block(ctx, blockID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("Failed to read response body for block %s: %v", blockID, err)
+		return nil, fmt.Errorf("failed to read response body for block %s: %w", blockID, err)
+	}
+
+	logger.GetLogger("dedups3").Debugf("Successfully read block from S3: %s, read %d bytes", blockID, len(data))
+	return data, nil
+}
+
+// getS3Block 范围读取S3上的块，length 为 0 时读到结尾
+func (s *S3Store) getS3Block(ctx context.Context, blockID string, offset, length int64) (io.ReadCloser, error) {
 	key := s.BlockPath(blockID)
 
 	// 处理范围请求
@@ -242,6 +252,8 @@ func (s *S3Store) ReadS3Block(blockID string, offset, length int64) ([]byte, err
 	if length > 0 {
 		rangeHeader = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
 		logger.GetLogger("dedups3").Debugf("Using range header: %s", rangeHeader)
+	} else if offset > 0 {
+		rangeHeader = fmt.Sprintf("bytes=%d-", offset)
 	}
 
 	input := &s3.GetObjectInput{
@@ -266,16 +278,103 @@ func (s *S3Store) ReadS3Block(blockID string, offset, length int64) ([]byte, err
 		logger.GetLogger("dedups3").Infof("Failed to read block %s from S3: %v", blockID, err)
 		return nil, fmt.Errorf("failed to read block %s from S3: %w", blockID, err)
 	}
-	defer resp.Body.Close()
+	return resp.Body, nil
+}
+
+// readS3At 范围读取S3上的块直接读入 p
+func (s *S3Store) readS3At(blockID string, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
 
-	data, err := io.ReadAll(resp.Body)
+	body, err := s.getS3Block(ctx, blockID, off, int64(len(p)))
 	if err != nil {
-		logger.GetLogger("dedups3").Errorf("Failed to read response body for block %s: %v", blockID, err)
-		return nil, fmt.Errorf("failed to read response body for block %s: %w", blockID, err)
+		return 0, err
 	}
+	defer body.Close()
 
-	logger.GetLogger("dedups3").Debugf("Successfully read block from S3: %s, read %d bytes", blockID, len(data))
-	return data, nil
+	n, err := io.ReadFull(body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// headS3Block 获取S3上块的大小
+func (s *S3Store) headS3Block(blockID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.conf.Bucket),
+		Key:    aws.String(s.BlockPath(blockID)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("head block %s from S3 failed: %w", blockID, err)
+	}
+	return aws.ToInt64(resp.ContentLength), nil
+}
+
+// OpenBlock 打开块按偏移读取，每次读取都是S3的范围请求，块还没上传到S3时从节点缓存读取
+func (s *S3Store) OpenBlock(location, blockID string) (BlockReader, error) {
+	return &s3BlockReader{
+		s:       s,
+		blockID: blockID,
+		remote: &rangeReader{
+			read: func(offset, length int64) ([]byte, error) {
+				data, err := s.ReadRemoteBlock(location, blockID, offset, length)
+				if err != nil {
+					// 再从S3 试一次
+					data, err = s.ReadS3Block(blockID, offset, length)
+				}
+				return data, err
+			},
+			size: func() (int64, error) {
+				return s.StatRemoteBlock(location, blockID)
+			},
+		},
+	}, nil
+}
+
+// s3BlockReader S3上的块，读取失败时从节点缓存读取
+type s3BlockReader struct {
+	s       *S3Store
+	blockID string
+	remote  *rangeReader
+}
+
+func (r *s3BlockReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.remote.data == nil {
+		n, err := r.s.readS3At(r.blockID, p, off)
+		if err == nil || errors.Is(err, io.EOF) {
+			return n, err
+		}
+	}
+	return r.remote.ReadAt(p, off)
+}
+
+func (r *s3BlockReader) Size() (int64, error) {
+	if r.remote.data == nil {
+		if size, err := r.s.headS3Block(r.blockID); err == nil {
+			return size, nil
+		}
+	}
+	return r.remote.Size()
+}
+
+func (r *s3BlockReader) readTail(off int64) ([]byte, error) {
+	if r.remote.data == nil {
+		if data, err := r.s.ReadS3Block(r.blockID, off, 0); err == nil {
+			return data, nil
+		}
+	}
+	return r.remote.readTail(off)
+}
+
+func (r *s3BlockReader) Close() error {
+	return r.remote.Close()
 }
 
 // DeleteBlock 删除S3块
@@ -0,0 +1,203 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/vfs"
+)
+
+// AsStreamStore 存储后端实现了 StreamBlockStore 时直接使用，否则适配只实现了 BlockStore 的后端
+func AsStreamStore(s BlockStore) StreamBlockStore {
+	if ss, ok := s.(StreamBlockStore); ok {
+		return ss
+	}
+	return &legacyStore{BlockStore: s}
+}
+
+// legacyStore 把只实现了 BlockStore 的存储后端适配成 StreamBlockStore，数据仍然整块放在内存中
+type legacyStore struct {
+	BlockStore
+}
+
+func (l *legacyStore) PutBlock(ctx context.Context, blockID string, r io.Reader, size int64, ver int32) error {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		logger.GetLogger("dedups3").Errorf("read block %s data failed: %v", blockID, err)
+		return fmt.Errorf("read block %s data failed: %w", blockID, err)
+	}
+	return l.WriteBlock(ctx, blockID, data, ver)
+}
+
+func (l *legacyStore) OpenBlock(location, blockID string) (BlockReader, error) {
+	return &rangeReader{read: func(offset, length int64) ([]byte, error) {
+		return l.ReadBlock(location, blockID, offset, length)
+	}}, nil
+}
+
+// rangeReader 用范围读取函数实现 BlockReader，length 为 0 时读到结尾
+// 有 size 时用它查询块大小，否则需要块大小时整块读出并缓存
+type rangeReader struct {
+	read func(offset, length int64) ([]byte, error)
+	size func() (int64, error)
+	data []byte
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.data != nil {
+		return bytes.NewReader(r.data).ReadAt(p, off)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data, err := r.read(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *rangeReader) Size() (int64, error) {
+	if r.data == nil && r.size != nil {
+		return r.size()
+	}
+	if r.data == nil {
+		data, err := r.read(0, 0)
+		if err != nil {
+			return 0, err
+		}
+		r.data = data
+	}
+	return int64(len(r.data)), nil
+}
+
+func (r *rangeReader) readTail(off int64) ([]byte, error) {
+	if r.data != nil {
+		if off >= int64(len(r.data)) {
+			return nil, io.EOF
+		}
+		return r.data[off:], nil
+	}
+	return r.read(off, 0)
+}
+
+func (r *rangeReader) Close() error {
+	r.data = nil
+	return nil
+}
+
+// tailReader 不用查询块大小就能直接读到块结尾的 BlockReader
+type tailReader interface {
+	readTail(off int64) ([]byte, error)
+}
+
+// ReadBlockTail 读出块从 off 开始到结尾的数据
+// 按范围读取的后端一次请求直接读到结尾，其他后端先查询块大小再读
+func ReadBlockTail(br BlockReader, off int64) ([]byte, error) {
+	if tr, ok := br.(tailReader); ok {
+		return tr.readTail(off)
+	}
+	size, err := br.Size()
+	if err != nil {
+		return nil, err
+	}
+	if size <= off {
+		return nil, fmt.Errorf("invalid read offset %d of block size %d", off, size)
+	}
+	data := make([]byte, size-off)
+	n, err := br.ReadAt(data, off)
+	if err != nil && (!errors.Is(err, io.EOF) || n == 0) {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// cacheBlockReader 读取本节点缓存文件系统中的块，文件开头是 4 字节的版本号
+type cacheBlockReader struct {
+	vfile     *vfs.TieredFs
+	storageID string
+	blockID   string
+}
+
+func (r *cacheBlockReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.vfile.ReadAt(r.storageID, r.blockID, p, off+4)
+}
+
+func (r *cacheBlockReader) Size() (int64, error) {
+	size, err := r.vfile.Size(r.storageID, r.blockID)
+	if err != nil {
+		return 0, err
+	}
+	return size - 4, nil
+}
+
+func (r *cacheBlockReader) Close() error {
+	return nil
+}
+
+// cachedVer 缓存文件系统中块的版本号，块不存在时返回 -1
+func cachedVer(vfile *vfs.TieredFs, storageID, blockID string) int32 {
+	if vfile.Exists(storageID, blockID) {
+		if v, err := vfile.ReadFile(storageID, blockID, 0, 4); err == nil && len(v) == 4 {
+			logger.GetLogger("dedups3").Debugf("get block %s old ver %d", blockID, int32(binary.BigEndian.Uint32(v)))
+			return int32(binary.BigEndian.Uint32(v))
+		}
+	}
+	return -1
+}
+
+// putCached 块写入缓存文件系统后异步刷到后端，缓存区放不下时调用 direct 直接写入后端
+// 写入的数据是 4 字节版本号 + 块数据
+func putCached(vfile *vfs.TieredFs, storageID, blockID string, r io.Reader, size int64, ver int32, direct func(r io.Reader, size int64) error) error {
+	if ver <= cachedVer(vfile, storageID, blockID) {
+		return nil
+	}
+
+	// 创建新数据：4字节版本号 + 序列化数据
+	versionBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(versionBuf, uint32(ver))
+	body := io.MultiReader(bytes.NewReader(versionBuf), r)
+
+	// 检查文件缓存区的剩余空间
+	if vfile.FreeSpace() < 2*(size+4) {
+		logger.GetLogger("dedups3").Infof("cache is too small for block %s size %d, write it directly", blockID, size)
+		if err := vfile.WriteThrough(storageID, blockID, func() error {
+			return direct(body, size+4)
+		}); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to write block %s directly: %v", blockID, err)
+			return fmt.Errorf("failed to write block %s directly: %w", blockID, err)
+		}
+		return nil
+	}
+
+	if err := vfile.WriteFrom(storageID, blockID, body, size+4, ver); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to write block %s: %v", blockID, err)
+		return fmt.Errorf("failed to write block %s: %w", blockID, err)
+	}
+	return nil
+}
@@ -89,6 +89,7 @@ func registerAdminRouter(mr *mux.Router) {
 	api_router.Methods(http.MethodPost).Path("/login").HandlerFunc(handler.AdminLoginHandler).Name("console:Login")
 	api_router.Methods(http.MethodPost).Path("/logout").HandlerFunc(handler.AdminLogoutHandler).Name("console:Logout")
 	api_router.Methods(http.MethodGet).Path("/stats").HandlerFunc(handler.AdminGetStatsHandler).Name("console:GetStats")
+	api_router.Methods(http.MethodGet).Path("/lifecycle").HandlerFunc(handler.AdminGetLifecycleHandler).Name("console:GetLifecycle")
 	api_router.Methods(http.MethodGet).Path("/bucket/list").HandlerFunc(handler.AdminListBucketsHandler).Name("console:ListBuckets")
 	api_router.Methods(http.MethodPut).Path("/bucket/create").HandlerFunc(handler.AdminCreateBucketHandler).Name("console:CreateBucket")
 	api_router.Methods(http.MethodDelete).Path("/bucket/delete").HandlerFunc(handler.AdminDeleteBucketHandler).Name("console:DeleteBucket")
@@ -97,6 +98,11 @@ func registerAdminRouter(mr *mux.Router) {
 	api_router.Methods(http.MethodPost).Path("/bucket/putobject").HandlerFunc(handler.AdminPutObjectHandler).Name("console:PutObject")
 	api_router.Methods(http.MethodPost).Path("/bucket/deleteobject").HandlerFunc(handler.AdminDelObjectHandler).Name("console:DeleteObject")
 	api_router.Methods(http.MethodPost).Path("/bucket/getobject").HandlerFunc(handler.AdminGetObjectHandler).Name("console:GetObject")
+	api_router.Methods(http.MethodGet).Path("/bucket/replication").HandlerFunc(handler.AdminGetReplicationHandler).Name("console:GetReplication")
+	api_router.Methods(http.MethodPost).Path("/bucket/target").HandlerFunc(handler.AdminPutBucketTargetHandler).Name("console:PutBucketTarget")
+	api_router.Methods(http.MethodDelete).Path("/bucket/target").HandlerFunc(handler.AdminDeleteBucketTargetHandler).Name("console:DeleteBucketTarget")
+	api_router.Methods(http.MethodPost).Path("/bucket/resync").HandlerFunc(handler.AdminResyncReplicationHandler).Name("console:ResyncReplication")
+	api_router.Methods(http.MethodGet).Path("/site/status").HandlerFunc(handler.AdminGetSiteHandler).Name("console:GetSiteStatus")
 
 	api_router.Methods(http.MethodGet).Path("/user/info").HandlerFunc(handler.AdminGetUserHandler).Name("console:GetUserInfo")
 	api_router.Methods(http.MethodGet).Path("/user/list").HandlerFunc(handler.AdminListUserHandler).Name("console:ListUsers")
@@ -127,6 +133,13 @@ func registerAdminRouter(mr *mux.Router) {
 	api_router.Methods(http.MethodPost).Path("/config/createquota").HandlerFunc(handler.AdminCreateQuotaHandler).Name("console:CreateQuota")
 	api_router.Methods(http.MethodPost).Path("/config/updatequota").HandlerFunc(handler.AdminUpdateQuotaHandler).Name("console:UpdateQuota")
 	api_router.Methods(http.MethodDelete).Path("/config/deletequota").HandlerFunc(handler.AdminDeleteQuotaHandler).Name("console:DeleteQuota")
+	api_router.Methods(http.MethodGet).Path("/config/publicaccess").HandlerFunc(handler.AdminGetPublicAccessHandler).Name("console:GetPublicAccessBlock")
+	api_router.Methods(http.MethodPost).Path("/config/publicaccess").HandlerFunc(handler.AdminPutPublicAccessHandler).Name("console:PutPublicAccessBlock")
+	api_router.Methods(http.MethodGet).Path("/kms/list").HandlerFunc(handler.AdminListKMSKeyHandler).Name("console:ListKMSKeys")
+	api_router.Methods(http.MethodPost).Path("/kms/create").HandlerFunc(handler.AdminCreateKMSKeyHandler).Name("console:CreateKMSKey")
+	api_router.Methods(http.MethodPost).Path("/kms/enable").HandlerFunc(handler.AdminEnableKMSKeyHandler).Name("console:EnableKMSKey")
+	api_router.Methods(http.MethodPost).Path("/kms/disable").HandlerFunc(handler.AdminDisableKMSKeyHandler).Name("console:DisableKMSKey")
+	api_router.Methods(http.MethodPost).Path("/kms/rotate").HandlerFunc(handler.AdminRotateKMSKeyHandler).Name("console:RotateKMSKey")
 	api_router.Methods(http.MethodGet).Path("/config/listchunkcfg").HandlerFunc(handler.AdminListChunkConfigHandler).Name("console:ListChunkConfigs")
 	api_router.Methods(http.MethodGet).Path("/config/getchunkcfg").HandlerFunc(handler.AdminGetChunkConfigHandler).Name("console:GetChunkConfig")
 	api_router.Methods(http.MethodPost).Path("/config/updatechunkcfg").HandlerFunc(handler.AdminSetChunkConfigHandler).Name("console:UpdateChunkConfig")
@@ -18,6 +18,7 @@ package router
 
 import (
 	"net/http"
+	"regexp"
 
 	"github.com/gorilla/mux"
 
@@ -28,14 +29,29 @@ import (
 )
 
 func registerAPIRouter(mr *mux.Router) {
+	cfg := config.Get()
+	// CORS 预检请求不带签名，按桶的跨域配置应答
+	for _, domain := range cfg.Server.Domains {
+		mr.Methods(http.MethodOptions).Host("{bucket:.+}." + domain).HandlerFunc(handler.PreflightHandler).Name("s3:PreflightRequest")
+	}
+	mr.Methods(http.MethodOptions).PathPrefix("/{bucket}").HandlerFunc(handler.PreflightHandler).Name("s3:PreflightRequest")
+
+	// 浏览器表单上传，签名和策略在表单字段中，由 PostObjectHandler 自行鉴权
+	for _, domain := range cfg.Server.Domains {
+		mr.Methods(http.MethodPost).Host("{bucket:.+}."+domain).Path("/").
+			HeadersRegexp(xhttp.ContentType, "multipart/form-data").HandlerFunc(handler.PostObjectHandler).Name("s3:PostObject")
+	}
+	mr.Methods(http.MethodPost).Path("/{bucket}").
+		HeadersRegexp(xhttp.ContentType, "multipart/form-data").HandlerFunc(handler.PostObjectHandler).Name("s3:PostObject")
+
 	// init api router
-	ar := mr.PathPrefix("/").HeadersRegexp(xhttp.Authorization, "AWS4-HMAC-SHA256 Credential=.+").Subrouter()
+	// 匹配 Authorization 头签名、查询字符串签名（预签名 URL）和不带签名的匿名请求
+	ar := mr.PathPrefix("/").MatcherFunc(matchS3Request).Subrouter()
 	// 应用AWS4签名验证中间件
 	ar.Use(middleware.AWS4SigningMiddleware)
 	ar.Use(middleware.S3AuthorizationMiddleware)
 
 	var routers []*mux.Router
-	cfg := config.Get()
 	for _, domain := range cfg.Server.Domains {
 		routers = append(routers, ar.Host("{bucket:.+}."+domain).Subrouter())
 	}
@@ -99,8 +115,8 @@ func registerAPIRouter(mr *mux.Router) {
 		// PutObject with auto-extract support for zip
 		router.Methods(http.MethodPut).Path("/{object:.+}").HeadersRegexp(xhttp.AmzSnowballExtract, "true").HandlerFunc(handler.PutObjectExtractHandler).Name("s3:PutObjectExtract")
 
-		// AppendObject to be rejected
-		router.Methods(http.MethodPut).Path("/{object:.+}").HeadersRegexp(xhttp.AmzWriteOffsetBytes, "").HandlerFunc(handler.ErrorResponseHandler).Name("s3:AppendObject") // Assuming errorResponseHandler is the final handler
+		// AppendObject
+		router.Methods(http.MethodPut).Path("/{object:.+}").HeadersRegexp(xhttp.AmzWriteOffsetBytes, "").HandlerFunc(handler.AppendObjectHandler).Name("s3:AppendObject")
 
 		// RenameObject
 		router.Methods(http.MethodPut).Path("/{object:.+}").HandlerFunc(handler.RenameObjectHandler).Queries("renameObject", "").Name("s3:RenameObject")
@@ -138,14 +154,16 @@ func registerAPIRouter(mr *mux.Router) {
 		router.Methods(http.MethodGet).HandlerFunc(handler.GetBucketACLHandler).Queries("acl", "").Name("s3:GetBucketAcl")
 		// PutBucketACL -- this is a dummy call.
 		router.Methods(http.MethodPut).HandlerFunc(handler.PutBucketACLHandler).Queries("acl", "").Name("s3:PutBucketAcl")
-		// GetBucketCors - this is a dummy call.
-		router.Methods(http.MethodGet).HandlerFunc(handler.GetBucketCorsHandler).Queries("cors", "").Name("s3:GetBucketCors")
-		// PutBucketCors - this is a dummy call.
-		router.Methods(http.MethodPut).HandlerFunc(handler.PutBucketCorsHandler).Queries("cors", "").Name("s3:PutBucketCors")
-		// DeleteBucketCors - this is a dummy call.
-		router.Methods(http.MethodDelete).HandlerFunc(handler.DeleteBucketCorsHandler).Queries("cors", "").Name("s3:DeleteBucketCors")
-		// GetBucketWebsiteHandler - this is a dummy call.
+		// GetBucketCors
+		router.Methods(http.MethodGet).HandlerFunc(handler.GetBucketCorsHandler).Queries("cors", "").Name("s3:GetBucketCORS")
+		// PutBucketCors
+		router.Methods(http.MethodPut).HandlerFunc(handler.PutBucketCorsHandler).Queries("cors", "").Name("s3:PutBucketCORS")
+		// DeleteBucketCors
+		router.Methods(http.MethodDelete).HandlerFunc(handler.DeleteBucketCorsHandler).Queries("cors", "").Name("s3:DeleteBucketCORS")
+		// GetBucketWebsiteHandler
 		router.Methods(http.MethodGet).HandlerFunc(handler.GetBucketWebsiteHandler).Queries("website", "").Name("s3:GetBucketWebsite")
+		// PutBucketWebsiteHandler
+		router.Methods(http.MethodPut).HandlerFunc(handler.PutBucketWebsiteHandler).Queries("website", "").Name("s3:PutBucketWebsite")
 		// GetBucketAccelerateHandler - this is a dummy call.
 		router.Methods(http.MethodGet).HandlerFunc(handler.GetBucketAccelerateHandler).Queries("accelerate", "").Name("s3:GetBucketAccelerateConfiguration")
 		// GetBucketRequestPaymentHandler - this is a dummy call.
@@ -225,3 +243,11 @@ func registerAPIRouter(mr *mux.Router) {
 	ar.Methods(http.MethodGet).Path("//").HandlerFunc(handler.ListBucketsHandler).Name("s3:ListBuckets")
 
 }
+
+var authHeaderRegex = regexp.MustCompile(`AWS4-HMAC-SHA256 Credential=.+`)
+
+// matchS3Request 请求带有 SigV4 签名，或者不带 Authorization 头（预签名 URL 和匿名请求）
+func matchS3Request(r *http.Request, _ *mux.RouteMatch) bool {
+	authHeader := r.Header.Get(xhttp.Authorization)
+	return authHeader == "" || authHeaderRegex.MatchString(authHeader)
+}
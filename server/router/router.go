@@ -51,9 +51,10 @@ func SetupS3Router() *mux.Router {
 	mr := mux.NewRouter().SkipClean(false).UseEncodedPath()
 
 	// 添加请求ID中间件（应放在首位）
-	mr.Use(mux.CORSMethodMiddleware(mr))
 	mr.Use(middleware.RequestIDMiddleware)
 	mr.Use(middleware.TraceMiddleware)
+	// 按桶的跨域配置加上 Access-Control-* 响应头
+	mr.Use(middleware.CorsMiddleware)
 	mr.Use(middleware.RateLimitMiddleware(middleware.RateLimitConfig{
 		RequestsPerSecond: 10,
 		BurstSize:         20,
@@ -62,6 +63,10 @@ func SetupS3Router() *mux.Router {
 
 	registerNodeRouter(mr)
 
+	registerSiteRouter(mr)
+
+	registerWebsiteRouter(mr)
+
 	registerAPIRouter(mr)
 
 	// 使用http.HandlerFunc适配器将函数转换为http.Handler接口
@@ -0,0 +1,38 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package router
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mageg-x/dedups3/handler"
+	"github.com/mageg-x/dedups3/middleware"
+	"github.com/mageg-x/dedups3/service/site"
+)
+
+func registerSiteRouter(mr *mux.Router) {
+	// 站点复制接口，仅当请求头包含 x-amz-dedups3-site-api 才匹配，需要 SigV4 签名
+	sr := mr.PathPrefix(site.SitePathPrefix).Headers(site.SiteAPIHeader, "").Subrouter()
+	sr.Use(middleware.AWS4SigningMiddleware)
+	sr.Methods(http.MethodPost).Path("/chunks").HandlerFunc(handler.SiteCheckChunksHandler).Name("SiteCheckChunks")
+	sr.Methods(http.MethodPut).Path("/object").HandlerFunc(handler.SitePutObjectHandler).Name("SitePutObject")
+	sr.Methods(http.MethodDelete).Path("/object").HandlerFunc(handler.SiteDeleteObjectHandler).Name("SiteDeleteObject")
+	sr.Methods(http.MethodPut).Path("/bucket").HandlerFunc(handler.SitePutBucketHandler).Name("SitePutBucket")
+	sr.Methods(http.MethodPut).Path("/iam").HandlerFunc(handler.SitePutIamHandler).Name("SitePutIam")
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package router
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mageg-x/dedups3/handler"
+	"github.com/mageg-x/dedups3/internal/config"
+)
+
+func registerWebsiteRouter(mr *mux.Router) {
+	// 静态网站接口，仅匹配 {bucket}.{website_domain} 的匿名 GET/HEAD 请求
+	cfg := config.Get()
+	for _, domain := range cfg.Server.WebsiteDomains {
+		wr := mr.Host("{bucket:.+}." + domain).Subrouter()
+		wr.Methods(http.MethodGet, http.MethodHead).PathPrefix("/").HandlerFunc(handler.WebsiteHandler).Name("s3:Website")
+	}
+}
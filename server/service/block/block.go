@@ -22,9 +22,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	sb "github.com/mageg-x/dedups3/plugs/block"
-	xcache "github.com/mageg-x/dedups3/plugs/cache"
-	"github.com/mageg-x/dedups3/plugs/kv"
+	"io"
 	"sort"
 	"sync"
 	"time"
@@ -36,6 +34,9 @@ import (
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/utils"
 	"github.com/mageg-x/dedups3/meta"
+	sb "github.com/mageg-x/dedups3/plugs/block"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
 	"github.com/mageg-x/dedups3/service/storage"
 )
 
@@ -188,7 +189,7 @@ func (s *BlockService) PutChunk(chunk *meta.Chunk, obj *meta.BaseObject) (*meta.
 			}
 
 			if !exists {
-				curBlock.ChunkList = append(curBlock.ChunkList, meta.BlockChunk{Hash: chunk.Hash, Size: chunk.Size, Data: chunk.Data})
+				curBlock.ChunkList = append(curBlock.ChunkList, meta.BlockChunk{Hash: chunk.Hash, Size: chunk.Size, Data: chunk.Data, Incompressible: obj.Incompressible})
 				chunk.Data = nil
 				curBlock.TotalSize += int64(chunk.Size)
 				curBlock.RealSize = curBlock.TotalSize
@@ -254,6 +255,8 @@ func (s *BlockService) doFlushBlock(ctx context.Context, block *meta.Block) erro
 	blockData := meta.BlockData{
 		BlockHeader: meta.BlockHeader{
 			ID:        block.ID,
+			KeyID:     block.KeyID,
+			DataKey:   block.DataKey,
 			TotalSize: block.TotalSize,
 			Ver:       block.Ver,
 			Finally:   block.Finally,
@@ -277,8 +280,9 @@ func (s *BlockService) doFlushBlock(ctx context.Context, block *meta.Block) erro
 			return fmt.Errorf("chunk %s size not match", block.ChunkList[i].Hash)
 		}
 		_chunk := meta.BlockChunk{
-			Hash: block.ChunkList[i].Hash,
-			Size: block.ChunkList[i].Size,
+			Hash:           block.ChunkList[i].Hash,
+			Size:           block.ChunkList[i].Size,
+			Incompressible: block.ChunkList[i].Incompressible,
 		}
 		blockData.ChunkList = append(blockData.ChunkList, _chunk)
 		blockData.Data = append(blockData.Data, block.ChunkList[i].Data...)
@@ -308,7 +312,12 @@ func (s *BlockService) doFlushBlock(ctx context.Context, block *meta.Block) erro
 	}
 	block.Compressed = blockData.Compressed
 	block.Encrypted = blockData.Encrypted
+	block.KeyID = blockData.KeyID
+	block.DataKey = blockData.DataKey
 	block.RealSize = blockData.RealSize
+	block.Segments = blockData.Segments
+	block.DataOffset = blockData.DataOffset
+	block.SkipSize = blockData.SkipSize
 
 	return nil
 }
@@ -327,22 +336,39 @@ func (s *BlockService) WriteBlock(ctx context.Context, storageID string, blockDa
 	}
 	logger.GetLogger("dedups3").Debugf("get storage id %s conf %#v", storageID, st.Chunk)
 
-	// 压缩Data
-	if st.Chunk != nil && st.Chunk.Compress {
-		if len(blockData.Data) > 1024 && utils.IsCompressible(blockData.Data, 4*1024, 0.9) {
-			compress, err := utils.Compress(blockData.Data)
-			if err == nil && compress != nil && float64(len(compress))/float64(len(blockData.Data)) < 0.9 {
-				blockData.Data = compress
-				blockData.Compressed = true
-			}
+	// 压缩Data，BlockData 可能来自 ReadBlock，数据已经是明文
+	blockData.Compressed = false
+	blockData.Encrypted = false
+	blockData.Segments = nil
+	blockData.SkipSize = 0
+	compress := st.Chunk != nil && st.Chunk.Compress
+	encrypt := st.Chunk != nil && st.Chunk.Encrypt
+	var parts [][]byte
+	if segSize := xconf.Get().Block.SegmentSize; segSize > 0 && canSegment(blockData) {
+		// 分段压缩加密，范围读取时只需要读出用到的分段
+		parts, err = s.encodeSegments(blockData, segSize, compress, encrypt)
+		if err != nil {
+			return err
+		}
+		compress, encrypt = false, false
+	}
+	if compress {
+		blockData.Data, blockData.Compressed = compressData(blockData.Data, allIncompressible(blockData.ChunkList))
+		if !blockData.Compressed {
+			blockData.SkipSize = int64(len(blockData.Data))
 		}
 	}
 	blockData.RealSize = int64(len(blockData.Data))
 
 	// 加密Data
-	if st.Chunk != nil && st.Chunk.Encrypt {
+	if encrypt {
 		if len(blockData.Data) > 0 {
-			encrypt, err := utils.Encrypt(blockData.Data, blockData.ID)
+			dataKey, err := s.blockDataKey(&blockData.BlockHeader)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("get block %s data key failed: %v", blockData.ID, err)
+				return fmt.Errorf("get block %s data key failed: %w", blockData.ID, err)
+			}
+			encrypt, err := utils.EncryptWithKey(blockData.Data, dataKey, []byte(blockData.ID))
 			if err == nil && encrypt != nil {
 				blockData.Data = encrypt
 				blockData.Encrypted = true
@@ -350,31 +376,45 @@ func (s *BlockService) WriteBlock(ctx context.Context, storageID string, blockDa
 		}
 	}
 
-	blockData.RealSize = int64(len(blockData.Data))
+	if parts == nil {
+		parts = [][]byte{blockData.Data}
+	}
+	blockData.RealSize = 0
+	for _, part := range parts {
+		blockData.RealSize += int64(len(part))
+	}
 
-	logger.GetLogger("dedups3").Debugf("flush block data size %d:%d, compress rate %.2f%%",
-		blockData.TotalSize, blockData.RealSize, float64(100.0*blockData.RealSize)/float64(blockData.TotalSize))
+	logger.GetLogger("dedups3").Debugf("flush block data size %d:%d, compress rate %.2f%%, skip compress %d",
+		blockData.TotalSize, blockData.RealSize, float64(100.0*blockData.RealSize)/float64(blockData.TotalSize), blockData.SkipSize)
 
-	data, err := msgpack.Marshal(&blockData)
+	// 块头和各个分段依次写入后端，不再拼接成完整的块文件
+	prefix, err := blockPrefix(blockData, blockData.RealSize)
 	if err != nil {
 		logger.GetLogger("dedups3").Debugf("msgpack marshal %s failed: %v", blockData.ID, err)
 		return fmt.Errorf("msgpack marshal %s failed: %w", blockData.ID, err)
 	}
-
-	err = st.Instance.WriteBlock(ctx, blockData.ID, data, blockData.Ver)
+	readers := make([]io.Reader, 0, len(parts)+1)
+	readers = append(readers, bytes.NewReader(prefix))
+	for _, part := range parts {
+		readers = append(readers, bytes.NewReader(part))
+	}
+	size := int64(len(prefix)) + blockData.RealSize
+	err = sb.AsStreamStore(st.Instance).PutBlock(ctx, blockData.ID, io.MultiReader(readers...), size, blockData.Ver)
 	if err != nil {
 		logger.GetLogger("dedups3").Debugf("write block %s failed: %v", blockData.ID, err)
 		return fmt.Errorf("write block %s failed: %w", blockData.ID, err)
 	} else {
 		logger.GetLogger("dedups3").Infof("finish write block %s success", blockData.ID)
 	}
+	// 块被重写（比如 gc 去掉空洞）后缓存的旧数据不能再用
+	bc.Del(storageID, blockData.ID)
 
 	return nil
 }
 
 func (s *BlockService) ReadBlock(storageID, blockID string) (*meta.BlockData, error) {
 	cacheKey := fmt.Sprintf("block:%s:%s", storageID, blockID)
-	data := bc.Get(storageID, cacheKey)
+	data := bc.Get(storageID, blockID)
 	if data == nil {
 		logger.GetLogger("dedups3").Debugf("block %s not found in block cache", blockID)
 		ss := storage.GetStorageService()
@@ -405,7 +445,7 @@ func (s *BlockService) ReadBlock(storageID, blockID string) (*meta.BlockData, er
 				return nil
 			}
 
-			data, err = st.Instance.ReadBlock(blockMeta.Location, blockID, 0, 0)
+			data, err = readBlockAt(st, blockMeta.Location, blockID, 0, 0)
 			if err != nil || len(data) == 0 {
 				logger.GetLogger("dedups3").Errorf("read block %s failed: %v", blockID, err)
 				return fmt.Errorf("read block %s failed: %w", blockID, err)
@@ -444,8 +484,16 @@ func (s *BlockService) ReadBlock(storageID, blockID string) (*meta.BlockData, er
 		logger.GetLogger("dedups3").Errorf("read block %s id not match block %s ", blockID, blockData.ID)
 		return nil, fmt.Errorf("read block %s id not match block %s ", blockID, blockData.ID)
 	}
-	if blockData.Encrypted {
-		_d, err := utils.Decrypt(blockData.Data, blockID)
+	if len(blockData.Segments) > 0 {
+		_d, err := s.decodeSegments(&blockData.BlockHeader, blockData.Data, 0, blockData.Segments)
+		if err != nil {
+			bc.Del(storageID, blockID)
+			logger.GetLogger("dedups3").Errorf("decode block %s segments failed: %v", blockID, err)
+			return nil, fmt.Errorf("decode block %s segments failed: %w", blockID, err)
+		}
+		blockData.Data = _d
+	} else if blockData.Encrypted {
+		_d, err := s.decryptBlock(&blockData)
 		if err != nil {
 			bc.Del(storageID, blockID)
 			logger.GetLogger("dedups3").Errorf("decrypt block %s:%s size %d:%d failed: %v", blockID, blockData.ID, len(blockData.Data), blockData.RealSize, err)
@@ -456,7 +504,7 @@ func (s *BlockService) ReadBlock(storageID, blockID string) (*meta.BlockData, er
 		blockData.Data = _d
 	}
 
-	if blockData.Compressed {
+	if blockData.Compressed && len(blockData.Segments) == 0 {
 		_d, err := utils.Decompress(blockData.Data)
 		if err != nil {
 			bc.Del(storageID, blockID)
@@ -473,6 +521,28 @@ func (s *BlockService) ReadBlock(storageID, blockID string) (*meta.BlockData, er
 	return &blockData, nil
 }
 
+// readBlockAt 读出块文件 [offset, offset+length) 的数据，length 为 0 时读到结尾，块文件不够 length 时返回读到的部分
+func readBlockAt(st *meta.Storage, location, blockID string, offset, length int64) ([]byte, error) {
+	br, err := sb.AsStreamStore(st.Instance).OpenBlock(location, blockID)
+	if err != nil {
+		return nil, err
+	}
+	defer br.Close()
+
+	if length == 0 {
+		return sb.ReadBlockTail(br, offset)
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("invalid read range %d:%d of block %s", offset, length, blockID)
+	}
+	data := make([]byte, length)
+	n, err := br.ReadAt(data, offset)
+	if err != nil && (!errors.Is(err, io.EOF) || n == 0) {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
 func (s *BlockService) ReadBlockHead(storageID, blockID string) (*meta.BlockHeader, error) {
 	ss := storage.GetStorageService()
 	if ss == nil {
@@ -496,7 +566,7 @@ func (s *BlockService) ReadBlockHead(storageID, blockID string) (*meta.BlockHead
 		return nil, fmt.Errorf("read block meta %s failed: %w", blockID, err)
 	}
 
-	data, err := st.Instance.ReadBlock(blockMeta.Location, blockID, 0, int64(cfg.Block.MaxHeadSize))
+	data, err := readBlockAt(st, blockMeta.Location, blockID, 0, int64(cfg.Block.MaxHeadSize))
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("read block header %s failed: %v", blockID, err)
 		return nil, fmt.Errorf("read block header %s failed: %w", blockID, err)
@@ -513,6 +583,33 @@ func (s *BlockService) ReadBlockHead(storageID, blockID string) (*meta.BlockHead
 	return &header, nil
 }
 
+// ScrubBlock 丢弃缓存后从存储重新读取块，用 verify 校验每个 chunk，返回校验失败的 chunk
+func (s *BlockService) ScrubBlock(storageID, blockID string, verify func(hash string, data []byte) bool) ([]string, error) {
+	bc.Del(storageID, blockID)
+	blockData, err := s.ReadBlock(storageID, blockID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("scrub read block %s failed: %v", blockID, err)
+		return nil, fmt.Errorf("scrub read block %s failed: %w", blockID, err)
+	}
+
+	bad := make([]string, 0)
+	offset := int64(0)
+	for _, ck := range blockData.ChunkList {
+		if offset+int64(ck.Size) > int64(len(blockData.Data)) {
+			return nil, fmt.Errorf("block %s chunk list exceeds data size %d", blockID, len(blockData.Data))
+		}
+		data := blockData.Data[offset : offset+int64(ck.Size)]
+		offset += int64(ck.Size)
+		if ck.Hash != meta.NONE_CHUNK_ID && !verify(ck.Hash, data) {
+			bad = append(bad, ck.Hash)
+		}
+	}
+	if len(bad) > 0 {
+		bc.Del(storageID, blockID)
+	}
+	return bad, nil
+}
+
 func (s *BlockService) RemoveBlock(storageID, blockID string) error {
 	ss := storage.GetStorageService()
 	if ss == nil {
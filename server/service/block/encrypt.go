@@ -0,0 +1,244 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package block
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/kms"
+)
+
+const (
+	rewrapLockKey   = "aws:lock:kms:rewrap"
+	rewrapLockOwner = "BlockService"
+	rewrapBatchSize = 100
+)
+
+// blockDataKey 返回块的明文数据密钥，块还没有数据密钥时生成一个，并把包装后的密钥写入 header
+// 同一个块的多个版本使用同一个数据密钥，元数据和块文件中保存的包装密钥始终能解出同一个密钥
+func (s *BlockService) blockDataKey(h *meta.BlockHeader) ([]byte, error) {
+	ks := kms.GetKMSService()
+	if ks == nil {
+		return nil, fmt.Errorf("kms service not initialized")
+	}
+
+	if h.KeyID != "" && len(h.DataKey) > 0 {
+		plain, err := ks.UnwrapDataKey(h.KeyID, h.DataKey, h.ID)
+		if err == nil {
+			// 顺便改用当前主密钥包装
+			if h.KeyID != ks.CurrentKeyID() {
+				if keyID, wrapped, err := ks.WrapDataKey(plain, h.ID); err == nil {
+					h.KeyID, h.DataKey = keyID, wrapped
+				}
+			}
+			return plain, nil
+		}
+		// 整个块都会重新加密，解不开旧的数据密钥时换一个新的
+		logger.GetLogger("dedups3").Warnf("unwrap block %s data key failed, generate new one: %v", h.ID, err)
+	}
+
+	plain, keyID, wrapped, err := ks.GenerateDataKey(h.ID)
+	if err != nil {
+		return nil, err
+	}
+	h.KeyID, h.DataKey = keyID, wrapped
+	return plain, nil
+}
+
+// decryptBlock 解密块数据，没有 KeyID 的旧块使用块ID派生的密钥
+func (s *BlockService) decryptBlock(bd *meta.BlockData) ([]byte, error) {
+	if bd.KeyID == "" {
+		return utils.Decrypt(bd.Data, bd.ID)
+	}
+	dataKey, err := s.openDataKey(&bd.BlockHeader)
+	if err != nil {
+		return nil, err
+	}
+	return utils.DecryptWithKey(bd.Data, dataKey, []byte(bd.ID))
+}
+
+// openDataKey 解出块的明文数据密钥，读数据时使用，不会生成新的密钥
+func (s *BlockService) openDataKey(h *meta.BlockHeader) ([]byte, error) {
+	if h.KeyID == "" {
+		return nil, fmt.Errorf("block %s has no data key", h.ID)
+	}
+	ks := kms.GetKMSService()
+	if ks == nil {
+		return nil, fmt.Errorf("kms service not initialized")
+	}
+	dataKey, err := ks.UnwrapDataKey(h.KeyID, h.DataKey, h.ID)
+	if err != nil {
+		// 块文件中的数据密钥不会被重新包装，旧主密钥下线后使用元数据中重新包装过的密钥
+		var bm meta.Block
+		exists, e := s.kvstore.Get(meta.GenBlockKey(h.StorageID, h.ID), &bm)
+		if e != nil || !exists || bm.KeyID == "" || bm.KeyID == h.KeyID {
+			return nil, err
+		}
+		dataKey, err = ks.UnwrapDataKey(bm.KeyID, bm.DataKey, h.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dataKey, nil
+}
+
+// RewrapTask 块以外由主密钥包装的一类密钥的重新包装任务，返回重新包装的数量
+// 有密钥重新包装失败时返回错误
+type RewrapTask struct {
+	Name string
+	Run  func() (int, error)
+}
+
+// StartRewrap 启动后台任务，定期把旧主密钥包装的数据密钥改用当前主密钥包装
+// 块的数据密钥之外，KMS 密钥、去重范围密钥和对象数据密钥等由 tasks 负责
+func (s *BlockService) StartRewrap(tasks ...RewrapTask) {
+	go func() {
+		for {
+			s.rewrapAll(tasks)
+			interval := xconf.Get().KMS.RewrapInterval
+			if interval <= 0 {
+				interval = time.Hour
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// rewrapAll 依次执行块和其他密钥的重新包装，全部成功时旧主密钥才可以从配置中删除
+func (s *BlockService) rewrapAll(tasks []RewrapTask) {
+	ks := kms.GetKMSService()
+	if ks == nil {
+		logger.GetLogger("dedups3").Errorf("kms service not initialized")
+		return
+	}
+	// 多个节点同一时间只允许一个执行
+	if ok, _ := s.kvstore.TryLock(rewrapLockKey, rewrapLockOwner, time.Hour); !ok {
+		return
+	}
+	defer s.kvstore.UnLock(rewrapLockKey, rewrapLockOwner)
+
+	tasks = append([]RewrapTask{{Name: "block", Run: s.RewrapBlocks}}, tasks...)
+	total, failed := 0, false
+	for _, task := range tasks {
+		n, err := task.Run()
+		total += n
+		if err != nil {
+			failed = true
+			logger.GetLogger("dedups3").Errorf("rewrap %s data keys failed after %d keys: %v", task.Name, n, err)
+		} else if n > 0 {
+			logger.GetLogger("dedups3").Infof("rewrap %d %s data keys finished", n, task.Name)
+		}
+	}
+	if failed {
+		logger.GetLogger("dedups3").Warnf("old master keys are still in use, keep them in old_master_keys")
+	} else if total > 0 {
+		logger.GetLogger("dedups3").Infof("all data keys are wrapped by master key %s, old master keys can be removed", ks.CurrentKeyID())
+	}
+}
+
+// RewrapBlocks 扫描所有块元数据，重新包装数据密钥，返回重新包装的块数
+// 有块重新包装失败时返回错误
+func (s *BlockService) RewrapBlocks() (int, error) {
+	ks := kms.GetKMSService()
+	if ks == nil {
+		return 0, fmt.Errorf("kms service not initialized")
+	}
+
+	currentKeyID := ks.CurrentKeyID()
+	count, failed := 0, 0
+	startKey := ""
+	for {
+		keys, nextKey, err := s.scanBlockKeys(startKey)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys {
+			done, err := s.rewrapBlock(ks, key, currentKeyID)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("rewrap block %s failed: %v", key, err)
+				failed++
+				continue
+			}
+			if done {
+				count++
+			}
+		}
+		if nextKey == "" || len(keys) == 0 {
+			break
+		}
+		startKey = nextKey
+	}
+	if failed > 0 {
+		return count, fmt.Errorf("%d blocks failed to rewrap", failed)
+	}
+	return count, nil
+}
+
+func (s *BlockService) scanBlockKeys(startKey string) ([]string, string, error) {
+	txn, err := s.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin txn: %w", err)
+	}
+	defer txn.Rollback()
+	keys, nextKey, err := txn.Scan("aws:block:", startKey, rewrapBatchSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan block keys: %w", err)
+	}
+	return keys, nextKey, nil
+}
+
+// rewrapBlock 重新包装一个块的数据密钥，返回 true 表示有更新
+func (s *BlockService) rewrapBlock(ks *kms.KMSService, blockKey, currentKeyID string) (bool, error) {
+	txn, err := s.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	var bm meta.Block
+	exists, err := txn.Get(blockKey, &bm)
+	if err != nil || !exists {
+		return false, err
+	}
+	if bm.KeyID == "" || bm.KeyID == currentKeyID {
+		return false, nil
+	}
+
+	keyID, wrapped, err := ks.RewrapDataKey(bm.KeyID, bm.DataKey, bm.ID)
+	if err != nil {
+		return false, err
+	}
+	bm.KeyID, bm.DataKey = keyID, wrapped
+	if err := txn.Set(blockKey, &bm); err != nil {
+		return false, fmt.Errorf("failed to set block meta: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit block meta: %w", err)
+	}
+	if cache, err := xcache.GetCache(); err == nil && cache != nil {
+		_ = cache.Del(context.Background(), blockKey)
+	}
+	return true, nil
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package block
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/storage"
+)
+
+// incompressibleEntropy 采样熵超过这个值的数据不尝试压缩
+const incompressibleEntropy = 7.5
+
+// compressData 数据可压缩并且压缩率足够时返回压缩后的数据
+// 来自已压缩内容类型的数据、采样熵过高或者试压缩效果差的数据不做完整压缩
+func compressData(data []byte, incompressible bool) (out []byte, compressed bool) {
+	if len(data) <= 1024 {
+		return data, false
+	}
+	if incompressible || utils.SampleEntropy(data, 4*1024) > incompressibleEntropy || !utils.IsCompressible(data, 4*1024, 0.9) {
+		return data, false
+	}
+	compress, err := utils.Compress(data)
+	if err == nil && compress != nil && float64(len(compress))/float64(len(data)) < 0.9 {
+		return compress, true
+	}
+	return data, false
+}
+
+// allIncompressible 所有 chunk 都来自已压缩的内容类型
+func allIncompressible(chunks []meta.BlockChunk) bool {
+	for _, ck := range chunks {
+		if !ck.Incompressible {
+			return false
+		}
+	}
+	return len(chunks) > 0
+}
+
+// segmentAAD 分段加密的附加数据，防止分段之间被互相替换
+func segmentAAD(blockID string, seg *meta.BlockSegment) []byte {
+	return []byte(fmt.Sprintf("%s:%d", blockID, seg.Offset))
+}
+
+// canSegment 切片列表和数据对得上才能按 chunk 边界分段
+func canSegment(bd *meta.BlockData) bool {
+	if len(bd.ChunkList) == 0 {
+		return false
+	}
+	size := int64(0)
+	for _, ck := range bd.ChunkList {
+		size += int64(ck.Size)
+	}
+	return size == int64(len(bd.Data))
+}
+
+// encodeSegments 按 chunk 边界把块数据切成不小于 segSize 的分段，每段独立压缩和加密
+// 可压缩和不可压缩的 chunk 不放在同一个分段中，返回按顺序排列的编码后分段数据
+func (s *BlockService) encodeSegments(bd *meta.BlockData, segSize int, compress, encrypt bool) ([][]byte, error) {
+	var dataKey []byte
+	if encrypt {
+		key, err := s.blockDataKey(&bd.BlockHeader)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("get block %s data key failed: %v", bd.ID, err)
+			return nil, fmt.Errorf("get block %s data key failed: %w", bd.ID, err)
+		}
+		dataKey = key
+	}
+
+	parts := make([][]byte, 0, len(bd.Data)/segSize+1)
+	pos := int64(0)
+	segments := make([]meta.BlockSegment, 0, len(bd.Data)/segSize+1)
+	begin, end := int64(0), int64(0)
+	for i, ck := range bd.ChunkList {
+		end += int64(ck.Size)
+		if end-begin < int64(segSize) && i < len(bd.ChunkList)-1 && bd.ChunkList[i+1].Incompressible == ck.Incompressible {
+			continue
+		}
+		seg := meta.BlockSegment{Offset: begin, Size: int32(end - begin), Pos: pos}
+		part := bd.Data[begin:end]
+		if compress {
+			part, seg.Compressed = compressData(part, ck.Incompressible)
+			if !seg.Compressed {
+				bd.SkipSize += int64(seg.Size)
+			}
+		}
+		if dataKey != nil {
+			encrypted, err := utils.EncryptWithKey(part, dataKey, segmentAAD(bd.ID, &seg))
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("encrypt block %s segment %d failed: %v", bd.ID, seg.Offset, err)
+				return nil, fmt.Errorf("encrypt block %s segment %d failed: %w", bd.ID, seg.Offset, err)
+			}
+			part = encrypted
+		}
+		seg.Len = int32(len(part))
+		seg.Crc = crc32.ChecksumIEEE(part)
+		parts = append(parts, part)
+		pos += int64(len(part))
+		bd.Compressed = bd.Compressed || seg.Compressed
+		segments = append(segments, seg)
+		begin = end
+	}
+
+	bd.Segments = segments
+	bd.Encrypted = dataKey != nil
+	return parts, nil
+}
+
+// decodeSegments 校验、解密并解压连续的若干分段，payload 从第一个分段的存储位置 base 开始
+func (s *BlockService) decodeSegments(h *meta.BlockHeader, payload []byte, base int64, segs []meta.BlockSegment) ([]byte, error) {
+	var dataKey []byte
+	if h.Encrypted {
+		key, err := s.openDataKey(h)
+		if err != nil {
+			return nil, fmt.Errorf("open block %s data key failed: %w", h.ID, err)
+		}
+		dataKey = key
+	}
+
+	size := 0
+	for _, seg := range segs {
+		size += int(seg.Size)
+	}
+	out := make([]byte, 0, size)
+	for i := range segs {
+		seg := &segs[i]
+		lo, hi := seg.Pos-base, seg.Pos-base+int64(seg.Len)
+		if lo < 0 || hi > int64(len(payload)) {
+			return nil, fmt.Errorf("block %s segment %d out of range %d:%d", h.ID, seg.Offset, hi, len(payload))
+		}
+		part := payload[lo:hi]
+		if crc32.ChecksumIEEE(part) != seg.Crc {
+			return nil, fmt.Errorf("block %s segment %d crc not match", h.ID, seg.Offset)
+		}
+		if dataKey != nil {
+			plain, err := utils.DecryptWithKey(part, dataKey, segmentAAD(h.ID, seg))
+			if err != nil {
+				return nil, fmt.Errorf("decrypt block %s segment %d failed: %w", h.ID, seg.Offset, err)
+			}
+			part = plain
+		}
+		if seg.Compressed {
+			plain, err := utils.Decompress(part)
+			if err != nil {
+				return nil, fmt.Errorf("decompress block %s segment %d failed: %w", h.ID, seg.Offset, err)
+			}
+			part = plain
+		}
+		if len(part) != int(seg.Size) {
+			return nil, fmt.Errorf("block %s segment %d size not match %d:%d", h.ID, seg.Offset, seg.Size, len(part))
+		}
+		out = append(out, part...)
+	}
+	return out, nil
+}
+
+// blockPrefix 编码块文件中 Data 之前的部分，块文件由它和 dataLen 字节的 Data 拼接而成
+// 写块时只需要编码块头，Data 直接接在后面流式写入，分段格式的块同时记录 Data 在文件中的偏移
+func blockPrefix(bd *meta.BlockData, dataLen int64) ([]byte, error) {
+	var binHead bytes.Buffer
+	if err := msgpack.NewEncoder(&binHead).EncodeBytesLen(int(dataLen)); err != nil {
+		return nil, err
+	}
+	// Data 是最后一个字段，空 Data 编码成长度为 0 的 bin8，换成实际长度的 bin 头
+	head := meta.BlockData{BlockHeader: bd.BlockHeader, Data: []byte{}}
+	head.DataOffset = 0
+	// DataOffset 本身也在头里，编码长度变化时重新计算
+	for i := 0; i < 4; i++ {
+		data, err := msgpack.Marshal(&head)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(data, []byte{msgpcode.Bin8, 0}) {
+			return nil, fmt.Errorf("block %s data is not encoded at the end", bd.ID)
+		}
+		prefix := append(data[:len(data)-2], binHead.Bytes()...)
+		if len(bd.Segments) == 0 || int64(len(prefix)) == head.DataOffset {
+			bd.DataOffset = head.DataOffset
+			return prefix, nil
+		}
+		head.DataOffset = int64(len(prefix))
+	}
+	return nil, fmt.Errorf("block %s data offset not stable", bd.ID)
+}
+
+// segmentPlan 找出块中包含指定 chunk 的分段，chunk 不会跨分段
+// 返回每个分段是否需要读、每个 chunk 所在的分段和需要读的存储数据大小，块不能按分段读取时 ok 为 false
+func segmentPlan(blk *meta.Block, hashes map[string]bool) (need []bool, chunkSeg []int, needLen int64, ok bool) {
+	segs := blk.Segments
+	if blk.Ver != meta.BLOCK_FINALY_VER || len(segs) == 0 || blk.DataOffset <= 0 {
+		return nil, nil, 0, false
+	}
+	need = make([]bool, len(segs))
+	chunkSeg = make([]int, len(blk.ChunkList))
+	offset, j := int64(0), 0
+	for i, ck := range blk.ChunkList {
+		for j < len(segs) && offset >= segs[j].Offset+int64(segs[j].Size) {
+			j++
+		}
+		if j == len(segs) {
+			return nil, nil, 0, false
+		}
+		chunkSeg[i] = j
+		if hashes[ck.Hash] {
+			need[j] = true
+		}
+		offset += int64(ck.Size)
+	}
+	totalLen := segs[len(segs)-1].Pos + int64(segs[len(segs)-1].Len)
+	for i, n := range need {
+		if n {
+			needLen += int64(segs[i].Len)
+		}
+	}
+	// 需要读的数据超过一半时直接读整个块
+	if needLen == 0 || needLen*2 > totalLen {
+		return nil, nil, 0, false
+	}
+	return need, chunkSeg, needLen, true
+}
+
+// ChunksReadSize 用 ReadBlockChunks 读出指定 chunk 时返回的明文数据大小，用来预留读缓冲
+func ChunksReadSize(blk *meta.Block, hashes map[string]bool) int64 {
+	need, _, _, ok := segmentPlan(blk, hashes)
+	if !ok {
+		return blk.TotalSize
+	}
+	size := int64(0)
+	for i, n := range need {
+		if n {
+			size += int64(blk.Segments[i].Size)
+		}
+	}
+	return size
+}
+
+// ReadBlockChunks 读出块中包含指定 chunk 的分段，返回的 BlockData 只有这些分段的切片列表和数据
+// 旧格式的块、不是终结块、需要读的数据超过一半或者分段读取失败时读整个块
+func (s *BlockService) ReadBlockChunks(storageID string, blk *meta.Block, hashes map[string]bool) (*meta.BlockData, error) {
+	if blk == nil {
+		return nil, fmt.Errorf("block meta is nil")
+	}
+	if bc.Get(storageID, blk.ID) != nil {
+		return s.ReadBlock(storageID, blk.ID)
+	}
+	need, chunkSeg, needLen, ok := segmentPlan(blk, hashes)
+	if !ok {
+		return s.ReadBlock(storageID, blk.ID)
+	}
+	segs := blk.Segments
+	totalLen := segs[len(segs)-1].Pos + int64(segs[len(segs)-1].Len)
+
+	ss := storage.GetStorageService()
+	if ss == nil {
+		logger.GetLogger("dedups3").Errorf("get nil storage service")
+		return nil, fmt.Errorf("get nil storage service")
+	}
+	st, err := ss.GetStorage(storageID)
+	if err != nil || st == nil || st.Instance == nil {
+		logger.GetLogger("dedups3").Errorf("get nil storage instance")
+		return nil, fmt.Errorf("get nil storage instance: %w", err)
+	}
+
+	// 相邻的分段合并成一次读取
+	data := make([]byte, 0, needLen*2)
+	for i := 0; i < len(segs); {
+		if !need[i] {
+			i++
+			continue
+		}
+		k := i
+		for k < len(segs) && need[k] {
+			k++
+		}
+		run := segs[i:k]
+		length := run[len(run)-1].Pos + int64(run[len(run)-1].Len) - run[0].Pos
+		raw, err := readBlockAt(st, blk.Location, blk.ID, blk.DataOffset+run[0].Pos, length)
+		if err == nil && int64(len(raw)) != length {
+			err = fmt.Errorf("read %d bytes, want %d", len(raw), length)
+		}
+		if err == nil {
+			raw, err = s.decodeSegments(&blk.BlockHeader, raw, run[0].Pos, run)
+		}
+		if err != nil {
+			logger.GetLogger("dedups3").Warnf("read block %s segments failed, read whole block: %v", blk.ID, err)
+			return s.ReadBlock(storageID, blk.ID)
+		}
+		data = append(data, raw...)
+		i = k
+	}
+
+	bd := &meta.BlockData{BlockHeader: blk.BlockHeader, Data: data}
+	bd.ChunkList = make([]meta.BlockChunk, 0)
+	for i, ck := range blk.ChunkList {
+		if need[chunkSeg[i]] {
+			bd.ChunkList = append(bd.ChunkList, meta.BlockChunk{Hash: ck.Hash, Size: ck.Size, Incompressible: ck.Incompressible})
+		}
+	}
+	bd.TotalSize = int64(len(data))
+	logger.GetLogger("dedups3").Debugf("read block %s %d chunks from segments, %d of %d bytes", blk.ID, len(bd.ChunkList), needLen, totalLen)
+	return bd, nil
+}
@@ -101,6 +101,7 @@ func GetBucketService() *BucketService {
 	instance = &BucketService{
 		kvstore: store,
 	}
+	instance.rebuildBucketIndex()
 	return instance
 }
 
@@ -134,12 +135,23 @@ func (b *BucketService) CreateBucket(params *BaseBucketParams) error {
 		}
 	}()
 
-	// 先判断bucket 是否已经存在
+	// 先判断bucket 是否已经存在，桶名在所有账户间全局唯一
 	key := "aws:bucket:" + ac.AccountID + ":" + params.BucketName
 	var bucket meta.BucketMetadata
 	exist, err := txn.Get(key, &bucket)
 	if exist && err == nil {
-		if bucket.Owner.ID == ac.AccountID {
+		logger.GetLogger("dedups3").Warnf("bucket %s already owned by you", params.BucketName)
+		return xhttp.ToError(xhttp.ErrBucketAlreadyOwnedByYou)
+	}
+	indexKey := meta.GenBucketIndexKey(params.BucketName)
+	var ownerID string
+	exist, err = txn.Get(indexKey, &ownerID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket index %s: %v", params.BucketName, err)
+		return fmt.Errorf("failed to get bucket index: %w", err)
+	}
+	if exist {
+		if ownerID == ac.AccountID {
 			logger.GetLogger("dedups3").Warnf("bucket %s already owned by you", params.BucketName)
 			return xhttp.ToError(xhttp.ErrBucketAlreadyOwnedByYou)
 		}
@@ -153,12 +165,29 @@ func (b *BucketService) CreateBucket(params *BaseBucketParams) error {
 		Owner:        meta.Owner{ID: ac.AccountID, DisplayName: ac.Name},
 		Location:     params.Location,
 	}
+	bm.UpdatedAt = bm.CreationDate
+	// 创建时开启对象锁定，同时开启版本控制
+	if params.ObjectLockEnabled {
+		bm.EnableVersioning()
+		bm.Versioning.CreatedAt = bm.CreationDate
+		bm.Versioning.UpdatedAt = bm.CreationDate
+		bm.ObjectLock = &meta.ObjectLockConfiguration{
+			XMLNS:             "http://s3.amazonaws.com/doc/2006-03-01/",
+			ObjectLockEnabled: "Enabled",
+			CreatedAt:         bm.CreationDate,
+			UpdatedAt:         bm.CreationDate,
+		}
+	}
 
 	err = txn.Set(key, &bm)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to put bucket: %v", err)
 		return fmt.Errorf("failed to put bucket: %w", err)
 	}
+	if err := txn.Set(indexKey, ac.AccountID); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to put bucket index: %v", err)
+		return fmt.Errorf("failed to put bucket index: %w", err)
+	}
 
 	if err := txn.Commit(); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
@@ -166,9 +195,10 @@ func (b *BucketService) CreateBucket(params *BaseBucketParams) error {
 	}
 	txn = nil
 
-	// 删除cache
+	// 删除cache，包括按桶名缓存的查找结果
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		cache.Del(context.Background(), key)
+		cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	_stats := stats.GetStatsService()
@@ -179,26 +209,25 @@ func (b *BucketService) CreateBucket(params *BaseBucketParams) error {
 	return nil
 }
 
-func (b *BucketService) GetBucketInfo(params *BaseBucketParams) (*meta.BucketMetadata, error) {
+func (b *BucketService) GetBucketInfo(ctx context.Context, params *BaseBucketParams) (*meta.BucketMetadata, error) {
 	iamService := iam.GetIamService()
 	if iamService == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get iam service")
 		return nil, errors.New("failed to get iam service")
 	}
 
-	ak, err := iamService.GetAccessKey(params.AccessKeyID)
-	if err != nil || ak == nil {
-		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
-		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	accountID, err := iamService.GetRequestAccountID(ctx, params.AccessKeyID)
+	if err != nil {
+		return nil, err
 	}
 
-	ac, err := iamService.GetAccount(ak.AccountID)
+	ac, err := iamService.GetAccount(accountID)
 	if err != nil || ac == nil {
-		logger.GetLogger("dedups3").Errorf("failed to get account %s", ak.AccountID)
+		logger.GetLogger("dedups3").Errorf("failed to get account %s", accountID)
 		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
 	}
 
-	key := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+	key := "aws:bucket:" + accountID + ":" + params.BucketName
 
 	// 先从cache 中查找
 	if cache, err := xcache.GetCache(); err == nil && cache != nil {
@@ -344,7 +373,15 @@ func (b *BucketService) DeleteBucket(params *BaseBucketParams) error {
 		return fmt.Errorf("failed to scan multipart uploads: %w", err)
 	}
 
-	if len(objects) > 0 || len(multiparts) > 0 {
+	// 检查是否有历史版本或删除标记
+	versionPrefix := meta.GenVersionPrefix(ac.AccountID, params.BucketName)
+	versions, _, err := txn.Scan(versionPrefix, "", 1)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to scan object versions in bucket %s: %v", params.BucketName, err)
+		return fmt.Errorf("failed to scan object versions: %w", err)
+	}
+
+	if len(objects) > 0 || len(multiparts) > 0 || len(versions) > 0 {
 		logger.GetLogger("dedups3").Tracef("bucket %s not empty", params.BucketName)
 		return xhttp.ToError(xhttp.ErrBucketNotEmpty)
 	}
@@ -355,6 +392,21 @@ func (b *BucketService) DeleteBucket(params *BaseBucketParams) error {
 		return fmt.Errorf("failed to delete bucket metadata: %w", err)
 	}
 
+	// 删除桶名索引，释放桶名
+	indexKey := meta.GenBucketIndexKey(params.BucketName)
+	var ownerID string
+	exist, err = txn.Get(indexKey, &ownerID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket index %s: %v", params.BucketName, err)
+		return fmt.Errorf("failed to get bucket index: %w", err)
+	}
+	if exist && ownerID == ac.AccountID {
+		if err := txn.Delete(indexKey); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to delete bucket index %s: %v", params.BucketName, err)
+			return fmt.Errorf("failed to delete bucket index: %w", err)
+		}
+	}
+
 	// 提交事务
 	if err := txn.Commit(); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
@@ -365,6 +417,7 @@ func (b *BucketService) DeleteBucket(params *BaseBucketParams) error {
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		cache.Del(context.Background(), bucketKey)
+		cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	_stats := stats.GetStatsService()
@@ -438,6 +491,7 @@ func (b *BucketService) PutBucketTagging(params *BaseBucketParams) error {
 		bucket.Tags[tag.Key] = tag.Value
 	}
 
+	bucket.UpdatedAt = time.Now().UTC()
 	err = txn.Set(bucketKey, &bucket)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to set bucket tags: %v", err)
@@ -454,6 +508,7 @@ func (b *BucketService) PutBucketTagging(params *BaseBucketParams) error {
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	return nil
@@ -532,6 +587,7 @@ func (b *BucketService) PutBucketLifecycle(params *BaseBucketParams, lifecycle *
 		bucket.Lifecycle = nil
 	}
 
+	bucket.UpdatedAt = time.Now().UTC()
 	err = txn.Set(bucketKey, &bucket)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to set bucket lifecycle configuration: %v", err)
@@ -548,12 +604,626 @@ func (b *BucketService) PutBucketLifecycle(params *BaseBucketParams, lifecycle *
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	logger.GetLogger("dedups3").Tracef("successfully set lifecycle configuration for bucket: %s", params.BucketName)
 	return nil
 }
 
+// PutBucketCors 设置存储桶的跨域配置，cors 为 nil 时删除跨域配置
+func (b *BucketService) PutBucketCors(params *BaseBucketParams, cors *meta.CORSConfiguration) error {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	ac, err := iamService.GetAccount(ak.AccountID)
+	if err != nil || ac == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account %s", ak.AccountID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var bucket meta.BucketMetadata
+	exist, err := txn.Get(bucketKey, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	if bucket.Owner.ID != ac.AccountID {
+		logger.GetLogger("dedups3").Errorf("access denied: user %s :%s is not the owner of bucket %s", ac.AccountID, bucket.Owner.ID, params.BucketName)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	if params.ExpectedOwnerID != "" && bucket.Owner.ID != params.ExpectedOwnerID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", params.ExpectedOwnerID, bucket.Owner.ID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	currentTime := time.Now().UTC()
+	if cors != nil {
+		if cors.XMLNS == "" {
+			cors.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+		}
+		cors.CreatedAt = currentTime
+		if bucket.CORS != nil && !bucket.CORS.CreatedAt.IsZero() {
+			cors.CreatedAt = bucket.CORS.CreatedAt
+		}
+		cors.UpdatedAt = currentTime
+	}
+	bucket.CORS = cors
+
+	bucket.UpdatedAt = currentTime
+	if err := txn.Set(bucketKey, &bucket); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket cors configuration: %v", err)
+		return fmt.Errorf("failed to set bucket cors configuration: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
+	}
+
+	logger.GetLogger("dedups3").Tracef("successfully set cors configuration for bucket: %s", params.BucketName)
+	return nil
+}
+
+// PutBucketWebsite 设置存储桶的静态网站配置，website 为 nil 时删除静态网站配置
+func (b *BucketService) PutBucketWebsite(params *BaseBucketParams, website *meta.WebsiteConfiguration) error {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	ac, err := iamService.GetAccount(ak.AccountID)
+	if err != nil || ac == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account %s", ak.AccountID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var bucket meta.BucketMetadata
+	exist, err := txn.Get(bucketKey, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	if bucket.Owner.ID != ac.AccountID {
+		logger.GetLogger("dedups3").Errorf("access denied: user %s :%s is not the owner of bucket %s", ac.AccountID, bucket.Owner.ID, params.BucketName)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	if params.ExpectedOwnerID != "" && bucket.Owner.ID != params.ExpectedOwnerID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", params.ExpectedOwnerID, bucket.Owner.ID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	currentTime := time.Now().UTC()
+	if website != nil {
+		if website.XMLNS == "" {
+			website.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+		}
+		website.CreatedAt = currentTime
+		if bucket.Website != nil && !bucket.Website.CreatedAt.IsZero() {
+			website.CreatedAt = bucket.Website.CreatedAt
+		}
+		website.UpdatedAt = currentTime
+	}
+	bucket.Website = website
+
+	bucket.UpdatedAt = currentTime
+	if err := txn.Set(bucketKey, &bucket); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket website configuration: %v", err)
+		return fmt.Errorf("failed to set bucket website configuration: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
+	}
+
+	logger.GetLogger("dedups3").Tracef("successfully set website configuration for bucket: %s", params.BucketName)
+	return nil
+}
+
+// PutBucketEncryption 设置存储桶的默认加密配置，sse 为 nil 时删除默认加密配置
+func (b *BucketService) PutBucketEncryption(params *BaseBucketParams, sse *meta.BucketSSEConfiguration) error {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	ac, err := iamService.GetAccount(ak.AccountID)
+	if err != nil || ac == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account %s", ak.AccountID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var bucket meta.BucketMetadata
+	exist, err := txn.Get(bucketKey, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	if bucket.Owner.ID != ac.AccountID {
+		logger.GetLogger("dedups3").Errorf("access denied: user %s :%s is not the owner of bucket %s", ac.AccountID, bucket.Owner.ID, params.BucketName)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	if params.ExpectedOwnerID != "" && bucket.Owner.ID != params.ExpectedOwnerID {
+		logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", params.ExpectedOwnerID, bucket.Owner.ID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	currentTime := time.Now().UTC()
+	if sse != nil {
+		if sse.XMLNS == "" {
+			sse.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+		}
+		sse.CreatedAt = currentTime
+		if bucket.SSE != nil && !bucket.SSE.CreatedAt.IsZero() {
+			sse.CreatedAt = bucket.SSE.CreatedAt
+		}
+		sse.UpdatedAt = currentTime
+	}
+	bucket.SSE = sse
+
+	bucket.UpdatedAt = currentTime
+	if err := txn.Set(bucketKey, &bucket); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket encryption configuration: %v", err)
+		return fmt.Errorf("failed to set bucket encryption configuration: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
+	}
+
+	// 默认加密的对象数据按对象密钥加密，之后写入的对象不再参与去重
+	if sse != nil {
+		logger.GetLogger("dedups3").Warnf("bucket %s default encryption enabled, new objects will not be deduplicated", params.BucketName)
+	}
+	logger.GetLogger("dedups3").Tracef("successfully set encryption configuration for bucket: %s", params.BucketName)
+	return nil
+}
+
+// bucketNameKey 按桶名缓存桶所有者的 key
+func bucketNameKey(bucketName string) string {
+	return "aws:bucket-name:" + bucketName
+}
+
+// LookupBucket 按桶名查找桶，用于没有签名的请求（如 CORS 预检），此时无法确定账户
+// 通过桶名全局索引定位所属账户，不存在的桶名也会短时间缓存，避免反复读取存储
+func (b *BucketService) LookupBucket(bucketName string) (*meta.BucketMetadata, error) {
+	if bucketName == "" {
+		return nil, xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+	cache, _ := xcache.GetCache()
+	cacheKey := bucketNameKey(bucketName)
+
+	var ownerID string
+	cached := false
+	if cache != nil {
+		_ownerID, ok, e := xcache.Get[string](cache, context.Background(), cacheKey)
+		if e == nil && ok && _ownerID != nil {
+			ownerID = *_ownerID
+			cached = true
+		}
+	}
+	if !cached {
+		exist, err := b.kvstore.Get(meta.GenBucketIndexKey(bucketName), &ownerID)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to get bucket index %s: %v", bucketName, err)
+			return nil, fmt.Errorf("failed to get bucket index: %w", err)
+		}
+		if !exist {
+			ownerID = ""
+		}
+		// 创建和删除桶时会删除缓存，空值表示桶不存在
+		if cache != nil {
+			_ = cache.Set(context.Background(), cacheKey, ownerID, time.Second*60)
+		}
+	}
+	if ownerID == "" {
+		return nil, xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	key := meta.GenBucketKey(ownerID, bucketName)
+	if cache != nil {
+		_bucket, ok, e := xcache.Get[meta.BucketMetadata](cache, context.Background(), key)
+		if e == nil && ok && _bucket != nil {
+			return _bucket, nil
+		}
+	}
+	var bucket meta.BucketMetadata
+	exist, err := b.kvstore.Get(key, &bucket)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket %s: %v", key, err)
+		return nil, fmt.Errorf("failed to get bucket: %w", err)
+	}
+	if !exist {
+		return nil, xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+	if cache != nil {
+		_ = cache.Set(context.Background(), key, &bucket, time.Second*600)
+	}
+	return &bucket, nil
+}
+
+// rebuildBucketIndex 为索引引入之前创建的桶补建桶名索引
+// 桶名在不同账户下重复时，最早创建的桶占用该桶名
+func (b *BucketService) rebuildBucketIndex() {
+	nextKey := ""
+	for {
+		txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+			return
+		}
+		keys, next, err := txn.Scan("aws:bucket:", nextKey, MAX_BUCKET_NUM)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to scan buckets: %v", err)
+			_ = txn.Rollback()
+			return
+		}
+		updated := 0
+		for _, key := range keys {
+			var bucket meta.BucketMetadata
+			if exist, err := txn.Get(key, &bucket); err != nil || !exist {
+				continue
+			}
+			if err := b.setBucketIndex(txn, &bucket); err != nil {
+				_ = txn.Rollback()
+				return
+			}
+			updated++
+		}
+		if err := txn.Commit(); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to commit bucket index: %v", err)
+			return
+		}
+		logger.GetLogger("dedups3").Debugf("checked bucket index for %d buckets", updated)
+		if next == "" || len(keys) == 0 {
+			return
+		}
+		nextKey = next
+	}
+}
+
+// setBucketIndex 桶名还没有被占用时，记录桶名到所有者账户的索引
+// 桶名已被其他账户更早创建的桶占用时保持不变
+func (b *BucketService) setBucketIndex(txn kv.Txn, bucket *meta.BucketMetadata) error {
+	indexKey := meta.GenBucketIndexKey(bucket.Name)
+	var ownerID string
+	exist, err := txn.Get(indexKey, &ownerID)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket index %s: %v", bucket.Name, err)
+		return fmt.Errorf("failed to get bucket index: %w", err)
+	}
+	if exist && ownerID != "" {
+		if ownerID == bucket.Owner.ID {
+			return nil
+		}
+		var owned meta.BucketMetadata
+		if ok, err := txn.Get(meta.GenBucketKey(ownerID, bucket.Name), &owned); err == nil && ok && !bucket.CreationDate.Before(owned.CreationDate) {
+			return nil
+		}
+	}
+	if err := txn.Set(indexKey, bucket.Owner.ID); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket index %s: %v", bucket.Name, err)
+		return fmt.Errorf("failed to set bucket index: %w", err)
+	}
+	logger.GetLogger("dedups3").Infof("set bucket index %s to account %s", bucket.Name, bucket.Owner.ID)
+	return nil
+}
+
+// PutBucketReplication 设置存储桶的复制配置，replication 为 nil 时删除复制配置
+func (b *BucketService) PutBucketReplication(params *BaseBucketParams, replication *meta.ReplicationConfiguration) error {
+	// 获取IAM服务
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+
+	// 验证访问密钥
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	ac, err := iamService.GetAccount(ak.AccountID)
+	if err != nil || ac == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account %s", ak.AccountID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	// 构建存储桶key
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+
+	// 开始事务
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	// 检查存储桶是否存在
+	var bucket meta.BucketMetadata
+	exist, err := txn.Get(bucketKey, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	// 检查用户是否是存储桶所有者
+	if bucket.Owner.ID != ac.AccountID {
+		logger.GetLogger("dedups3").Errorf("access denied: user %s :%s is not the owner of bucket %s", ac.AccountID, bucket.Owner.ID, params.BucketName)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	if params.ExpectedOwnerID != "" {
+		// 检查存储桶的实际所有者是否与请求的所有者匹配
+		if bucket.Owner.ID != params.ExpectedOwnerID {
+			logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", params.ExpectedOwnerID, bucket.Owner.ID)
+			return xhttp.ToError(xhttp.ErrAccessDenied)
+		}
+	}
+
+	currentTime := time.Now().UTC()
+	if replication != nil {
+		// 复制要求源桶开启版本控制
+		if !bucket.Versioning.IsEnabled() {
+			logger.GetLogger("dedups3").Errorf("bucket %s versioning not enabled, can not set replication", params.BucketName)
+			return xhttp.ToError(xhttp.ErrReplicationNeedsVersioningError)
+		}
+		// 每条规则的目标桶都要先通过管理接口配置好目标端点
+		for _, rule := range replication.Rules {
+			if _, ok := bucket.Targets.GetTargetByArn(rule.Destination.Bucket); !ok {
+				logger.GetLogger("dedups3").Errorf("bucket %s replication rule %s target %s not found", params.BucketName, rule.ID, rule.Destination.Bucket)
+				return xhttp.ToError(xhttp.ErrRemoteTargetNotFoundError)
+			}
+		}
+		// 设置XML命名空间
+		if replication.XMLNS == "" {
+			replication.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+		}
+		replication.CreatedAt = currentTime
+		if bucket.Replication != nil && !bucket.Replication.CreatedAt.IsZero() {
+			replication.CreatedAt = bucket.Replication.CreatedAt
+		}
+		replication.UpdatedAt = currentTime
+	}
+	bucket.Replication = replication
+
+	err = txn.Set(bucketKey, &bucket)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket replication configuration: %v", err)
+		return fmt.Errorf("failed to set bucket replication configuration: %w", err)
+	}
+
+	// 提交事务
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	// 清除缓存
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
+	}
+
+	logger.GetLogger("dedups3").Tracef("successfully set replication configuration for bucket: %s", params.BucketName)
+	return nil
+}
+
+// PutBucketTarget 添加或替换存储桶的复制目标，target.ID 相同的目标会被替换
+func (b *BucketService) PutBucketTarget(params *BaseBucketParams, target *meta.BucketTarget) error {
+	return b.updateBucketTargets(params, func(bucket *meta.BucketMetadata) error {
+		if bucket.Targets == nil {
+			bucket.Targets = &meta.BucketTargets{CreatedAt: time.Now().UTC()}
+		}
+		if old, ok := bucket.Targets.GetTarget(target.ID); ok {
+			// 正在被复制规则使用的目标不允许修改 ARN
+			if old.Arn != target.Arn && isTargetInUse(bucket, old.Arn) {
+				logger.GetLogger("dedups3").Errorf("bucket %s target %s is used by replication rule", bucket.Name, target.ID)
+				return xhttp.ToError(xhttp.ErrInvalidBucketState)
+			}
+			_ = bucket.Targets.RemoveTarget(target.ID)
+		}
+		if other, ok := bucket.Targets.GetTargetByArn(target.Arn); ok {
+			logger.GetLogger("dedups3").Errorf("bucket %s target arn %s already used by target %s", bucket.Name, target.Arn, other.ID)
+			return xhttp.ToError(xhttp.ErrInvalidRequest)
+		}
+		if err := bucket.Targets.AddTarget(*target); err != nil {
+			logger.GetLogger("dedups3").Errorf("bucket %s add target %s failed: %v", bucket.Name, target.ID, err)
+			return xhttp.ToError(xhttp.ErrInvalidRequest)
+		}
+		return nil
+	})
+}
+
+// DeleteBucketTarget 删除存储桶的复制目标
+func (b *BucketService) DeleteBucketTarget(params *BaseBucketParams, targetID string) error {
+	return b.updateBucketTargets(params, func(bucket *meta.BucketMetadata) error {
+		target, ok := bucket.Targets.GetTarget(targetID)
+		if !ok {
+			logger.GetLogger("dedups3").Errorf("bucket %s target %s not found", bucket.Name, targetID)
+			return xhttp.ToError(xhttp.ErrRemoteTargetNotFoundError)
+		}
+		// 正在被复制规则使用的目标不允许删除
+		if isTargetInUse(bucket, target.Arn) {
+			logger.GetLogger("dedups3").Errorf("bucket %s target %s is used by replication rule", bucket.Name, targetID)
+			return xhttp.ToError(xhttp.ErrInvalidBucketState)
+		}
+		return bucket.Targets.RemoveTarget(targetID)
+	})
+}
+
+// isTargetInUse 判断目标是否被复制规则引用
+func isTargetInUse(bucket *meta.BucketMetadata, arn string) bool {
+	if bucket.Replication == nil {
+		return false
+	}
+	for _, rule := range bucket.Replication.Rules {
+		if rule.Destination.Bucket == arn {
+			return true
+		}
+	}
+	return false
+}
+
+// updateBucketTargets 在事务中修改存储桶的复制目标
+func (b *BucketService) updateBucketTargets(params *BaseBucketParams, update func(bucket *meta.BucketMetadata) error) error {
+	// 获取IAM服务
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+
+	// 验证访问密钥
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	// 构建存储桶key
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+
+	// 开始事务
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	// 检查存储桶是否存在
+	var bucket meta.BucketMetadata
+	exist, err := txn.Get(bucketKey, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	// 检查用户是否是存储桶所有者
+	if bucket.Owner.ID != ak.AccountID {
+		logger.GetLogger("dedups3").Errorf("access denied: user %s :%s is not the owner of bucket %s", ak.AccountID, bucket.Owner.ID, params.BucketName)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	if err := update(&bucket); err != nil {
+		return err
+	}
+
+	err = txn.Set(bucketKey, &bucket)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket targets: %v", err)
+		return fmt.Errorf("failed to set bucket targets: %w", err)
+	}
+
+	// 提交事务
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	// 清除缓存
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
+	}
+
+	logger.GetLogger("dedups3").Tracef("successfully set targets for bucket: %s", params.BucketName)
+	return nil
+}
+
 // PutBucketNotification 设置存储桶的事件通知配置
 func (b *BucketService) PutBucketNotification(params *BaseBucketParams, notification *meta.EventNotificationConfiguration) error {
 	// 获取IAM服务
@@ -627,6 +1297,7 @@ func (b *BucketService) PutBucketNotification(params *BaseBucketParams, notifica
 		bucket.Notification = nil
 	}
 
+	bucket.UpdatedAt = time.Now().UTC()
 	err = txn.Set(bucketKey, &bucket)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to set bucket notification configuration: %v", err)
@@ -643,6 +1314,7 @@ func (b *BucketService) PutBucketNotification(params *BaseBucketParams, notifica
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	logger.GetLogger("dedups3").Tracef("successfully set notification configuration for bucket: %s", params.BucketName)
@@ -708,6 +1380,16 @@ func (b *BucketService) PutBucketObjectLockConfig(params *BaseBucketParams, conf
 		}
 	}
 
+	// 对象锁定依赖版本控制，开启后不能关闭
+	if config != nil && config.IsEnabled() && !bucket.Versioning.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s versioning must be enabled to apply object lock", params.BucketName)
+		return xhttp.ToError(xhttp.ErrInvalidBucketState)
+	}
+	if bucket.ObjectLock.IsEnabled() && !config.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s object lock can not be disabled", params.BucketName)
+		return xhttp.ToError(xhttp.ErrInvalidBucketState)
+	}
+
 	// 设置对象锁定配置
 	currentTime := time.Now().UTC()
 	if config != nil {
@@ -721,6 +1403,7 @@ func (b *BucketService) PutBucketObjectLockConfig(params *BaseBucketParams, conf
 	}
 	bucket.ObjectLock = config
 
+	bucket.UpdatedAt = time.Now().UTC()
 	err = txn.Set(bucketKey, &bucket)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to set bucket object lock configuration: %v", err)
@@ -737,12 +1420,121 @@ func (b *BucketService) PutBucketObjectLockConfig(params *BaseBucketParams, conf
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	logger.GetLogger("dedups3").Tracef("successfully set object lock configuration for bucket: %s", params.BucketName)
 	return nil
 }
 
+// PutBucketVersioning 设置存储桶的版本控制状态
+func (b *BucketService) PutBucketVersioning(params *BaseBucketParams, config *meta.VersioningConfiguration) error {
+	// 获取IAM服务
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+
+	// 验证访问密钥
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	ac, err := iamService.GetAccount(ak.AccountID)
+	if err != nil || ac == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account %s", ak.AccountID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	// 构建存储桶key
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+
+	// 开始事务
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	// 检查存储桶是否存在
+	var bucket meta.BucketMetadata
+	exist, err := txn.Get(bucketKey, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+
+	// 检查用户是否是存储桶所有者
+	if bucket.Owner.ID != ac.AccountID {
+		logger.GetLogger("dedups3").Errorf("access denied: user %s :%s is not the owner of bucket %s", ac.AccountID, bucket.Owner.ID, params.BucketName)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	if params.ExpectedOwnerID != "" {
+		// 检查存储桶的实际所有者是否与请求的所有者匹配
+		if bucket.Owner.ID != params.ExpectedOwnerID {
+			logger.GetLogger("dedups3").Errorf("bucket owner mismatch: expected %s, got %s", params.ExpectedOwnerID, bucket.Owner.ID)
+			return xhttp.ToError(xhttp.ErrAccessDenied)
+		}
+	}
+
+	// 开启对象锁定的桶不允许暂停版本控制
+	if config.IsSuspended() && bucket.ObjectLock.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s object lock enabled, can not suspend versioning", params.BucketName)
+		return xhttp.ToError(xhttp.ErrInvalidBucketState)
+	}
+
+	// 配置了复制规则的桶不允许暂停版本控制
+	if config.IsSuspended() && bucket.Replication != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s replication configured, can not suspend versioning", params.BucketName)
+		return xhttp.ToError(xhttp.ErrInvalidBucketState)
+	}
+
+	// 设置版本控制配置
+	currentTime := time.Now().UTC()
+	// 设置XML命名空间
+	if config.XMLNS == "" {
+		config.XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+	}
+	config.CreatedAt = currentTime
+	if bucket.Versioning != nil && !bucket.Versioning.CreatedAt.IsZero() {
+		config.CreatedAt = bucket.Versioning.CreatedAt
+	}
+	config.UpdatedAt = currentTime
+	bucket.Versioning = config
+
+	bucket.UpdatedAt = time.Now().UTC()
+	err = txn.Set(bucketKey, &bucket)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set bucket versioning configuration: %v", err)
+		return fmt.Errorf("failed to set bucket versioning configuration: %w", err)
+	}
+
+	// 提交事务
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	// 清除缓存
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
+	}
+
+	logger.GetLogger("dedups3").Tracef("successfully set versioning configuration for bucket: %s", params.BucketName)
+	return nil
+}
+
 // PutBucketACL 设置存储桶的访问控制列表
 func (b *BucketService) PutBucketACL(params *BaseBucketParams, acl *meta.AccessControlPolicy) error {
 	// 获取IAM服务
@@ -818,6 +1610,7 @@ func (b *BucketService) PutBucketACL(params *BaseBucketParams, acl *meta.AccessC
 		bucket.ACL = nil
 	}
 
+	bucket.UpdatedAt = time.Now().UTC()
 	err = txn.Set(bucketKey, &bucket)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to set bucket ACL: %v", err)
@@ -834,6 +1627,7 @@ func (b *BucketService) PutBucketACL(params *BaseBucketParams, acl *meta.AccessC
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	logger.GetLogger("dedups3").Tracef("successfully set ACL for bucket: %s", params.BucketName)
@@ -903,6 +1697,7 @@ func (b *BucketService) PutBucketPolicy(params *BaseBucketParams, policy *meta.B
 		policy.UpdatedAt = currentTime
 	}
 	bucket.Policy = policy
+	bucket.UpdatedAt = time.Now().UTC()
 	err = txn.Set(bucketKey, &bucket)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to set bucket Policy: %v", err)
@@ -919,6 +1714,7 @@ func (b *BucketService) PutBucketPolicy(params *BaseBucketParams, policy *meta.B
 	// 清除缓存
 	if cache, e := xcache.GetCache(); e == nil && cache != nil {
 		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(params.BucketName))
 	}
 
 	logger.GetLogger("dedups3").Tracef("successfully set Policy for bucket: %s", params.BucketName)
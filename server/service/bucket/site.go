@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/iam"
+)
+
+// 以下接口供站点复制使用，不经过 IAM 校验
+
+// ScanBuckets 分批读取所有账户的桶，返回下一批的起始 key，没有更多时为空
+func (b *BucketService) ScanBuckets(startKey string, limit int) ([]*meta.BucketMetadata, string, error) {
+	txn, err := b.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	keys, next, err := txn.Scan("aws:bucket:", startKey, limit)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to scan buckets: %v", err)
+		return nil, "", fmt.Errorf("failed to scan buckets: %w", err)
+	}
+	values, err := txn.BatchGet(keys)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to batch get buckets: %v", err)
+		return nil, "", fmt.Errorf("failed to batch get buckets: %w", err)
+	}
+	buckets := make([]*meta.BucketMetadata, 0, len(keys))
+	for _, k := range keys {
+		var bucket meta.BucketMetadata
+		if data, ok := values[k]; !ok || json.Unmarshal(data, &bucket) != nil {
+			continue
+		}
+		buckets = append(buckets, &bucket)
+	}
+	if len(keys) == 0 {
+		next = ""
+	}
+	return buckets, next, nil
+}
+
+// ApplySiteBucket 写入对端同步过来的桶配置，按 UpdatedAt 后写者胜
+// 复制规则和复制目标只属于本站点，保持本地的配置不变
+// 返回配置是否被更新
+func (b *BucketService) ApplySiteBucket(remote *meta.BucketMetadata) (bool, error) {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return false, fmt.Errorf("failed to get iam service")
+	}
+	// 账户还没有同步过来时由对端稍后重试
+	if _, err := iamService.GetAccount(remote.Owner.ID); err != nil {
+		logger.GetLogger("dedups3").Errorf("account %s of site bucket %s not exist", remote.Owner.ID, remote.Name)
+		return false, xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucketKey := meta.GenBucketKey(remote.Owner.ID, remote.Name)
+	txn, err := b.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return false, fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var local meta.BucketMetadata
+	exists, err := txn.Get(bucketKey, &local)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket %s: %v", bucketKey, err)
+		return false, fmt.Errorf("failed to get bucket %s: %w", bucketKey, err)
+	}
+	if exists && !remote.UpdatedAt.After(local.UpdatedAt) {
+		logger.GetLogger("dedups3").Debugf("site bucket %s is not newer than local %s:%s", remote.Name, remote.UpdatedAt, local.UpdatedAt)
+		return false, nil
+	}
+
+	bucket := *remote
+	bucket.Replication = nil
+	bucket.Targets = nil
+	if exists {
+		bucket.Replication = local.Replication
+		bucket.Targets = local.Targets
+	}
+	if err := txn.Set(bucketKey, &bucket); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set site bucket %s: %v", bucketKey, err)
+		return false, fmt.Errorf("failed to set site bucket %s: %w", bucketKey, err)
+	}
+	if !exists {
+		if err := b.setBucketIndex(txn, &bucket); err != nil {
+			return false, err
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), bucketKey)
+		_ = cache.Del(context.Background(), bucketNameKey(remote.Name))
+	}
+	logger.GetLogger("dedups3").Infof("apply site bucket %s/%s updated at %s", remote.Owner.ID, remote.Name, remote.UpdatedAt)
+	return true, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/gc"
+)
+
+// AppendMeta 追加写完成后更新对象，保留旧对象的前 keep 个chunk，后面换成重新切分的 tail
+// 被替换的旧chunk减少引用，对象的大小和 ETag 在同一个事务里更新
+// 追加期间对象被修改或删除时返回 ErrObjectChanged，新写入的数据由调用方回收
+func (c *ChunkService) AppendMeta(ctx context.Context, storeKey string, keep int, tail []*meta.Chunk, blocks map[string]*meta.Block, oldObj, newObj *meta.Object) error {
+	txn, err := c.kvstore.BeginTxn(ctx, nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s create transaction failed: %v", newObj.Bucket, newObj.Key, err)
+		return fmt.Errorf("%s/%s create transaction failed: %w", newObj.Bucket, newObj.Key, err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var current meta.Object
+	exists, err := txn.Get(storeKey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s get object failed: %v", newObj.Bucket, newObj.Key, err)
+		return fmt.Errorf("%s/%s get object failed: %w", newObj.Bucket, newObj.Key, err)
+	}
+	if !exists || current.ETag != oldObj.ETag || current.Size != oldObj.Size || current.VersionID != oldObj.VersionID ||
+		current.DataLocation != oldObj.DataLocation || !current.LastModified.Equal(oldObj.LastModified) || keep > len(current.Chunks) {
+		logger.GetLogger("dedups3").Warnf("%s/%s version %s changed during append", newObj.Bucket, newObj.Key, newObj.GetVersionID())
+		return ErrObjectChanged
+	}
+
+	oldBlockKeys, err := c.writeDataMeta(txn, meta.ObjectToBaseObject(newObj), tail, blocks)
+	if err != nil {
+		return err
+	}
+	newObj.Chunks = make([]string, 0, keep+len(tail))
+	newObj.Chunks = append(newObj.Chunks, current.Chunks[:keep]...)
+	for _, _chunk := range tail {
+		newObj.Chunks = append(newObj.Chunks, _chunk.Hash)
+	}
+
+	// 只回收被重新切分的旧chunk
+	gcItems := make([]gc.GCItem, 0, len(current.Chunks)-keep)
+	for _, id := range current.Chunks[keep:] {
+		gcItems = append(gcItems, gc.GCItem{StorageID: current.DataLocation, ID: id})
+	}
+	if err := AddGCChunks(txn, gcItems); err != nil {
+		return err
+	}
+
+	if len(blocks) > 0 {
+		// 后置重删检查
+		gcKey := gc.GCDedupPrefix + utils.GenUUID()
+		gcData := gc.GCDedup{
+			GCData: gc.GCData{
+				CreateAt: time.Now().UTC(),
+				Items:    make([]gc.GCItem, 0, len(blocks)),
+			},
+		}
+		for _, _block := range blocks {
+			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: _block.StorageID, ID: _block.ID})
+		}
+		if err := txn.Set(gcKey, &gcData); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s set post dedup block failed: %v", newObj.Bucket, newObj.Key, err)
+		}
+	}
+
+	if err := txn.Set(storeKey, newObj); err != nil {
+		logger.GetLogger("dedups3").Errorf("set object %s/%s meta info failed: %v", newObj.Bucket, newObj.Key, err)
+		return fmt.Errorf("set object %s/%s meta info failed: %w", newObj.Bucket, newObj.Key, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s commit failed: %v", newObj.Bucket, newObj.Key, err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		chunkKeys := make([]string, 0, len(gcItems))
+		for _, item := range gcItems {
+			chunkKeys = append(chunkKeys, meta.GenChunkKey(item.StorageID, item.ID))
+		}
+		_ = cache.MDel(ctx, chunkKeys)
+		_ = cache.MDel(ctx, oldBlockKeys)
+		_ = cache.Del(ctx, storeKey)
+	}
+	logger.GetLogger("dedups3").Infof("append object %s/%s size %d -> %d, keep %d chunks and rewrite %d", newObj.Bucket, newObj.Key, oldObj.Size, newObj.Size, keep, len(tail))
+	return nil
+}
@@ -76,18 +76,15 @@ func GetChunkService() *ChunkService {
 }
 
 func (c *ChunkService) DoChunk(r io.Reader, obj *meta.BaseObject, cb WriteObjCB) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	// 创建输出通道
-	chunkChan := make(chan *meta.Chunk, 100)
-
 	// 根据 ChunkSize 设置 ChunkerOpts
 	chunkSize := 16 * 1024
 	FixSize, Encrypt, Compress := false, true, true
+	var chunkConf *meta.ChunkConfig
 	ss := storage.GetStorageService()
 	if ss != nil {
 		if _storage, err := ss.GetStorage(obj.DataLocation); err == nil {
 			if _storage.Chunk != nil {
+				chunkConf = _storage.Chunk
 				chunkSize = max(int(_storage.Chunk.ChunkSize*1024), 16*1024)
 				FixSize = _storage.Chunk.FixSize
 				Encrypt = _storage.Chunk.Encrypt
@@ -107,13 +104,44 @@ func (c *ChunkService) DoChunk(r io.Reader, obj *meta.BaseObject, cb WriteObjCB)
 		Compress: Compress,
 	}
 
+	// 加密对象的 chunk 不参与去重，不需要去重范围
+	obj.DedupScope, obj.DedupKey = "", nil
+	var scopeKey []byte
+	if len(obj.SSEKey) == 0 && chunkConf != nil {
+		var err error
+		if scopeKey, err = c.applyDedupScope(obj, chunkConf); err != nil {
+			return err
+		}
+	}
+
+	return c.process(obj, cb, func(ctx context.Context, chunkChan chan *meta.Chunk) error {
+		if len(obj.SSEKey) > 0 {
+			return c.splitEncrypt(ctx, r, chunkChan, opts, obj)
+		}
+		if obj.DedupScope != "" {
+			return c.splitScoped(ctx, r, chunkChan, opts, obj, scopeKey)
+		}
+		// 直接传递 r.Body (io.ReadCloser) 给期望 io.Reader 的函数
+		return c.Split(ctx, r, chunkChan, opts, obj)
+	})
+}
+
+// process 执行 切分->去重->重组->汇总->写元数据 的流水线，produce 负责把切分好的chunk依次写入通道
+func (c *ChunkService) process(obj *meta.BaseObject, cb WriteObjCB, produce func(ctx context.Context, chunkChan chan *meta.Chunk) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 创建输出通道
+	chunkChan := make(chan *meta.Chunk, 100)
+	// 切分和去重阶段的错误，先写入再取消，回滚时返回给调用方
+	stageErr := make(chan error, 2)
+
 	// 切分
 	go func() {
 		defer close(chunkChan)
-		// 直接传递 r.Body (io.ReadCloser) 给期望 io.Reader 的函数
-		err := c.Split(ctx, r, chunkChan, opts, obj)
+		err := produce(ctx, chunkChan)
 		if err != nil {
 			logger.GetLogger("dedups3").Errorf("%s/%s split chunk failed: %v", obj.Bucket, obj.Key, err)
+			stageErr <- err
 			cancel()
 			return
 		}
@@ -134,6 +162,7 @@ func (c *ChunkService) DoChunk(r io.Reader, obj *meta.BaseObject, cb WriteObjCB)
 		chunks, err := c.Dedup(ctx, chunkChan, dedupChan, obj)
 		if err != nil {
 			logger.GetLogger("dedups3").Errorf("%s/%s Dedup chunk failed: %v", obj.Bucket, obj.Key, err)
+			stageErr <- err
 			cancel()
 			return
 		}
@@ -189,6 +218,11 @@ func (c *ChunkService) DoChunk(r io.Reader, obj *meta.BaseObject, cb WriteObjCB)
 			}
 		}
 
+		select {
+		case err := <-stageErr:
+			return fmt.Errorf("dochunk %s/%s failed, then rollback %d block data: %w", obj.Bucket, obj.Key, len(blocks), err)
+		default:
+		}
 		return fmt.Errorf("dochunk %s/%s failed, then rollback %d block data", obj.Bucket, obj.Key, len(blocks))
 	}
 
@@ -334,6 +368,8 @@ func (c *ChunkService) Dedup(ctx context.Context, inputChan, dedupChan chan *met
 	finished := false
 	dedupNum := 0
 	offset := 0
+	// 站点复制时对端已有的chunk只传hash，没有数据，无法计算整个对象的MD5
+	hasRef := false
 	for !finished {
 		select {
 		case <-ctx.Done():
@@ -344,6 +380,9 @@ func (c *ChunkService) Dedup(ctx context.Context, inputChan, dedupChan chan *met
 			if chunk != nil {
 				//logger.GetLogger("dedups3").Debugf("get cdc chunk %d fp %s", chunk.Size, chunk.Hash)
 				// 更新整个数据块的 MD5
+				if chunk.Data == nil {
+					hasRef = true
+				}
 				fullMD5.Write(chunk.Data)
 				allChunk = append(allChunk, chunk)
 				batchDedup = append(batchDedup, chunk)
@@ -378,6 +417,11 @@ func (c *ChunkService) Dedup(ctx context.Context, inputChan, dedupChan chan *met
 							return nil, fmt.Errorf("%s/%s chunk unmarshal failed: %w", obj.Bucket, obj.Key, err)
 						}
 
+						// 不同去重范围的 chunk 不能共用
+						if _chunk.Scope != item.Scope {
+							logger.GetLogger("dedups3").Errorf("%s/%s chunk %s belongs to another dedup scope", obj.Bucket, obj.Key, item.Hash)
+							return nil, fmt.Errorf("%w: %s", ErrScopeMismatch, item.Hash)
+						}
 						chunkFilter[item.Hash] = _chunk.BlockID
 						logger.GetLogger("dedups3").Debugf("chunk %s/%s/%s [%d-%d] has already been dedupped in block %s between object",
 							obj.Bucket, obj.Key, item.Hash, offset-int(item.Size), offset, _chunk.BlockID)
@@ -396,6 +440,12 @@ func (c *ChunkService) Dedup(ctx context.Context, inputChan, dedupChan chan *met
 						continue
 					}
 
+					// 引用的chunk本地不存在，需要对端补发数据
+					if item.Data == nil {
+						logger.GetLogger("dedups3").Errorf("chunk %s/%s/%s referenced without data is missing", obj.Bucket, obj.Key, item.Hash)
+						return nil, fmt.Errorf("%w: %s", ErrChunkMissing, item.Hash)
+					}
+
 					logger.GetLogger("dedups3").Debugf("chunk %s/%s/%s has not found dedupped", obj.Bucket, obj.Key, item.Hash)
 					chunkFilter[item.Hash] = meta.NONE_BLOCK_ID
 
@@ -406,6 +456,12 @@ func (c *ChunkService) Dedup(ctx context.Context, inputChan, dedupChan chan *met
 		}
 	}
 
+	// 加密对象和限定去重范围的对象 MD5 在切分时已经计算
+	if hasRef || len(obj.SSEKey) > 0 || obj.DedupScope != "" {
+		logger.GetLogger("dedups3").Infof("dedump object %s/%s finished, all chunk num is %d dedup chunk num is %d", obj.Bucket, obj.Key, len(allChunk), dedupNum)
+		return allChunk, nil
+	}
+
 	// 计算整个数据块的 MD5
 	fullMD5Sum := fullMD5.Sum(nil)
 	fullMD5Hex := hex.EncodeToString(fullMD5Sum)
@@ -542,90 +598,11 @@ func (c *ChunkService) WriteMeta(ctx context.Context, accountID string, allChunk
 		}
 	}()
 
-	type Pair struct {
-		BlockID string
-		ChunkID string
-	}
-
-	chunk2block := make(map[string]string, 0)
-
-	// 写入chunk元数据
-	for _, chunk := range allChunk {
-		//logger.GetLogger("dedups3").Errorf("%s/%s write chunk %s:%s:%d ", obj.Bucket, obj.Key, chunk.Hash, chunk.BlockID, len(chunk.Data))
-		chunkey := meta.GenChunkKey(obj.DataLocation, chunk.Hash)
-		var _old_chunk meta.Chunk
-		exists, e := txn.Get(chunkey, &_old_chunk)
-		if e != nil {
-			logger.GetLogger("dedups3").Errorf("%s/%s get chunk failed: %v", obj.Bucket, obj.Key, err)
-			return fmt.Errorf("%s/%s get chunk %s failed: %w", obj.Bucket, obj.Key, chunkey, err)
-		}
-
-		if exists {
-			if _old_chunk.BlockID != chunk.BlockID {
-				logger.GetLogger("dedups3").Debugf("%s/%s  chunk %s has multi bolock %s:%s", obj.Bucket, obj.Key, chunk.Hash, _old_chunk.BlockID, chunk.BlockID)
-			}
-
-			// 一个chunk只能属于一个 block
-			//chunk.BlockID = _old_chunk.BlockID
-			chunk2block[chunk.Hash] = _old_chunk.BlockID
-
-			oldBlockKeys = append(oldBlockKeys, meta.GenBlockKey(obj.DataLocation, _old_chunk.BlockID))
-
-			_old_chunk.RefCount += 1
-			e := txn.Set(chunkey, &_old_chunk)
-			if e != nil {
-				logger.GetLogger("dedups3").Errorf("%s/%s set chunk %s failed: %v", obj.Bucket, obj.Key, _old_chunk.Hash, err)
-				return fmt.Errorf("%s/%s set chunk failed: %w", obj.Bucket, obj.Key, err)
-			} else {
-				logger.GetLogger("dedups3").Debugf("%s/%s refresh set chunk: %s to block %s:%s", obj.Bucket, obj.Key, chunk.Hash, chunk.BlockID, _old_chunk.BlockID)
-			}
-		} else {
-			chunk.RefCount = 1
-			e := txn.Set(chunkey, &chunk)
-			if e != nil {
-				logger.GetLogger("dedups3").Errorf("%s/%s set chunk %s failed: %v", obj.Bucket, obj.Key, chunkey, err)
-				return fmt.Errorf("%s/%s set chunk failed: %w", obj.Bucket, obj.Key, err)
-			} else {
-				chunk2block[chunk.Hash] = chunk.BlockID
-				logger.GetLogger("dedups3").Debugf("%s/%s refresh set chunk: %s to block %s", obj.Bucket, obj.Key, chunk.Hash, chunk.BlockID)
-			}
-		}
-	}
-
-	// 写入block的元数据
-	for _, item := range blocks {
-		var _oldBlock meta.Block
-		blockKey := meta.GenBlockKey(obj.DataLocation, item.ID)
-		exists, err := txn.Get(blockKey, &_oldBlock)
-		if err != nil {
-			logger.GetLogger("dedups3").Errorf("%s/%s get block %s failed: %v", obj.Bucket, obj.Key, blockKey, err)
-			return fmt.Errorf("%s/%s get block %s failed: %w", obj.Bucket, obj.Key, blockKey, err)
-		}
-		_curBlock := item
-		if exists {
-			if len(_oldBlock.ChunkList) > len(item.ChunkList) {
-				_curBlock = &_oldBlock
-			} else {
-				for i := 0; i < len(_oldBlock.ChunkList); i++ {
-					_curBlock.ChunkList[i] = _oldBlock.ChunkList[i]
-				}
-			}
-		}
-		for i := 0; i < len(_curBlock.ChunkList); i++ {
-			bid, ok := chunk2block[_curBlock.ChunkList[i].Hash]
-			if ok && bid != _curBlock.ID {
-				_curBlock.ChunkList[i].Hash = meta.NONE_CHUNK_ID // 无索引的chunk
-			}
-		}
-		//logger.GetLogger("dedups3").Errorf("%s/%s write block meta inf : %s:%d:%d", obj.Bucket, obj.Key, item.ID, item.TotalSize, item.RealSize)
-
-		err = txn.Set(blockKey, _curBlock)
-		if err != nil {
-			logger.GetLogger("dedups3").Errorf("%s/%s/%s set block meta failed: %v", obj.Bucket, obj.Key, _curBlock.ID, err)
-			return fmt.Errorf("%s/%s set block meta failed: %w", obj.Bucket, obj.Key, err)
-		} else {
-			logger.GetLogger("dedups3").Debugf("%s/%s/%s set block meta   ok", obj.Bucket, obj.Key, _curBlock.ID)
-		}
+	// 写入chunk和block的元数据
+	oldKeys, err := c.writeDataMeta(txn, obj, allChunk, blocks)
+	oldBlockKeys = append(oldBlockKeys, oldKeys...)
+	if err != nil {
+		return err
 	}
 
 	//写入object meta信息
@@ -636,7 +613,7 @@ func (c *ChunkService) WriteMeta(ctx context.Context, accountID string, allChunk
 	}
 	logger.GetLogger("dedups3").Infof("prepare to write object %s  meta ...", obj.Key)
 	// 如果是覆盖，需要先删除旧的索引
-	gcChunks := make([]string, 0)
+	gcChunks := make([]gc.GCItem, 0)
 	switch object.(type) {
 	case *meta.PartObject:
 		var _obj meta.PartObject
@@ -646,8 +623,8 @@ func (c *ChunkService) WriteMeta(ctx context.Context, accountID string, allChunk
 			return fmt.Errorf("%s/%s get object failed: %w", obj.Bucket, obj.Key, err)
 		}
 		if exists && len(_obj.Chunks) > 0 {
-			gcChunks = append(gcChunks, _obj.Chunks...)
 			for _, k := range _obj.Chunks {
+				gcChunks = append(gcChunks, gc.GCItem{StorageID: _obj.DataLocation, ID: k})
 				oldChunkKeys = append(oldChunkKeys, meta.GenChunkKey(_obj.DataLocation, k))
 			}
 		}
@@ -658,11 +635,19 @@ func (c *ChunkService) WriteMeta(ctx context.Context, accountID string, allChunk
 			logger.GetLogger("dedups3").Errorf("%s/%s get object failed: %v", obj.Bucket, obj.Key, err)
 			return fmt.Errorf("%s/%s get object failed: %w", obj.Bucket, obj.Key, err)
 		}
-		if exists && len(_obj.Chunks) > 0 {
-			gcChunks = append(gcChunks, _obj.Chunks...)
-			for _, k := range _obj.Chunks {
-				oldChunkKeys = append(oldChunkKeys, meta.GenChunkKey(_obj.DataLocation, k))
-			}
+		var oldObj *meta.Object
+		if exists {
+			oldObj = &_obj
+		}
+		// 开启版本控制时旧对象转为历史版本，否则回收
+		items, err := ArchiveObject(txn, accountID, oldObj, normalobj)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s archive old object failed: %v", obj.Bucket, obj.Key, err)
+			return fmt.Errorf("%s/%s archive old object failed: %w", obj.Bucket, obj.Key, err)
+		}
+		for _, item := range items {
+			gcChunks = append(gcChunks, item)
+			oldChunkKeys = append(oldChunkKeys, meta.GenChunkKey(item.StorageID, item.ID))
 		}
 	default:
 		logger.GetLogger("dedups3").Errorf("unsupport type %s", objType.String())
@@ -674,12 +659,10 @@ func (c *ChunkService) WriteMeta(ctx context.Context, accountID string, allChunk
 		gcData := gc.GCChunk{
 			GCData: gc.GCData{
 				CreateAt: time.Now().UTC(),
-				Items:    make([]gc.GCItem, 0),
+				// 旧对象可能在其他存储点，按各自的存储点回收
+				Items: gcChunks,
 			},
 		}
-		for _, id := range gcChunks {
-			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: obj.DataLocation, ID: id})
-		}
 
 		err = txn.Set(gckey, &gcData)
 		if err != nil {
@@ -737,6 +720,100 @@ func (c *ChunkService) WriteMeta(ctx context.Context, accountID string, allChunk
 	return nil
 }
 
+// writeDataMeta 在事务中写入chunk和block的元数据，已经存在的chunk只增加引用计数
+// 返回需要从缓存中清理的block key
+func (c *ChunkService) writeDataMeta(txn kv.Txn, obj *meta.BaseObject, allChunk []*meta.Chunk, blocks map[string]*meta.Block) ([]string, error) {
+	var err error
+	oldBlockKeys := make([]string, 0)
+	chunk2block := make(map[string]string, 0)
+
+	// 写入chunk元数据
+	for _, chunk := range allChunk {
+		//logger.GetLogger("dedups3").Errorf("%s/%s write chunk %s:%s:%d ", obj.Bucket, obj.Key, chunk.Hash, chunk.BlockID, len(chunk.Data))
+		chunkey := meta.GenChunkKey(obj.DataLocation, chunk.Hash)
+		var _old_chunk meta.Chunk
+		exists, e := txn.Get(chunkey, &_old_chunk)
+		if e != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s get chunk failed: %v", obj.Bucket, obj.Key, err)
+			return oldBlockKeys, fmt.Errorf("%s/%s get chunk %s failed: %w", obj.Bucket, obj.Key, chunkey, err)
+		}
+
+		if exists {
+			// 不同去重范围的 chunk 不能共用
+			if _old_chunk.Scope != chunk.Scope {
+				logger.GetLogger("dedups3").Errorf("%s/%s chunk %s belongs to another dedup scope", obj.Bucket, obj.Key, chunk.Hash)
+				return oldBlockKeys, fmt.Errorf("%w: %s", ErrScopeMismatch, chunk.Hash)
+			}
+			if _old_chunk.BlockID != chunk.BlockID {
+				logger.GetLogger("dedups3").Debugf("%s/%s  chunk %s has multi bolock %s:%s", obj.Bucket, obj.Key, chunk.Hash, _old_chunk.BlockID, chunk.BlockID)
+			}
+
+			// 一个chunk只能属于一个 block
+			//chunk.BlockID = _old_chunk.BlockID
+			chunk2block[chunk.Hash] = _old_chunk.BlockID
+
+			oldBlockKeys = append(oldBlockKeys, meta.GenBlockKey(obj.DataLocation, _old_chunk.BlockID))
+
+			_old_chunk.RefCount += 1
+			e := txn.Set(chunkey, &_old_chunk)
+			if e != nil {
+				logger.GetLogger("dedups3").Errorf("%s/%s set chunk %s failed: %v", obj.Bucket, obj.Key, _old_chunk.Hash, err)
+				return oldBlockKeys, fmt.Errorf("%s/%s set chunk failed: %w", obj.Bucket, obj.Key, err)
+			} else {
+				logger.GetLogger("dedups3").Debugf("%s/%s refresh set chunk: %s to block %s:%s", obj.Bucket, obj.Key, chunk.Hash, chunk.BlockID, _old_chunk.BlockID)
+			}
+		} else {
+			chunk.RefCount = 1
+			e := txn.Set(chunkey, &chunk)
+			if e != nil {
+				logger.GetLogger("dedups3").Errorf("%s/%s set chunk %s failed: %v", obj.Bucket, obj.Key, chunkey, err)
+				return oldBlockKeys, fmt.Errorf("%s/%s set chunk failed: %w", obj.Bucket, obj.Key, err)
+			} else {
+				chunk2block[chunk.Hash] = chunk.BlockID
+				logger.GetLogger("dedups3").Debugf("%s/%s refresh set chunk: %s to block %s", obj.Bucket, obj.Key, chunk.Hash, chunk.BlockID)
+			}
+		}
+	}
+
+	// 写入block的元数据
+	for _, item := range blocks {
+		var _oldBlock meta.Block
+		blockKey := meta.GenBlockKey(obj.DataLocation, item.ID)
+		exists, err := txn.Get(blockKey, &_oldBlock)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s get block %s failed: %v", obj.Bucket, obj.Key, blockKey, err)
+			return oldBlockKeys, fmt.Errorf("%s/%s get block %s failed: %w", obj.Bucket, obj.Key, blockKey, err)
+		}
+		_curBlock := item
+		if exists {
+			if len(_oldBlock.ChunkList) > len(item.ChunkList) {
+				_curBlock = &_oldBlock
+			} else {
+				for i := 0; i < len(_oldBlock.ChunkList); i++ {
+					_curBlock.ChunkList[i] = _oldBlock.ChunkList[i]
+				}
+			}
+		}
+		for i := 0; i < len(_curBlock.ChunkList); i++ {
+			bid, ok := chunk2block[_curBlock.ChunkList[i].Hash]
+			if ok && bid != _curBlock.ID {
+				_curBlock.ChunkList[i].Hash = meta.NONE_CHUNK_ID // 无索引的chunk
+			}
+		}
+		//logger.GetLogger("dedups3").Errorf("%s/%s write block meta inf : %s:%d:%d", obj.Bucket, obj.Key, item.ID, item.TotalSize, item.RealSize)
+
+		err = txn.Set(blockKey, _curBlock)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s/%s set block meta failed: %v", obj.Bucket, obj.Key, _curBlock.ID, err)
+			return oldBlockKeys, fmt.Errorf("%s/%s set block meta failed: %w", obj.Bucket, obj.Key, err)
+		} else {
+			logger.GetLogger("dedups3").Debugf("%s/%s/%s set block meta   ok", obj.Bucket, obj.Key, _curBlock.ID)
+		}
+	}
+
+	return oldBlockKeys, nil
+}
+
 func (c *ChunkService) BatchGet(storageID string, chunkIDs []string) ([]*meta.Chunk, error) {
 	chunkMap := make(map[string]*meta.Chunk)
 	keys := make([]string, 0, len(chunkIDs))
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package chunk
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+)
+
+// splitEncrypt 切分后用对象数据密钥加密每个chunk，chunk 的 hash 按密文计算
+// 每次加密的 nonce 随机，加密对象的数据不参与去重
+// SSE-S3、SSE-KMS 和桶默认加密的对象同样如此：数据密钥按对象生成，由 KMS 密钥包装，
+// 改用范围内固定的收敛密钥虽然可以去重，但数据不再受对象指定的 KMS 密钥保护，
+// 需要加密又需要去重的场景应在存储点开启收敛加密（ChunkConfig.Convergent），而不是使用 SSE
+func (c *ChunkService) splitEncrypt(ctx context.Context, r io.Reader, outputChan chan *meta.Chunk, opt *ChunkerOpts, obj *meta.BaseObject) error {
+	return c.splitSeal(ctx, r, outputChan, opt, obj, func(data []byte) ([]byte, error) {
+		return utils.EncryptWithKey(data, obj.SSEKey, nil)
+	})
+}
+
+// splitScoped 切分后按对象的去重范围重新计算 chunk 的 hash，scopeKey 不为空时先做收敛加密
+// 收敛加密的 nonce 由明文派生，同一范围内相同的数据密文相同，仍然可以去重
+func (c *ChunkService) splitScoped(ctx context.Context, r io.Reader, outputChan chan *meta.Chunk, opt *ChunkerOpts, obj *meta.BaseObject, scopeKey []byte) error {
+	var seal func(data []byte) ([]byte, error)
+	if scopeKey != nil {
+		seal = func(data []byte) ([]byte, error) {
+			return utils.EncryptConvergent(data, scopeKey)
+		}
+	}
+	return c.splitSeal(ctx, r, outputChan, opt, obj, seal)
+}
+
+// splitSeal 切分后用 seal 转换每个chunk的数据，再按对象的去重范围计算 hash，seal 为 nil 时数据不变
+// 对象的 MD5 和 Content-MD5 校验基于明文，在这里完成
+func (c *ChunkService) splitSeal(ctx context.Context, r io.Reader, outputChan chan *meta.Chunk, opt *ChunkerOpts, obj *meta.BaseObject, seal func(data []byte) ([]byte, error)) error {
+	hasher := md5.New()
+	plainChan := make(chan *meta.Chunk, 100)
+	splitErr := make(chan error, 1)
+	go func() {
+		defer close(plainChan)
+		splitErr <- c.Split(ctx, io.TeeReader(r, hasher), plainChan, opt, obj)
+	}()
+
+	var sealErr error
+	for ck := range plainChan {
+		// 出错后继续读完通道，让切分协程退出
+		if sealErr != nil {
+			continue
+		}
+		data := ck.Data
+		if seal != nil {
+			var err error
+			if data, err = seal(ck.Data); err != nil {
+				sealErr = fmt.Errorf("encrypt chunk of %s/%s failed: %w", obj.Bucket, obj.Key, err)
+				continue
+			}
+		}
+		select {
+		case outputChan <- meta.NewScopedChunk(data, obj.DedupScope):
+		case <-ctx.Done():
+			sealErr = fmt.Errorf("split %s/%s canceled: %w", obj.Bucket, obj.Key, ctx.Err())
+		}
+	}
+	if err := <-splitErr; err != nil {
+		return err
+	}
+	if sealErr != nil {
+		return sealErr
+	}
+
+	md5Hex := hex.EncodeToString(hasher.Sum(nil))
+	if string(obj.ETag) != "" && string(obj.ETag) != md5Hex {
+		return fmt.Errorf("Content-MD5 mismatch for %s/%s: %s:%s", obj.Bucket, obj.Key, obj.ETag, md5Hex)
+	}
+	obj.ETag = meta.Etag(md5Hex)
+	return nil
+}
+
+// PlainChunkSize 加密对象（包括收敛加密）中 chunk 对应的明文长度
+func PlainChunkSize(ck *meta.Chunk, encrypted bool) int64 {
+	if encrypted {
+		return int64(ck.Size) - utils.EncryptOverhead
+	}
+	return int64(ck.Size)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/gc"
+)
+
+// WriteRestore 完成恢复任务，写入恢复出来的临时副本，副本的 chunk 写在 restore.DataLocation 存储点
+// 恢复任务在此期间被取消或者已经完成时返回 ErrObjectChanged，新写入的数据由调用方回收
+func (c *ChunkService) WriteRestore(ctx context.Context, key string, allChunk []*meta.Chunk, blocks map[string]*meta.Block, restore *meta.Restore) error {
+	txn, err := c.kvstore.BeginTxn(ctx, nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s create transaction failed: %v", restore.Bucket, restore.Key, err)
+		return fmt.Errorf("%s/%s create transaction failed: %w", restore.Bucket, restore.Key, err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var current meta.Restore
+	exists, err := txn.Get(key, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s get restore failed: %v", restore.Bucket, restore.Key, err)
+		return fmt.Errorf("%s/%s get restore failed: %w", restore.Bucket, restore.Key, err)
+	}
+	if !exists || !current.Ongoing || !current.RequestAt.Equal(restore.RequestAt) {
+		logger.GetLogger("dedups3").Warnf("%s/%s version %s restore changed during rehydrate", restore.Bucket, restore.Key, restore.VersionID)
+		return ErrObjectChanged
+	}
+
+	oldBlockKeys := make([]string, 0)
+	restore.Chunks = make([]string, 0, len(allChunk))
+	if len(allChunk) > 0 {
+		base := &meta.BaseObject{Bucket: restore.Bucket, Key: restore.Key, DataLocation: restore.DataLocation}
+		oldBlockKeys, err = c.writeDataMeta(txn, base, allChunk, blocks)
+		if err != nil {
+			return err
+		}
+		for _, _chunk := range allChunk {
+			restore.Chunks = append(restore.Chunks, _chunk.Hash)
+		}
+	}
+
+	if len(blocks) > 0 {
+		// 后置重删检查
+		gcKey := gc.GCDedupPrefix + utils.GenUUID()
+		gcData := gc.GCDedup{
+			GCData: gc.GCData{
+				CreateAt: time.Now().UTC(),
+				Items:    make([]gc.GCItem, 0, len(blocks)),
+			},
+		}
+		for _, _block := range blocks {
+			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: _block.StorageID, ID: _block.ID})
+		}
+		if err := txn.Set(gcKey, &gcData); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s set post dedup block failed: %v", restore.Bucket, restore.Key, err)
+		}
+	}
+
+	// 过期时间从恢复完成时开始计算
+	restore.Ongoing = false
+	restore.ExpiryDate = meta.RestoreExpiry(time.Now().UTC(), restore.Days)
+	if err := txn.Set(key, restore); err != nil {
+		logger.GetLogger("dedups3").Errorf("set restore %s/%s failed: %v", restore.Bucket, restore.Key, err)
+		return fmt.Errorf("set restore %s/%s failed: %w", restore.Bucket, restore.Key, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s commit failed: %v", restore.Bucket, restore.Key, err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.MDel(ctx, oldBlockKeys)
+	}
+	logger.GetLogger("dedups3").Infof("restore object %s/%s version %s to %s, expiry at %s", restore.Bucket, restore.Key, restore.VersionID, restore.DataLocation, restore.ExpiryDate)
+	return nil
+}
@@ -0,0 +1,244 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package chunk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/kms"
+)
+
+const (
+	// dedupKeyPrefix 去重范围的收敛加密密钥，用主密钥包装后保存
+	dedupKeyPrefix = "aws:dedup:key:"
+)
+
+var (
+	// ErrScopeMismatch 相同 hash 的 chunk 属于另一个去重范围
+	ErrScopeMismatch = errors.New("chunk belongs to another dedup scope")
+
+	// scopeKeys 已经解开的范围密钥缓存，按包装后的密钥索引，站点复制过来的对象可能带着对端的范围密钥
+	scopeKeys sync.Map
+)
+
+// DedupScopeID 返回对象所属的去重范围，全局去重时为空
+// account 范围按对象所有者划分，bucket 范围按所有者和桶划分
+func DedupScopeID(conf *meta.ChunkConfig, accountID, bucket string) string {
+	if conf == nil {
+		return ""
+	}
+	switch conf.DedupScope {
+	case meta.DEDUP_SCOPE_ACCOUNT:
+		return "account:" + accountID
+	case meta.DEDUP_SCOPE_BUCKET:
+		return "bucket:" + accountID + "/" + bucket
+	}
+	return ""
+}
+
+// ownerID 返回对象或者分段的所有者
+func ownerID(obj *meta.BaseObject) string {
+	if obj.ObjType == meta.PART_OBJECT {
+		return meta.BaseObjectToPart(obj).Owner.ID
+	}
+	return meta.BaseObjectToObject(obj).Owner.ID
+}
+
+// applyDedupScope 按存储点的切片配置设置对象的去重范围，需要收敛加密时返回范围密钥
+func (c *ChunkService) applyDedupScope(obj *meta.BaseObject, conf *meta.ChunkConfig) ([]byte, error) {
+	scope := DedupScopeID(conf, ownerID(obj), obj.Bucket)
+	if scope == "" {
+		return nil, nil
+	}
+	obj.DedupScope = scope
+	if !conf.Convergent {
+		return nil, nil
+	}
+	plain, sse, err := c.scopeKey(scope)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get dedup scope %s key: %v", scope, err)
+		return nil, fmt.Errorf("failed to get dedup scope %s key: %w", scope, err)
+	}
+	obj.DedupKey = sse
+	return plain, nil
+}
+
+// scopeKey 返回去重范围的收敛加密密钥，第一次使用时生成
+// 同一范围的密钥必须固定，否则相同的数据加密后不同，无法去重
+func (c *ChunkService) scopeKey(scope string) ([]byte, *meta.ObjectSSE, error) {
+	key := dedupKeyPrefix + scope
+	var sse meta.ObjectSSE
+	exists, err := c.kvstore.Get(key, &sse)
+	if err != nil && !exists {
+		return nil, nil, fmt.Errorf("read dedup scope key: %w", err)
+	}
+	if !exists {
+		ks := kms.GetKMSService()
+		if ks == nil {
+			return nil, nil, errors.New("kms service not initialized")
+		}
+		plain, keyID, wrapped, err := ks.GenerateDataKey(scopeKeyContext(scope))
+		if err != nil {
+			return nil, nil, err
+		}
+		sse = meta.ObjectSSE{KeyID: keyID, DataKey: wrapped}
+
+		// 同一范围并发生成时只有一个成功，其他的读取已有的
+		txn, err := c.kvstore.BeginTxn(context.Background(), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("begin txn: %w", err)
+		}
+		defer txn.Rollback()
+		if err := txn.SetNX(key, &sse); err != nil {
+			if errors.Is(err, kv.ErrKeyExists) {
+				return c.scopeKey(scope)
+			}
+			return nil, nil, fmt.Errorf("save dedup scope key: %w", err)
+		}
+		if err := txn.Commit(); err != nil {
+			return nil, nil, fmt.Errorf("commit dedup scope key: %w", err)
+		}
+		scopeKeys.Store(scopeKeyCacheID(scope, &sse), plain)
+		return plain, &sse, nil
+	}
+
+	plain, err := OpenScopeKey(scope, &sse)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plain, &sse, nil
+}
+
+// OpenScopeKey 解开对象中保存的范围密钥，用来解密收敛加密的 chunk
+func OpenScopeKey(scope string, sse *meta.ObjectSSE) ([]byte, error) {
+	if sse == nil {
+		return nil, nil
+	}
+	cacheID := scopeKeyCacheID(scope, sse)
+	if v, ok := scopeKeys.Load(cacheID); ok {
+		return v.([]byte), nil
+	}
+	ks := kms.GetKMSService()
+	if ks == nil {
+		return nil, errors.New("kms service not initialized")
+	}
+	plain, err := ks.UnwrapDataKey(sse.KeyID, sse.DataKey, scopeKeyContext(scope))
+	if err != nil {
+		return nil, err
+	}
+	scopeKeys.Store(cacheID, plain)
+	return plain, nil
+}
+
+func scopeKeyCacheID(scope string, sse *meta.ObjectSSE) string {
+	return scope + "/" + sse.KeyID + "/" + string(sse.DataKey)
+}
+
+// scopeKeyContext 包装范围密钥时的附加认证数据，密钥只能用于对应的范围
+func scopeKeyContext(scope string) string {
+	return "dedup/" + scope
+}
+
+// RewrapScopeKeys 把旧主密钥包装的去重范围密钥改用当前主密钥包装，返回重新包装的密钥数
+// 对象中保存的范围密钥副本由对象服务和分段上传服务各自重新包装
+func (c *ChunkService) RewrapScopeKeys() (int, error) {
+	count, failed := 0, 0
+	startKey := ""
+	for {
+		txn, err := c.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+		if err != nil {
+			return count, fmt.Errorf("begin txn: %w", err)
+		}
+		keys, nextKey, err := txn.Scan(dedupKeyPrefix, startKey, 100)
+		_ = txn.Rollback()
+		if err != nil {
+			return count, fmt.Errorf("scan dedup scope keys: %w", err)
+		}
+		for _, key := range keys {
+			done, err := c.rewrapScopeKey(key)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("rewrap dedup scope key %s failed: %v", key, err)
+				failed++
+				continue
+			}
+			if done {
+				count++
+			}
+		}
+		if nextKey == "" || len(keys) == 0 {
+			break
+		}
+		startKey = nextKey
+	}
+	if failed > 0 {
+		return count, fmt.Errorf("%d dedup scope keys failed to rewrap", failed)
+	}
+	return count, nil
+}
+
+// rewrapScopeKey 重新包装一个去重范围的密钥，返回 true 表示有更新
+func (c *ChunkService) rewrapScopeKey(key string) (bool, error) {
+	txn, err := c.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	var sse meta.ObjectSSE
+	exists, err := txn.Get(key, &sse)
+	if err != nil || !exists {
+		return false, err
+	}
+	done, err := RewrapScopeKey(strings.TrimPrefix(key, dedupKeyPrefix), &sse)
+	if err != nil || !done {
+		return false, err
+	}
+	if err := txn.Set(key, &sse); err != nil {
+		return false, fmt.Errorf("save dedup scope key: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return false, fmt.Errorf("commit dedup scope key: %w", err)
+	}
+	return true, nil
+}
+
+// RewrapScopeKey 把旧主密钥包装的范围密钥改用当前主密钥包装，返回 true 表示有更新
+func RewrapScopeKey(scope string, sse *meta.ObjectSSE) (bool, error) {
+	if sse == nil {
+		return false, nil
+	}
+	ks := kms.GetKMSService()
+	if ks == nil {
+		return false, errors.New("kms service not initialized")
+	}
+	if sse.KeyID == ks.CurrentKeyID() {
+		return false, nil
+	}
+	keyID, wrapped, err := ks.RewrapDataKey(sse.KeyID, sse.DataKey, scopeKeyContext(scope))
+	if err != nil {
+		return false, err
+	}
+	sse.KeyID, sse.DataKey = keyID, wrapped
+	return true, nil
+}
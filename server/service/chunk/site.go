@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package chunk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/gc"
+)
+
+var (
+	// ErrChunkMissing 对端只传了hash的chunk在本地不存在
+	ErrChunkMissing = errors.New("referenced chunk is missing")
+	// ErrReplicaStale 本地对象不比对端旧，复制的对象被忽略
+	ErrReplicaStale = errors.New("replica is not newer than local object")
+)
+
+// MissingChunks 返回本地存储点中不存在的chunk
+func (c *ChunkService) MissingChunks(storageID string, hashes []string) ([]string, error) {
+	missing := make([]string, 0)
+	seen := make(map[string]struct{}, len(hashes))
+	batchSize := 100
+	for i := 0; i < len(hashes); i += batchSize {
+		end := min(i+batchSize, len(hashes))
+		keys := make([]string, 0, end-i)
+		for _, hash := range hashes[i:end] {
+			keys = append(keys, meta.GenChunkKey(storageID, hash))
+		}
+		result, err := c.kvstore.BatchGet(keys)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to batchGet chunks: %v", err)
+			return nil, fmt.Errorf("failed to batchGet chunks: %w", err)
+		}
+		for j, hash := range hashes[i:end] {
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+			seen[hash] = struct{}{}
+			if result[keys[j]] == nil {
+				missing = append(missing, hash)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// Ingest 写入对端已经切分好的chunk，next 按对象中的顺序返回chunk，结束时返回 io.EOF
+// chunk 的数据为空时引用本地已有的chunk，本地不存在时返回 ErrChunkMissing
+func (c *ChunkService) Ingest(next func() (*meta.Chunk, error), obj *meta.BaseObject, cb WriteObjCB) error {
+	return c.process(obj, cb, func(ctx context.Context, chunkChan chan *meta.Chunk) error {
+		size := int64(0)
+		for {
+			ck, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read %s/%s chunk failed: %w", obj.Bucket, obj.Key, err)
+			}
+			size += int64(ck.Size)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("ingest %s/%s canceled: %w", obj.Bucket, obj.Key, ctx.Err())
+			case chunkChan <- ck:
+			}
+		}
+		if size != obj.Size {
+			return fmt.Errorf("ingest %s/%s size mismatch %d:%d", obj.Bucket, obj.Key, size, obj.Size)
+		}
+		logger.GetLogger("dedups3").Infof("ingest object %s/%s chunk finished, size %d", obj.Bucket, obj.Key, size)
+		return nil
+	})
+}
+
+// WriteReplica 写入对端复制过来的对象，按 LastModified 后写者胜
+// 本地当前版本不比复制的对象旧时返回 ErrReplicaStale
+// allChunk 为 nil 时对象没有chunk数据（内联或者空对象）
+func (c *ChunkService) WriteReplica(ctx context.Context, accountID string, allChunk []*meta.Chunk, blocks map[string]*meta.Block, obj *meta.Object) error {
+	txn, err := c.kvstore.BeginTxn(ctx, nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s create transaction failed: %v", obj.Bucket, obj.Key, err)
+		return fmt.Errorf("%s/%s create transaction failed: %w", obj.Bucket, obj.Key, err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	objKey := "aws:object:" + accountID + ":" + obj.Bucket + "/" + obj.Key
+	var current meta.Object
+	exists, err := txn.Get(objKey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s get object failed: %v", obj.Bucket, obj.Key, err)
+		return fmt.Errorf("%s/%s get object failed: %w", obj.Bucket, obj.Key, err)
+	}
+	var oldObj *meta.Object
+	if exists {
+		if !obj.LastModified.After(current.LastModified) {
+			logger.GetLogger("dedups3").Infof("%s/%s replica %s is not newer than local %s", obj.Bucket, obj.Key, obj.LastModified, current.LastModified)
+			return ErrReplicaStale
+		}
+		oldObj = &current
+	}
+
+	oldBlockKeys := make([]string, 0)
+	if allChunk != nil {
+		oldBlockKeys, err = c.writeDataMeta(txn, meta.ObjectToBaseObject(obj), allChunk, blocks)
+		if err != nil {
+			return err
+		}
+		obj.Chunks = make([]string, 0, len(allChunk))
+		for _, _chunk := range allChunk {
+			obj.Chunks = append(obj.Chunks, _chunk.Hash)
+		}
+	}
+
+	// 开启版本控制时旧对象转为历史版本，否则回收
+	gcItems, err := ArchiveObject(txn, accountID, oldObj, obj)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s archive old object failed: %v", obj.Bucket, obj.Key, err)
+		return err
+	}
+	if err := AddGCChunks(txn, gcItems); err != nil {
+		return err
+	}
+
+	if len(blocks) > 0 {
+		// 后置重删检查
+		gcKey := gc.GCDedupPrefix + utils.GenUUID()
+		gcData := gc.GCDedup{
+			GCData: gc.GCData{
+				CreateAt: time.Now().UTC(),
+				Items:    make([]gc.GCItem, 0, len(blocks)),
+			},
+		}
+		for _, _block := range blocks {
+			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: _block.StorageID, ID: _block.ID})
+		}
+		if err := txn.Set(gcKey, &gcData); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s set post dedup block failed: %v", obj.Bucket, obj.Key, err)
+		}
+	}
+
+	if err := txn.Set(objKey, obj); err != nil {
+		logger.GetLogger("dedups3").Errorf("set object %s/%s meta info failed: %v", obj.Bucket, obj.Key, err)
+		return fmt.Errorf("set object %s/%s meta info failed: %w", obj.Bucket, obj.Key, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s commit failed: %v", obj.Bucket, obj.Key, err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		chunkKeys := make([]string, 0, len(gcItems))
+		for _, item := range gcItems {
+			chunkKeys = append(chunkKeys, meta.GenChunkKey(item.StorageID, item.ID))
+		}
+		_ = cache.MDel(ctx, chunkKeys)
+		_ = cache.MDel(ctx, oldBlockKeys)
+		_ = cache.Del(ctx, objKey)
+	}
+	logger.GetLogger("dedups3").Infof("write replica object %s/%s version %s", obj.Bucket, obj.Key, obj.GetVersionID())
+	return nil
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package chunk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/gc"
+)
+
+var (
+	// ErrObjectChanged 重写数据期间对象被修改或删除
+	ErrObjectChanged = errors.New("object changed during rewrite")
+)
+
+// ArchiveObject 覆盖写对象时处理旧的当前版本
+// newObj.VersionID 为空: 桶未开启版本控制，旧对象直接回收
+// newObj.VersionID 为 null: 版本控制暂停，旧的 null 版本被替换回收，其他版本转为历史版本
+// 其他: 版本控制开启，旧对象转为历史版本保存
+// 返回需要回收的chunk
+func ArchiveObject(txn kv.Txn, accountID string, oldObj, newObj *meta.Object) ([]gc.GCItem, error) {
+	gcItems := make([]gc.GCItem, 0)
+	// 被回收的对象如果处于锁定状态，拒绝覆盖
+	collect := func(obj *meta.Object) error {
+		if obj.IsLocked(false) {
+			logger.GetLogger("dedups3").Errorf("%s/%s version %s is locked, can not be overwritten", obj.Bucket, obj.Key, obj.GetVersionID())
+			return xhttp.ToError(xhttp.ErrObjectLocked)
+		}
+		for _, id := range obj.Chunks {
+			gcItems = append(gcItems, gc.GCItem{StorageID: obj.DataLocation, ID: id})
+		}
+		return nil
+	}
+
+	switch newObj.VersionID {
+	case "":
+		if oldObj != nil {
+			if err := collect(oldObj); err != nil {
+				return nil, err
+			}
+		}
+	case meta.NullVersionID:
+		// 历史版本中已经存在的 null 版本要被替换
+		nullKey, err := FindVersionKey(txn, accountID, newObj.Bucket, newObj.Key, meta.NullVersionID)
+		if err != nil {
+			return nil, err
+		}
+		if nullKey != "" {
+			var nullObj meta.Object
+			exists, err := txn.Get(nullKey, &nullObj)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("%s/%s get null version failed: %v", newObj.Bucket, newObj.Key, err)
+				return nil, fmt.Errorf("%s/%s get null version failed: %w", newObj.Bucket, newObj.Key, err)
+			}
+			if exists {
+				if err := collect(&nullObj); err != nil {
+					return nil, err
+				}
+			}
+			if err := DeleteVersion(txn, accountID, newObj.Bucket, newObj.Key, meta.NullVersionID, nullKey); err != nil {
+				return nil, err
+			}
+		}
+		if oldObj != nil {
+			if oldObj.GetVersionID() == meta.NullVersionID {
+				if err := collect(oldObj); err != nil {
+					return nil, err
+				}
+			} else if err := PutVersion(txn, accountID, oldObj); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if oldObj != nil {
+			if err := PutVersion(txn, accountID, oldObj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return gcItems, nil
+}
+
+// PutVersion 把对象保存为历史版本，null 版本同时记录指针
+func PutVersion(txn kv.Txn, accountID string, obj *meta.Object) error {
+	if obj.VersionID == "" {
+		obj.VersionID = meta.NullVersionID
+	}
+	versionKey := meta.GenVersionKey(accountID, obj.Bucket, obj.Key, meta.GenVersionSortKey(obj.VersionID, obj.LastModified))
+	if err := txn.Set(versionKey, obj); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s save version %s failed: %v", obj.Bucket, obj.Key, obj.VersionID, err)
+		return fmt.Errorf("%s/%s save version %s failed: %w", obj.Bucket, obj.Key, obj.VersionID, err)
+	}
+	if obj.VersionID == meta.NullVersionID {
+		nullKey := meta.GenNullVersionKey(accountID, obj.Bucket, obj.Key)
+		if err := txn.Set(nullKey, versionKey); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s save null version pointer failed: %v", obj.Bucket, obj.Key, err)
+			return fmt.Errorf("%s/%s save null version pointer failed: %w", obj.Bucket, obj.Key, err)
+		}
+	}
+	logger.GetLogger("dedups3").Debugf("%s/%s save version %s", obj.Bucket, obj.Key, obj.VersionID)
+	return nil
+}
+
+// DeleteVersion 删除对象的历史版本，null 版本同时删除指针
+func DeleteVersion(txn kv.Txn, accountID, bucket, key, versionID, versionKey string) error {
+	if err := txn.Delete(versionKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s delete version %s failed: %v", bucket, key, versionID, err)
+		return fmt.Errorf("%s/%s delete version %s failed: %w", bucket, key, versionID, err)
+	}
+	if versionID == meta.NullVersionID {
+		if err := txn.Delete(meta.GenNullVersionKey(accountID, bucket, key)); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s delete null version pointer failed: %v", bucket, key, err)
+			return fmt.Errorf("%s/%s delete null version pointer failed: %w", bucket, key, err)
+		}
+	}
+	return nil
+}
+
+// FindVersionKey 查找对象历史版本的存储key
+// null 版本通过指针查找，没有 null 版本时返回空字符串
+func FindVersionKey(txn kv.Txn, accountID, bucket, key, versionID string) (string, error) {
+	if versionID != meta.NullVersionID {
+		return meta.GenVersionKey(accountID, bucket, key, versionID), nil
+	}
+	var versionKey string
+	if _, err := txn.Get(meta.GenNullVersionKey(accountID, bucket, key), &versionKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s get null version pointer failed: %v", bucket, key, err)
+		return "", fmt.Errorf("%s/%s get null version pointer failed: %w", bucket, key, err)
+	}
+	return versionKey, nil
+}
+
+// AddGCChunks 把需要回收的chunk写入gc队列，延迟处理
+func AddGCChunks(txn kv.Txn, items []gc.GCItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	gckey := gc.GCChunkPrefix + utils.GenUUID()
+	gcData := gc.GCChunk{
+		GCData: gc.GCData{
+			CreateAt: time.Now().UTC(),
+			Items:    items,
+		},
+	}
+	if err := txn.Set(gckey, &gcData); err != nil {
+		logger.GetLogger("dedups3").Errorf("set gc chunk %s failed: %v", gckey, err)
+		return fmt.Errorf("set gc chunk %s failed: %w", gckey, err)
+	}
+	logger.GetLogger("dedups3").Infof("set gc chunk %s delay to proccess", gckey)
+	return nil
+}
+
+// ReplaceMeta 用重新写入的数据替换对象的数据，对象的版本等其他信息保持不变
+// storeKey 是对象元数据所在的key，可以是当前版本也可以是历史版本
+// allChunk 为 nil 时数据不变，只替换对象元数据
+// 重写期间对象被修改时返回 ErrObjectChanged，新写入的数据由调用方回收
+func (c *ChunkService) ReplaceMeta(ctx context.Context, storeKey string, allChunk []*meta.Chunk, blocks map[string]*meta.Block, oldObj, newObj *meta.Object) error {
+	txn, err := c.kvstore.BeginTxn(ctx, nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s create transaction failed: %v", newObj.Bucket, newObj.Key, err)
+		return fmt.Errorf("%s/%s create transaction failed: %w", newObj.Bucket, newObj.Key, err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var current meta.Object
+	exists, err := txn.Get(storeKey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s get object failed: %v", newObj.Bucket, newObj.Key, err)
+		return fmt.Errorf("%s/%s get object failed: %w", newObj.Bucket, newObj.Key, err)
+	}
+	if !exists || current.ETag != oldObj.ETag || current.VersionID != oldObj.VersionID ||
+		current.DataLocation != oldObj.DataLocation || !current.LastModified.Equal(oldObj.LastModified) {
+		logger.GetLogger("dedups3").Warnf("%s/%s version %s changed during rewrite", newObj.Bucket, newObj.Key, newObj.GetVersionID())
+		return ErrObjectChanged
+	}
+
+	gcItems := make([]gc.GCItem, 0)
+	oldBlockKeys := make([]string, 0)
+	if allChunk != nil {
+		oldBlockKeys, err = c.writeDataMeta(txn, meta.ObjectToBaseObject(newObj), allChunk, blocks)
+		if err != nil {
+			return err
+		}
+		newObj.Chunks = make([]string, 0, len(allChunk))
+		for _, _chunk := range allChunk {
+			newObj.Chunks = append(newObj.Chunks, _chunk.Hash)
+		}
+
+		// 旧数据按原来的存储点回收
+		for _, id := range current.Chunks {
+			gcItems = append(gcItems, gc.GCItem{StorageID: current.DataLocation, ID: id})
+		}
+		if err := AddGCChunks(txn, gcItems); err != nil {
+			return err
+		}
+	}
+
+	if len(blocks) > 0 {
+		// 后置重删检查
+		gcKey := gc.GCDedupPrefix + utils.GenUUID()
+		gcData := gc.GCDedup{
+			GCData: gc.GCData{
+				CreateAt: time.Now().UTC(),
+				Items:    make([]gc.GCItem, 0, len(blocks)),
+			},
+		}
+		for _, _block := range blocks {
+			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: _block.StorageID, ID: _block.ID})
+		}
+		if err := txn.Set(gcKey, &gcData); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s set post dedup block failed: %v", newObj.Bucket, newObj.Key, err)
+		}
+	}
+
+	if err := txn.Set(storeKey, newObj); err != nil {
+		logger.GetLogger("dedups3").Errorf("set object %s/%s meta info failed: %v", newObj.Bucket, newObj.Key, err)
+		return fmt.Errorf("set object %s/%s meta info failed: %w", newObj.Bucket, newObj.Key, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s commit failed: %v", newObj.Bucket, newObj.Key, err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		chunkKeys := make([]string, 0, len(gcItems))
+		for _, item := range gcItems {
+			chunkKeys = append(chunkKeys, meta.GenChunkKey(item.StorageID, item.ID))
+		}
+		_ = cache.MDel(ctx, chunkKeys)
+		_ = cache.MDel(ctx, oldBlockKeys)
+		_ = cache.Del(ctx, storeKey)
+	}
+	logger.GetLogger("dedups3").Infof("replace object %s/%s version %s data to %s", newObj.Bucket, newObj.Key, newObj.GetVersionID(), newObj.DataLocation)
+	return nil
+}
@@ -157,6 +157,13 @@ func (g *GCService) doClean() {
 		return
 	}
 
+	// 校验读取时发现损坏的块
+	err = g.clean(GCScrubPrefix)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to scrub blocks: %v", err)
+		return
+	}
+
 	logger.GetLogger("dedups3").Tracef("garbage collection scan completed")
 }
 
@@ -179,6 +186,8 @@ func (g *GCService) clean(prefix string) error {
 			nextKey, _ = g.cleanOne4Block(prefix, nextKey)
 		case GCDedupPrefix:
 			nextKey, _ = g.dedupOne4Block(prefix, nextKey)
+		case GCScrubPrefix:
+			nextKey, _ = g.scrubOne4Block(prefix, nextKey)
 		default:
 			logger.GetLogger("dedups3").Debugf("cleaning up chunk prefix %s", prefix)
 		}
@@ -691,14 +700,14 @@ func (g *GCService) shrinkBlock(_block *meta.Block) error {
 
 	newBlockData.UpdatedAt = time.Now().UTC()
 	newBlockData.CalcChunkHash()
-	_block.BlockHeader = newBlockData.BlockHeader
-	copy(_block.ChunkList, newBlockData.ChunkList)
 
 	err = bs.WriteBlock(context.Background(), _block.StorageID, newBlockData)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to write block data: %v", err)
 		return fmt.Errorf("failed to write block data: %w", err)
 	}
+	// 写入后才有新的压缩加密标记和分段索引
+	_block.BlockHeader = newBlockData.BlockHeader
 
 	err = utils.RetryCall(5, func() error {
 		return g.kvstore.Set(blockKey, _block)
@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/block"
+)
+
+const (
+	// GCScrubPrefix 待校验的块，读取时发现 chunk 校验失败后加入
+	GCScrubPrefix = "aws:gc:scrub:"
+	// ScrubDamagedPrefix 校验后确认存储中数据损坏的块，需要人工处理
+	ScrubDamagedPrefix = "aws:scrub:damaged:"
+)
+
+// IntegrityStats 数据完整性校验的运行统计
+type IntegrityStats struct {
+	Mismatched int64 `json:"mismatched"` // 读取时 hash 校验失败的 chunk 数
+	Scheduled  int64 `json:"scheduled"`  // 加入校验任务的块数
+	Repaired   int64 `json:"repaired"`   // 丢弃缓存重新读取后校验通过的块数
+	Damaged    int64 `json:"damaged"`    // 存储中数据损坏的块数
+}
+
+type GCScrub struct {
+	GCData
+}
+
+// ScrubDamaged 存储中损坏的块和其中校验失败的 chunk
+type ScrubDamaged struct {
+	StorageID string    `json:"StorageID"`
+	BlockID   string    `json:"BlockID"`
+	Chunks    []string  `json:"Chunks"`
+	Reason    string    `json:"Reason,omitempty"`
+	CreateAt  time.Time `json:"CreateAt"`
+}
+
+var integrity struct {
+	mismatched atomic.Int64
+	scheduled  atomic.Int64
+	repaired   atomic.Int64
+	damaged    atomic.Int64
+}
+
+// GetIntegrityStats 获取数据完整性校验的运行统计
+func GetIntegrityStats() *IntegrityStats {
+	return &IntegrityStats{
+		Mismatched: integrity.mismatched.Load(),
+		Scheduled:  integrity.scheduled.Load(),
+		Repaired:   integrity.repaired.Load(),
+		Damaged:    integrity.damaged.Load(),
+	}
+}
+
+// ReportChunkMismatch 读取时 chunk 校验失败，计数并把所在的块加入校验任务
+// 同一个块重复报告只保留一条任务
+func ReportChunkMismatch(storageID, blockID, hash string) {
+	integrity.mismatched.Add(1)
+	logger.GetLogger("dedups3").Errorf("chunk %s in block %s/%s integrity check failed", hash, storageID, blockID)
+
+	store, err := kv.GetKvStore()
+	if err != nil || store == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get kv store for scrub: %v", err)
+		return
+	}
+	scrub := GCScrub{GCData{
+		CreateAt: time.Now().UTC(),
+		Items:    []GCItem{{StorageID: storageID, ID: blockID}},
+	}}
+	if err := store.Set(GCScrubPrefix+storageID+":"+blockID, &scrub); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to schedule scrub of block %s/%s: %v", storageID, blockID, err)
+		return
+	}
+	integrity.scheduled.Add(1)
+}
+
+// scrubOne4Block 处理一个校验任务，丢弃块缓存后重新读取并校验每个 chunk
+// 重新读取后校验通过说明是缓存的数据损坏，否则记录损坏的块
+func (g *GCService) scrubOne4Block(prefix, startKey string) (nextKey string, err error) {
+	txn, err := g.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin txn: %v", err)
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	keys, nk, err := txn.Scan(prefix, startKey, 1)
+	if err != nil || len(keys) == 0 {
+		txn.Rollback()
+		return "", err
+	}
+	nextKey = nk
+	curKey := keys[0]
+	var scrub GCScrub
+	exists, err := txn.Get(curKey, &scrub)
+	txn.Rollback()
+	if err != nil || !exists {
+		return nextKey, fmt.Errorf("failed to get scrub task %s: %w", curKey, err)
+	}
+
+	bs := block.GetBlockService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get block service")
+		return nextKey, errors.New("failed to get block service")
+	}
+
+	for _, item := range scrub.Items {
+		bad, err := bs.ScrubBlock(item.StorageID, item.ID, func(hash string, data []byte) bool {
+			var ck meta.Chunk
+			exists, err := g.kvstore.Get(meta.GenChunkKey(item.StorageID, hash), &ck)
+			if err != nil || !exists {
+				// chunk 已经被删除，不需要校验
+				return true
+			}
+			return ck.Verify(data)
+		})
+		if err == nil && len(bad) == 0 {
+			integrity.repaired.Add(1)
+			logger.GetLogger("dedups3").Warnf("block %s/%s passed scrub after dropping cache", item.StorageID, item.ID)
+			continue
+		}
+
+		damaged := ScrubDamaged{StorageID: item.StorageID, BlockID: item.ID, Chunks: bad, CreateAt: time.Now().UTC()}
+		if err != nil {
+			damaged.Reason = err.Error()
+		}
+		integrity.damaged.Add(1)
+		logger.GetLogger("dedups3").Errorf("block %s/%s is damaged, %d chunks failed scrub: %v", item.StorageID, item.ID, len(bad), err)
+		if e := g.kvstore.Set(ScrubDamagedPrefix+item.StorageID+":"+item.ID, &damaged); e != nil {
+			logger.GetLogger("dedups3").Errorf("failed to record damaged block %s/%s: %v", item.StorageID, item.ID, e)
+			return nextKey, fmt.Errorf("failed to record damaged block %s: %w", item.ID, e)
+		}
+	}
+
+	if err := g.kvstore.Delete(curKey); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to delete scrub task %s: %v", curKey, err)
+		return nextKey, fmt.Errorf("failed to delete scrub task %s: %w", curKey, err)
+	}
+	return nextKey, nil
+}
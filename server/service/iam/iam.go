@@ -17,6 +17,7 @@
 package iam
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -168,7 +169,7 @@ func (s *IamService) CreateAccount(username, password string) (*meta.IamAccount,
 		return nil, fmt.Errorf("failed to set account to kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, err
 	}
@@ -277,7 +278,7 @@ func (s *IamService) CreateUser(accountID, username, targetusername, password st
 		}
 	}
 
-	if err = s.conf.TxnCommit(txn); err != nil {
+	if err = s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -401,7 +402,7 @@ func (s *IamService) UpdateUser(accountID, username, targetusername, password st
 		}
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -497,7 +498,7 @@ func (s *IamService) DeleteUser(accountID, username, targetusername string) erro
 		}
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -584,7 +585,7 @@ func (s *IamService) CreateAccessKey(accountID, username string, ak, sk string,
 		return nil, fmt.Errorf("failed to set user to kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -637,7 +638,7 @@ func (s *IamService) UpdateAccessKey(accountID, ak, sk string, expiredAt time.Ti
 		return nil, fmt.Errorf("failed to set access key to kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -671,7 +672,7 @@ func (s *IamService) DeleteAccessKey(accountID, ak string) error {
 		return fmt.Errorf("failed to delete access key to kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -701,6 +702,41 @@ func (s *IamService) GetAccessKey(accessKeyID string) (*meta.AccessKey, error) {
 	return accessKey, nil
 }
 
+// WithAnonymous 在请求上下文中记录匿名访问主体和鉴权得到的桶所有者账户
+// 匿名请求没有访问密钥，以桶所有者的账户访问数据
+func WithAnonymous(ctx context.Context, ownerID string) context.Context {
+	ctx = context.WithValue(ctx, "anonymous", true)
+	return context.WithValue(ctx, "owneraccount", ownerID)
+}
+
+// IsAnonymous 请求是否是匿名请求
+func IsAnonymous(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	anonymous, _ := ctx.Value("anonymous").(bool)
+	return anonymous
+}
+
+// GetRequestAccountID 获取请求访问数据使用的账户ID
+// 匿名请求使用请求上下文中记录的桶所有者账户，其他请求通过访问密钥查找所属账户
+func (s *IamService) GetRequestAccountID(ctx context.Context, accessKeyID string) (string, error) {
+	if IsAnonymous(ctx) {
+		ownerID, _ := ctx.Value("owneraccount").(string)
+		if ownerID == "" {
+			logger.GetLogger("dedups3").Errorf("anonymous request has no owner account")
+			return "", xhttp.ToError(xhttp.ErrAccessDenied)
+		}
+		return ownerID, nil
+	}
+	ak, err := s.GetAccessKey(accessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s: %v", accessKeyID, err)
+		return "", xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	return ak.AccountID, nil
+}
+
 func (s *IamService) CreatePolicy(accountID, username, policyname, desc, doc string) (*meta.IamPolicy, error) {
 	if !meta.IsValidIAMName(policyname) {
 		return nil, xhttp.ToError(xhttp.ErrInvalidName)
@@ -761,7 +797,7 @@ func (s *IamService) CreatePolicy(accountID, username, policyname, desc, doc str
 		logger.GetLogger("dedups3").Errorf("failed to set policy to kv config: %v", err)
 		return nil, fmt.Errorf("failed to set policy to kv config: %w", err)
 	}
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -821,7 +857,7 @@ func (s *IamService) UpdatePolicy(accountID, username, policyname, desc, doc str
 		logger.GetLogger("dedups3").Errorf("failed to set policy to kv config: %v", err)
 		return nil, fmt.Errorf("failed to set policy to kv config: %w", err)
 	}
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -962,7 +998,7 @@ func (s *IamService) DeletePolicy(accountID, username, policyname string) error
 		return fmt.Errorf("failed to delete policy from kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1030,7 +1066,7 @@ func (s *IamService) CreateRole(accountID, username, rolename, desc, assumeRoleP
 		return nil, fmt.Errorf("failed to set role to kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1111,7 +1147,7 @@ func (s *IamService) UpdateRole(accountID, username, rolename, desc, assumeRoleP
 		logger.GetLogger("dedups3").Errorf("failed to set role to kv config: %v", err)
 		return nil, fmt.Errorf("failed to set role to kv config: %w", err)
 	}
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1189,7 +1225,7 @@ func (s *IamService) DeleteRole(accountID, username, rolename string) error {
 		}
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1259,7 +1295,7 @@ func (s *IamService) CreateGroup(accountID, username, groupname, desc string, us
 		logger.GetLogger("dedups3").Errorf("failed to set role to kv config: %v", err)
 		return nil, fmt.Errorf("failed to set role to kv config: %w", err)
 	}
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1340,7 +1376,7 @@ func (s *IamService) UpdateGroup(accountID, username, groupname, desc string, us
 		logger.GetLogger("dedups3").Errorf("failed to set role to kv config: %v", err)
 		return nil, fmt.Errorf("failed to set role to kv config: %w", err)
 	}
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1428,7 +1464,7 @@ func (s *IamService) DeleteGroup(accountID, username, groupname string) error {
 		return fmt.Errorf("failed to set role to kv config: %w", err)
 	}
 
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1467,7 +1503,7 @@ func (s *IamService) SetQuota(accountID string, quota *meta.QuotaConfig) error {
 		logger.GetLogger("dedups3").Errorf("failed to set quota config: %v", err)
 		return fmt.Errorf("failed to set quota config: %w", err)
 	}
-	if err := s.conf.TxnCommit(txn); err != nil {
+	if err := s.commit(txn); err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -1479,6 +1515,46 @@ func (s *IamService) DeleteQuota(accountID string) error {
 	return s.SetQuota(accountID, nil)
 }
 
+// SetBlockPublicAccess 设置账户是否禁止匿名访问
+func (s *IamService) SetBlockPublicAccess(accountID string, block bool) error {
+	txn, err := s.conf.TxnBegin()
+	if err != nil || txn == "" {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvstore txn: %v", err)
+		return fmt.Errorf("failed to initialize kvstore txn: %w", err)
+	}
+	defer func() {
+		if txn != "" && s.conf != nil {
+			_ = s.conf.TxnRollback(txn)
+		}
+	}()
+
+	accountKey := ACCOUNT_PREFIX + accountID
+	var _ac meta.IamAccount
+	ac, err := s.conf.TxnGetKv(txn, accountKey, _ac)
+	if ac == nil || err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get account from kv config: %v", err)
+		return fmt.Errorf("failed to get account from kv config: %w", err)
+	}
+	account, ok := ac.(*meta.IamAccount)
+	if account == nil || !ok {
+		logger.GetLogger("dedups3").Errorf("failed to get account from kv config: %v", err)
+		return fmt.Errorf("failed to get account from kv config: %w", err)
+	}
+
+	account.BlockPublicAccess = block
+
+	if err := s.conf.TxnSetKv(txn, accountKey, account); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set block public access: %v", err)
+		return fmt.Errorf("failed to set block public access: %w", err)
+	}
+	if err := s.commit(txn); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	txn = ""
+	return nil
+}
+
 // ============================== 权限检查方法 ==============================
 
 // 获取用户所有策略（直接附加+通过组附加+通过角色附加）
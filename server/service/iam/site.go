@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package iam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+)
+
+const (
+	// IAM_MTIME_KEY 记录 IAM 数据最后修改时间，站点同步按它做后写者胜
+	IAM_MTIME_KEY = "dedups3:default:iam-mtime"
+)
+
+// sitePrefixes 需要在站点间同步的 IAM 数据
+var sitePrefixes = []string{ACCOUNT_PREFIX, USER_PREFIX, GROUP_PREFIX, ROLE_PREFIX, POLICY_PREFIX, ACCESSKEY_PREFIX}
+
+// IamSnapshot IAM 数据的完整快照
+type IamSnapshot struct {
+	UpdatedAt time.Time                  `json:"updatedAt"`
+	Entries   map[string]json.RawMessage `json:"entries"`
+}
+
+// commit 提交事务，同时刷新 IAM 数据的修改时间
+func (s *IamService) commit(txn string) error {
+	if err := s.conf.TxnSetKv(txn, IAM_MTIME_KEY, time.Now().UTC()); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set iam mtime: %v", err)
+		return fmt.Errorf("failed to set iam mtime: %w", err)
+	}
+	return s.conf.TxnCommit(txn)
+}
+
+// UpdatedAt 获取 IAM 数据最后修改时间，从未修改过时返回零值
+func (s *IamService) UpdatedAt() (time.Time, error) {
+	v, err := s.conf.Get(IAM_MTIME_KEY, time.Time{})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam mtime: %v", err)
+		return time.Time{}, fmt.Errorf("failed to get iam mtime: %w", err)
+	}
+	t, ok := v.(*time.Time)
+	if !ok || t == nil {
+		return time.Time{}, nil
+	}
+	return *t, nil
+}
+
+// ExportSnapshot 导出全部 IAM 数据
+func (s *IamService) ExportSnapshot() (*IamSnapshot, error) {
+	updatedAt, err := s.UpdatedAt()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &IamSnapshot{
+		UpdatedAt: updatedAt,
+		Entries:   make(map[string]json.RawMessage),
+	}
+	for _, prefix := range sitePrefixes {
+		// IAM 数据量不大，一次全部读出
+		items, _, err := s.conf.List(prefix, "", 0, json.RawMessage{})
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to list %s: %v", prefix, err)
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		for k, v := range items {
+			if raw, ok := v.(*json.RawMessage); ok && raw != nil {
+				snapshot.Entries[k] = *raw
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+// ImportSnapshot 用对端的快照替换本地 IAM 数据，快照不比本地新时忽略
+// keepAccessKey 是对端调用时使用的密钥，即使快照中没有也保留，避免同步后对端无法再访问
+// 返回数据是否被替换
+func (s *IamService) ImportSnapshot(snapshot *IamSnapshot, keepAccessKey string) (bool, error) {
+	updatedAt, err := s.UpdatedAt()
+	if err != nil {
+		return false, err
+	}
+	if !snapshot.UpdatedAt.After(updatedAt) {
+		logger.GetLogger("dedups3").Debugf("site iam snapshot %s is not newer than local %s", snapshot.UpdatedAt, updatedAt)
+		return false, nil
+	}
+
+	txn, err := s.conf.TxnBegin()
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to initialize kvconfig txn: %v", err)
+		return false, fmt.Errorf("failed to initialize kvconfig txn: %w", err)
+	}
+	defer func() {
+		if txn != "" && s.conf != nil {
+			_ = s.conf.TxnRollback(txn)
+		}
+	}()
+
+	for _, prefix := range sitePrefixes {
+		items, _, err := s.conf.TxnListKv(txn, prefix, "", 0, json.RawMessage{})
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to list %s: %v", prefix, err)
+			return false, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		for k := range items {
+			if _, ok := snapshot.Entries[k]; ok || k == ACCESSKEY_PREFIX+keepAccessKey {
+				continue
+			}
+			if err := s.conf.TxnDelKv(txn, k); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to delete %s: %v", k, err)
+				return false, fmt.Errorf("failed to delete %s: %w", k, err)
+			}
+		}
+	}
+	for k, v := range snapshot.Entries {
+		if err := s.conf.TxnSetKv(txn, k, v); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to set %s: %v", k, err)
+			return false, fmt.Errorf("failed to set %s: %w", k, err)
+		}
+	}
+	// 修改时间与对端保持一致，避免同一份数据被来回同步
+	if err := s.conf.TxnSetKv(txn, IAM_MTIME_KEY, snapshot.UpdatedAt); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set iam mtime: %v", err)
+		return false, fmt.Errorf("failed to set iam mtime: %w", err)
+	}
+	if err := s.conf.TxnCommit(txn); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit transaction: %v", err)
+		return false, err
+	}
+	txn = ""
+
+	logger.GetLogger("dedups3").Infof("import site iam snapshot updated at %s with %d entries", snapshot.UpdatedAt, len(snapshot.Entries))
+	return true, nil
+}
@@ -0,0 +1,433 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/plugs/kv"
+)
+
+const (
+	keyPrefix = "aws:kms:key:"
+	// DefaultKeyID 账户默认的 KMS 密钥，SSE-KMS 没有指定密钥时使用，第一次使用时自动创建
+	DefaultKeyID = "aws/s3"
+
+	keyMaterialSize = 32
+)
+
+var (
+	ErrKeyNotFound = errors.New("kms key not found")
+	ErrKeyExists   = errors.New("kms key already exists")
+	ErrKeyDisabled = errors.New("kms key is disabled")
+	ErrInvalidKey  = errors.New("invalid kms key id")
+
+	keyIDRegex  = regexp.MustCompile(`^[a-zA-Z0-9/_-]{1,256}$`)
+	keyARNRegex = regexp.MustCompile(`^arn:aws:kms:[^:]*:[^:]*:key/(.+)$`)
+)
+
+// KeyVersion KMS 密钥的一个版本，密钥材料由主密钥包装后保存
+type KeyVersion struct {
+	Version     int       `json:"version"`
+	MasterKeyID string    `json:"masterKeyId"`
+	Material    []byte    `json:"material"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Key 账户下的 KMS 密钥，用于包装对象的数据密钥
+// 轮换只增加新版本，旧版本保留用于解密；禁用后该密钥包装的对象都无法读取
+type Key struct {
+	AccountID   string       `json:"accountId"`
+	KeyID       string       `json:"keyId"`
+	Description string       `json:"description"`
+	Enabled     bool         `json:"enabled"`
+	Versions    []KeyVersion `json:"versions"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// CurrentVersion 当前使用的密钥版本号
+func (k *Key) CurrentVersion() int {
+	if len(k.Versions) == 0 {
+		return 0
+	}
+	return k.Versions[len(k.Versions)-1].Version
+}
+
+// ARN 密钥的 ARN
+func (k *Key) ARN() string {
+	return KeyARN(k.AccountID, k.KeyID)
+}
+
+// KeyARN 生成 KMS 密钥的 ARN，响应头中返回的密钥ID使用这个格式
+func KeyARN(accountID, keyID string) string {
+	return "arn:aws:kms:us-east-1:" + accountID + ":key/" + keyID
+}
+
+// NormalizeKeyID 把客户端传入的密钥 ARN 转换为密钥ID
+func NormalizeKeyID(keyID string) (string, error) {
+	keyID = strings.TrimSpace(keyID)
+	if m := keyARNRegex.FindStringSubmatch(keyID); m != nil {
+		keyID = m[1]
+	}
+	if !keyIDRegex.MatchString(keyID) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidKey, keyID)
+	}
+	return keyID, nil
+}
+
+func genKMSKey(accountID, keyID string) string {
+	return keyPrefix + accountID + ":" + keyID
+}
+
+// newKeyVersion 生成新的密钥材料并用当前主密钥包装
+func (k *KMSService) newKeyVersion(accountID, keyID string, version int) (*KeyVersion, error) {
+	material := make([]byte, keyMaterialSize)
+	if _, err := rand.Read(material); err != nil {
+		return nil, fmt.Errorf("generate key material: %w", err)
+	}
+	masterKeyID, wrapped, err := k.WrapDataKey(material, keyMaterialContext(accountID, keyID, version))
+	if err != nil {
+		return nil, err
+	}
+	return &KeyVersion{
+		Version:     version,
+		MasterKeyID: masterKeyID,
+		Material:    wrapped,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+func keyMaterialContext(accountID, keyID string, version int) string {
+	return accountID + "/" + keyID + "/" + strconv.Itoa(version)
+}
+
+// CreateKey 在账户下创建 KMS 密钥
+func (k *KMSService) CreateKey(accountID, keyID, description string) (*Key, error) {
+	keyID, err := NormalizeKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	kv1, err := k.newKeyVersion(accountID, keyID, 1)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	key := &Key{
+		AccountID:   accountID,
+		KeyID:       keyID,
+		Description: description,
+		Enabled:     true,
+		Versions:    []KeyVersion{*kv1},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	txn, err := k.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+	if err := txn.SetNX(genKMSKey(accountID, keyID), key); err != nil {
+		if errors.Is(err, kv.ErrKeyExists) {
+			return nil, fmt.Errorf("%w: %s", ErrKeyExists, keyID)
+		}
+		return nil, fmt.Errorf("save kms key %s: %w", keyID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit kms key %s: %w", keyID, err)
+	}
+	logger.GetLogger("dedups3").Infof("account %s create kms key %s", accountID, keyID)
+	return key, nil
+}
+
+// GetKey 获取账户下的 KMS 密钥
+func (k *KMSService) GetKey(accountID, keyID string) (*Key, error) {
+	keyID, err := NormalizeKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	var key Key
+	exists, err := k.kvstore.Get(genKMSKey(accountID, keyID), &key)
+	if err != nil {
+		return nil, fmt.Errorf("read kms key %s: %w", keyID, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	return &key, nil
+}
+
+// ListKeys 列出账户下所有 KMS 密钥
+func (k *KMSService) ListKeys(accountID string) ([]*Key, error) {
+	txn, err := k.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	prefix := keyPrefix + accountID + ":"
+	keys := make([]*Key, 0)
+	startKey := ""
+	for {
+		names, nextKey, err := txn.Scan(prefix, startKey, 100)
+		if err != nil {
+			return nil, fmt.Errorf("scan kms keys: %w", err)
+		}
+		for _, name := range names {
+			var key Key
+			exists, err := txn.Get(name, &key)
+			if err != nil || !exists {
+				continue
+			}
+			keys = append(keys, &key)
+		}
+		if nextKey == "" || len(names) == 0 {
+			return keys, nil
+		}
+		startKey = nextKey
+	}
+}
+
+// updateKey 在事务中修改 KMS 密钥
+func (k *KMSService) updateKey(accountID, keyID string, fn func(key *Key) error) (*Key, error) {
+	keyID, err := NormalizeKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := k.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	var key Key
+	exists, err := txn.Get(genKMSKey(accountID, keyID), &key)
+	if err != nil {
+		return nil, fmt.Errorf("read kms key %s: %w", keyID, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	if err := fn(&key); err != nil {
+		return nil, err
+	}
+	key.UpdatedAt = time.Now().UTC()
+	if err := txn.Set(genKMSKey(accountID, keyID), &key); err != nil {
+		return nil, fmt.Errorf("save kms key %s: %w", keyID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit kms key %s: %w", keyID, err)
+	}
+	return &key, nil
+}
+
+// SetKeyEnabled 启用或禁用 KMS 密钥
+func (k *KMSService) SetKeyEnabled(accountID, keyID string, enabled bool) (*Key, error) {
+	key, err := k.updateKey(accountID, keyID, func(key *Key) error {
+		key.Enabled = enabled
+		return nil
+	})
+	if err == nil {
+		logger.GetLogger("dedups3").Infof("account %s set kms key %s enabled %v", accountID, keyID, enabled)
+	}
+	return key, err
+}
+
+// RotateKey 轮换 KMS 密钥，新的数据密钥使用新版本包装，旧版本包装的数据密钥仍然可以解开
+func (k *KMSService) RotateKey(accountID, keyID string) (*Key, error) {
+	key, err := k.updateKey(accountID, keyID, func(key *Key) error {
+		v, err := k.newKeyVersion(key.AccountID, key.KeyID, key.CurrentVersion()+1)
+		if err != nil {
+			return err
+		}
+		key.Versions = append(key.Versions, *v)
+		return nil
+	})
+	if err == nil {
+		logger.GetLogger("dedups3").Infof("account %s rotate kms key %s to version %d", accountID, keyID, key.CurrentVersion())
+	}
+	return key, err
+}
+
+// keyMaterial 解开 KMS 密钥指定版本的密钥材料，version 为 0 时使用当前版本
+func (k *KMSService) keyMaterial(key *Key, version int) (int, []byte, error) {
+	if !key.Enabled {
+		return 0, nil, fmt.Errorf("%w: %s", ErrKeyDisabled, key.KeyID)
+	}
+	if version == 0 {
+		version = key.CurrentVersion()
+	}
+	for _, v := range key.Versions {
+		if v.Version != version {
+			continue
+		}
+		material, err := k.UnwrapDataKey(v.MasterKeyID, v.Material, keyMaterialContext(key.AccountID, key.KeyID, v.Version))
+		if err != nil {
+			return 0, nil, err
+		}
+		return version, material, nil
+	}
+	return 0, nil, fmt.Errorf("%w: %s version %d", ErrKeyNotFound, key.KeyID, version)
+}
+
+// GenerateObjectKey 生成对象的数据密钥，返回明文密钥、密钥版本和用 KMS 密钥包装后的密钥
+func (k *KMSService) GenerateObjectKey(accountID, keyID, context string) ([]byte, int, []byte, error) {
+	plain := make([]byte, dataKeySize)
+	if _, err := rand.Read(plain); err != nil {
+		return nil, 0, nil, fmt.Errorf("generate data key: %w", err)
+	}
+	version, wrapped, err := k.EncryptObjectKey(accountID, keyID, plain, context)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return plain, version, wrapped, nil
+}
+
+// EncryptObjectKey 用 KMS 密钥的当前版本包装已有的数据密钥，复制对象时复用源对象的数据密钥
+// 使用账户默认密钥时，密钥不存在会自动创建
+func (k *KMSService) EncryptObjectKey(accountID, keyID string, plain []byte, context string) (int, []byte, error) {
+	key, err := k.GetKey(accountID, keyID)
+	if errors.Is(err, ErrKeyNotFound) && keyID == DefaultKeyID {
+		key, err = k.CreateKey(accountID, keyID, "default key for SSE-KMS")
+		if errors.Is(err, ErrKeyExists) {
+			key, err = k.GetKey(accountID, keyID)
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	version, material, err := k.keyMaterial(key, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	wrapped, err := utils.EncryptWithKey(plain, material, []byte(context))
+	if err != nil {
+		return 0, nil, fmt.Errorf("wrap data key with kms key %s: %w", keyID, err)
+	}
+	return version, wrapped, nil
+}
+
+// DecryptObjectKey 用 KMS 密钥解开对象的数据密钥，密钥被禁用时返回 ErrKeyDisabled
+func (k *KMSService) DecryptObjectKey(accountID, keyID string, version int, wrapped []byte, context string) ([]byte, error) {
+	key, err := k.GetKey(accountID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	_, material, err := k.keyMaterial(key, version)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := utils.DecryptWithKey(wrapped, material, []byte(context))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with kms key %s: %w", keyID, err)
+	}
+	return plain, nil
+}
+
+// RewrapKeys 把旧主密钥包装的 KMS 密钥材料改用当前主密钥包装，返回重新包装的密钥数
+// 有密钥重新包装失败时返回错误，此时旧主密钥仍在使用，不能从配置中删除
+func (k *KMSService) RewrapKeys() (int, error) {
+	currentKeyID := k.CurrentKeyID()
+	count, failed := 0, 0
+	startKey := ""
+	for {
+		names, nextKey, err := k.scanKeys(startKey)
+		if err != nil {
+			return count, err
+		}
+		for _, name := range names {
+			done, err := k.rewrapKey(name, currentKeyID)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("rewrap kms key %s failed: %v", name, err)
+				failed++
+				continue
+			}
+			if done {
+				count++
+			}
+		}
+		if nextKey == "" || len(names) == 0 {
+			break
+		}
+		startKey = nextKey
+	}
+	if failed > 0 {
+		return count, fmt.Errorf("%d kms keys failed to rewrap", failed)
+	}
+	return count, nil
+}
+
+func (k *KMSService) scanKeys(startKey string) ([]string, string, error) {
+	txn, err := k.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+	names, nextKey, err := txn.Scan(keyPrefix, startKey, 100)
+	if err != nil {
+		return nil, "", fmt.Errorf("scan kms keys: %w", err)
+	}
+	return names, nextKey, nil
+}
+
+// rewrapKey 重新包装一个 KMS 密钥所有版本的密钥材料，返回 true 表示有更新
+func (k *KMSService) rewrapKey(name, currentKeyID string) (bool, error) {
+	txn, err := k.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	var key Key
+	exists, err := txn.Get(name, &key)
+	if err != nil || !exists {
+		return false, err
+	}
+	changed := false
+	for i := range key.Versions {
+		v := &key.Versions[i]
+		if v.MasterKeyID == currentKeyID {
+			continue
+		}
+		masterKeyID, wrapped, err := k.RewrapDataKey(v.MasterKeyID, v.Material, keyMaterialContext(key.AccountID, key.KeyID, v.Version))
+		if err != nil {
+			return false, err
+		}
+		v.MasterKeyID, v.Material = masterKeyID, wrapped
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := txn.Set(name, &key); err != nil {
+		return false, fmt.Errorf("save kms key %s: %w", key.KeyID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return false, fmt.Errorf("commit kms key %s: %w", key.KeyID, err)
+	}
+	return true, nil
+}
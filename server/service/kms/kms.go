@@ -0,0 +1,256 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/plugs/kv"
+)
+
+const (
+	// MasterKeyEnv 主密钥环境变量，优先级最高
+	MasterKeyEnv = "DEDUPS3_KMS_MASTER_KEY"
+	// autoMasterKey 没有配置主密钥时自动生成的主密钥，保存在元数据中
+	autoMasterKey = "aws:kms:masterkey"
+
+	masterKeySize = 32
+	dataKeySize   = 32
+)
+
+var (
+	ErrMasterKeyNotFound = errors.New("master key not found")
+
+	instance *KMSService
+	mu       = sync.Mutex{}
+)
+
+// MasterKey 用于包装数据密钥的主密钥
+type MasterKey struct {
+	ID  string `json:"id"`
+	Key []byte `json:"key"`
+}
+
+// KMSService 密钥管理，数据密钥随机生成，由主密钥包装后和数据一起保存
+type KMSService struct {
+	kvstore kv.KVStore
+	mutex   sync.RWMutex
+	current *MasterKey
+	keys    map[string]*MasterKey
+}
+
+// GetKMSService 获取全局密钥管理服务实例
+func GetKMSService() *KMSService {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance
+	}
+	kvStore, err := kv.GetKvStore()
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get kv store for kms: %v", err)
+		return nil
+	}
+	k := &KMSService{
+		kvstore: kvStore,
+		keys:    make(map[string]*MasterKey),
+	}
+	if err := k.loadMasterKeys(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to load kms master keys: %v", err)
+		return nil
+	}
+	instance = k
+	logger.GetLogger("dedups3").Infof("kms service initialized with master key %s", k.current.ID)
+	return instance
+}
+
+// ParseMasterKey 解析 keyID:base64 格式的主密钥
+func ParseMasterKey(s string) (*MasterKey, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.Index(s, ":")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid master key format, want keyID:base64")
+	}
+	key, err := base64.StdEncoding.DecodeString(s[idx+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key %s: %w", s[:idx], err)
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("invalid master key %s: want %d bytes, got %d", s[:idx], masterKeySize, len(key))
+	}
+	return &MasterKey{ID: s[:idx], Key: key}, nil
+}
+
+// loadMasterKeys 加载当前主密钥和旧主密钥
+func (k *KMSService) loadMasterKeys() error {
+	cfg := xconf.Get()
+
+	current := os.Getenv(MasterKeyEnv)
+	if current == "" && cfg.KMS.MasterKeyFile != "" {
+		data, err := os.ReadFile(cfg.KMS.MasterKeyFile)
+		if err != nil {
+			return fmt.Errorf("read master key file %s: %w", cfg.KMS.MasterKeyFile, err)
+		}
+		current = string(data)
+	}
+	if current == "" {
+		current = cfg.KMS.MasterKey
+	}
+
+	for _, s := range cfg.KMS.OldMasterKeys {
+		mk, err := ParseMasterKey(s)
+		if err != nil {
+			return err
+		}
+		k.keys[mk.ID] = mk
+	}
+
+	// 自动生成的主密钥一直保留，以便配置主密钥后旧数据仍然可以解密
+	auto, err := k.loadAutoMasterKey(current == "")
+	if err != nil {
+		return err
+	}
+	if auto != nil {
+		k.keys[auto.ID] = auto
+	}
+
+	if current == "" {
+		logger.GetLogger("dedups3").Warnf("no kms master key configured, using generated master key %s stored with metadata", auto.ID)
+		k.current = auto
+		return nil
+	}
+	mk, err := ParseMasterKey(current)
+	if err != nil {
+		return err
+	}
+	if old, ok := k.keys[mk.ID]; ok && string(old.Key) != string(mk.Key) {
+		return fmt.Errorf("master key id %s is used by different keys", mk.ID)
+	}
+	k.keys[mk.ID] = mk
+	k.current = mk
+	return nil
+}
+
+// loadAutoMasterKey 读取自动生成的主密钥，create 为 true 时不存在则生成
+func (k *KMSService) loadAutoMasterKey(create bool) (*MasterKey, error) {
+	var mk MasterKey
+	exists, err := k.kvstore.Get(autoMasterKey, &mk)
+	if err != nil && !exists {
+		return nil, fmt.Errorf("read auto master key: %w", err)
+	}
+	if exists {
+		return &mk, nil
+	}
+	if !create {
+		return nil, nil
+	}
+
+	key := make([]byte, masterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate master key: %w", err)
+	}
+	mk = MasterKey{ID: "auto-" + time.Now().UTC().Format("20060102150405"), Key: key}
+
+	// 多个节点同时启动时只有一个生成成功，其他节点读取已有的
+	txn, err := k.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin txn: %w", err)
+	}
+	defer txn.Rollback()
+	if err := txn.SetNX(autoMasterKey, &mk); err != nil {
+		if errors.Is(err, kv.ErrKeyExists) {
+			return k.loadAutoMasterKey(false)
+		}
+		return nil, fmt.Errorf("save auto master key: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit auto master key: %w", err)
+	}
+	return &mk, nil
+}
+
+// CurrentKeyID 当前主密钥ID，新的数据密钥都用它包装
+func (k *KMSService) CurrentKeyID() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.current.ID
+}
+
+// GenerateDataKey 生成随机数据密钥，返回明文密钥和用当前主密钥包装后的密钥
+// context 为附加认证数据，解包时必须一致，防止包装后的密钥被挪用到其他数据上
+func (k *KMSService) GenerateDataKey(context string) (plain []byte, keyID string, wrapped []byte, err error) {
+	plain = make([]byte, dataKeySize)
+	if _, err = rand.Read(plain); err != nil {
+		return nil, "", nil, fmt.Errorf("generate data key: %w", err)
+	}
+	keyID, wrapped, err = k.WrapDataKey(plain, context)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return plain, keyID, wrapped, nil
+}
+
+// WrapDataKey 用当前主密钥包装数据密钥
+func (k *KMSService) WrapDataKey(plain []byte, context string) (string, []byte, error) {
+	k.mutex.RLock()
+	current := k.current
+	k.mutex.RUnlock()
+
+	wrapped, err := utils.EncryptWithKey(plain, current.Key, []byte(context))
+	if err != nil {
+		return "", nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	return current.ID, wrapped, nil
+}
+
+// UnwrapDataKey 用 keyID 对应的主密钥解开数据密钥
+func (k *KMSService) UnwrapDataKey(keyID string, wrapped []byte, context string) ([]byte, error) {
+	k.mutex.RLock()
+	mk, ok := k.keys[keyID]
+	k.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMasterKeyNotFound, keyID)
+	}
+	plain, err := utils.DecryptWithKey(wrapped, mk.Key, []byte(context))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with master key %s: %w", keyID, err)
+	}
+	return plain, nil
+}
+
+// RewrapDataKey 把旧主密钥包装的数据密钥改用当前主密钥包装，已经是当前主密钥时原样返回
+func (k *KMSService) RewrapDataKey(keyID string, wrapped []byte, context string) (string, []byte, error) {
+	if keyID == k.CurrentKeyID() {
+		return keyID, wrapped, nil
+	}
+	plain, err := k.UnwrapDataKey(keyID, wrapped, context)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.WrapDataKey(plain, context)
+}
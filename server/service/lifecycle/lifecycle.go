@@ -0,0 +1,601 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/multipart"
+	"github.com/mageg-x/dedups3/service/object"
+)
+
+const (
+	LIFECYCLE_PREKEY = "aws:lifecycle:"
+
+	lifecycleProgressKey = LIFECYCLE_PREKEY + "progress"
+	lifecycleStatsPrefix = LIFECYCLE_PREKEY + "stats:"
+	lifecycleLockKey     = "aws:lock:lifecycle"
+	lifecycleLockOwner   = "LifecycleService"
+
+	// DefaultLifecycleScanInterval 两轮扫描之间的间隔
+	DefaultLifecycleScanInterval = time.Hour
+	// DefaultLifecycleBatchInterval 两批处理之间的间隔
+	DefaultLifecycleBatchInterval = 100 * time.Millisecond
+	// DefaultLifecycleBatchSize 每批处理的 key 数量
+	DefaultLifecycleBatchSize = 100
+
+	// 每个桶依次扫描的阶段
+	PhaseObjects  = "objects"  // 当前版本：过期、转换存储类别
+	PhaseVersions = "versions" // 历史版本：清理过期的删除标记
+	PhaseUploads  = "uploads"  // 未完成的分段上传
+)
+
+var (
+	instance *LifecycleService
+	mu       = sync.Mutex{}
+)
+
+// Progress 扫描进度，持久化在 kv 中，服务重启后从游标处继续
+type Progress struct {
+	BucketKey      string    `json:"bucketKey"`      // 当前处理的桶
+	Phase          string    `json:"phase"`          // 当前处理的阶段
+	NextKey        string    `json:"nextKey"`        // 当前阶段下一次扫描的起始 key
+	RoundStartAt   time.Time `json:"roundStartAt"`   // 本轮开始时间
+	LastRoundAt    time.Time `json:"lastRoundAt"`    // 上一轮完成时间
+	Rounds         int64     `json:"rounds"`         // 完成的轮数
+	ScannedBuckets int64     `json:"scannedBuckets"` // 本轮已扫描的桶数量
+	ScannedKeys    int64     `json:"scannedKeys"`    // 本轮已扫描的 key 数量
+	UpdateAt       time.Time `json:"updateAt"`
+}
+
+// RuleStats 单条规则的执行统计
+type RuleStats struct {
+	Expired             int64     `json:"expired"`             // 过期的当前版本
+	DeleteMarkerRemoved int64     `json:"deleteMarkerRemoved"` // 清理的删除标记
+	UploadAborted       int64     `json:"uploadAborted"`       // 中止的分段上传
+	Transitioned        int64     `json:"transitioned"`        // 转换存储类别的对象
+	Skipped             int64     `json:"skipped"`             // 被锁定或已被修改而跳过的对象
+	Failed              int64     `json:"failed"`              // 执行失败的次数
+	LastActionAt        time.Time `json:"lastActionAt"`
+}
+
+// BucketStats 桶内所有规则的执行统计，key 为规则 ID
+type BucketStats struct {
+	Bucket   string                `json:"bucket"`
+	Rules    map[string]*RuleStats `json:"rules"`
+	UpdateAt time.Time             `json:"updateAt"`
+}
+
+type LifecycleService struct {
+	running atomic.Bool
+	kvstore kv.KVStore
+	mutex   sync.Mutex
+}
+
+// GetLifecycleService 获取全局生命周期服务实例
+func GetLifecycleService() *LifecycleService {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance
+	}
+	logger.GetLogger("dedups3").Infof("initializing lifecycle service")
+	kvStore, err := kv.GetKvStore()
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get kv store for lifecycle: %v", err)
+		return nil
+	}
+	instance = &LifecycleService{
+		kvstore: kvStore,
+		running: atomic.Bool{},
+		mutex:   sync.Mutex{},
+	}
+	logger.GetLogger("dedups3").Infof("lifecycle service initialized successfully")
+	return instance
+}
+
+// Start 启动生命周期服务
+func (l *LifecycleService) Start() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.running.Load() {
+		logger.GetLogger("dedups3").Infof("lifecycle service is already running")
+		return nil
+	}
+
+	l.running.Store(true)
+
+	go l.loop()
+	logger.GetLogger("dedups3").Infof("lifecycle service started successfully")
+	return nil
+}
+
+// Stop 停止生命周期服务
+func (l *LifecycleService) Stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.running.Store(false)
+	logger.GetLogger("dedups3").Infof("lifecycle service stopped successfully")
+}
+
+// GetProgress 获取扫描进度
+func (l *LifecycleService) GetProgress() (*Progress, error) {
+	progress := &Progress{}
+	if _, err := l.kvstore.Get(lifecycleProgressKey, progress); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get lifecycle progress: %v", err)
+		return nil, err
+	}
+	return progress, nil
+}
+
+// ListBucketStats 获取账户下所有桶的规则执行统计
+func (l *LifecycleService) ListBucketStats(accountID string) ([]*BucketStats, error) {
+	txn, err := l.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin txn: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	prefix := lifecycleStatsPrefix + accountID + ":"
+	result := make([]*BucketStats, 0)
+	nk := ""
+	for {
+		keys, next, err := txn.Scan(prefix, nk, 1000)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to scan lifecycle stats: %v", err)
+			return nil, fmt.Errorf("failed to scan lifecycle stats: %w", err)
+		}
+		for _, k := range keys {
+			var bs BucketStats
+			if exists, err := txn.Get(k, &bs); err != nil || !exists {
+				continue
+			}
+			result = append(result, &bs)
+		}
+		if next == "" || len(keys) == 0 {
+			break
+		}
+		nk = next
+	}
+	return result, nil
+}
+
+func (l *LifecycleService) loop() {
+	for l.running.Load() {
+		done, err := l.runBatch()
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("lifecycle batch failed: %v", err)
+		}
+		if done || err != nil {
+			time.Sleep(time.Minute)
+		} else {
+			time.Sleep(DefaultLifecycleBatchInterval)
+		}
+	}
+}
+
+// runBatch 处理一批 key 并保存进度，返回 true 表示本轮已经结束或无事可做
+func (l *LifecycleService) runBatch() (bool, error) {
+	// 多个节点共享进度，同一时间只允许一个节点执行
+	if ok, _ := l.kvstore.TryLock(lifecycleLockKey, lifecycleLockOwner, 30*time.Minute); !ok {
+		return true, nil
+	}
+	defer l.kvstore.UnLock(lifecycleLockKey, lifecycleLockOwner)
+
+	progress, err := l.GetProgress()
+	if err != nil {
+		return true, err
+	}
+
+	// 开始新的一轮
+	if progress.BucketKey == "" {
+		if time.Since(progress.LastRoundAt) < DefaultLifecycleScanInterval {
+			return true, nil
+		}
+		progress.RoundStartAt = time.Now().UTC()
+		progress.ScannedBuckets = 0
+		progress.ScannedKeys = 0
+		if err := l.nextBucket(progress, ""); err != nil {
+			return true, err
+		}
+		if progress.BucketKey == "" {
+			return true, l.finishRound(progress)
+		}
+		logger.GetLogger("dedups3").Infof("lifecycle round %d started", progress.Rounds+1)
+	}
+
+	var bucket meta.BucketMetadata
+	exists, err := l.kvstore.Get(progress.BucketKey, &bucket)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get bucket %s: %v", progress.BucketKey, err)
+		return true, err
+	}
+
+	stats := make(map[string]*RuleStats)
+	next := ""
+	if exists && hasEnabledRule(bucket.Lifecycle) {
+		switch progress.Phase {
+		case PhaseObjects:
+			next, err = l.processObjects(&bucket, progress, stats)
+		case PhaseVersions:
+			next, err = l.processVersions(&bucket, progress, stats)
+		case PhaseUploads:
+			next, err = l.processUploads(&bucket, progress, stats)
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+
+	// 当前阶段结束，进入下一个阶段或下一个桶
+	progress.NextKey = next
+	if next == "" {
+		switch {
+		case exists && progress.Phase == PhaseObjects:
+			progress.Phase = PhaseVersions
+		case exists && progress.Phase == PhaseVersions:
+			progress.Phase = PhaseUploads
+		default:
+			progress.ScannedBuckets++
+			if err := l.nextBucket(progress, progress.BucketKey+"\x00"); err != nil {
+				return true, err
+			}
+		}
+	}
+
+	if err := l.saveProgress(progress, bucket.Owner.ID, bucket.Name, stats); err != nil {
+		return true, err
+	}
+	if progress.BucketKey == "" {
+		return true, l.finishRound(progress)
+	}
+	return false, nil
+}
+
+// nextBucket 把游标移动到 startKey 之后第一个配置了生命周期规则的桶
+func (l *LifecycleService) nextBucket(progress *Progress, startKey string) error {
+	txn, err := l.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin txn: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	progress.BucketKey = ""
+	progress.Phase = PhaseObjects
+	progress.NextKey = ""
+	nk := startKey
+	for {
+		keys, next, err := txn.Scan("aws:bucket:", nk, DefaultLifecycleBatchSize)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to scan buckets: %v", err)
+			return fmt.Errorf("failed to scan buckets: %w", err)
+		}
+		values, err := txn.BatchGet(keys)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to batch get buckets: %v", err)
+			return fmt.Errorf("failed to batch get buckets: %w", err)
+		}
+		for _, k := range keys {
+			var bucket meta.BucketMetadata
+			if data, ok := values[k]; !ok || json.Unmarshal(data, &bucket) != nil {
+				continue
+			}
+			if hasEnabledRule(bucket.Lifecycle) {
+				progress.BucketKey = k
+				return nil
+			}
+			progress.ScannedBuckets++
+		}
+		if next == "" || len(keys) == 0 {
+			return nil
+		}
+		nk = next
+	}
+}
+
+// processObjects 处理一批当前版本：先检查过期，再检查存储类别转换
+func (l *LifecycleService) processObjects(bucket *meta.BucketMetadata, progress *Progress, stats map[string]*RuleStats) (string, error) {
+	prefix := "aws:object:" + bucket.Owner.ID + ":" + bucket.Name + "/"
+	objs, next, err := l.scanObjects(prefix, progress.NextKey)
+	if err != nil {
+		return "", err
+	}
+	progress.ScannedKeys += int64(len(objs))
+
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		return "", errors.New("failed to get object service")
+	}
+	cfg := bucket.Lifecycle
+	for _, obj := range objs {
+		if rule := cfg.FindExpirationRule(obj.Key, obj.Tags, obj.LastModified, false); rule != nil {
+			_, err := objSvc.ExpireObject(bucket, obj)
+			ruleStats(stats, rule).record(err, func(s *RuleStats) { s.Expired++ })
+			if err != nil {
+				logger.GetLogger("dedups3").Warnf("lifecycle rule %s expire %s/%s failed: %v", rule.ID, bucket.Name, obj.Key, err)
+			} else {
+				logger.GetLogger("dedups3").Infof("lifecycle rule %s expired %s/%s", rule.ID, bucket.Name, obj.Key)
+			}
+			continue
+		}
+		if rule := cfg.FindTransitionRule(obj.Key, obj.Tags, obj.LastModified); rule != nil && obj.StorageClass != rule.Transition.StorageClass {
+			_, err := objSvc.TransitionObject(bucket, obj, rule.Transition.StorageClass)
+			ruleStats(stats, rule).record(err, func(s *RuleStats) { s.Transitioned++ })
+			if err != nil {
+				logger.GetLogger("dedups3").Warnf("lifecycle rule %s transition %s/%s failed: %v", rule.ID, bucket.Name, obj.Key, err)
+			}
+		}
+	}
+	return next, nil
+}
+
+// processVersions 处理一批历史版本：对象仅剩删除标记且已过期时删除该标记
+func (l *LifecycleService) processVersions(bucket *meta.BucketMetadata, progress *Progress, stats map[string]*RuleStats) (string, error) {
+	if bucket.Versioning == nil || bucket.Versioning.Status == "" {
+		return "", nil
+	}
+	prefix := meta.GenVersionPrefix(bucket.Owner.ID, bucket.Name)
+	versions, next, err := l.scanObjects(prefix, progress.NextKey)
+	if err != nil {
+		return "", err
+	}
+	progress.ScannedKeys += int64(len(versions))
+
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		return "", errors.New("failed to get object service")
+	}
+	for _, version := range versions {
+		if !version.DeleteMarker {
+			continue
+		}
+		rule := bucket.Lifecycle.FindExpirationRule(version.Key, nil, version.LastModified, true)
+		if rule == nil {
+			continue
+		}
+		expired, err := objSvc.IsExpiredDeleteMarker(bucket, version)
+		if err != nil || !expired {
+			continue
+		}
+		_, err = objSvc.RemoveDeleteMarker(bucket, version.Key, version.GetVersionID())
+		ruleStats(stats, rule).record(err, func(s *RuleStats) { s.DeleteMarkerRemoved++ })
+		if err != nil {
+			logger.GetLogger("dedups3").Warnf("lifecycle rule %s remove delete marker %s/%s failed: %v", rule.ID, bucket.Name, version.Key, err)
+		}
+	}
+	return next, nil
+}
+
+// processUploads 处理一批分段上传：超过规则天数的上传被中止
+func (l *LifecycleService) processUploads(bucket *meta.BucketMetadata, progress *Progress, stats map[string]*RuleStats) (string, error) {
+	prefix := "aws:upload:" + bucket.Owner.ID + ":" + bucket.Name + "/"
+	txn, err := l.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin txn: %v", err)
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	keys, next, err := txn.Scan(prefix, progress.NextKey, DefaultLifecycleBatchSize)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to scan multipart uploads: %v", err)
+		return "", fmt.Errorf("failed to scan multipart uploads: %w", err)
+	}
+	progress.ScannedKeys += int64(len(keys))
+	// 跳过分段的元数据，只处理上传任务本身
+	uploadKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts := strings.Split(strings.TrimPrefix(k, prefix), "/")
+		if len(parts) >= 2 && strings.HasPrefix(parts[len(parts)-1], multipart.UID_PREFIX+"-") {
+			uploadKeys = append(uploadKeys, k)
+		}
+	}
+	values, err := txn.BatchGet(uploadKeys)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to batch get multipart uploads: %v", err)
+		return "", fmt.Errorf("failed to batch get multipart uploads: %w", err)
+	}
+
+	ms := multipart.GetMultiPartService()
+	if ms == nil {
+		return "", errors.New("failed to get multipart service")
+	}
+	for _, k := range uploadKeys {
+		var upload meta.MultipartUpload
+		if data, ok := values[k]; !ok || json.Unmarshal(data, &upload) != nil {
+			continue
+		}
+		rule := bucket.Lifecycle.FindAbortUploadRule(upload.Key, upload.Created)
+		if rule == nil {
+			continue
+		}
+		err := ms.AbortUpload(bucket.Owner.ID, bucket.Name, upload.Key, upload.UploadID)
+		ruleStats(stats, rule).record(err, func(s *RuleStats) { s.UploadAborted++ })
+		if err != nil {
+			logger.GetLogger("dedups3").Warnf("lifecycle rule %s abort upload %s/%s/%s failed: %v", rule.ID, bucket.Name, upload.Key, upload.UploadID, err)
+		} else {
+			logger.GetLogger("dedups3").Infof("lifecycle rule %s aborted upload %s/%s/%s", rule.ID, bucket.Name, upload.Key, upload.UploadID)
+		}
+	}
+	return next, nil
+}
+
+// scanObjects 从 startKey 开始读取一批对象元数据
+func (l *LifecycleService) scanObjects(prefix, startKey string) ([]*meta.Object, string, error) {
+	txn, err := l.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin txn: %v", err)
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	keys, next, err := txn.Scan(prefix, startKey, DefaultLifecycleBatchSize)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to scan %s: %v", prefix, err)
+		return nil, "", fmt.Errorf("failed to scan %s: %w", prefix, err)
+	}
+	values, err := txn.BatchGet(keys)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to batch get objects: %v", err)
+		return nil, "", fmt.Errorf("failed to batch get objects: %w", err)
+	}
+	objs := make([]*meta.Object, 0, len(keys))
+	for _, k := range keys {
+		data, ok := values[k]
+		if !ok {
+			continue
+		}
+		var obj meta.Object
+		if err := json.Unmarshal(data, &obj); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to unmarshal object %s: %v", k, err)
+			continue
+		}
+		objs = append(objs, &obj)
+	}
+	if len(keys) == 0 {
+		next = ""
+	}
+	return objs, next, nil
+}
+
+// saveProgress 保存进度，同时累加本批次的规则统计
+func (l *LifecycleService) saveProgress(progress *Progress, accountID, bucketName string, stats map[string]*RuleStats) error {
+	txn, err := l.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin txn: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	if len(stats) > 0 {
+		statsKey := lifecycleStatsPrefix + accountID + ":" + bucketName
+		bs := BucketStats{}
+		if _, err := txn.Get(statsKey, &bs); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to get lifecycle stats %s: %v", statsKey, err)
+			return fmt.Errorf("failed to get lifecycle stats %s: %w", statsKey, err)
+		}
+		bs.Bucket = bucketName
+		if bs.Rules == nil {
+			bs.Rules = make(map[string]*RuleStats)
+		}
+		for id, s := range stats {
+			total := bs.Rules[id]
+			if total == nil {
+				total = &RuleStats{}
+				bs.Rules[id] = total
+			}
+			total.Expired += s.Expired
+			total.DeleteMarkerRemoved += s.DeleteMarkerRemoved
+			total.UploadAborted += s.UploadAborted
+			total.Transitioned += s.Transitioned
+			total.Skipped += s.Skipped
+			total.Failed += s.Failed
+			if s.LastActionAt.After(total.LastActionAt) {
+				total.LastActionAt = s.LastActionAt
+			}
+		}
+		bs.UpdateAt = time.Now().UTC()
+		if err := txn.Set(statsKey, &bs); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to set lifecycle stats %s: %v", statsKey, err)
+			return fmt.Errorf("failed to set lifecycle stats %s: %w", statsKey, err)
+		}
+	}
+
+	progress.UpdateAt = time.Now().UTC()
+	if err := txn.Set(lifecycleProgressKey, progress); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set lifecycle progress: %v", err)
+		return fmt.Errorf("failed to set lifecycle progress: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit txn: %v", err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+	return nil
+}
+
+// finishRound 结束本轮扫描
+func (l *LifecycleService) finishRound(progress *Progress) error {
+	progress.BucketKey = ""
+	progress.Phase = ""
+	progress.NextKey = ""
+	progress.LastRoundAt = time.Now().UTC()
+	progress.Rounds++
+	logger.GetLogger("dedups3").Infof("lifecycle round %d finished: %d buckets %d keys in %s",
+		progress.Rounds, progress.ScannedBuckets, progress.ScannedKeys, progress.LastRoundAt.Sub(progress.RoundStartAt))
+	return l.saveProgress(progress, "", "", nil)
+}
+
+// hasEnabledRule 判断生命周期配置中是否有启用的规则
+func hasEnabledRule(cfg *meta.LifecycleConfiguration) bool {
+	if cfg == nil {
+		return false
+	}
+	for _, rule := range cfg.Rules {
+		if rule.Status == "Enabled" {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleStats 获取规则在本批次的统计，没有 ID 的规则统一记在 "-" 下
+func ruleStats(stats map[string]*RuleStats, rule *meta.LifecycleRule) *RuleStats {
+	id := rule.ID
+	if id == "" {
+		id = "-"
+	}
+	s := stats[id]
+	if s == nil {
+		s = &RuleStats{}
+		stats[id] = s
+	}
+	return s
+}
+
+// record 根据执行结果累加统计，对象被锁定或已被修改的情况算作跳过
+func (s *RuleStats) record(err error, onSuccess func(s *RuleStats)) {
+	s.LastActionAt = time.Now().UTC()
+	switch {
+	case err == nil:
+		onSuccess(s)
+	case errors.Is(err, xhttp.ToError(xhttp.ErrObjectLocked)),
+		errors.Is(err, xhttp.ToError(xhttp.ErrPreconditionFailed)),
+		errors.Is(err, chunk.ErrObjectChanged):
+		s.Skipped++
+	default:
+		s.Failed++
+	}
+}
@@ -17,6 +17,7 @@
 package multipart
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
@@ -40,6 +41,7 @@ import (
 	"github.com/mageg-x/dedups3/service/chunk"
 	"github.com/mageg-x/dedups3/service/storage"
 
+	"github.com/mageg-x/dedups3/internal/checksum"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/utils"
@@ -83,6 +85,7 @@ type CompleteMultipartUploadResult struct {
 	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
 	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
 	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumType      string `xml:"ChecksumType,omitempty"`
 }
 
 type ListPartsResult struct {
@@ -103,6 +106,7 @@ type ListPartsResult struct {
 
 	// Checksum 相关字段（可选，根据需求启用）
 	ChecksumAlgorithm string `xml:"ChecksumAlgorithm,omitempty"`
+	ChecksumType      string `xml:"ChecksumType,omitempty"`
 	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
 	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
 	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
@@ -186,8 +190,13 @@ func (m *MultiPartService) AbortMultipartUpload(params *object.BaseObjectParams)
 		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
 		return xhttp.ToError(xhttp.ErrAccessDenied)
 	}
+	return m.AbortUpload(ak.AccountID, params.BucketName, params.ObjKey, params.UploadID)
+}
+
+// AbortUpload 中止账户下的分段上传，供生命周期等后台服务直接调用
+func (m *MultiPartService) AbortUpload(accountID, bucket, key, uploadID string) error {
 	// 检查分段上传任务是否存在
-	uploadKey := "aws:upload:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey + "/" + params.UploadID
+	uploadKey := "aws:upload:" + accountID + ":" + bucket + "/" + key + "/" + uploadID
 	var upload meta.MultipartUpload
 	exists, err := m.kvstore.Get(uploadKey, &upload)
 	if err != nil {
@@ -265,10 +274,10 @@ func (m *MultiPartService) AbortMultipartUpload(params *object.BaseObjectParams)
 		gckey := gc.GCChunkPrefix + utils.GenUUID()
 		err = txn.Set(gckey, &gcData)
 		if err != nil {
-			logger.GetLogger("dedups3").Errorf("aborted multipart upload %s/%s/%s set gc chunk failed: %v", params.BucketName, params.ObjKey, params.UploadID, err)
-			return fmt.Errorf("aborted multipart upload %s/%s/%s set gc chunk failed: %w", params.BucketName, params.ObjKey, params.UploadID, err)
+			logger.GetLogger("dedups3").Errorf("aborted multipart upload %s/%s/%s set gc chunk failed: %v", bucket, key, uploadID, err)
+			return fmt.Errorf("aborted multipart upload %s/%s/%s set gc chunk failed: %w", bucket, key, uploadID, err)
 		} else {
-			logger.GetLogger("dedups3").Infof("aborted multipart upload %s/%s/%s set gc chunk %s delay to proccess", params.BucketName, params.ObjKey, params.UploadID, gckey)
+			logger.GetLogger("dedups3").Infof("aborted multipart upload %s/%s/%s set gc chunk %s delay to proccess", bucket, key, uploadID, gckey)
 		}
 	}
 
@@ -281,7 +290,7 @@ func (m *MultiPartService) AbortMultipartUpload(params *object.BaseObjectParams)
 	txn = nil
 
 	logger.GetLogger("dedups3").Infof("aborted multipart upload: bucket=%s, key=%s, uploadID=%s",
-		params.BucketName, params.ObjKey, params.UploadID)
+		bucket, key, uploadID)
 
 	return nil
 }
@@ -378,6 +387,25 @@ func (m *MultiPartService) CreateMultipartUpload(headers http.Header, params *ob
 	userMeta, _ := utils.ExtractMetadata(headers)
 	// X-Amz-Tagging
 	tags, _ := utils.ExtractTags(headers)
+	// 对象锁定
+	retention, legalHold, err := object.ParseObjectLockHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	// 服务端加密
+	sseReq, err := object.ParseSSEHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	customerKey, err := object.ParseCustomerKeyHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	// 附加校验和，每个分段都按这个算法计算
+	checksumAlgo, checksumType, err := parseUploadChecksum(headers)
+	if err != nil {
+		return nil, err
+	}
 
 	// 检查bucket是否存在
 	key := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
@@ -387,6 +415,10 @@ func (m *MultiPartService) CreateMultipartUpload(headers http.Header, params *ob
 		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
 		return nil, xhttp.ToError(xhttp.ErrNoSuchBucket)
 	}
+	if (retention != nil || legalHold != nil) && !_bucket.ObjectLock.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s is missing object lock configuration", params.BucketName)
+		return nil, xhttp.ToError(xhttp.ErrInvalidBucketObjectLockConfiguration)
+	}
 
 	// 检查object 是否已经存在
 	key = "aws:object:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey
@@ -450,6 +482,24 @@ func (m *MultiPartService) CreateMultipartUpload(headers http.Header, params *ob
 		UserMetadata:       userMeta,
 		Tags:               tags,
 		Created:            time.Now().UTC(),
+		ChecksumAlgorithm:  checksumAlgo,
+		ChecksumType:       checksumType,
+	}
+	if retention != nil {
+		upload.LockMode = retention.Mode
+		upload.LockRetainUntil = retention.RetainUntilDate
+	}
+	if legalHold != nil {
+		upload.LegalHold = legalHold.IsLegalHoldActive()
+	}
+	// 所有分段共用一个数据密钥，请求没有指定加密方式时使用桶的默认加密配置
+	objKey, err := object.NewObjectKey(ak.AccountID, &_bucket, sseReq, customerKey)
+	if err != nil {
+		return nil, err
+	}
+	if objKey != nil {
+		upload.Encryption = meta.EncryptionInfo{Type: objKey.Algorithm, KMSKey: objKey.KMSKeyID}
+		upload.SSE = objKey.SSE
 	}
 	key = "aws:upload:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey + "/" + uploadID
 
@@ -557,6 +607,22 @@ func (m *MultiPartService) UploadPart(r io.Reader, params *object.BaseObjectPara
 		Initiator:    upload.Initiator,
 		StorageClass: upload.StorageClass,
 	}
+	// 图片、视频、压缩包等已经压缩过的内容写块时不再尝试压缩
+	part.Incompressible = utils.IsCompressedContentType(upload.ContentType)
+	// 分段使用创建上传时生成的数据密钥加密
+	if part.SSEKey, err = uploadDataKey(&upload, params.CustomerKey); err != nil {
+		return nil, err
+	}
+	// 上传声明了校验和算法时每个分段都要计算，分段请求中的算法必须和上传的一致
+	spec := params.Checksum
+	if upload.ChecksumAlgorithm != "" {
+		if spec == nil {
+			spec = &checksum.Spec{Algorithm: upload.ChecksumAlgorithm}
+		} else if spec.Algorithm != upload.ChecksumAlgorithm {
+			logger.GetLogger("dedups3").Errorf("part checksum algorithm %s not match upload %s", spec.Algorithm, upload.ChecksumAlgorithm)
+			return nil, xhttp.ToError(xhttp.ErrInvalidChecksum)
+		}
+	}
 
 	// 进行chunk切分
 	chunker := chunk.GetChunkService()
@@ -565,13 +631,58 @@ func (m *MultiPartService) UploadPart(r io.Reader, params *object.BaseObjectPara
 		return nil, errors.New("failed to get chunk service")
 	}
 
-	err = chunker.DoChunk(r, meta.PartToBaseObject(part), m.WritePartMeta)
+	cr := checksum.NewReader(r, spec)
+	err = chunker.DoChunk(cr, meta.PartToBaseObject(part), m.checksumPartMeta(cr))
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to chunk object: %v", err)
+		if cr.Err() != nil {
+			return nil, cr.Err()
+		}
 		return nil, fmt.Errorf("failed to chunk object: %w", err)
 	}
 	return part, nil
 }
+
+// checksumPartMeta 数据读完后先检查校验和，再写分段元数据
+func (m *MultiPartService) checksumPartMeta(cr *checksum.Reader) chunk.WriteObjCB {
+	return func(cs *chunk.ChunkService, chunks []*meta.Chunk, blocks map[string]*meta.Block, obj *meta.BaseObject) error {
+		if err := cr.Verify(); err != nil {
+			return err
+		}
+		obj.Checksum = cr.Checksum()
+		return m.WritePartMeta(cs, chunks, blocks, obj)
+	}
+}
+
+// parseUploadChecksum 解析创建分段上传时声明的校验和算法和类型
+// 没有指定类型时 CRC64NVME 只能是 FULL_OBJECT，其他算法默认 COMPOSITE；SHA 算法不能合并为整体校验和
+func parseUploadChecksum(headers http.Header) (string, string, error) {
+	algo := checksum.Normalize(headers.Get(xhttp.AmzChecksumAlgo))
+	typ := strings.ToUpper(strings.TrimSpace(headers.Get(xhttp.AmzChecksumType)))
+	if algo == "" {
+		if typ != "" {
+			logger.GetLogger("dedups3").Errorf("checksum type %s without algorithm", typ)
+			return "", "", xhttp.ToError(xhttp.ErrInvalidChecksum)
+		}
+		return "", "", nil
+	}
+	if !checksum.Valid(algo) {
+		logger.GetLogger("dedups3").Errorf("invalid checksum algorithm %s", algo)
+		return "", "", xhttp.ToError(xhttp.ErrInvalidChecksum)
+	}
+	switch {
+	case typ == "" && algo == checksum.CRC64NVME:
+		typ = xhttp.AmzChecksumTypeFullObject
+	case typ == "":
+		typ = xhttp.AmzChecksumTypeComposite
+	case typ == xhttp.AmzChecksumTypeFullObject && checksum.IsCRC(algo):
+	case typ == xhttp.AmzChecksumTypeComposite && algo != checksum.CRC64NVME:
+	default:
+		logger.GetLogger("dedups3").Errorf("checksum type %s not supported by %s", typ, algo)
+		return "", "", xhttp.ToError(xhttp.ErrInvalidChecksum)
+	}
+	return algo, typ, nil
+}
 func (m *MultiPartService) UploadPartCopy(srcBucket, srcObject string, params *object.BaseObjectParams) (*meta.PartObject, error) {
 	iamService := iam.GetIamService()
 	if iamService == nil {
@@ -600,6 +711,15 @@ func (m *MultiPartService) UploadPartCopy(srcBucket, srcObject string, params *o
 		logger.GetLogger("dedups3").Errorf("source object %s does not exist", srcObjKey)
 		return nil, xhttp.ToError(xhttp.ErrNoSuchKey)
 	}
+	// 归档的源对象只能从恢复出来的临时副本复制
+	_os := object.GetObjectService()
+	if _os == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get object service")
+		return nil, errors.New("failed to get object service")
+	}
+	if err := _os.ResolveArchived(ak.AccountID, &srcObj); err != nil {
+		return nil, err
+	}
 
 	// 3. 检查目标 upload 是否存在
 	uploadKey := "aws:upload:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey + "/" + params.UploadIDMarker
@@ -633,6 +753,23 @@ func (m *MultiPartService) UploadPartCopy(srcBucket, srcObject string, params *o
 		Initiator:    upload.Initiator,
 		StorageClass: upload.StorageClass,
 	}
+	// 源对象整体的校验和就是分段的校验和
+	if c := srcObj.Checksum; c != nil && c.Type == xhttp.AmzChecksumTypeFullObject && c.Algorithm == upload.ChecksumAlgorithm {
+		part.Checksum = &meta.Checksum{Algorithm: c.Algorithm, Value: c.Value}
+	}
+
+	// 源对象或上传加密时数据不能共用，按上传的数据密钥重新写入
+	if srcObj.SSEKey, err = object.DecryptObjectKey(srcObj.Owner.ID, srcObj.EncryptionType, srcObj.SSE, params.SourceCustomerKey); err != nil {
+		return nil, err
+	}
+	sseKey, err := uploadDataKey(&upload, params.CustomerKey)
+	if err != nil {
+		return nil, err
+	}
+	// 限定去重范围的源对象 chunk 不能直接共用，重新写入后在上传的去重范围内去重
+	if srcObj.SSE != nil || upload.SSE != nil || srcObj.DedupScope != "" {
+		return m.rewritePart(&srcObj, &upload, part, sseKey)
+	}
 
 	// 只支持同源复制
 	if srcObj.DataLocation == upload.DataLocation {
@@ -682,6 +819,65 @@ func (m *MultiPartService) UploadPartCopy(srcBucket, srcObject string, params *o
 	return part, nil
 }
 
+// uploadDataKey 解开上传的数据密钥，SSE-C 上传的每个分段请求都要提供创建时的客户密钥
+func uploadDataKey(upload *meta.MultipartUpload, ck *object.CustomerKey) ([]byte, error) {
+	if upload.SSE.IsCustomerKey() && ck == nil {
+		return nil, xhttp.ToError(xhttp.ErrSSEMultipartEncrypted)
+	}
+	return object.DecryptObjectKey(upload.Owner.ID, upload.Encryption.Type, upload.SSE, ck)
+}
+
+// sameDedupKey 两个分段的收敛加密范围密钥是否相同
+// 主密钥轮换后分段中的范围密钥可能被分别重新包装，包装后的密钥不同时比较解开后的密钥
+func sameDedupKey(scope string, a, b *meta.ObjectSSE) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.KeyID == b.KeyID && bytes.Equal(a.DataKey, b.DataKey) {
+		return true
+	}
+	plainA, errA := chunk.OpenScopeKey(scope, a)
+	plainB, errB := chunk.OpenScopeKey(scope, b)
+	return errA == nil && errB == nil && bytes.Equal(plainA, plainB)
+}
+
+// rewritePart 读出源对象的数据，用上传的数据密钥重新切分写入分段
+func (m *MultiPartService) rewritePart(src *meta.Object, upload *meta.MultipartUpload, part *meta.PartObject, sseKey []byte) (*meta.PartObject, error) {
+	_os := object.GetObjectService()
+	chunker := chunk.GetChunkService()
+	if _os == nil || chunker == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get object or chunk service")
+		return nil, errors.New("failed to get object or chunk service")
+	}
+	reader, err := _os.ReadObjectData(src)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	part.Key = fmt.Sprintf("%s/%s/%d", upload.Key, upload.UploadID, part.PartNumber)
+	// 源对象可能是分段上传的，ETag 不是数据的 MD5，清空后由切分重新计算
+	part.ETag = ""
+	part.Chunks = make([]string, 0)
+	part.SSEKey = sseKey
+	part.Incompressible = utils.IsCompressedContentType(upload.ContentType)
+	// 重新读出数据时顺便计算分段的校验和
+	var spec *checksum.Spec
+	if part.Checksum == nil && upload.ChecksumAlgorithm != "" {
+		spec = &checksum.Spec{Algorithm: upload.ChecksumAlgorithm}
+	}
+	cr := checksum.NewReader(reader, spec)
+	writeMeta := m.WritePartMeta
+	if spec != nil {
+		writeMeta = m.checksumPartMeta(cr)
+	}
+	if err := chunker.DoChunk(cr, meta.PartToBaseObject(part), writeMeta); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to copy %s/%s to part %s: %v", src.Bucket, src.Key, part.Key, err)
+		return nil, fmt.Errorf("failed to copy %s/%s to part %s: %w", src.Bucket, src.Key, part.Key, err)
+	}
+	return part, nil
+}
+
 func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, params *object.BaseObjectParams) (*meta.Object, error) {
 	// 参数校验
 	if params.AccessKeyID == "" || params.BucketName == "" || params.ObjKey == "" || params.UploadID == "" || len(cliParts) == 0 {
@@ -714,6 +910,21 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 		logger.GetLogger("dedups3").Errorf("multipart upload not found: %s", uploadKey)
 		return nil, xhttp.ToError(xhttp.ErrNoSuchUpload)
 	}
+	// 请求带了 SSE-C 客户密钥时必须和创建上传时的一致
+	if params.CustomerKey != nil {
+		if err := object.CheckCustomerKey(upload.SSE, params.CustomerKey); err != nil {
+			return nil, err
+		}
+	}
+
+	// 检查bucket是否存在
+	bucketKey := "aws:bucket:" + ak.AccountID + ":" + params.BucketName
+	var bucket meta.BucketMetadata
+	bucketOK, err := m.kvstore.Get(bucketKey, &bucket)
+	if !bucketOK || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", params.BucketName)
+		return nil, xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
 
 	// === 条件检查开始 ===
 	// 获取当前对象是否存在
@@ -744,6 +955,13 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 	}
 	// === 条件检查结束 ===
 
+	// 未开启版本控制时覆盖会删除旧对象，锁定的对象不能被覆盖
+	if existsOldObj && !bucket.Versioning.IsEnabled() {
+		if err := object.CheckObjectLock(&oldObj, false); err != nil {
+			return nil, err
+		}
+	}
+
 	// 开启事务
 	txnReadOnly, err := m.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
 	if err != nil {
@@ -809,6 +1027,10 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 			logger.GetLogger("dedups3").Errorf("part etag not match expected %s, got %s", p.ETag, cliParts[i].ETag)
 			return nil, xhttp.ToError(xhttp.ErrInvalidPart)
 		}
+		if cliParts[i].Checksum != "" && (p.Checksum == nil || p.Checksum.Value != cliParts[i].Checksum) {
+			logger.GetLogger("dedups3").Errorf("part %d checksum not match expected %v, got %s", p.PartNumber, p.Checksum, cliParts[i].Checksum)
+			return nil, xhttp.ToError(xhttp.ErrInvalidPart)
+		}
 		//除了最后一个其他都要大于 5M
 		if i < len(allParts)-1 && p.Size < meta.MIN_PART_SIZE {
 			logger.GetLogger("dedups3").Errorf("the none last part size %d is smaller then %d", p.Size, meta.MIN_PART_SIZE)
@@ -828,6 +1050,7 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 	hash := md5.New()
 	totalSize := int64(0)
 	Chunks := make([]string, 0)
+	parts := make([]meta.ObjectPart, 0, len(allParts))
 
 	for _, p := range allParts {
 		partETag := string(p.ETag)
@@ -838,8 +1061,18 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 			return nil, xhttp.ToError(xhttp.ErrInvalidPart)
 		}
 		hash.Write(binaryMD5)
+		// 分段上传过程中去重范围配置变化时，分段的 chunk 无法组成同一个对象
+		if p.DedupScope != allParts[0].DedupScope || !sameDedupKey(p.DedupScope, p.DedupKey, allParts[0].DedupKey) {
+			logger.GetLogger("dedups3").Errorf("part %d dedup scope %s differs from part 1 %s", p.PartNumber, p.DedupScope, allParts[0].DedupScope)
+			return nil, xhttp.ToError(xhttp.ErrInvalidPart)
+		}
 		Chunks = append(Chunks, p.Chunks...)
 		totalSize += p.Size
+		objPart := meta.ObjectPart{PartNumber: p.PartNumber, ETag: p.ETag, Size: p.Size}
+		if p.Checksum != nil {
+			objPart.Checksum = p.Checksum.Value
+		}
+		parts = append(parts, objPart)
 	}
 	if totalSize > meta.MAX_OBJECT_SIZE {
 		logger.GetLogger("dedups3").Errorf("too large object for %s/%s", params.ObjKey, params.UploadID)
@@ -849,6 +1082,10 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 	// 生成最终 ETag
 	compositeMD5 := hex.EncodeToString(hash.Sum(nil))
 	finalETag := fmt.Sprintf("%s-%d", compositeMD5, len(allParts))
+	objChecksum, err := uploadChecksum(&upload, allParts, params.Checksum)
+	if err != nil {
+		return nil, err
+	}
 
 	// 构造最终对象
 	obj := &meta.Object{
@@ -861,17 +1098,37 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 			LastModified: time.Now().UTC(),
 			CreatedAt:    upload.Created, // 继承上传创建时间
 			DataLocation: upload.DataLocation,
+			DedupScope:   allParts[0].DedupScope,
+			DedupKey:     allParts[0].DedupKey,
+			Checksum:     objChecksum,
 		},
 		ContentType:        upload.ContentType,
 		ContentEncoding:    upload.ContentEncoding,
 		ContentLanguage:    upload.ContentLanguage,
 		CacheControl:       upload.CacheControl,
 		ContentDisposition: upload.ContentDisposition,
+		EncryptionType:     upload.Encryption.Type,
+		KMSKeyID:           upload.Encryption.KMSKey,
+		SSE:                upload.SSE,
 		StorageClass:       upload.StorageClass,
 		UserMetadata:       upload.UserMetadata,
 		Tags:               upload.Tags,
+		Parts:              parts,
 		Owner:              upload.Owner,
 	}
+	obj.VersionID = bucket.NewVersionID()
+	// 对象锁定，创建上传时没有指定则使用桶的默认保留规则
+	var retention *meta.Retention
+	if upload.LockMode != "" {
+		retention = &meta.Retention{Mode: upload.LockMode, RetainUntilDate: upload.LockRetainUntil}
+	}
+	var legalHold *meta.LegalHold
+	if upload.LegalHold {
+		legalHold = &meta.LegalHold{Status: meta.LegalHoldOn}
+	}
+	if err := object.ApplyObjectLock(&bucket, obj, retention, legalHold); err != nil {
+		return nil, err
+	}
 
 	err = utils.RetryCall(5, func() error {
 		txn, err := m.kvstore.BeginTxn(context.Background(), nil)
@@ -885,8 +1142,27 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 			}
 		}()
 
-		// 保存对象
+		// 如果是覆盖已有的对象，旧对象转为历史版本或回收
 		objKey := "aws:object:" + ak.AccountID + ":" + obj.Bucket + "/" + obj.Key
+		var _oldObj meta.Object
+		existsOldObj, err := txn.Get(objKey, &_oldObj)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to get existing object %s: %v", objKey, err)
+			return fmt.Errorf("failed to get existing object %s: %w", objKey, err)
+		}
+		var old *meta.Object
+		if existsOldObj {
+			old = &_oldObj
+		}
+		gcItems, err := chunk.ArchiveObject(txn, ak.AccountID, old, obj)
+		if err != nil {
+			return err
+		}
+		if err := chunk.AddGCChunks(txn, gcItems); err != nil {
+			return err
+		}
+
+		// 保存对象
 		if err := txn.Set(objKey, obj); err != nil {
 			logger.GetLogger("dedups3").Errorf("failed to save object: %v", err)
 			return fmt.Errorf("failed to save object: %w", err)
@@ -900,26 +1176,6 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 			return fmt.Errorf("failed to delete upload info: %w", err)
 		}
 
-		//如果是覆盖已有的对象，要先删除旧的对象
-		if existsOldObj {
-			gckey := gc.GCChunkPrefix + utils.GenUUID()
-			gcData := gc.GCChunk{
-				GCData: gc.GCData{
-					CreateAt: time.Now().UTC(),
-					Items:    make([]gc.GCItem, 0),
-				},
-			}
-			for _, id := range oldObj.Chunks {
-				gcData.Items = append(gcData.Items, gc.GCItem{StorageID: oldObj.DataLocation, ID: id})
-			}
-
-			err = txn.Set(gckey, &gcData)
-			if err != nil {
-				logger.GetLogger("dedups3").Errorf("%s/%s set gc chunk failed: %v", obj.Bucket, obj.Key, err)
-				return fmt.Errorf("%s/%s set gc chunk failed: %w", obj.Bucket, obj.Key, err)
-			}
-		}
-
 		// 提交事务
 		err = txn.Commit()
 		if err != nil {
@@ -940,6 +1196,47 @@ func (m *MultiPartService) CompleteMultipartUpload(cliParts []meta.PartETag, par
 	return obj, nil
 }
 
+// uploadChecksum 由各分段的校验和计算对象的校验和，有分段没有校验和时对象不带校验和
+// want 是完成请求中带的整个对象的校验和，和计算结果不一致时返回 BadDigest
+func uploadChecksum(upload *meta.MultipartUpload, parts []*meta.PartObject, want *checksum.Spec) (*meta.Checksum, error) {
+	algo := upload.ChecksumAlgorithm
+	if algo == "" {
+		return nil, nil
+	}
+	values := make([]string, 0, len(parts))
+	sizes := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		if p.Checksum == nil || p.Checksum.Algorithm != algo {
+			logger.GetLogger("dedups3").Warnf("upload %s part %d has no %s checksum", upload.UploadID, p.PartNumber, algo)
+			return nil, nil
+		}
+		values = append(values, p.Checksum.Value)
+		sizes = append(sizes, p.Size)
+	}
+
+	typ := upload.ChecksumType
+	var value string
+	var err error
+	if typ == xhttp.AmzChecksumTypeFullObject {
+		value, err = checksum.FullObject(algo, values, sizes)
+	} else {
+		typ = xhttp.AmzChecksumTypeComposite
+		value, err = checksum.Composite(algo, values)
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to compute upload %s checksum: %v", upload.UploadID, err)
+		return nil, xhttp.ToError(xhttp.ErrInvalidPart)
+	}
+	// 客户端算的组合校验和可能不带分段数
+	if want != nil && want.Value != "" {
+		if want.Algorithm != algo || strings.Split(want.Value, "-")[0] != strings.Split(value, "-")[0] {
+			logger.GetLogger("dedups3").Errorf("upload %s checksum mismatch: %s %s:%s", upload.UploadID, want.Algorithm, want.Value, value)
+			return nil, xhttp.ToError(xhttp.ErrBadDigest)
+		}
+	}
+	return &meta.Checksum{Algorithm: algo, Type: typ, Value: value}, nil
+}
+
 func (m *MultiPartService) ListParts(params *object.BaseObjectParams) (*meta.MultipartUpload, []*meta.PartObject, error) {
 	// 验证访问密钥
 	iamService := iam.GetIamService()
@@ -1152,3 +1449,86 @@ func (m *MultiPartService) ListMultipartUploads(params *object.BaseObjectParams)
 	logger.GetLogger("dedups3").Infof("list multipart uploads  %#v", uploads)
 	return uploads, nil
 }
+
+// RewrapUploadKeys 把进行中的分段上传里旧主密钥包装的密钥改用当前主密钥包装，返回更新的上传任务和分段数
+// 上传任务保存 SSE-S3 的数据密钥，分段保存收敛加密的范围密钥副本
+// 有密钥重新包装失败时返回错误，此时旧主密钥仍在使用，不能从配置中删除
+func (m *MultiPartService) RewrapUploadKeys() (int, error) {
+	count, failed := 0, 0
+	startKey := ""
+	for {
+		txn, err := m.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+		if err != nil {
+			return count, fmt.Errorf("failed to begin txn: %w", err)
+		}
+		keys, nextKey, err := txn.Scan("aws:upload:", startKey, 100)
+		_ = txn.Rollback()
+		if err != nil {
+			return count, fmt.Errorf("failed to scan multipart uploads: %w", err)
+		}
+		for _, key := range keys {
+			done, err := m.rewrapUpload(key)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("rewrap multipart upload %s keys failed: %v", key, err)
+				failed++
+				continue
+			}
+			if done {
+				count++
+			}
+		}
+		if nextKey == "" || len(keys) == 0 {
+			break
+		}
+		startKey = nextKey
+	}
+	if failed > 0 {
+		return count, fmt.Errorf("%d multipart uploads or parts failed to rewrap", failed)
+	}
+	return count, nil
+}
+
+// rewrapUpload 重新包装一个上传任务或分段中的密钥，返回 true 表示有更新
+func (m *MultiPartService) rewrapUpload(key string) (bool, error) {
+	txn, err := m.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	// 上传任务 key 的最后一段是上传ID，分段 key 的最后一段是分段编号
+	var value interface{}
+	var done bool
+	segs := strings.Split(key, "/")
+	if strings.HasPrefix(segs[len(segs)-1], UID_PREFIX+"-") {
+		var upload meta.MultipartUpload
+		exists, err := txn.Get(key, &upload)
+		if err != nil || !exists {
+			return false, err
+		}
+		if done, err = object.RewrapObjectKey(upload.Owner.ID, upload.Encryption.Type, upload.SSE); err != nil {
+			return false, err
+		}
+		value = &upload
+	} else {
+		var part meta.PartObject
+		exists, err := txn.Get(key, &part)
+		if err != nil || !exists {
+			return false, err
+		}
+		if done, err = chunk.RewrapScopeKey(part.DedupScope, part.DedupKey); err != nil {
+			return false, err
+		}
+		value = &part
+	}
+	if !done {
+		return false, nil
+	}
+	if err := txn.Set(key, value); err != nil {
+		return false, fmt.Errorf("failed to set multipart upload meta: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit multipart upload meta: %w", err)
+	}
+	return true, nil
+}
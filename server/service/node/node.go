@@ -54,7 +54,8 @@ func GetNodeService() *NodeService {
 	return instance
 }
 
-func (n *NodeService) ReadLocalBlock(storageID, blockID string, offset, length int64) ([]byte, error) {
+// localDiskStore 本节点磁盘上指定存储的块
+func (n *NodeService) localDiskStore(storageID string) (*block.DiskStore, error) {
 	ss := storage.GetStorageService()
 	if ss == nil {
 		logger.GetLogger("dedups3").Errorf("get nil storage service")
@@ -76,5 +77,22 @@ func (n *NodeService) ReadLocalBlock(storageID, blockID string, offset, length i
 		logger.GetLogger("dedups3").Errorf("get nil storage service")
 		return nil, fmt.Errorf("get nil storage")
 	}
+	return ds, nil
+}
+
+func (n *NodeService) ReadLocalBlock(storageID, blockID string, offset, length int64) ([]byte, error) {
+	ds, err := n.localDiskStore(storageID)
+	if err != nil {
+		return nil, err
+	}
 	return ds.ReadLocalBlock(blockID, offset, length)
 }
+
+// LocalBlockSize 本节点磁盘上块的大小
+func (n *NodeService) LocalBlockSize(storageID, blockID string) (int64, error) {
+	ds, err := n.localDiskStore(storageID)
+	if err != nil {
+		return 0, err
+	}
+	return ds.LocalBlockSize(blockID)
+}
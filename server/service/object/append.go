@@ -0,0 +1,278 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mageg-x/dedups3/internal/checksum"
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/stats"
+	"github.com/mageg-x/dedups3/service/storage"
+)
+
+// AppendObject 在对象末尾追加数据，offset 必须等于对象当前的大小，对象不存在时 offset 必须为 0
+// 旧对象的chunk保持不动，只把最后一个chunk和追加的数据一起重新切分，和整个对象重新上传得到的切分结果一致
+// 同一个对象的追加按 key 串行，元数据更新时再检查对象没有被其他节点修改
+func (o *ObjectService) AppendObject(r io.Reader, headers http.Header, params *BaseObjectParams, offset int64) (*meta.Object, error) {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return nil, errors.New("failed to get iam service")
+	}
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	bucket, err := o.getBucket(ak.AccountID, params.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	// 追加会原地修改对象，开启版本控制的桶中版本不可修改
+	if bucket.Versioning.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s versioning enabled, append object is not allowed", params.BucketName)
+		return nil, xhttp.ToError(xhttp.ErrInvalidRequest)
+	}
+	if exceeded, _ := stats.GetStatsService().CheckQuotaExceeded(ak.AccountID); exceeded {
+		logger.GetLogger("dedups3").Errorf("account %s quota exceeded", ak.AccountID)
+		return nil, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)
+	}
+
+	objkey := "aws:object:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey
+	var result *meta.Object
+	err = utils.WithLockKey(objkey, func() error {
+		current, err := o.GetCurrentObject(ak.AccountID, params.BucketName, params.ObjKey)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.DeleteMarker {
+			if offset != 0 {
+				logger.GetLogger("dedups3").Errorf("object %s/%s does not exist, append offset %d", params.BucketName, params.ObjKey, offset)
+				return xhttp.ToError(xhttp.ErrInvalidWriteOffset)
+			}
+			// 第一次追加就是普通上传
+			putParams := *params
+			putParams.IfNoneMatch = "*"
+			result, err = o.PutObject(r, headers, &putParams)
+			if errors.Is(err, xhttp.ToError(xhttp.ErrPreconditionFailed)) {
+				return xhttp.ToError(xhttp.ErrInvalidWriteOffset)
+			}
+			return err
+		}
+		result, err = o.appendObject(objkey, current, r, headers, params, offset)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _stats := stats.GetStatsService(); _stats != nil {
+		_stats.RefreshAccountStats(ak.AccountID)
+	}
+	return result, nil
+}
+
+// appendObject 把追加的数据和旧对象的尾部一起切分，写入新的尾部chunk
+func (o *ObjectService) appendObject(objkey string, current *meta.Object, r io.Reader, headers http.Header, params *BaseObjectParams, offset int64) (*meta.Object, error) {
+	if offset != current.Size {
+		logger.GetLogger("dedups3").Errorf("object %s/%s size %d, append offset %d", current.Bucket, current.Key, current.Size, offset)
+		return nil, xhttp.ToError(xhttp.ErrInvalidWriteOffset)
+	}
+	if meta.IsArchiveClass(current.StorageClass) {
+		logger.GetLogger("dedups3").Errorf("object %s/%s is archived, can not append", current.Bucket, current.Key)
+		return nil, xhttp.ToError(xhttp.ErrInvalidObjectState)
+	}
+	if err := CheckObjectLock(current, false); err != nil {
+		return nil, err
+	}
+	// 追加的数据沿用对象的加密方式，SSE-C 对象需要在请求中带上客户密钥
+	customerKey, err := ParseCustomerKeyHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	if current.SSEKey, err = objectKey(current, customerKey); err != nil {
+		return nil, err
+	}
+
+	cs := chunk.GetChunkService()
+	if cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get chunk service")
+		return nil, errors.New("failed to get chunk service")
+	}
+	keep, tailStart, err := o.appendTail(cs, current)
+	if err != nil {
+		return nil, err
+	}
+
+	// 旧对象从 tailStart 开始的数据和追加的数据一起重新切分
+	tail := io.Reader(bytes.NewReader(nil))
+	if tailStart < current.Size {
+		reader, err := o.readObject(current, tailStart, current.Size-1)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		tail = reader
+	}
+	// 对象有整体的 CRC 校验和时按同样的算法计算追加数据的 CRC，合并后得到新对象的校验和
+	spec := params.Checksum
+	combinable := current.Checksum != nil && current.Checksum.Type == xhttp.AmzChecksumTypeFullObject && checksum.IsCRC(current.Checksum.Algorithm)
+	if spec == nil && combinable {
+		spec = &checksum.Spec{Algorithm: current.Checksum.Algorithm}
+	}
+	cr := checksum.NewReader(r, spec)
+	hasher := md5.New()
+	var appended byteCounter
+	body := io.TeeReader(cr, io.MultiWriter(hasher, &appended))
+
+	newObj := current.Clone()
+	newObj.ETag = ""
+	newObj.Chunks = nil
+	newObj.ChunksInline = nil
+	newObj.Parts = nil
+	newObj.ReplicationStatus = ""
+	newObj.LastModified = time.Now().UTC()
+	newObj.Incompressible = utils.IsCompressedContentType(newObj.ContentType)
+
+	// 写元数据失败时切分流水线只返回笼统的错误，原因记在 metaErr 里
+	var metaErr error
+	err = cs.DoChunk(io.MultiReader(tail, body), meta.ObjectToBaseObject(newObj), func(cs *chunk.ChunkService, chunks []*meta.Chunk, blocks map[string]*meta.Block, obj *meta.BaseObject) error {
+		if metaErr = cr.Verify(); metaErr != nil {
+			return metaErr
+		}
+		dataMD5 := hex.EncodeToString(hasher.Sum(nil))
+		if params.ContentMd5 != "" && params.ContentMd5 != dataMD5 {
+			logger.GetLogger("dedups3").Errorf("append %s/%s Content-MD5 mismatch: %s:%s", obj.Bucket, obj.Key, params.ContentMd5, dataMD5)
+			metaErr = xhttp.ToError(xhttp.ErrBadDigest)
+			return metaErr
+		}
+		if obj.Size != current.Size-tailStart+int64(appended) {
+			logger.GetLogger("dedups3").Errorf("append %s/%s read tail failed, get size %d:%d", obj.Bucket, obj.Key, obj.Size, current.Size-tailStart+int64(appended))
+			metaErr = fmt.Errorf("append %s/%s read tail failed", obj.Bucket, obj.Key)
+			return metaErr
+		}
+		obj.Size = current.Size + int64(appended)
+		obj.ETag = appendETag(current.ETag, dataMD5)
+		obj.Checksum = appendChecksum(current, cr, int64(appended))
+		metaErr = cs.AppendMeta(context.Background(), objkey, keep, chunks, blocks, current, meta.BaseObjectToObject(obj))
+		return metaErr
+	})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to append object %s/%s: %v", current.Bucket, current.Key, err)
+		if metaErr == nil {
+			return nil, err
+		}
+		if errors.Is(metaErr, chunk.ErrObjectChanged) {
+			return nil, xhttp.ToError(xhttp.ErrInvalidWriteOffset)
+		}
+		return nil, metaErr
+	}
+	return newObj, nil
+}
+
+// appendTail 计算追加时需要保留的旧chunk数量，以及重新切分的起始位置
+// 最后一个chunk是在对象末尾截断的，需要和追加的数据一起重新切分；内联对象和去重范围发生变化的对象整个重新切分
+func (o *ObjectService) appendTail(cs *chunk.ChunkService, current *meta.Object) (int, int64, error) {
+	if current.ChunksInline != nil || len(current.Chunks) == 0 {
+		return 0, 0, nil
+	}
+	// 存储点的去重范围变了，新旧chunk不能混在一个对象里
+	if len(current.SSEKey) == 0 {
+		var conf *meta.ChunkConfig
+		if ss := storage.GetStorageService(); ss != nil {
+			if _storage, err := ss.GetStorage(current.DataLocation); err == nil {
+				conf = _storage.Chunk
+			}
+		}
+		scope := chunk.DedupScopeID(conf, current.Owner.ID, current.Bucket)
+		convergent := scope != "" && conf.Convergent
+		if scope != current.DedupScope || convergent != (current.DedupKey != nil) {
+			logger.GetLogger("dedups3").Infof("object %s/%s dedup scope changed, rewrite all data", current.Bucket, current.Key)
+			return 0, 0, nil
+		}
+	}
+
+	last := current.Chunks[len(current.Chunks)-1]
+	chunks, err := cs.BatchGet(current.DataLocation, []string{last})
+	if err != nil || len(chunks) != 1 {
+		logger.GetLogger("dedups3").Errorf("failed to get object %s/%s last chunk %s: %v", current.Bucket, current.Key, last, err)
+		return 0, 0, fmt.Errorf("failed to get object %s/%s last chunk %s", current.Bucket, current.Key, last)
+	}
+	encrypted := len(current.SSEKey) > 0 || current.DedupKey != nil
+	tailStart := current.Size - chunk.PlainChunkSize(chunks[0], encrypted)
+	if tailStart < 0 {
+		logger.GetLogger("dedups3").Errorf("object %s/%s last chunk %s size mismatch", current.Bucket, current.Key, last)
+		return 0, 0, fmt.Errorf("object %s/%s last chunk %s size mismatch", current.Bucket, current.Key, last)
+	}
+	return len(current.Chunks) - 1, tailStart, nil
+}
+
+// appendETag 追加后的 ETag 由旧 ETag 和追加数据的 MD5 组合而成，和分段上传一样带上段数，不是整个对象的 MD5
+func appendETag(prev meta.Etag, dataMD5 string) meta.Etag {
+	parts := 1
+	if i := strings.LastIndex(string(prev), "-"); i >= 0 {
+		if n, err := strconv.Atoi(string(prev[i+1:])); err == nil {
+			parts = n
+		}
+	}
+	sum := md5.Sum([]byte(string(prev) + dataMD5))
+	return meta.Etag(fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts+1))
+}
+
+// appendChecksum 追加后对象的校验和，只有整体 CRC 能和追加数据的 CRC 合并，其他情况新对象不带校验和
+func appendChecksum(current *meta.Object, cr *checksum.Reader, appended int64) *meta.Checksum {
+	added := cr.Checksum()
+	if added == nil {
+		return nil
+	}
+	if current.Size == 0 {
+		return added
+	}
+	if current.Checksum == nil || current.Checksum.Type != xhttp.AmzChecksumTypeFullObject || current.Checksum.Algorithm != added.Algorithm {
+		return nil
+	}
+	value, err := checksum.Combine(added.Algorithm, current.Checksum.Value, added.Value, appended)
+	if err != nil {
+		logger.GetLogger("dedups3").Warnf("failed to combine %s/%s checksum: %v", current.Bucket, current.Key, err)
+		return nil
+	}
+	added.Value = value
+	return added
+}
+
+// byteCounter 统计写入的字节数
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
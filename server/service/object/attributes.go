@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"encoding/xml"
+	"strings"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/meta"
+)
+
+const (
+	// MaxObjectAttributesParts GetObjectAttributes 一次最多返回的分段数
+	MaxObjectAttributesParts = 1000
+)
+
+// GetObjectAttributesResponse GetObjectAttributes 的应答，只包含请求的属性
+type GetObjectAttributesResponse struct {
+	XMLName      xml.Name               `xml:"GetObjectAttributesResponse"`
+	XMLNS        string                 `xml:"xmlns,attr"`
+	ETag         string                 `xml:"ETag,omitempty"`
+	Checksum     *ObjectChecksum        `xml:"Checksum,omitempty"`
+	ObjectParts  *ObjectAttributesParts `xml:"ObjectParts,omitempty"`
+	StorageClass string                 `xml:"StorageClass,omitempty"`
+	ObjectSize   *int64                 `xml:"ObjectSize,omitempty"`
+}
+
+// ObjectChecksum 对象的校验和
+type ObjectChecksum struct {
+	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
+	ChecksumType      string `xml:"ChecksumType,omitempty"`
+}
+
+// ObjectAttributesParts 分段上传对象的分段列表
+type ObjectAttributesParts struct {
+	PartNumberMarker     int                    `xml:"PartNumberMarker"`
+	NextPartNumberMarker int                    `xml:"NextPartNumberMarker"`
+	MaxParts             int                    `xml:"MaxParts"`
+	IsTruncated          bool                   `xml:"IsTruncated"`
+	PartsCount           int                    `xml:"PartsCount"`
+	Parts                []ObjectAttributesPart `xml:"Part"`
+}
+
+// ObjectAttributesPart 分段的编号、大小和校验和
+type ObjectAttributesPart struct {
+	PartNumber        int    `xml:"PartNumber"`
+	Size              int64  `xml:"Size"`
+	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
+}
+
+// ParseObjectAttributes 解析 x-amz-object-attributes 请求头，至少要指定一个属性
+func ParseObjectAttributes(values []string) (map[string]bool, error) {
+	attrs := make(map[string]bool)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			switch name {
+			case "ETag", xhttp.Checksum, xhttp.ObjectParts, xhttp.StorageClass, xhttp.ObjectSize:
+				attrs[name] = true
+			default:
+				return nil, xhttp.ToError(xhttp.ErrInvalidAttributeName)
+			}
+		}
+	}
+	if len(attrs) == 0 {
+		return nil, xhttp.ToError(xhttp.ErrInvalidAttributeName)
+	}
+	return attrs, nil
+}
+
+// ObjectAttributes 按请求的属性生成应答，分段从 partNumberMarker 之后开始最多列出 maxParts 个
+// 不是分段上传的对象没有 ObjectParts
+func ObjectAttributes(obj *meta.Object, attrs map[string]bool, maxParts, partNumberMarker int) *GetObjectAttributesResponse {
+	resp := &GetObjectAttributesResponse{
+		XMLNS: "http://s3.amazonaws.com/doc/2006-03-01/",
+	}
+	if attrs["ETag"] {
+		resp.ETag = string(obj.ETag)
+	}
+	if attrs[xhttp.StorageClass] {
+		resp.StorageClass = obj.StorageClass
+		if resp.StorageClass == "" {
+			resp.StorageClass = meta.STANDARD_CLASS_STORAGE
+		}
+	}
+	if attrs[xhttp.ObjectSize] {
+		size := obj.Size
+		resp.ObjectSize = &size
+	}
+	if attrs[xhttp.Checksum] && obj.Checksum != nil {
+		resp.Checksum = &ObjectChecksum{ChecksumType: obj.Checksum.Type}
+		c := resp.Checksum
+		c.ChecksumCRC32, c.ChecksumCRC32C, c.ChecksumSHA1, c.ChecksumSHA256, c.ChecksumCRC64NVME = obj.Checksum.Values()
+	}
+	if attrs[xhttp.ObjectParts] && len(obj.Parts) > 0 {
+		parts := &ObjectAttributesParts{
+			PartNumberMarker: partNumberMarker,
+			MaxParts:         maxParts,
+			PartsCount:       len(obj.Parts),
+			Parts:            make([]ObjectAttributesPart, 0),
+		}
+		for _, part := range obj.Parts {
+			if part.PartNumber <= partNumberMarker {
+				continue
+			}
+			if len(parts.Parts) >= maxParts {
+				parts.IsTruncated = true
+				break
+			}
+			item := ObjectAttributesPart{PartNumber: part.PartNumber, Size: part.Size}
+			if obj.Checksum != nil && part.Checksum != "" {
+				partChecksum := &meta.Checksum{Algorithm: obj.Checksum.Algorithm, Value: part.Checksum}
+				item.ChecksumCRC32, item.ChecksumCRC32C, item.ChecksumSHA1, item.ChecksumSHA256, item.ChecksumCRC64NVME = partChecksum.Values()
+			}
+			parts.Parts = append(parts.Parts, item)
+			parts.NextPartNumberMarker = part.PartNumber
+		}
+		resp.ObjectParts = parts
+	}
+	return resp
+}
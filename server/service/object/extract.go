@@ -0,0 +1,282 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+)
+
+const (
+	// maxExtractErrors 应答中最多列出的失败条目数，其余的只计数
+	maxExtractErrors = 1000
+)
+
+var (
+	errMalformedArchive = errors.New("malformed archive")
+)
+
+// ExtractResult 自动解压上传的结果，单个条目失败不影响其他条目
+type ExtractResult struct {
+	XMLName   xml.Name       `xml:"ExtractResult"`
+	XMLNS     string         `xml:"xmlns,attr"`
+	Extracted int64          `xml:"Extracted"` // 成功写入的对象数
+	Skipped   int64          `xml:"Skipped"`   // 跳过的目录、链接等非普通文件
+	Failed    int64          `xml:"Failed"`    // 写入失败的条目数
+	Truncated bool           `xml:"Truncated"` // 压缩包损坏或者配额超限，后面的条目没有处理
+	Errors    []ExtractError `xml:"Error"`
+}
+
+// ExtractError 写入失败的条目
+type ExtractError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// archiveEntry 压缩包中的一个普通文件
+type archiveEntry struct {
+	name string
+	size int64
+	body io.Reader
+}
+
+// PutObjectExtract 把 tar、tar.gz 或 zip 压缩包解压为多个对象，对象 key 为目标 key 所在目录加上条目路径
+// 每个条目按普通上传写入，走同样的切分去重流程，onPut 在每个对象写入成功后调用
+// 没有任何条目写入之前遇到的桶不存在、无权限、压缩包格式错误等直接返回错误
+func (o *ObjectService) PutObjectExtract(r io.Reader, headers http.Header, params *BaseObjectParams, onPut func(obj *meta.Object)) (*ExtractResult, error) {
+	result := &ExtractResult{
+		XMLNS:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		Errors: make([]ExtractError, 0),
+	}
+	prefix := ""
+	if i := strings.LastIndex(params.ObjKey, "/"); i >= 0 {
+		prefix = params.ObjKey[:i+1]
+	}
+	entryHeaders := extractEntryHeaders(headers)
+
+	fail := func(key string, err error) {
+		result.Failed++
+		if len(result.Errors) >= maxExtractErrors {
+			return
+		}
+		code, message := xhttp.ToApiErr(xhttp.ErrInternalError).Code, err.Error()
+		var apiErr xhttp.APIError
+		if errors.As(err, &apiErr) {
+			code, message = apiErr.Code, apiErr.Description
+		}
+		result.Errors = append(result.Errors, ExtractError{Key: key, Code: code, Message: message})
+	}
+
+	err := walkArchive(r, func(entry *archiveEntry) error {
+		if entry == nil {
+			result.Skipped++
+			return nil
+		}
+		key, err := extractKey(prefix, entry.name)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("invalid archive entry %s: %v", entry.name, err)
+			fail(entry.name, err)
+			return nil
+		}
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		obj, err := o.PutObject(entry.body, entryHeaders, &BaseObjectParams{
+			BucketName:   params.BucketName,
+			ObjKey:       key,
+			ContentType:  contentType,
+			ContentLen:   entry.size,
+			AccessKeyID:  params.AccessKeyID,
+			StorageClass: params.StorageClass,
+		})
+		if err == nil {
+			result.Extracted++
+			if onPut != nil {
+				onPut(obj)
+			}
+			return nil
+		}
+		logger.GetLogger("dedups3").Errorf("failed to extract %s/%s: %v", params.BucketName, key, err)
+		// 对所有条目都一样的错误，不再继续
+		if errors.Is(err, xhttp.ToError(xhttp.ErrAccessDenied)) || errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) ||
+			errors.Is(err, xhttp.ToError(xhttp.ErrAdminBucketQuotaExceeded)) {
+			return err
+		}
+		fail(key, err)
+		return nil
+	})
+	if err == nil {
+		logger.GetLogger("dedups3").Infof("extract %s/%s finished, extracted %d skipped %d failed %d", params.BucketName, params.ObjKey, result.Extracted, result.Skipped, result.Failed)
+		return result, nil
+	}
+
+	if result.Extracted == 0 && result.Failed == 0 {
+		if errors.Is(err, errMalformedArchive) {
+			logger.GetLogger("dedups3").Errorf("invalid archive %s/%s: %v", params.BucketName, params.ObjKey, err)
+			return nil, fmt.Errorf("%w: %v", xhttp.ToError(xhttp.ErrMalformedRequestBody), err)
+		}
+		return nil, err
+	}
+	// 已经写入了部分对象，把中断的原因作为压缩包本身的错误返回
+	logger.GetLogger("dedups3").Errorf("extract %s/%s aborted after %d entries: %v", params.BucketName, params.ObjKey, result.Extracted+result.Failed, err)
+	if errors.Is(err, errMalformedArchive) {
+		err = fmt.Errorf("%w: %v", xhttp.ToError(xhttp.ErrMalformedRequestBody), err)
+	}
+	result.Truncated = true
+	fail(params.ObjKey, err)
+	return result, nil
+}
+
+// extractEntryHeaders 条目继承请求中的元数据、加密和锁定设置，去掉只对压缩包本身有意义的头
+func extractEntryHeaders(headers http.Header) http.Header {
+	entryHeaders := headers.Clone()
+	for _, name := range []string{
+		xhttp.ContentMD5, xhttp.ContentLength, xhttp.AmzDecodedContentLength, xhttp.ContentType,
+		xhttp.ContentEncoding, xhttp.AmzSnowballExtract,
+	} {
+		entryHeaders.Del(name)
+	}
+	for name := range entryHeaders {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-checksum-") {
+			entryHeaders.Del(name)
+		}
+	}
+	return entryHeaders
+}
+
+// extractKey 条目路径转换为对象 key，拒绝跳出目标目录的路径
+func extractKey(prefix, name string) (string, error) {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", xhttp.ToError(xhttp.ErrInvalidObjectName)
+		}
+	}
+	key := prefix + strings.TrimPrefix(path.Clean("/"+name), "/")
+	if err := utils.CheckValidObjectName(key); err != nil {
+		return "", xhttp.ToError(xhttp.ErrInvalidObjectName)
+	}
+	return key, nil
+}
+
+// walkArchive 按顺序遍历压缩包中的普通文件，非普通文件回调时 entry 为 nil
+// 根据文件头识别格式：gzip 压缩的 tar、zip，其他按 tar 处理
+func walkArchive(r io.Reader, fn func(entry *archiveEntry) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errMalformedArchive, err)
+		}
+		defer gz.Close()
+		return walkTar(gz, fn)
+	case bytes.Equal(magic, []byte("PK\x03\x04")) || bytes.Equal(magic, []byte("PK\x05\x06")):
+		return walkZip(br, fn)
+	default:
+		return walkTar(br, fn)
+	}
+}
+
+func walkTar(r io.Reader, fn func(entry *archiveEntry) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errMalformedArchive, err)
+		}
+		var entry *archiveEntry
+		if hdr.Typeflag == tar.TypeReg {
+			entry = &archiveEntry{name: hdr.Name, size: hdr.Size, body: tr}
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZip zip 的目录在文件末尾，先把数据写入临时文件再读取
+// 临时文件大小不超过配置的解压上限，超过时返回 EntityTooLarge
+func walkZip(r io.Reader, fn func(entry *archiveEntry) error) error {
+	limit := xconf.Get().Server.MaxExtractSize
+	if limit <= 0 || limit > meta.MAX_OBJECT_SIZE {
+		limit = meta.MAX_OBJECT_SIZE
+	}
+	tmp, err := os.CreateTemp("", "dedups3-extract-*.zip")
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to create temp file: %v", err)
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	size, err := io.Copy(tmp, io.LimitReader(r, limit+1))
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to spool zip archive: %v", err)
+		return fmt.Errorf("failed to spool zip archive: %w", err)
+	}
+	if size > limit {
+		logger.GetLogger("dedups3").Errorf("zip archive exceeds extract limit %d", limit)
+		return xhttp.ToError(xhttp.ErrEntityTooLarge)
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMalformedArchive, err)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			if err := fn(nil); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", errMalformedArchive, f.Name, err)
+		}
+		err = fn(&archiveEntry{name: f.Name, size: int64(f.UncompressedSize64), body: rc})
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/storage"
+)
+
+// 以下接口供后台生命周期服务使用，以桶所有者的身份执行，不经过 IAM 校验
+
+// ExpireObject 过期对象的当前版本
+// 开启版本控制的桶插入删除标记，否则直接删除；对象在扫描后被覆盖时返回 ErrPreconditionFailed
+func (o *ObjectService) ExpireObject(bucket *meta.BucketMetadata, obj *meta.Object) (*meta.Object, error) {
+	return o.deleteObject(bucket, bucket.Owner, &BaseObjectParams{
+		BucketName: bucket.Name,
+		ObjKey:     obj.Key,
+		IfMatch:    string(obj.ETag),
+	})
+}
+
+// RemoveDeleteMarker 永久删除过期的删除标记
+func (o *ObjectService) RemoveDeleteMarker(bucket *meta.BucketMetadata, key, versionID string) (*meta.Object, error) {
+	return o.deleteObject(bucket, bucket.Owner, &BaseObjectParams{
+		BucketName: bucket.Name,
+		ObjKey:     key,
+		VersionID:  versionID,
+	})
+}
+
+// IsExpiredDeleteMarker 判断删除标记是否是对象仅剩的版本
+func (o *ObjectService) IsExpiredDeleteMarker(bucket *meta.BucketMetadata, marker *meta.Object) (bool, error) {
+	accountID := bucket.Owner.ID
+	objkey := "aws:object:" + accountID + ":" + bucket.Name + "/" + marker.Key
+	var current meta.Object
+	exists, err := o.kvstore.Get(objkey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objkey, err)
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	txn, err := o.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+	versionPrefix := meta.GenVersionKey(accountID, bucket.Name, marker.Key, "")
+	keys, _, err := txn.Scan(versionPrefix, "", 2)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("scan %s versions failed: %v", objkey, err)
+		return false, fmt.Errorf("scan %s versions failed: %w", objkey, err)
+	}
+	// null 版本的存储key带有修改时间前缀，只比较结尾的版本ID
+	return len(keys) == 1 && strings.HasSuffix(keys[0], marker.GetVersionID()), nil
+}
+
+// TransitionObject 把对象的当前版本转换到目标存储类别
+// 目标存储类别对应的存储点与当前不同时，数据会被重新写入目标存储点
+func (o *ObjectService) TransitionObject(bucket *meta.BucketMetadata, obj *meta.Object, storageClass string) (*meta.Object, error) {
+	ss := storage.GetStorageService()
+	if ss == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get storage service")
+		return nil, errors.New("failed to get storage service")
+	}
+	scs := ss.GetStoragesByClass(storageClass)
+	if len(scs) == 0 {
+		logger.GetLogger("dedups3").Errorf("no storage class %s", storageClass)
+		return nil, xhttp.ToError(xhttp.ErrInvalidStorageClass)
+	}
+	sc := scs[0]
+
+	cs := chunk.GetChunkService()
+	if cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get chunk service")
+		return nil, errors.New("failed to get chunk service")
+	}
+
+	storeKey := "aws:object:" + bucket.Owner.ID + ":" + bucket.Name + "/" + obj.Key
+	newObj := obj.Clone()
+	newObj.StorageClass = storageClass
+	newObj.DataLocation = sc.ID
+
+	// 内联数据或者存储点相同，只修改存储类别
+	if obj.ChunksInline != nil || len(obj.Chunks) == 0 || obj.DataLocation == sc.ID {
+		if err := cs.ReplaceMeta(context.Background(), storeKey, nil, nil, obj, newObj); err != nil {
+			return nil, err
+		}
+		return newObj, nil
+	}
+
+	// 服务端没有 SSE-C 对象的客户密钥，不能读出数据转移
+	if obj.SSE.IsCustomerKey() {
+		logger.GetLogger("dedups3").Warnf("%s/%s is encrypted with customer key, skip transition", obj.Bucket, obj.Key)
+		return nil, fmt.Errorf("%s/%s is encrypted with customer key", obj.Bucket, obj.Key)
+	}
+	reader, err := o.readObject(obj, 0, obj.Size-1)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// 加密对象重新写入时继续使用原来的数据密钥
+	if newObj.SSEKey, err = objectKey(obj, nil); err != nil {
+		return nil, err
+	}
+	// 重新切分时会用 ETag 校验数据，分段上传的 ETag 不是数据的 MD5，先清空，写入前再恢复
+	newObj.ETag = ""
+	newObj.Incompressible = utils.IsCompressedContentType(newObj.ContentType)
+	var replaceErr error
+	err = cs.DoChunk(reader, meta.ObjectToBaseObject(newObj), func(cs *chunk.ChunkService, chunks []*meta.Chunk, blocks map[string]*meta.Block, base *meta.BaseObject) error {
+		rewritten := meta.BaseObjectToObject(base)
+		if rewritten.Size != obj.Size || (!strings.Contains(string(obj.ETag), "-") && rewritten.ETag != obj.ETag) {
+			logger.GetLogger("dedups3").Errorf("%s/%s transition data mismatch: size %d:%d etag %s:%s", obj.Bucket, obj.Key, rewritten.Size, obj.Size, rewritten.ETag, obj.ETag)
+			replaceErr = fmt.Errorf("%s/%s transition data mismatch", obj.Bucket, obj.Key)
+			return replaceErr
+		}
+		rewritten.ETag = obj.ETag
+		replaceErr = cs.ReplaceMeta(context.Background(), storeKey, chunks, blocks, obj, rewritten)
+		return replaceErr
+	})
+	if replaceErr != nil {
+		return nil, replaceErr
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s transition to %s failed: %v", obj.Bucket, obj.Key, storageClass, err)
+		return nil, err
+	}
+	logger.GetLogger("dedups3").Infof("transition object %s/%s from %s to %s", obj.Bucket, obj.Key, obj.StorageClass, storageClass)
+	return newObj, nil
+}
@@ -32,10 +32,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mageg-x/dedups3/internal/checksum"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/internal/logger"
 	"github.com/mageg-x/dedups3/internal/utils"
 	"github.com/mageg-x/dedups3/meta"
+	sb "github.com/mageg-x/dedups3/plugs/block"
 	xcache "github.com/mageg-x/dedups3/plugs/cache"
 	"github.com/mageg-x/dedups3/plugs/kv"
 	"github.com/mageg-x/dedups3/service/block"
@@ -84,6 +86,15 @@ type BaseObjectParams struct {
 	Encodingtype            string
 	Prefix                  string
 	ClientToken             string
+	VersionID               string
+	SourceVersionID         string
+	BypassGovernance        bool
+	ObjectLockRetention     *meta.Retention
+	ObjectLockLegalHold     *meta.LegalHold
+	ServerSideEncryption    *SSERequest
+	CustomerKey             *CustomerKey   // SSE-C 客户密钥
+	SourceCustomerKey       *CustomerKey   // 复制源对象的 SSE-C 客户密钥
+	Checksum                *checksum.Spec // 请求中声明的附加校验和
 }
 
 type DeleteObjectsRequest struct {
@@ -234,21 +245,29 @@ func GetObjectService() *ObjectService {
 	return instance
 }
 
-func (o *ObjectService) HeadObject(params *BaseObjectParams) (*meta.Object, error) {
+func (o *ObjectService) HeadObject(ctx context.Context, params *BaseObjectParams) (*meta.Object, error) {
 	iamService := iam.GetIamService()
 	if iamService == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get iam service")
 		return nil, errors.New("failed to get iam service")
 	}
 
-	ak, err := iamService.GetAccessKey(params.AccessKeyID)
-	if err != nil || ak == nil {
-		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
-		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	accountID, err := iamService.GetRequestAccountID(ctx, params.AccessKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 指定版本直接读取，不走缓存
+	if params.VersionID != "" {
+		object, err := o.getObjectVersion(accountID, params.BucketName, params.ObjKey, params.VersionID)
+		if err != nil {
+			return object, err
+		}
+		return object, o.setRestoreStatus(accountID, object)
 	}
 
 	// 检查object 是否存在
-	objkey := "aws:object:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey
+	objkey := "aws:object:" + accountID + ":" + params.BucketName + "/" + params.ObjKey
 	var object *meta.Object
 	if cache, err := xcache.GetCache(); err == nil && cache != nil {
 		_object, ok, e := xcache.Get[meta.Object](cache, context.Background(), objkey)
@@ -275,8 +294,7 @@ func (o *ObjectService) HeadObject(params *BaseObjectParams) (*meta.Object, erro
 			_ = cache.Set(context.Background(), objkey, object, time.Second*600)
 		}
 	}
-
-	return object, nil
+	return object, o.setRestoreStatus(accountID, object)
 }
 
 func (o *ObjectService) PutObject(r io.Reader, headers http.Header, params *BaseObjectParams) (*meta.Object, error) {
@@ -380,6 +398,35 @@ func (o *ObjectService) PutObject(r io.Reader, headers http.Header, params *Base
 
 	objectInfo := meta.NewObject(params.BucketName, params.ObjKey)
 	objectInfo.ParseHeaders(headers)
+	objectInfo.VersionID = bucket.NewVersionID()
+	// 对象锁定
+	retention, legalHold, err := ParseObjectLockHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyObjectLock(bucket, objectInfo, retention, legalHold); err != nil {
+		return nil, err
+	}
+	// 未开启版本控制时覆盖会删除旧对象，锁定的对象不能被覆盖
+	if dstobiOk && !bucket.Versioning.IsEnabled() {
+		if err := CheckObjectLock(&_dstobj, false); err != nil {
+			return nil, err
+		}
+	}
+	// 服务端加密，请求没有指定时使用桶的默认加密配置
+	sseReq, err := ParseSSEHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	customerKey, err := ParseCustomerKeyHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	objKey, err := NewObjectKey(ak.AccountID, bucket, sseReq, customerKey)
+	if err != nil {
+		return nil, err
+	}
+	objKey.Apply(objectInfo)
 	objectInfo.StorageClass = storageClass
 	objectInfo.DataLocation = sc.ID
 	objectInfo.ContentType = params.ContentType
@@ -406,8 +453,12 @@ func (o *ObjectService) PutObject(r io.Reader, headers http.Header, params *Base
 		}
 	}()
 
-	// 短body， 直接存放到元数据里面
-	if params.ContentLen < 8*1024 {
+	// 附加校验和在读数据时一起计算，读到结尾时和请求中的值比较
+	cr := checksum.NewReader(r, params.Checksum)
+	r = cr
+
+	// 短body， 直接存放到元数据里面，ContentLen 为 -1 表示长度未知
+	if params.ContentLen >= 0 && params.ContentLen < 8*1024 {
 		// 先压缩，如果压缩后小于 1024，就放到元数据里面，否则就跳过
 		bodyBytes, err := io.ReadAll(r)
 		if err != nil {
@@ -435,10 +486,16 @@ func (o *ObjectService) PutObject(r io.Reader, headers http.Header, params *Base
 		}
 
 		if objectInfo.ChunksInline != nil {
+			// 加密对象的内联数据也要加密
+			if objectInfo.ChunksInline.Data, err = sealInline(objectInfo.ChunksInline.Data, objectInfo.SSEKey); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to encrypt %s/%s inline data: %v", objectInfo.Bucket, objectInfo.Key, err)
+				return nil, fmt.Errorf("failed to encrypt %s/%s inline data: %w", objectInfo.Bucket, objectInfo.Key, err)
+			}
 			// 计算etag
 			hash := md5.Sum(bodyBytes)
 			objectInfo.ETag = meta.Etag(hex.EncodeToString(hash[:]))
 			objectInfo.Size = int64(len(bodyBytes))
+			objectInfo.Checksum = cr.Checksum()
 			// 直接写meta
 			objPrefix := "aws:object:"
 			err = chunker.WriteMeta(context.Background(), ak.AccountID, nil, nil, objectInfo, objPrefix)
@@ -453,9 +510,21 @@ func (o *ObjectService) PutObject(r io.Reader, headers http.Header, params *Base
 		}
 	}
 
-	err = chunker.DoChunk(r, meta.ObjectToBaseObject(objectInfo), o.WriteObjectMeta)
+	// 图片、视频、压缩包等已经压缩过的内容写块时不再尝试压缩
+	objectInfo.Incompressible = utils.IsCompressedContentType(objectInfo.ContentType)
+	err = chunker.DoChunk(r, meta.ObjectToBaseObject(objectInfo), func(cs *chunk.ChunkService, chunks []*meta.Chunk, blocks map[string]*meta.Block, obj *meta.BaseObject) error {
+		// 数据已经读完，校验和不一致时不写元数据
+		if err := cr.Verify(); err != nil {
+			return err
+		}
+		obj.Checksum = cr.Checksum()
+		return o.WriteObjectMeta(cs, chunks, blocks, obj)
+	})
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to chunk object: %v", err)
+		if cr.Err() != nil {
+			err = cr.Err()
+		}
 	}
 
 	_stats := stats.GetStatsService()
@@ -497,23 +566,27 @@ func (o *ObjectService) WriteObjectMeta(cs *chunk.ChunkService, chunks []*meta.C
 	return nil
 }
 
-func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *BaseObjectParams) (*meta.Object, io.ReadCloser, error) {
+func (o *ObjectService) GetObject(ctx context.Context, r io.Reader, headers http.Header, params *BaseObjectParams) (*meta.Object, io.ReadCloser, error) {
 	iamService := iam.GetIamService()
 	if iamService == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get iam service")
 		return nil, nil, errors.New("failed to get iam service")
 	}
 
-	ak, err := iamService.GetAccessKey(params.AccessKeyID)
-	if err != nil || ak == nil {
-		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
-		return nil, nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	accountID, err := iamService.GetRequestAccountID(ctx, params.AccessKeyID)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// 检查object 是否存在
-	objkey := "aws:object:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey
+	objkey := "aws:object:" + accountID + ":" + params.BucketName + "/" + params.ObjKey
 	var object *meta.Object
-	if cache, err := xcache.GetCache(); err == nil && cache != nil {
+	if params.VersionID != "" {
+		object, err = o.getObjectVersion(accountID, params.BucketName, params.ObjKey, params.VersionID)
+		if err != nil {
+			return object, nil, err
+		}
+	} else if cache, err := xcache.GetCache(); err == nil && cache != nil {
 		_object, ok, e := xcache.Get[meta.Object](cache, context.Background(), objkey)
 		if e == nil && ok {
 			object = _object
@@ -536,6 +609,11 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 	}
 	logger.GetLogger("dedups3").Debugf("get object %s  %#v", objkey, object)
 
+	// 归档对象只能读取恢复出来的临时副本
+	if err := o.ResolveArchived(accountID, object); err != nil {
+		return nil, nil, err
+	}
+
 	// 计算数据范围
 	start := int64(0)
 	end := object.Size - 1
@@ -549,20 +627,44 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 		end = s + l - 1
 	}
 	logger.GetLogger("dedups3").Debugf("read object %s meta %#v", objkey, object.ETag)
+	// SSE-C 对象用请求中的客户密钥解开数据密钥
+	if object.SSEKey, err = objectKey(object, params.CustomerKey); err != nil {
+		return nil, nil, err
+	}
+	reader, err := o.readObject(object, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return object, reader, nil
+}
+
+// readObject 按顺序读出对象 [start, end] 范围内的数据，数据从对象所在的存储点读取
+func (o *ObjectService) readObject(object *meta.Object, start, end int64) (io.ReadCloser, error) {
+	objkey := object.Bucket + "/" + object.Key
+	// 加密对象先解开数据密钥，密钥被禁用时直接返回错误
+	sseKey, err := objectKey(object, nil)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := sseKey != nil
 	// 数据内联
 	if object.ChunksInline != nil && object.ChunksInline.Data != nil {
 		logger.GetLogger("dedups3").Infof("read object %s data from inline", objkey)
-		data := object.ChunksInline.Data
+		data, err := openInline(object.ChunksInline.Data, sseKey)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to decrypt object %s inline data: %v", objkey, err)
+			return nil, fmt.Errorf("failed to decrypt object %s inline data: %w", objkey, err)
+		}
 		if object.ChunksInline.Compress {
 			data, err = utils.Decompress(data)
 			if err != nil {
 				logger.GetLogger("dedups3").Errorf("failed to decompress object %s", objkey)
-				return nil, nil, fmt.Errorf("failed to decompress object %s", objkey)
+				return nil, fmt.Errorf("failed to decompress object %s", objkey)
 			}
 		}
 		if int64(len(data)) != object.Size {
 			logger.GetLogger("dedups3").Errorf("get be damaged object data %s", objkey)
-			return nil, nil, fmt.Errorf("get be damaged object data %s", objkey)
+			return nil, fmt.Errorf("get be damaged object data %s", objkey)
 		}
 		// 截取 range 部分
 		if start > 0 || end < int64(len(data))-1 {
@@ -571,77 +673,72 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 		if len(data) > 0 {
 			reader := bytes.NewReader(data)
 			readCloser := io.NopCloser(reader) // 包装成 ReadCloser
-			return object, readCloser, nil
+			return readCloser, nil
 		}
-		logger.GetLogger("dedups3").Errorf("failed to get the range of object %s , err %v", objkey, err)
-		return nil, nil, fmt.Errorf("failed to get the range of object %s , err %w", objkey, err)
+		logger.GetLogger("dedups3").Errorf("failed to get the range of object %s [%d-%d]", objkey, start, end)
+		return nil, fmt.Errorf("failed to get the range of object %s [%d-%d]", objkey, start, end)
+	}
+
+	// 收敛加密的 chunk 用对象去重范围的密钥解密，内联数据不做收敛加密
+	if sseKey == nil && object.DedupKey != nil {
+		if sseKey, err = chunk.OpenScopeKey(object.DedupScope, object.DedupKey); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to open object %s dedup scope key: %v", objkey, err)
+			return nil, fmt.Errorf("failed to open object %s dedup scope key: %w", objkey, err)
+		}
+		encrypted = true
 	}
 
 	cs := chunk.GetChunkService()
 	if cs == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get the chunk service")
-		return nil, nil, errors.New("failed to get the chunk service")
+		return nil, errors.New("failed to get the chunk service")
 	}
 	chunks, err := cs.BatchGet(object.DataLocation, object.Chunks)
 	if err != nil || chunks == nil || len(chunks) != len(object.Chunks) {
 		logger.GetLogger("dedups3").Errorf("failed to get the object %d chunks", len(object.Chunks))
-		return nil, nil, fmt.Errorf("failed to get the object %d chunks", len(object.Chunks))
-	}
-	offset := int64(0)
-	blockIDs := make(map[string]*meta.Block, 0)
-	for _, _chunk := range chunks {
-		offset += int64(_chunk.Size)
-		if offset < start {
-			continue
-		}
-		blockIDs[_chunk.BlockID] = nil
-		if offset > end {
-			break
-		}
-	}
-	bids := make([]string, 0)
-	for bid := range blockIDs {
-		bids = append(bids, bid)
+		return nil, fmt.Errorf("failed to get the object %d chunks", len(object.Chunks))
 	}
+	// 读取计划，按顺序列出要读的块和每个块中要读的 chunk，分段格式的块只读出这些 chunk 所在的分段
+	plan := newReadPlan(chunks, start, end, encrypted)
+	bids := plan.blockIDs()
 
-	logger.GetLogger("dedups3").Debugf("to get the object %s blocks %#v", params.ObjKey, bids)
+	logger.GetLogger("dedups3").Debugf("to get the object %s blocks %#v", object.Key, bids)
 	bs := block.GetBlockService()
 	if bs == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get the block service")
-		return nil, nil, errors.New("failed to get the block service")
+		return nil, errors.New("failed to get the block service")
 	}
 	blocks, err := bs.BatchGet(object.DataLocation, bids)
 	if err != nil || blocks == nil || len(blocks) != len(bids) {
 		logger.GetLogger("dedups3").Errorf("failed to get the block meta %d:%d", len(bids), len(blocks))
-		return nil, nil, errors.New("failed to get the block meta")
+		return nil, errors.New("failed to get the block meta")
 	}
 	for _, _block := range blocks {
-		blockIDs[_block.ID] = _block
-	}
-
-	// 寻找合适的后端存储点
-	storageClass := params.StorageClass
-	if storageClass == "" {
-		storageClass = meta.STANDARD_CLASS_STORAGE
-	}
-
-	ss := storage.GetStorageService()
-	if ss == nil {
-		logger.GetLogger("dedups3").Errorf("failed to get storage service")
-		return nil, nil, errors.New("failed to get storage service")
-	}
-
-	scs := ss.GetStoragesByClass(storageClass)
-	if len(scs) == 0 {
-		logger.GetLogger("dedups3").Errorf("no storage class %s", storageClass)
-		return nil, nil, fmt.Errorf("no storage class %s", storageClass)
+		plan.byBlock[_block.ID].blk = _block
+	}
+
+	// 存储点开启校验时，按 chunk 的 hash 校验从块中读出的数据
+	verify := false
+	if ss := storage.GetStorageService(); ss != nil {
+		if st, err := ss.GetStorage(object.DataLocation); err == nil && st != nil && st.Chunk != nil {
+			verify = st.Chunk.Verify
+			// 不压缩不加密也不校验的存储点，块在本地文件中原样存放时直接从文件发送数据
+			if opener, ok := st.Instance.(sb.BlockFileOpener); ok && !encrypted && !verify && !st.Chunk.Compress && !st.Chunk.Encrypt {
+				if sections, ok := plainSections(plan, chunks, start, end); ok {
+					logger.GetLogger("dedups3").Debugf("read object %s [%d-%d] from %d plain block sections", objkey, start, end, len(sections))
+					return newPlainReader(st.Instance, opener, sections), nil
+				}
+			}
+		}
 	}
-	sc := scs[0]
 
-	// 按顺序读出object 的chunk 数据
+	// 按顺序读出object 的chunk 数据，任何错误都通过 CloseWithError 传给读端，不能让客户端收到截断的数据
 	pr, pw := io.Pipe()
-	blockLoaded := make([]string, 0)
+	// 预读后面的块，所有请求共享读缓冲预算
+	ctx, cancel := context.WithCancel(context.Background())
+	plan.prefetch(ctx, bs, object.DataLocation)
 	go func() {
+		defer plan.close(cancel)
 		defer pw.Close() // 确保无论成功失败都要关闭写端
 
 		// 创建一个 MD5 哈希器
@@ -651,34 +748,20 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 		// 使用 MultiWriter，同时写入 pw 和 hasher
 		writer = io.MultiWriter(pw, hasher)
 
-		offset = 0
+		offset := int64(0)
 		num := 0
-		blockDatas := make(map[string]*meta.BlockData, 0)
-		for _, _chunk := range chunks {
-			if offset+int64(_chunk.Size) <= start {
-				offset += int64(_chunk.Size)
+		for i, _chunk := range chunks {
+			plainSize := chunk.PlainChunkSize(_chunk, encrypted)
+			if offset+plainSize <= start {
+				offset += plainSize
 				continue // 还没到起始位置
 			}
 
-			// 为了防止内存爆炸，释放一些 已经用过的block data
-			if len(blockLoaded) > 20 {
-				delBlockID := blockLoaded[0]
-				delete(blockDatas, delBlockID)
-				blockLoaded = blockLoaded[1:]
-			}
-
-			_blockdata := blockDatas[_chunk.BlockID]
-			if _blockdata == nil {
-				logger.GetLogger("dedups3").Debugf("read obj %s block %s", object.Key, _chunk.BlockID)
-				_bd, err := bs.ReadBlock(sc.ID, _chunk.BlockID)
-
-				if err != nil || _bd == nil || len(_bd.Data) == 0 {
-					logger.GetLogger("dedups3").Errorf("failed to get the block %s data", _chunk.BlockID)
-					return
-				}
-				_blockdata = _bd
-				blockDatas[_chunk.BlockID] = _blockdata
-				blockLoaded = append(blockLoaded, _chunk.BlockID)
+			_blockdata, err := plan.get(ctx, _chunk.BlockID)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to get the block %s data: %v", _chunk.BlockID, err)
+				_ = pw.CloseWithError(fmt.Errorf("failed to get the block %s data: %w", _chunk.BlockID, err))
+				return
 			}
 
 			// 从_data 中 读取 chunk 内容
@@ -694,6 +777,20 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 				chunkData = _blockdata.Data[block_offset : block_offset+int64(item.Size)]
 				break
 			}
+			if verify && len(chunkData) > 0 && !_chunk.Verify(chunkData) {
+				gc.ReportChunkMismatch(object.DataLocation, _chunk.BlockID, _chunk.Hash)
+				_ = pw.CloseWithError(fmt.Errorf("chunk %s in block %s integrity check failed", _chunk.Hash, _chunk.BlockID))
+				return
+			}
+			if encrypted && len(chunkData) > 0 {
+				plain, err := utils.DecryptWithKey(chunkData, sseKey, nil)
+				if err != nil {
+					logger.GetLogger("dedups3").Errorf("failed to decrypt chunk %s of object %s: %v", _chunk.Hash, objkey, err)
+					_ = pw.CloseWithError(fmt.Errorf("failed to decrypt chunk %s: %w", _chunk.Hash, err))
+					return
+				}
+				chunkData = plain
+			}
 			if offset+int64(len(chunkData)) > end+1 {
 				_size := end - offset + 1
 				chunkData = chunkData[:_size]
@@ -705,9 +802,10 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 			if len(chunkData) == 0 {
 				logger.GetLogger("dedups3").Errorf("failed to get the chunk data from block %s start %d end %d offset %d block_offset %d chunk size %d  block header",
 					_chunk.BlockID, start, end, offset, block_offset, _chunk.Size)
+				_ = pw.CloseWithError(fmt.Errorf("chunk %s not found in block %s", _chunk.Hash, _chunk.BlockID))
 				return
 			}
-			offset += int64(_chunk.Size)
+			offset += plainSize
 
 			// 写入数据（同时写给 pw 和 hasher）
 			if _, err := writer.Write(chunkData); err != nil {
@@ -716,6 +814,8 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 				return
 			}
 			num += len(chunkData)
+			// 块不会再被用到，释放数据和预算
+			plan.release(_chunk.BlockID, i)
 
 			if offset > end {
 				// 已读够，提前结束
@@ -724,21 +824,36 @@ func (o *ObjectService) GetObject(r io.Reader, headers http.Header, params *Base
 			}
 		}
 
+		if int64(num) != end-start+1 {
+			logger.GetLogger("dedups3").Errorf("object %s chunks end early, write %d of range [%d-%d]", objkey, num, start, end)
+			_ = pw.CloseWithError(fmt.Errorf("object %s data is incomplete: %d of %d bytes", objkey, num, end-start+1))
+			return
+		}
+
 		// 所有数据写完，计算最终 MD5
 		finalMD5 := hasher.Sum(nil) // []byte 类型，16 字节
 		finalMD5Hex := hex.EncodeToString(finalMD5)
-		// 检查计算的MD5是否与对象的ETag一致
-		if string(object.ETag) != finalMD5Hex {
-			logger.GetLogger("dedups3").Debugf("get object %s/%s MD5 mismatch: stored=%s calculated=%s range[%d-%d]", object.Bucket, object.Key, object.ETag, finalMD5Hex, start, end)
+		// 完整读取时检查计算的MD5是否与对象的ETag一致，分段上传和追加写的 ETag 不是 MD5
+		if start == 0 && end == object.Size-1 && isMD5ETag(object.ETag) && string(object.ETag) != finalMD5Hex {
+			logger.GetLogger("dedups3").Errorf("get object %s/%s MD5 mismatch: stored=%s calculated=%s", object.Bucket, object.Key, object.ETag, finalMD5Hex)
+			_ = pw.CloseWithError(fmt.Errorf("object %s MD5 mismatch", objkey))
 		}
 	}()
 
-	logger.GetLogger("dedups3").Debugf("put object %#v", object)
-	return object, pr, nil
+	return pr, nil
+}
+
+// isMD5ETag ETag 是否是数据的 MD5
+func isMD5ETag(etag meta.Etag) bool {
+	if len(etag) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(string(etag))
+	return err == nil
 }
 
 // ListObjects 实现 S3 兼容的对象列表功能
-func (o *ObjectService) ListObjects(bucket, accessKeyID, prefix, marker, delimiter string, maxKeys int) (objects []*meta.Object, commonPrefixes []string, isTruncated bool, nextMarker string, err error) {
+func (o *ObjectService) ListObjects(ctx context.Context, bucket, accessKeyID, prefix, marker, delimiter string, maxKeys int) (objects []*meta.Object, commonPrefixes []string, isTruncated bool, nextMarker string, err error) {
 	// 设置 maxKeys 上限
 	if maxKeys <= 0 || maxKeys > 1000 {
 		maxKeys = 1000
@@ -756,14 +871,13 @@ func (o *ObjectService) ListObjects(bucket, accessKeyID, prefix, marker, delimit
 		return nil, nil, false, "", errors.New("failed to get iam service")
 	}
 
-	ak, err := iamService.GetAccessKey(accessKeyID)
-	if err != nil || ak == nil {
-		logger.GetLogger("dedups3").Errorf("failed to get access key %s", accessKeyID)
-		return nil, nil, false, "", xhttp.ToError(xhttp.ErrAccessDenied)
+	accountID, err := iamService.GetRequestAccountID(ctx, accessKeyID)
+	if err != nil {
+		return nil, nil, false, "", err
 	}
 
 	// 检查存储桶是否存在
-	bucketKey := "aws:bucket:" + ak.AccountID + ":" + bucket
+	bucketKey := "aws:bucket:" + accountID + ":" + bucket
 	var bucketMeta meta.BucketMetadata
 	if exists, err := o.kvstore.Get(bucketKey, &bucketMeta); !exists || err != nil {
 		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", bucket)
@@ -771,7 +885,7 @@ func (o *ObjectService) ListObjects(bucket, accessKeyID, prefix, marker, delimit
 	}
 
 	// 构建 KV 存储中的前缀
-	accountPrefix := "aws:object:" + ak.AccountID + ":" + bucket + "/"
+	accountPrefix := "aws:object:" + accountID + ":" + bucket + "/"
 	storePrefix := accountPrefix
 	if prefix != "" {
 		storePrefix += prefix // 如: aws:object:acc:bkt:logs/
@@ -990,7 +1104,7 @@ func (o *ObjectService) ListObjects(bucket, accessKeyID, prefix, marker, delimit
 }
 
 // ListObjectsV2 实现S3兼容的对象列表功能（V2版本）
-func (o *ObjectService) ListObjectsV2(bucket, accessKeyID, prefix, continuationToken, startAfter, delimiter string, maxKeys int) (objects []*meta.Object, commonPrefixes []string, isTruncated bool, nextToken string, err error) {
+func (o *ObjectService) ListObjectsV2(ctx context.Context, bucket, accessKeyID, prefix, continuationToken, startAfter, delimiter string, maxKeys int) (objects []*meta.Object, commonPrefixes []string, isTruncated bool, nextToken string, err error) {
 	// 1. 解码 continuationToken → 得到 marker
 	var marker string
 	// 优先使用 StartAfter
@@ -1006,75 +1120,135 @@ func (o *ObjectService) ListObjectsV2(bucket, accessKeyID, prefix, continuationT
 	}
 
 	// 调用V1版本的方法获取对象列表
-	obs, cp, t, nm, e := o.ListObjects(bucket, accessKeyID, prefix, marker, delimiter, maxKeys)
+	obs, cp, t, nm, e := o.ListObjects(ctx, bucket, accessKeyID, prefix, marker, delimiter, maxKeys)
 	nextToken = base64.StdEncoding.EncodeToString([]byte(nm))
 	return obs, cp, t, nextToken, e
 }
 
-func (o *ObjectService) DeleteObject(params *BaseObjectParams) error {
+// DeleteObject 删除对象
+// 未开启版本控制的桶直接删除对象；开启或暂停版本控制时，不指定版本号会插入删除标记，指定版本号则永久删除该版本
+// 返回被删除的版本或新建的删除标记
+func (o *ObjectService) DeleteObject(params *BaseObjectParams) (*meta.Object, error) {
 	iamService := iam.GetIamService()
 	if iamService == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get iam service")
-		return errors.New("failed to get iam service")
+		return nil, errors.New("failed to get iam service")
 	}
 
 	ak, err := iamService.GetAccessKey(params.AccessKeyID)
 	if err != nil || ak == nil {
 		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
-		return xhttp.ToError(xhttp.ErrAccessDenied)
+		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucket, err := o.getBucket(ak.AccountID, params.BucketName)
+	if err != nil {
+		return nil, err
 	}
+	return o.deleteObject(bucket, meta.Owner{ID: ak.AccountID, DisplayName: ak.Username}, params)
+}
+
+// deleteObject 以 owner 的身份删除桶中的对象，删除标记的所有者为 owner
+func (o *ObjectService) deleteObject(bucket *meta.BucketMetadata, owner meta.Owner, params *BaseObjectParams) (*meta.Object, error) {
+	accountID := owner.ID
+	versioned := bucket.Versioning != nil && bucket.Versioning.Status != ""
 
 	// 检查object 是否存在
 	txn, err := o.kvstore.BeginTxn(context.Background(), nil)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer func() {
 		if txn != nil {
 			_ = txn.Rollback()
 		}
 	}()
-	objkey := "aws:object:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey
+	objkey := "aws:object:" + accountID + ":" + params.BucketName + "/" + params.ObjKey
 	var _object meta.Object
 	exists, err := txn.Get(objkey, &_object)
-	if !exists || err != nil {
-		logger.GetLogger("dedups3").Errorf("object %s does not exist", objkey)
-		return xhttp.ToError(xhttp.ErrNoSuchKey)
-	}
-	// 删除obj 关联的chunk
-	if exists && len(_object.Chunks) > 0 {
-		gckey := gc.GCChunkPrefix + utils.GenUUID()
-		gcData := gc.GCChunk{
-			GCData: gc.GCData{
-				CreateAt: time.Now().UTC(),
-				Items:    make([]gc.GCItem, 0, len(_object.Chunks)),
-			},
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objkey, err)
+		return nil, fmt.Errorf("failed to fetch object %s: %w", objkey, err)
+	}
+
+	// If-Match 只有当前版本的 ETag 匹配时才删除
+	if params.IfMatch != "" && (!exists || string(_object.ETag) != params.IfMatch) {
+		logger.GetLogger("dedups3").Infof("object %s if match not match %s:%s", objkey, params.IfMatch, _object.ETag)
+		return nil, xhttp.ToError(xhttp.ErrPreconditionFailed)
+	}
+
+	var result *meta.Object
+	gcItems := make([]gc.GCItem, 0)
+	switch {
+	case params.VersionID != "":
+		// 永久删除指定版本
+		var current *meta.Object
+		if exists {
+			current = &_object
 		}
-		for _, id := range _object.Chunks {
-			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: _object.DataLocation, ID: id})
+		deleted, items, err := o.deleteVersion(txn, accountID, params.BucketName, params.ObjKey, params.VersionID, current, params.BypassGovernance)
+		if err != nil {
+			return nil, err
 		}
-
-		err = txn.Set(gckey, &gcData)
+		result = deleted
+		gcItems = append(gcItems, items...)
+	case versioned:
+		// 插入删除标记，当前版本转为历史版本
+		marker := meta.NewObject(params.BucketName, params.ObjKey)
+		marker.DeleteMarker = true
+		marker.VersionID = bucket.NewVersionID()
+		marker.LastModified = time.Now().UTC()
+		marker.Owner = owner
+		// 暂停状态下的 null 删除标记会替换已有的 null 版本
+		var current *meta.Object
+		if exists {
+			current = &_object
+		}
+		items, err := chunk.ArchiveObject(txn, accountID, current, marker)
 		if err != nil {
-			logger.GetLogger("dedups3").Errorf("%s/%s set gc chunk failed: %v", _object.Bucket, _object.Key, err)
-			return fmt.Errorf("%s/%s set gc chunk failed: %w", _object.Bucket, _object.Key, err)
-		} else {
-			logger.GetLogger("dedups3").Infof("%s/%s set gc chunk %s delay to proccess", _object.Bucket, _object.Key, gckey)
+			return nil, err
+		}
+		gcItems = append(gcItems, items...)
+		if exists {
+			if err := txn.Delete(objkey); err != nil {
+				logger.GetLogger("dedups3").Errorf("%s/%s delete object failed: %v", _object.Bucket, _object.Key, err)
+				return nil, fmt.Errorf("%s/%s delete object failed: %w", _object.Bucket, _object.Key, err)
+			}
+		}
+		if err := chunk.PutVersion(txn, accountID, marker); err != nil {
+			return nil, err
+		}
+		logger.GetLogger("dedups3").Debugf("%s/%s add delete marker %s", params.BucketName, params.ObjKey, marker.VersionID)
+		result = marker
+	default:
+		if !exists {
+			logger.GetLogger("dedups3").Errorf("object %s does not exist", objkey)
+			return nil, xhttp.ToError(xhttp.ErrNoSuchKey)
 		}
+		if err := CheckObjectLock(&_object, params.BypassGovernance); err != nil {
+			return nil, err
+		}
+		// 删除obj 关联的chunk
+		for _, id := range _object.Chunks {
+			gcItems = append(gcItems, gc.GCItem{StorageID: _object.DataLocation, ID: id})
+		}
+		if err := txn.Delete(objkey); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s delete object failed: %v", _object.Bucket, _object.Key, err)
+			return nil, fmt.Errorf("%s/%s delete object failed: %w", _object.Bucket, _object.Key, err)
+		}
+		logger.GetLogger("dedups3").Debugf("delete object %s/%s  chunk %d", _object.Bucket, _object.Key, len(_object.Chunks))
+		result = &_object
 	}
-	err = txn.Delete(objkey)
-	if err != nil {
-		logger.GetLogger("dedups3").Errorf("%s/%s delete object failed: %v", _object.Bucket, _object.Key, err)
-		return fmt.Errorf("%s/%s delete object failed: %w", _object.Bucket, _object.Key, err)
-	} else {
-		logger.GetLogger("dedups3").Debug("delete object %s/%s  chunk %d", _object.Bucket, _object.Key, len(_object.Chunks))
+
+	if err := chunk.AddGCChunks(txn, gcItems); err != nil {
+		return nil, err
 	}
 
 	err = txn.Commit()
 	if err != nil {
-		logger.GetLogger("dedups3").Errorf("%s/%s commit object failed: %v", _object.Bucket, _object.Key, err)
-		return fmt.Errorf("%s/%s commit object failed: %w", _object.Bucket, _object.Key, err)
+		logger.GetLogger("dedups3").Errorf("%s/%s commit object failed: %v", params.BucketName, params.ObjKey, err)
+		return nil, fmt.Errorf("%s/%s commit object failed: %w", params.BucketName, params.ObjKey, err)
 	}
 	txn = nil
 
@@ -1082,19 +1256,18 @@ func (o *ObjectService) DeleteObject(params *BaseObjectParams) error {
 		// obj
 		_ = cache.Del(context.Background(), objkey)
 		// chunk
-		chunkKeys := make([]string, 0, len(_object.Chunks))
-		for _, hash := range _object.Chunks {
-			chunkKey := meta.GenChunkKey(_object.DataLocation, hash)
-			chunkKeys = append(chunkKeys, chunkKey)
+		chunkKeys := make([]string, 0, len(gcItems))
+		for _, item := range gcItems {
+			chunkKeys = append(chunkKeys, meta.GenChunkKey(item.StorageID, item.ID))
 		}
 		_ = cache.MDel(context.Background(), chunkKeys)
 	}
 
 	_stats := stats.GetStatsService()
 	if _stats != nil {
-		_stats.RefreshAccountStats(ak.AccountID)
+		_stats.RefreshAccountStats(accountID)
 	}
-	return nil
+	return result, nil
 }
 
 func (o *ObjectService) CopyObject(srcBucket, srcObject string, params *BaseObjectParams) (*meta.Object, error) {
@@ -1113,10 +1286,29 @@ func (o *ObjectService) CopyObject(srcBucket, srcObject string, params *BaseObje
 	// 检查 源object 是否存在
 	srcobjkey := "aws:object:" + ak.AccountID + ":" + srcBucket + "/" + srcObject
 	var srcobj meta.Object
-	srcobjOK, err := o.kvstore.Get(srcobjkey, &srcobj)
-	if !srcobjOK || err != nil {
-		logger.GetLogger("dedups3").Errorf("object %s does not exist", srcobjkey)
-		return nil, xhttp.ToError(xhttp.ErrNoSuchKey)
+	srcobjOK := false
+	if params.SourceVersionID != "" {
+		_srcobj, err := o.getObjectVersion(ak.AccountID, srcBucket, srcObject, params.SourceVersionID)
+		if err != nil {
+			// 删除标记不能作为复制源
+			if errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+				return nil, xhttp.ToError(xhttp.ErrInvalidRequest)
+			}
+			return nil, err
+		}
+		srcobj = *_srcobj
+		srcobjOK = true
+	} else {
+		srcobjOK, err = o.kvstore.Get(srcobjkey, &srcobj)
+		if !srcobjOK || err != nil {
+			logger.GetLogger("dedups3").Errorf("object %s does not exist", srcobjkey)
+			return nil, xhttp.ToError(xhttp.ErrNoSuchKey)
+		}
+	}
+
+	// 归档的源对象只能从恢复出来的临时副本复制
+	if err := o.ResolveArchived(ak.AccountID, &srcobj); err != nil {
+		return nil, err
 	}
 
 	// 检查目标桶名是否 合法
@@ -1190,6 +1382,52 @@ func (o *ObjectService) CopyObject(srcBucket, srcObject string, params *BaseObje
 	dstobj.Key = params.ObjKey
 	dstobj.StorageClass = storageClass
 	dstobj.DataLocation = sc.ID
+	dstobj.VersionID = dstbucket.NewVersionID()
+	// 复制状态由目标桶的复制规则重新决定
+	dstobj.ReplicationStatus = ""
+	dstobj.RestoreStatus = ""
+	// 锁定信息不从源对象继承
+	if err := ApplyObjectLock(&dstbucket, dstobj, params.ObjectLockRetention, params.ObjectLockLegalHold); err != nil {
+		return nil, err
+	}
+	// 服务端加密，请求没有指定时使用目标桶的默认加密配置
+	srcKey, err := objectKey(&srcobj, params.SourceCustomerKey)
+	if err != nil {
+		return nil, err
+	}
+	srcobj.SSEKey = srcKey
+	var dstKey *ObjectKey
+	switch {
+	case srcKey == nil:
+		dstKey, err = NewObjectKey(ak.AccountID, &dstbucket, params.ServerSideEncryption, params.CustomerKey)
+	case params.CustomerKey != nil:
+		if params.ServerSideEncryption != nil {
+			return nil, xhttp.ToError(xhttp.ErrIncompatibleEncryptionMethod)
+		}
+		dstKey, err = wrapCustomerKey(ak.AccountID, params.CustomerKey, srcKey)
+	default:
+		// 加密的源对象复用数据密钥，只按目标的加密方式重新包装，chunk 可以直接共用
+		dstKey, err = wrapObjectKey(ak.AccountID, resolveSSE(&dstbucket, params.ServerSideEncryption), srcKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dstKey.Apply(dstobj)
+	// 一个加密一个不加密时数据不能共用，内联数据直接转换，其他的重新写入
+	if (srcKey != nil) != (dstobj.SSEKey != nil) {
+		if srcobj.ChunksInline == nil {
+			return o.rewriteObject(&srcobj, dstobj)
+		}
+		data, err := openInline(srcobj.ChunksInline.Data, srcKey)
+		if err == nil {
+			data, err = sealInline(data, dstobj.SSEKey)
+		}
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to convert %s/%s inline data: %v", srcobj.Bucket, srcobj.Key, err)
+			return nil, fmt.Errorf("failed to convert %s/%s inline data: %w", srcobj.Bucket, srcobj.Key, err)
+		}
+		dstobj.ChunksInline = &meta.InlineChunk{Compress: srcobj.ChunksInline.Compress, Data: data}
+	}
 
 	if srcobj.DataLocation == dstobj.DataLocation {
 		txn, err := o.kvstore.BeginTxn(context.Background(), nil)
@@ -1226,25 +1464,16 @@ func (o *ObjectService) CopyObject(srcBucket, srcObject string, params *BaseObje
 			logger.GetLogger("dedups3").Errorf("%s/%s get object failed: %v", _dstobj.Bucket, _dstobj.Key, err)
 			return nil, fmt.Errorf("%s/%s get object failed: %w", _dstobj.Bucket, _dstobj.Key, err)
 		}
-		if exists && len(_dstobj.Chunks) > 0 {
-			gckey := gc.GCChunkPrefix + utils.GenUUID()
-			gcData := gc.GCChunk{
-				GCData: gc.GCData{
-					CreateAt: time.Now().UTC(),
-					Items:    make([]gc.GCItem, 0),
-				},
-			}
-			for _, id := range _dstobj.Chunks {
-				gcData.Items = append(gcData.Items, gc.GCItem{StorageID: _dstobj.DataLocation, ID: id})
-			}
-
-			err = txn.Set(gckey, &gcData)
-			if err != nil {
-				logger.GetLogger("dedups3").Errorf("%s/%s set gc chunk failed: %v", _dstobj.Bucket, _dstobj.Key, err)
-				return nil, fmt.Errorf("%s/%s set gc chunk failed: %w", _dstobj.Bucket, _dstobj.Key, err)
-			} else {
-				logger.GetLogger("dedups3").Infof("%s/%s set gc chunk %s delay to proccess", _dstobj.Bucket, _dstobj.Key, gckey)
-			}
+		var oldobj *meta.Object
+		if exists {
+			oldobj = &_dstobj
+		}
+		gcItems, err := chunk.ArchiveObject(txn, ak.AccountID, oldobj, dstobj)
+		if err != nil {
+			return nil, err
+		}
+		if err := chunk.AddGCChunks(txn, gcItems); err != nil {
+			return nil, err
 		}
 
 		err = txn.Set(dstobjKey, dstobj)
@@ -1278,6 +1507,40 @@ func (o *ObjectService) CopyObject(srcBucket, srcObject string, params *BaseObje
 	}
 }
 
+// rewriteObject 读出源对象的数据，按目标对象的存储点和数据密钥重新写入
+func (o *ObjectService) rewriteObject(src, dst *meta.Object) (*meta.Object, error) {
+	cs := chunk.GetChunkService()
+	if cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get chunk service")
+		return nil, errors.New("failed to get chunk service")
+	}
+	reader, err := o.ReadObjectData(src)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// 分段上传的 ETag 不是数据的 MD5，清空后由切分重新计算
+	dst.ETag = ""
+	dst.Chunks = nil
+	dst.ChunksInline = nil
+	dst.Parts = nil
+	dst.Incompressible = utils.IsCompressedContentType(dst.ContentType)
+	if err := cs.DoChunk(reader, meta.ObjectToBaseObject(dst), o.WriteObjectMeta); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to rewrite %s/%s to %s/%s: %v", src.Bucket, src.Key, dst.Bucket, dst.Key, err)
+		return nil, err
+	}
+
+	if cache, err := xcache.GetCache(); err == nil && cache != nil {
+		_ = cache.Del(context.Background(), "aws:object:"+dst.Owner.ID+":"+dst.Bucket+"/"+dst.Key)
+	}
+	if _stats := stats.GetStatsService(); _stats != nil {
+		_stats.RefreshAccountStats(dst.Owner.ID)
+	}
+	logger.GetLogger("dedups3").Infof("rewrite object %s/%s to %s/%s finish", src.Bucket, src.Key, dst.Bucket, dst.Key)
+	return dst, nil
+}
+
 // CanCopyObject 判断 CopyObject 是否允许
 // 返回：是否允许, HTTP状态码
 func (o *ObjectService) CanCopyObject(dest CopyObjectInfo, src CopyObjectInfo, cond CopyObjectConditions) (bool, int) {
@@ -1554,6 +1817,16 @@ func (o *ObjectService) RenameObject(params *BaseObjectParams) (*meta.Object, er
 		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
 	}
 
+	// 重命名会原地移走当前版本且不产生删除标记，开启过版本控制的桶暂不支持
+	bucket, err := o.getBucket(ak.AccountID, params.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	if bucket.Versioning.IsEnabled() || bucket.Versioning.IsSuspended() {
+		logger.GetLogger("dedups3").Errorf("bucket %s is versioned, rename object is not implemented", params.BucketName)
+		return nil, xhttp.ToError(xhttp.ErrNotImplemented)
+	}
+
 	// 检查 源object 是否存在
 	srcobjkey := "aws:object:" + ak.AccountID + ":" + params.BucketName + "/" + params.ObjKey
 	var srcobj meta.Object
@@ -1668,26 +1941,26 @@ func (o *ObjectService) RenameObject(params *BaseObjectParams) (*meta.Object, er
 		}
 	}()
 
-	// 如果目标 object name已经存在 ，需要先删除旧的索引
-	if dstObjOK && len(dstObj.Chunks) > 0 {
-		gckey := gc.GCChunkPrefix + utils.GenUUID()
-		gcData := gc.GCChunk{
-			GCData: gc.GCData{
-				CreateAt: time.Now().UTC(),
-				Items:    make([]gc.GCItem, 0),
-			},
-		}
-		for _, id := range dstObj.Chunks {
-			gcData.Items = append(gcData.Items, gc.GCItem{StorageID: dstObj.DataLocation, ID: id})
-		}
+	// 处于保留期的源对象不能被移走
+	if err := CheckObjectLock(&srcobj, params.BypassGovernance); err != nil {
+		return nil, err
+	}
 
-		err = txn.Set(gckey, &gcData)
-		if err != nil {
-			logger.GetLogger("dedups3").Errorf("%s/%s set gc chunk failed: %v", dstObj.Bucket, dstObj.Key, err)
-			return nil, fmt.Errorf("%s/%s set gc chunk failed: %w", dstObj.Bucket, dstObj.Key, err)
-		} else {
-			logger.GetLogger("dedups3").Infof("%s/%s set gc chunk %s delay to proccess", dstObj.Bucket, dstObj.Key, gckey)
-		}
+	// 如果目标 object name已经存在，旧对象按覆盖写处理，锁定的对象拒绝覆盖
+	newObj := srcobj.Clone()
+	newObj.Key = params.DestObjKey
+	newObj.LastModified = time.Now().UTC()
+	newObj.ReplicationStatus = ""
+	var oldObj *meta.Object
+	if dstObjOK {
+		oldObj = &dstObj
+	}
+	gcItems, err := chunk.ArchiveObject(txn, ak.AccountID, oldObj, newObj)
+	if err != nil {
+		return nil, err
+	}
+	if err := chunk.AddGCChunks(txn, gcItems); err != nil {
+		return nil, err
 	}
 
 	// 删除 源object 的 key
@@ -1698,9 +1971,7 @@ func (o *ObjectService) RenameObject(params *BaseObjectParams) (*meta.Object, er
 	}
 
 	//重新设置 新key
-	srcobj.Key = params.DestObjKey
-	srcobj.LastModified = time.Now().UTC()
-	err = txn.Set(dstobjkey, &srcobj)
+	err = txn.Set(dstobjkey, newObj)
 	if err != nil {
 		logger.GetLogger("dedups3").Errorf("failed to update object %s : %v", dstobjkey, err)
 		return nil, fmt.Errorf("failed to update object: %w", err)
@@ -1720,5 +1991,5 @@ func (o *ObjectService) RenameObject(params *BaseObjectParams) (*meta.Object, er
 	}
 
 	logger.GetLogger("dedups3").Infof("successfully renamed object %s to %s", params.ObjKey, params.DestObjKey)
-	return &srcobj, nil
+	return newObj, nil
 }
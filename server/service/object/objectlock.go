@@ -0,0 +1,311 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/iam"
+)
+
+// ParseObjectLockHeaders 解析 x-amz-object-lock-* 请求头
+// 没有对应的请求头时返回 nil
+func ParseObjectLockHeaders(headers http.Header) (*meta.Retention, *meta.LegalHold, error) {
+	var retention *meta.Retention
+	var legalHold *meta.LegalHold
+
+	mode := strings.TrimSpace(headers.Get(xhttp.AmzObjectLockMode))
+	until := strings.TrimSpace(headers.Get(xhttp.AmzObjectLockRetainUntilDate))
+	if mode != "" || until != "" {
+		// mode 和 retain-until-date 必须同时提供
+		if mode == "" || until == "" {
+			logger.GetLogger("dedups3").Errorf("object lock mode %s and retain until date %s must both be supplied", mode, until)
+			return nil, nil, xhttp.ToError(xhttp.ErrObjectLockInvalidHeaders)
+		}
+		mode = strings.ToUpper(mode)
+		if mode != meta.RetentionGovernance && mode != meta.RetentionCompliance {
+			logger.GetLogger("dedups3").Errorf("unknown object lock mode %s", mode)
+			return nil, nil, xhttp.ToError(xhttp.ErrUnknownWORMModeDirective)
+		}
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("invalid object lock retain until date %s: %v", until, err)
+			return nil, nil, xhttp.ToError(xhttp.ErrInvalidRetentionDate)
+		}
+		if !t.After(time.Now().UTC()) {
+			logger.GetLogger("dedups3").Errorf("object lock retain until date %s is in the past", until)
+			return nil, nil, xhttp.ToError(xhttp.ErrPastObjectLockRetainDate)
+		}
+		retention = &meta.Retention{Mode: mode, RetainUntilDate: t.UTC()}
+	}
+
+	if status := strings.TrimSpace(headers.Get(xhttp.AmzObjectLockLegalHold)); status != "" {
+		legalHold = &meta.LegalHold{Status: strings.ToUpper(status)}
+		if err := legalHold.Validate(); err != nil {
+			logger.GetLogger("dedups3").Errorf("invalid object lock legal hold %s: %v", status, err)
+			return nil, nil, xhttp.ToError(xhttp.ErrInvalidRequest)
+		}
+	}
+	return retention, legalHold, nil
+}
+
+// ApplyObjectLock 把请求指定的保留设置写入对象，未指定时使用桶的默认保留规则
+func ApplyObjectLock(bucket *meta.BucketMetadata, obj *meta.Object, retention *meta.Retention, legalHold *meta.LegalHold) error {
+	obj.LockMode = ""
+	obj.LockRetainUntil = time.Time{}
+	obj.LegalHold = false
+
+	if !bucket.ObjectLock.IsEnabled() {
+		if retention != nil || legalHold != nil {
+			logger.GetLogger("dedups3").Errorf("bucket %s is missing object lock configuration", bucket.Name)
+			return xhttp.ToError(xhttp.ErrInvalidBucketObjectLockConfiguration)
+		}
+		return nil
+	}
+
+	if retention != nil {
+		obj.LockMode = retention.Mode
+		obj.LockRetainUntil = retention.RetainUntilDate
+	} else if rule := bucket.ObjectLock.Rule; rule != nil && rule.DefaultRetention != nil {
+		obj.LockMode = rule.DefaultRetention.Mode
+		obj.LockRetainUntil = rule.DefaultRetention.RetainUntil(time.Now().UTC())
+	}
+	if legalHold != nil {
+		obj.LegalHold = legalHold.IsLegalHoldActive()
+	}
+	return nil
+}
+
+// CheckObjectLock 检查对象是否可以被删除或覆盖
+func CheckObjectLock(obj *meta.Object, bypassGovernance bool) error {
+	if obj == nil || obj.DeleteMarker {
+		return nil
+	}
+	if obj.IsLocked(bypassGovernance) {
+		logger.GetLogger("dedups3").Errorf("object %s/%s version %s is locked", obj.Bucket, obj.Key, obj.GetVersionID())
+		return xhttp.ToError(xhttp.ErrObjectLocked)
+	}
+	return nil
+}
+
+// loadObjectVersion 在事务中读取对象的指定版本，返回存储key和对象
+// versionID 为空时读取当前版本
+func (o *ObjectService) loadObjectVersion(txn kv.Txn, accountID, bucket, key, versionID string) (string, *meta.Object, error) {
+	objkey := "aws:object:" + accountID + ":" + bucket + "/" + key
+	var current meta.Object
+	exists, err := txn.Get(objkey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objkey, err)
+		return "", nil, err
+	}
+	if versionID == "" {
+		if !exists {
+			logger.GetLogger("dedups3").Infof("object %s does not exist", objkey)
+			return "", nil, xhttp.ToError(xhttp.ErrNoSuchKey)
+		}
+		return objkey, &current, nil
+	}
+	if exists && current.GetVersionID() == versionID {
+		return objkey, &current, nil
+	}
+
+	versionKey, err := chunk.FindVersionKey(txn, accountID, bucket, key, versionID)
+	if err != nil {
+		return "", nil, err
+	}
+	var version meta.Object
+	exists = false
+	if versionKey != "" {
+		exists, err = txn.Get(versionKey, &version)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to fetch object version %s: %v", versionKey, err)
+			return "", nil, err
+		}
+	}
+	if !exists {
+		logger.GetLogger("dedups3").Infof("object %s/%s version %s does not exist", bucket, key, versionID)
+		return "", nil, xhttp.ToError(xhttp.ErrNoSuchVersion)
+	}
+	if version.DeleteMarker {
+		logger.GetLogger("dedups3").Infof("object %s/%s version %s is a delete marker", bucket, key, versionID)
+		return "", nil, xhttp.ToError(xhttp.ErrMethodNotAllowed)
+	}
+	return versionKey, &version, nil
+}
+
+// updateObjectLock 修改对象版本的锁定信息
+func (o *ObjectService) updateObjectLock(params *BaseObjectParams, update func(obj *meta.Object) error) (*meta.Object, error) {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return nil, errors.New("failed to get iam service")
+	}
+
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucket, err := o.getBucket(ak.AccountID, params.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	if !bucket.ObjectLock.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s is missing object lock configuration", params.BucketName)
+		return nil, xhttp.ToError(xhttp.ErrInvalidBucketObjectLockConfiguration)
+	}
+
+	txn, err := o.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	storeKey, obj, err := o.loadObjectVersion(txn, ak.AccountID, params.BucketName, params.ObjKey, params.VersionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(obj); err != nil {
+		return nil, err
+	}
+	if err := txn.Set(storeKey, obj); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s set object lock failed: %v", params.BucketName, params.ObjKey, err)
+		return nil, fmt.Errorf("%s/%s set object lock failed: %w", params.BucketName, params.ObjKey, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s commit failed: %v", params.BucketName, params.ObjKey, err)
+		return nil, kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), "aws:object:"+ak.AccountID+":"+params.BucketName+"/"+params.ObjKey)
+	}
+	return obj, nil
+}
+
+// GetObjectRetention 获取对象版本的保留设置
+func (o *ObjectService) GetObjectRetention(params *BaseObjectParams) (*meta.Retention, error) {
+	obj, err := o.getObjectLockTarget(params)
+	if err != nil {
+		return nil, err
+	}
+	retention := obj.GetRetention()
+	if retention == nil {
+		logger.GetLogger("dedups3").Infof("object %s/%s has no retention", params.BucketName, params.ObjKey)
+		return nil, xhttp.ToError(xhttp.ErrNoSuchObjectLockConfiguration)
+	}
+	return retention, nil
+}
+
+// PutObjectRetention 设置对象版本的保留设置
+func (o *ObjectService) PutObjectRetention(params *BaseObjectParams, retention *meta.Retention) (*meta.Object, error) {
+	next := retention
+	if next.IsEmpty() {
+		next = nil
+	} else if !next.RetainUntilDate.After(time.Now().UTC()) {
+		logger.GetLogger("dedups3").Errorf("retain until date %s is in the past", next.RetainUntilDate)
+		return nil, xhttp.ToError(xhttp.ErrPastObjectLockRetainDate)
+	}
+
+	return o.updateObjectLock(params, func(obj *meta.Object) error {
+		if !obj.GetRetention().IsUpdateAllowed(next, params.BypassGovernance) {
+			logger.GetLogger("dedups3").Errorf("object %s/%s retention %s can not be weakened", obj.Bucket, obj.Key, obj.LockMode)
+			return xhttp.ToError(xhttp.ErrObjectLocked)
+		}
+		if next == nil {
+			obj.LockMode = ""
+			obj.LockRetainUntil = time.Time{}
+		} else {
+			obj.LockMode = next.Mode
+			obj.LockRetainUntil = next.RetainUntilDate.UTC()
+		}
+		return nil
+	})
+}
+
+// GetObjectLegalHold 获取对象版本的法律保留状态
+func (o *ObjectService) GetObjectLegalHold(params *BaseObjectParams) (*meta.LegalHold, error) {
+	obj, err := o.getObjectLockTarget(params)
+	if err != nil {
+		return nil, err
+	}
+	legalHold := &meta.LegalHold{Status: meta.LegalHoldOff}
+	if obj.LegalHold {
+		legalHold.Status = meta.LegalHoldOn
+	}
+	return legalHold, nil
+}
+
+// PutObjectLegalHold 设置对象版本的法律保留状态
+func (o *ObjectService) PutObjectLegalHold(params *BaseObjectParams, legalHold *meta.LegalHold) (*meta.Object, error) {
+	return o.updateObjectLock(params, func(obj *meta.Object) error {
+		obj.LegalHold = legalHold.IsLegalHoldActive()
+		return nil
+	})
+}
+
+// getObjectLockTarget 读取需要查询锁定信息的对象版本
+func (o *ObjectService) getObjectLockTarget(params *BaseObjectParams) (*meta.Object, error) {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return nil, errors.New("failed to get iam service")
+	}
+
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+
+	bucket, err := o.getBucket(ak.AccountID, params.BucketName)
+	if err != nil {
+		return nil, err
+	}
+	if !bucket.ObjectLock.IsEnabled() {
+		logger.GetLogger("dedups3").Errorf("bucket %s is missing object lock configuration", params.BucketName)
+		return nil, xhttp.ToError(xhttp.ErrInvalidBucketObjectLockConfiguration)
+	}
+
+	txn, err := o.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	_, obj, err := o.loadObjectVersion(txn, ak.AccountID, params.BucketName, params.ObjKey, params.VersionID)
+	return obj, err
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/block"
+	"github.com/mageg-x/dedups3/service/chunk"
+)
+
+const (
+	// defaultReadBudget server.memlimit 解析失败时的读缓冲预算
+	defaultReadBudget = 4 << 30
+)
+
+var (
+	readBudgetOnce sync.Once
+	readBudget     *memBudget
+	readBudgetSize int64
+)
+
+// memBudget 读缓冲内存预算
+// 和 semaphore 不同，读完后实际大小超过预留时直接记账，允许短时间超出预算
+type memBudget struct {
+	mu     sync.Mutex
+	size   int64
+	used   int64
+	notify chan struct{} // 有预算归还时关闭
+}
+
+func newMemBudget(size int64) *memBudget {
+	return &memBudget{size: size, notify: make(chan struct{})}
+}
+
+// tryAcquire 预算足够时预留 n 字节，不等待
+func (b *memBudget) tryAcquire(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used > 0 && b.used+n > b.size {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// acquire 等待预算足够后预留 n 字节，预算全部空闲时总能预留成功
+func (b *memBudget) acquire(ctx context.Context, n int64) error {
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+n <= b.size {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		notify := b.notify
+		b.mu.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// charge 记账 n 字节，不检查预算
+func (b *memBudget) charge(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n
+}
+
+// release 归还 n 字节并唤醒等待的请求
+func (b *memBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// getReadBudget 所有读对象请求共享的读缓冲预算，为 server.memlimit 的一半
+// 预算用完时预读等待其他请求释放，避免大量并发下载把内存撑爆
+func getReadBudget() (*memBudget, int64) {
+	readBudgetOnce.Do(func() {
+		readBudgetSize = defaultReadBudget
+		limit, err := humanize.ParseBytes(xconf.Get().Server.Memlimit)
+		if err == nil && limit > 0 {
+			readBudgetSize = int64(limit / 2)
+		} else {
+			logger.GetLogger("dedups3").Warnf("invalid server memlimit %q, use default read budget: %v", xconf.Get().Server.Memlimit, err)
+		}
+		readBudget = newMemBudget(readBudgetSize)
+	})
+	return readBudget, readBudgetSize
+}
+
+// blockLoad 读取计划中的一个块，块数据在最后一个用到它的 chunk 读完后释放
+type blockLoad struct {
+	id       string
+	blk      *meta.Block
+	hashes   map[string]bool // 要读的 chunk
+	last     int             // 最后一个用到这个块的 chunk 序号
+	reserved int64           // 占用的读缓冲预算
+	used     bool            // 已经开始使用，只由读数据的协程访问
+	done     chan struct{}
+	data     *meta.BlockData
+	err      error
+}
+
+// readPlan 按对象 chunk 的顺序排好的块读取计划，块按第一次用到的顺序预读
+type readPlan struct {
+	loads   []*blockLoad
+	byBlock map[string]*blockLoad
+	window  chan struct{} // 已经开始预读还没用到的块数不超过预读数
+	held    int64         // 计划中所有块占用的读缓冲预算
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// newReadPlan 计算读出 [start, end] 范围需要的块
+func newReadPlan(chunks []*meta.Chunk, start, end int64, encrypted bool) *readPlan {
+	plan := &readPlan{byBlock: make(map[string]*blockLoad)}
+	offset := int64(0)
+	for i, _chunk := range chunks {
+		offset += chunk.PlainChunkSize(_chunk, encrypted)
+		if offset <= start {
+			continue
+		}
+		ld := plan.byBlock[_chunk.BlockID]
+		if ld == nil {
+			ld = &blockLoad{id: _chunk.BlockID, hashes: make(map[string]bool), done: make(chan struct{})}
+			plan.byBlock[_chunk.BlockID] = ld
+			plan.loads = append(plan.loads, ld)
+		}
+		ld.hashes[_chunk.Hash] = true
+		ld.last = i
+		if offset > end {
+			break
+		}
+	}
+	return plan
+}
+
+// blockIDs 计划中所有块的ID
+func (p *readPlan) blockIDs() []string {
+	ids := make([]string, 0, len(p.loads))
+	for _, ld := range p.loads {
+		ids = append(ids, ld.id)
+	}
+	return ids
+}
+
+// prefetch 按计划顺序预读块，最多预读到当前块之后 block.prefetch_num 个，每个块读之前先从读缓冲预算中预留内存
+// 已经占用预算时不等待预算，否则前面的块要等后面的块预读完才会用到并释放，会互相等待
+// 预算不够时直接读不预留，读完后按实际大小记账
+func (p *readPlan) prefetch(ctx context.Context, bs *block.BlockService, storageID string) {
+	num := xconf.Get().Block.PrefetchNum
+	if num <= 0 {
+		num = 1
+	}
+	budget, budgetSize := getReadBudget()
+	p.window = make(chan struct{}, num)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for _, ld := range p.loads {
+			select {
+			case p.window <- struct{}{}:
+			case <-ctx.Done():
+				p.fail(ld, ctx.Err())
+				continue
+			}
+			// 单个块超过整个预算时只预留整个预算
+			size := min(block.ChunksReadSize(ld.blk, ld.hashes), budgetSize)
+			p.mu.Lock()
+			holding := p.held > 0
+			p.mu.Unlock()
+			if !holding {
+				if err := budget.acquire(ctx, size); err != nil {
+					p.fail(ld, err)
+					continue
+				}
+			} else if !budget.tryAcquire(size) {
+				size = 0
+			}
+			p.mu.Lock()
+			ld.reserved = size
+			p.held += size
+			p.mu.Unlock()
+
+			p.wg.Add(1)
+			go func(ld *blockLoad) {
+				defer p.wg.Done()
+				data, err := bs.ReadBlockChunks(storageID, ld.blk, ld.hashes)
+				if err == nil && (data == nil || len(data.Data) == 0) {
+					err = fmt.Errorf("block %s data is empty", ld.id)
+				}
+				ld.data, ld.err = data, err
+				// 按实际读出的大小记账，少于预留时归还多余的预算
+				actual := int64(0)
+				if err == nil {
+					actual = int64(len(data.Data))
+				}
+				p.mu.Lock()
+				if actual < ld.reserved {
+					budget.release(ld.reserved - actual)
+				} else if actual > ld.reserved {
+					budget.charge(actual - ld.reserved)
+				}
+				p.held += actual - ld.reserved
+				ld.reserved = actual
+				p.mu.Unlock()
+				close(ld.done)
+			}(ld)
+		}
+	}()
+}
+
+func (p *readPlan) fail(ld *blockLoad, err error) {
+	ld.err = err
+	close(ld.done)
+}
+
+// get 等待块读完，第一次用到块时让出一个预读位置
+func (p *readPlan) get(ctx context.Context, blockID string) (*meta.BlockData, error) {
+	ld := p.byBlock[blockID]
+	if ld == nil {
+		return nil, fmt.Errorf("block %s is not in read plan", blockID)
+	}
+	select {
+	case <-ld.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !ld.used {
+		ld.used = true
+		select {
+		case <-p.window:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return ld.data, ld.err
+}
+
+// release 序号为 i 的 chunk 读完后释放最后一次用到的块
+func (p *readPlan) release(blockID string, i int) {
+	ld := p.byBlock[blockID]
+	if ld == nil || ld.last != i {
+		return
+	}
+	p.free(ld)
+}
+
+func (p *readPlan) free(ld *blockLoad) {
+	budget, _ := getReadBudget()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ld.data = nil
+	if ld.reserved > 0 {
+		budget.release(ld.reserved)
+		p.held -= ld.reserved
+		ld.reserved = 0
+	}
+}
+
+// close 取消还没完成的预读，等预读协程退出后归还所有预算
+func (p *readPlan) close(cancel context.CancelFunc) {
+	cancel()
+	go func() {
+		p.wg.Wait()
+		for _, ld := range p.loads {
+			p.free(ld)
+		}
+	}()
+}
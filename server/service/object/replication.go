@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+)
+
+// 以下接口供后台复制服务使用，以桶所有者的身份执行，不经过 IAM 校验
+
+// GetBucketMeta 获取桶元数据
+func (o *ObjectService) GetBucketMeta(accountID, bucketName string) (*meta.BucketMetadata, error) {
+	return o.getBucket(accountID, bucketName)
+}
+
+// GetCurrentObject 获取对象的当前版本，不存在时返回 nil
+func (o *ObjectService) GetCurrentObject(accountID, bucket, key string) (*meta.Object, error) {
+	objkey := "aws:object:" + accountID + ":" + bucket + "/" + key
+	var current meta.Object
+	exists, err := o.kvstore.Get(objkey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objkey, err)
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	return &current, nil
+}
+
+// ReadObjectData 读取对象的全部数据
+func (o *ObjectService) ReadObjectData(obj *meta.Object) (io.ReadCloser, error) {
+	if obj.Size == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return o.readObject(obj, 0, obj.Size-1)
+}
+
+// SetReplicationStatus 更新对象当前版本的复制状态
+// 对象在此期间被覆盖或删除时返回 chunk.ErrObjectChanged
+func (o *ObjectService) SetReplicationStatus(accountID string, obj *meta.Object, status string) error {
+	objkey := "aws:object:" + accountID + ":" + obj.Bucket + "/" + obj.Key
+	txn, err := o.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var current meta.Object
+	exists, err := txn.Get(objkey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objkey, err)
+		return fmt.Errorf("failed to fetch object %s: %w", objkey, err)
+	}
+	if !exists || current.ETag != obj.ETag || current.VersionID != obj.VersionID || !current.LastModified.Equal(obj.LastModified) {
+		logger.GetLogger("dedups3").Infof("%s/%s version %s changed before set replication status", obj.Bucket, obj.Key, obj.GetVersionID())
+		return chunk.ErrObjectChanged
+	}
+	if current.ReplicationStatus == status {
+		return nil
+	}
+
+	current.ReplicationStatus = status
+	if err := txn.Set(objkey, &current); err != nil {
+		logger.GetLogger("dedups3").Errorf("set object %s replication status failed: %v", objkey, err)
+		return fmt.Errorf("set object %s replication status failed: %w", objkey, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s commit failed: %v", obj.Bucket, obj.Key, err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), objkey)
+	}
+	obj.ReplicationStatus = status
+	logger.GetLogger("dedups3").Debugf("set object %s/%s replication status %s", obj.Bucket, obj.Key, status)
+	return nil
+}
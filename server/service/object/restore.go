@@ -0,0 +1,446 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/gc"
+	"github.com/mageg-x/dedups3/service/iam"
+)
+
+const (
+	restoreLockKey   = "aws:lock:restore"
+	restoreLockOwner = "ObjectService"
+	restoreBatchSize = 100
+	// restoreInterval 两轮扫描恢复任务之间的间隔，新的恢复请求会立即唤醒扫描
+	restoreInterval = time.Minute
+)
+
+var (
+	errRestoreCanceled = errors.New("restore canceled")
+	// restoreKick 唤醒本节点的恢复任务扫描
+	restoreKick = make(chan struct{}, 1)
+)
+
+// RestoreObject 发起归档对象的恢复，返回 true 表示新建了恢复任务
+// 已经恢复完成的对象只更新临时副本的过期时间，恢复进行中时返回 ErrObjectRestoreAlreadyInProgress
+func (o *ObjectService) RestoreObject(params *BaseObjectParams, req *meta.RestoreRequest) (bool, error) {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return false, errors.New("failed to get iam service")
+	}
+
+	ak, err := iamService.GetAccessKey(params.AccessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", params.AccessKeyID)
+		return false, xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	if _, err := o.getBucket(ak.AccountID, params.BucketName); err != nil {
+		return false, err
+	}
+
+	var obj *meta.Object
+	if params.VersionID != "" {
+		if obj, err = o.getObjectVersion(ak.AccountID, params.BucketName, params.ObjKey, params.VersionID); err != nil {
+			return false, err
+		}
+	} else {
+		if obj, err = o.GetCurrentObject(ak.AccountID, params.BucketName, params.ObjKey); err != nil {
+			return false, err
+		}
+		if obj == nil || obj.DeleteMarker {
+			logger.GetLogger("dedups3").Infof("object %s/%s does not exist", params.BucketName, params.ObjKey)
+			return false, xhttp.ToError(xhttp.ErrNoSuchKey)
+		}
+	}
+	if !meta.IsArchiveClass(obj.StorageClass) {
+		logger.GetLogger("dedups3").Errorf("object %s/%s storage class %s can not be restored", obj.Bucket, obj.Key, obj.StorageClass)
+		return false, xhttp.ToError(xhttp.ErrInvalidObjectState)
+	}
+
+	key := meta.GenRestoreKey(ak.AccountID, obj.Bucket, obj.Key, obj.GetVersionID())
+	txn, err := o.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var current meta.Restore
+	exists, err := txn.Get(key, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get restore %s: %v", key, err)
+		return false, fmt.Errorf("failed to get restore %s: %w", key, err)
+	}
+	now := time.Now().UTC()
+	if exists && current.Matches(obj) && !current.IsExpired(now) {
+		if current.Ongoing {
+			logger.GetLogger("dedups3").Infof("object %s/%s restore is already in progress", obj.Bucket, obj.Key)
+			return false, xhttp.ToError(xhttp.ErrObjectRestoreAlreadyInProgress)
+		}
+		// 已经恢复的对象，从现在开始重新计算过期时间
+		current.Days = req.Days
+		current.ExpiryDate = meta.RestoreExpiry(now, req.Days)
+		if err := txn.Set(key, &current); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to set restore %s: %v", key, err)
+			return false, fmt.Errorf("failed to set restore %s: %w", key, err)
+		}
+		if err := txn.Commit(); err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to commit restore %s: %v", key, err)
+			return false, kv.ErrTxnCommit
+		}
+		txn = nil
+		logger.GetLogger("dedups3").Infof("object %s/%s restore expiry extended to %s", obj.Bucket, obj.Key, current.ExpiryDate)
+		return false, nil
+	}
+
+	// 过期或者已经失效的旧副本先回收
+	if exists {
+		if err := chunk.AddGCChunks(txn, restoreGCItems(&current)); err != nil {
+			return false, err
+		}
+	}
+	restore := &meta.Restore{
+		AccountID:    ak.AccountID,
+		Bucket:       obj.Bucket,
+		Key:          obj.Key,
+		VersionID:    obj.GetVersionID(),
+		ETag:         obj.ETag,
+		LastModified: obj.LastModified,
+		Tier:         req.GetTier(),
+		Days:         req.Days,
+		Ongoing:      true,
+		RequestAt:    now,
+		Chunks:       make([]string, 0),
+	}
+	if err := txn.Set(key, restore); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to set restore %s: %v", key, err)
+		return false, fmt.Errorf("failed to set restore %s: %w", key, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit restore %s: %v", key, err)
+		return false, kv.ErrTxnCommit
+	}
+	txn = nil
+
+	select {
+	case restoreKick <- struct{}{}:
+	default:
+	}
+	logger.GetLogger("dedups3").Infof("object %s/%s version %s restore requested, tier %s days %d", obj.Bucket, obj.Key, restore.VersionID, restore.Tier, restore.Days)
+	return true, nil
+}
+
+// getRestore 获取对象版本的恢复任务，没有恢复过或者恢复副本已经失效时返回 nil
+func (o *ObjectService) getRestore(accountID string, obj *meta.Object) (*meta.Restore, error) {
+	key := meta.GenRestoreKey(accountID, obj.Bucket, obj.Key, obj.GetVersionID())
+	var restore meta.Restore
+	exists, err := o.kvstore.Get(key, &restore)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get restore %s: %v", key, err)
+		return nil, err
+	}
+	if !exists || !restore.Matches(obj) || restore.IsExpired(time.Now().UTC()) {
+		return nil, nil
+	}
+	return &restore, nil
+}
+
+// setRestoreStatus 填充归档对象的恢复状态，用于 x-amz-restore 头
+func (o *ObjectService) setRestoreStatus(accountID string, obj *meta.Object) error {
+	obj.RestoreStatus = ""
+	if !meta.IsArchiveClass(obj.StorageClass) {
+		return nil
+	}
+	restore, err := o.getRestore(accountID, obj)
+	if err != nil {
+		return err
+	}
+	if restore != nil {
+		obj.RestoreStatus = restore.Status()
+	}
+	return nil
+}
+
+// ResolveArchived 归档对象只有恢复完成后才能读取，数据改为从恢复出来的临时副本读取
+// 未恢复或者恢复还在进行时返回 ErrInvalidObjectState
+func (o *ObjectService) ResolveArchived(accountID string, obj *meta.Object) error {
+	if !meta.IsArchiveClass(obj.StorageClass) {
+		return nil
+	}
+	restore, err := o.getRestore(accountID, obj)
+	if err != nil {
+		return err
+	}
+	if restore == nil || restore.Ongoing {
+		logger.GetLogger("dedups3").Errorf("object %s/%s in %s is not restored", obj.Bucket, obj.Key, obj.StorageClass)
+		return xhttp.ToError(xhttp.ErrInvalidObjectState)
+	}
+	obj.RestoreStatus = restore.Status()
+	if obj.ChunksInline == nil && len(obj.Chunks) > 0 {
+		obj.DataLocation = restore.DataLocation
+		obj.Chunks = append([]string(nil), restore.Chunks...)
+	}
+	return nil
+}
+
+// StartRestore 启动后台任务，执行恢复请求并回收过期的临时副本
+func (o *ObjectService) StartRestore() {
+	go func() {
+		for {
+			if n, err := o.ProcessRestores(); err != nil {
+				logger.GetLogger("dedups3").Errorf("process restores failed after %d objects: %v", n, err)
+			} else if n > 0 {
+				logger.GetLogger("dedups3").Infof("process %d object restores finished", n)
+			}
+			select {
+			case <-restoreKick:
+			case <-time.After(restoreInterval):
+			}
+		}
+	}()
+}
+
+// ProcessRestores 扫描所有恢复任务，恢复进行中的对象，回收过期或者失效的副本，返回处理的任务数
+func (o *ObjectService) ProcessRestores() (int, error) {
+	// 多个节点同一时间只允许一个执行
+	if ok, _ := o.kvstore.TryLock(restoreLockKey, restoreLockOwner, time.Hour); !ok {
+		return 0, nil
+	}
+	defer o.kvstore.UnLock(restoreLockKey, restoreLockOwner)
+
+	count := 0
+	startKey := ""
+	for {
+		keys, nextKey, err := o.scanRestoreKeys(startKey)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys {
+			done, err := o.processRestore(key)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("process restore %s failed: %v", key, err)
+				continue
+			}
+			if done {
+				count++
+			}
+		}
+		if nextKey == "" || len(keys) == 0 {
+			return count, nil
+		}
+		startKey = nextKey
+	}
+}
+
+func (o *ObjectService) scanRestoreKeys(startKey string) ([]string, string, error) {
+	txn, err := o.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin txn: %w", err)
+	}
+	defer txn.Rollback()
+	keys, nextKey, err := txn.Scan(meta.RESTORE_PREKEY, startKey, restoreBatchSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan restore keys: %w", err)
+	}
+	return keys, nextKey, nil
+}
+
+// processRestore 处理一个恢复任务，返回 true 表示完成了恢复或者回收了副本
+func (o *ObjectService) processRestore(key string) (bool, error) {
+	var restore meta.Restore
+	exists, err := o.kvstore.Get(key, &restore)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	// 源对象版本被删除或覆盖后，恢复任务和副本一起失效
+	obj, err := o.getObjectVersion(restore.AccountID, restore.Bucket, restore.Key, restore.VersionID)
+	if err != nil && !errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchVersion)) && !errors.Is(err, xhttp.ToError(xhttp.ErrMethodNotAllowed)) {
+		return false, err
+	}
+	if err != nil || !restore.Matches(obj) || !meta.IsArchiveClass(obj.StorageClass) {
+		return true, o.dropRestore(key, &restore)
+	}
+
+	if restore.Ongoing {
+		return true, o.rehydrate(key, &restore, obj)
+	}
+	if restore.IsExpired(time.Now().UTC()) {
+		return true, o.dropRestore(key, &restore)
+	}
+	return false, nil
+}
+
+// rehydrate 把归档对象的 chunk 复制到标准存储点，作为可以直接读取的临时副本
+// 标准存储点已经有的 chunk 只增加引用，不重复复制数据
+func (o *ObjectService) rehydrate(key string, restore *meta.Restore, obj *meta.Object) error {
+	cs := chunk.GetChunkService()
+	if cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get chunk service")
+		return errors.New("failed to get chunk service")
+	}
+	storageID, err := o.GetStorageID(meta.STANDARD_CLASS_STORAGE)
+	if err != nil {
+		return err
+	}
+	restore.DataLocation = storageID
+
+	// 内联数据和空对象没有 chunk，直接完成
+	if obj.ChunksInline != nil || len(obj.Chunks) == 0 {
+		return cs.WriteRestore(context.Background(), key, nil, nil, restore)
+	}
+
+	chunks, err := cs.BatchGet(obj.DataLocation, obj.Chunks)
+	if err != nil || len(chunks) != len(obj.Chunks) {
+		logger.GetLogger("dedups3").Errorf("failed to get the object %s/%s %d chunks", obj.Bucket, obj.Key, len(obj.Chunks))
+		return fmt.Errorf("failed to get the object %s/%s chunks", obj.Bucket, obj.Key)
+	}
+	missing, err := cs.MissingChunks(storageID, obj.Chunks)
+	if err != nil {
+		return err
+	}
+	want := make(map[string]struct{}, len(missing))
+	for _, hash := range missing {
+		want[hash] = struct{}{}
+	}
+
+	// 副本保存的是 chunk 原样的数据，加密 chunk 的长度包含密文开销
+	copied := obj.Clone()
+	copied.DataLocation = storageID
+	copied.ETag = ""
+	copied.Size = 0
+	for _, ck := range chunks {
+		copied.Size += int64(ck.Size)
+	}
+
+	chunkChan := make(chan *meta.Chunk, 16)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(chunkChan)
+		readErr <- o.ReadChunks(obj, func(hash string) bool {
+			_, ok := want[hash]
+			return ok
+		}, func(ck *meta.Chunk, data []byte) error {
+			select {
+			case chunkChan <- &meta.Chunk{Hash: ck.Hash, Size: ck.Size, Scope: ck.Scope, Data: data}:
+				return nil
+			case <-done:
+				return errRestoreCanceled
+			}
+		})
+	}()
+	next := func() (*meta.Chunk, error) {
+		ck, ok := <-chunkChan
+		if !ok {
+			if err := <-readErr; err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		return ck, nil
+	}
+
+	var writeErr error
+	err = cs.Ingest(next, meta.ObjectToBaseObject(copied), func(cs *chunk.ChunkService, chunks []*meta.Chunk, blocks map[string]*meta.Block, base *meta.BaseObject) error {
+		writeErr = cs.WriteRestore(context.Background(), key, chunks, blocks, restore)
+		return writeErr
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("%s/%s rehydrate to %s failed: %v", obj.Bucket, obj.Key, storageID, err)
+		return err
+	}
+	return nil
+}
+
+// dropRestore 删除恢复任务并回收临时副本
+func (o *ObjectService) dropRestore(key string, restore *meta.Restore) error {
+	txn, err := o.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	var current meta.Restore
+	exists, err := txn.Get(key, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get restore %s: %v", key, err)
+		return fmt.Errorf("failed to get restore %s: %w", key, err)
+	}
+	// 扫描之后被重新发起或者延长了过期时间
+	if !exists || !current.RequestAt.Equal(restore.RequestAt) || !current.ExpiryDate.Equal(restore.ExpiryDate) {
+		return nil
+	}
+	items := restoreGCItems(&current)
+	if err := chunk.AddGCChunks(txn, items); err != nil {
+		return err
+	}
+	if err := txn.Delete(key); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to delete restore %s: %v", key, err)
+		return fmt.Errorf("failed to delete restore %s: %w", key, err)
+	}
+	if err := txn.Commit(); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to commit restore %s: %v", key, err)
+		return kv.ErrTxnCommit
+	}
+	txn = nil
+
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		chunkKeys := make([]string, 0, len(items))
+		for _, item := range items {
+			chunkKeys = append(chunkKeys, meta.GenChunkKey(item.StorageID, item.ID))
+		}
+		_ = cache.MDel(context.Background(), chunkKeys)
+	}
+	logger.GetLogger("dedups3").Infof("restored copy of %s/%s version %s removed", current.Bucket, current.Key, current.VersionID)
+	return nil
+}
+
+// restoreGCItems 临时副本需要回收的 chunk
+func restoreGCItems(restore *meta.Restore) []gc.GCItem {
+	items := make([]gc.GCItem, 0, len(restore.Chunks))
+	for _, id := range restore.Chunks {
+		items = append(items, gc.GCItem{StorageID: restore.DataLocation, ID: id})
+	}
+	return items
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/kms"
+)
+
+const rewrapBatchSize = 100
+
+// RewrapObjectKeys 把对象当前版本和历史版本中旧主密钥包装的密钥改用当前主密钥包装，返回更新的对象数
+// 包括 SSE-S3 的数据密钥和收敛加密的范围密钥副本
+// 有对象重新包装失败时返回错误，此时旧主密钥仍在使用，不能从配置中删除
+func (o *ObjectService) RewrapObjectKeys() (int, error) {
+	count, failed := 0, 0
+	for _, prefix := range []string{"aws:object:", "aws:version:"} {
+		startKey := ""
+		for {
+			txn, err := o.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+			if err != nil {
+				return count, fmt.Errorf("failed to begin txn: %w", err)
+			}
+			keys, nextKey, err := txn.Scan(prefix, startKey, rewrapBatchSize)
+			_ = txn.Rollback()
+			if err != nil {
+				return count, fmt.Errorf("failed to scan %s: %w", prefix, err)
+			}
+			for _, key := range keys {
+				done, err := o.rewrapObject(key)
+				if err != nil {
+					logger.GetLogger("dedups3").Errorf("rewrap object %s keys failed: %v", key, err)
+					failed++
+					continue
+				}
+				if done {
+					count++
+				}
+			}
+			if nextKey == "" || len(keys) == 0 {
+				break
+			}
+			startKey = nextKey
+		}
+	}
+	if failed > 0 {
+		return count, fmt.Errorf("%d objects failed to rewrap", failed)
+	}
+	return count, nil
+}
+
+// rewrapObject 重新包装一个对象版本中的密钥，返回 true 表示有更新
+func (o *ObjectService) rewrapObject(key string) (bool, error) {
+	txn, err := o.kvstore.BeginTxn(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin txn: %w", err)
+	}
+	defer txn.Rollback()
+
+	var obj meta.Object
+	exists, err := txn.Get(key, &obj)
+	if err != nil || !exists {
+		return false, err
+	}
+	sseDone, err := RewrapObjectKey(obj.Owner.ID, obj.EncryptionType, obj.SSE)
+	if err != nil {
+		return false, err
+	}
+	scopeDone, err := chunk.RewrapScopeKey(obj.DedupScope, obj.DedupKey)
+	if err != nil {
+		return false, err
+	}
+	if !sseDone && !scopeDone {
+		return false, nil
+	}
+	if err := txn.Set(key, &obj); err != nil {
+		return false, fmt.Errorf("failed to set object meta: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit object meta: %w", err)
+	}
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Del(context.Background(), key)
+	}
+	return true, nil
+}
+
+// RewrapObjectKey 把旧主密钥包装的对象数据密钥改用当前主密钥包装，返回 true 表示有更新
+// 只有 SSE-S3 的数据密钥由主密钥直接包装，SSE-KMS 的由 KMS 密钥包装，SSE-C 的由客户密钥包装
+func RewrapObjectKey(accountID, algorithm string, sse *meta.ObjectSSE) (bool, error) {
+	if sse == nil || sse.IsCustomerKey() || algorithm == xhttp.AmzEncryptionKMS {
+		return false, nil
+	}
+	ks := kms.GetKMSService()
+	if ks == nil {
+		return false, errors.New("kms service not initialized")
+	}
+	if sse.KeyID == ks.CurrentKeyID() {
+		return false, nil
+	}
+	keyID, wrapped, err := ks.RewrapDataKey(sse.KeyID, sse.DataKey, sseContext(accountID))
+	if err != nil {
+		return false, err
+	}
+	sse.KeyID, sse.DataKey = keyID, wrapped
+	return true, nil
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	sb "github.com/mageg-x/dedups3/plugs/block"
+)
+
+// fileSection 块数据中连续的一段明文
+type fileSection struct {
+	blk    *meta.Block
+	offset int64 // 在块数据中的偏移
+	length int64
+}
+
+// isPlainBlock 分段格式并且所有分段都没有压缩和加密的块，明文在块文件中原样存放
+func isPlainBlock(blk *meta.Block) bool {
+	if blk == nil || blk.Ver != meta.BLOCK_FINALY_VER || blk.DataOffset <= 0 || len(blk.Segments) == 0 || blk.Compressed || blk.Encrypted {
+		return false
+	}
+	for _, seg := range blk.Segments {
+		if seg.Compressed || seg.Pos != seg.Offset || seg.Len != seg.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// plainSections 把 [start, end] 范围的 chunk 转成块文件中的连续片段，同一块中相邻的 chunk 合并成一段
+// 有任何一个块不是明文存放时 ok 为 false
+func plainSections(plan *readPlan, chunks []*meta.Chunk, start, end int64) ([]fileSection, bool) {
+	offsets := make(map[string]map[string]int64)
+	sections := make([]fileSection, 0, len(plan.loads))
+	pos, total := int64(0), int64(0)
+	for _, _chunk := range chunks {
+		size := int64(_chunk.Size)
+		if pos+size <= start {
+			pos += size
+			continue
+		}
+		ld := plan.byBlock[_chunk.BlockID]
+		if ld == nil || !isPlainBlock(ld.blk) {
+			return nil, false
+		}
+		offs := offsets[ld.id]
+		if offs == nil {
+			offs = make(map[string]int64, len(ld.blk.ChunkList))
+			off := int64(0)
+			for _, item := range ld.blk.ChunkList {
+				if _, ok := offs[item.Hash]; !ok {
+					offs[item.Hash] = off
+				}
+				off += int64(item.Size)
+			}
+			offsets[ld.id] = offs
+		}
+		off, ok := offs[_chunk.Hash]
+		if !ok {
+			return nil, false
+		}
+
+		lo, hi := int64(0), size
+		if start > pos {
+			lo = start - pos
+		}
+		if pos+size > end+1 {
+			hi = end + 1 - pos
+		}
+		if n := len(sections); n > 0 && sections[n-1].blk == ld.blk && sections[n-1].offset+sections[n-1].length == off+lo {
+			sections[n-1].length += hi - lo
+		} else {
+			sections = append(sections, fileSection{blk: ld.blk, offset: off + lo, length: hi - lo})
+		}
+		total += hi - lo
+		pos += size
+		if pos > end {
+			break
+		}
+	}
+	return sections, total == end-start+1
+}
+
+// plainReader 按顺序读出块文件中的片段，WriteTo 把 *os.File 片段直接交给写端，写端是 TCP 连接时走 sendfile
+type plainReader struct {
+	opener   sb.BlockFileOpener
+	store    sb.StreamBlockStore
+	sections []fileSection
+	next     int
+	cur      *io.LimitedReader
+	curID    string
+	file     *os.File
+	br       sb.BlockReader // 块文件打不开时按偏移读取
+	fileID   string
+	base     int64
+}
+
+func newPlainReader(store sb.BlockStore, opener sb.BlockFileOpener, sections []fileSection) *plainReader {
+	return &plainReader{store: sb.AsStreamStore(store), opener: opener, sections: sections}
+}
+
+// section 打开下一个片段，块文件不在本节点的磁盘上时按偏移读取
+func (r *plainReader) section() (*io.LimitedReader, error) {
+	sec := &r.sections[r.next]
+	r.next++
+	r.curID = sec.blk.ID
+	pos := sec.blk.DataOffset + sec.offset
+	if r.fileID != sec.blk.ID {
+		r.closeFile()
+		f, base, err := r.opener.OpenBlockFile(sec.blk.Location, sec.blk.ID)
+		if err != nil {
+			// 块还在内存映射区或者在其他节点上
+			logger.GetLogger("dedups3").Debugf("open block %s file failed, read by range: %v", sec.blk.ID, err)
+			br, err := r.store.OpenBlock(sec.blk.Location, sec.blk.ID)
+			if err != nil {
+				return nil, fmt.Errorf("open block %s failed: %w", sec.blk.ID, err)
+			}
+			r.br = br
+		}
+		r.file, r.fileID, r.base = f, sec.blk.ID, base
+	}
+	if r.file == nil {
+		return &io.LimitedReader{R: io.NewSectionReader(r.br, pos, sec.length), N: sec.length}, nil
+	}
+	if _, err := r.file.Seek(r.base+pos, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek block %s file failed: %w", sec.blk.ID, err)
+	}
+	return &io.LimitedReader{R: r.file, N: sec.length}, nil
+}
+
+// finish 当前片段读完，块文件比记录的短时返回错误
+func (r *plainReader) finish() error {
+	if r.cur.N != 0 {
+		return fmt.Errorf("block %s is truncated: %w", r.curID, io.ErrUnexpectedEOF)
+	}
+	r.cur = nil
+	return nil
+}
+
+func (r *plainReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if r.next >= len(r.sections) {
+				return 0, io.EOF
+			}
+			cur, err := r.section()
+			if err != nil {
+				return 0, err
+			}
+			r.cur = cur
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			if err = r.finish(); err != nil {
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+// WriteTo 实现 io.WriterTo，io.Copy 优先使用它，让写端的 ReadFrom 拿到文件
+func (r *plainReader) WriteTo(w io.Writer) (int64, error) {
+	total := int64(0)
+	for r.cur != nil || r.next < len(r.sections) {
+		if r.cur == nil {
+			cur, err := r.section()
+			if err != nil {
+				return total, err
+			}
+			r.cur = cur
+		}
+		n, err := io.Copy(w, r.cur)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if err = r.finish(); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *plainReader) closeFile() {
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+	if r.br != nil {
+		_ = r.br.Close()
+	}
+	r.file, r.br, r.fileID = nil, nil, ""
+}
+
+func (r *plainReader) Close() error {
+	r.closeFile()
+	r.cur = nil
+	r.next = len(r.sections)
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/block"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/storage"
+)
+
+// 以下接口供站点复制使用，以桶所有者的身份执行，不经过 IAM 校验
+
+// GetStorageID 获取存储类别对应的本地存储点
+func (o *ObjectService) GetStorageID(storageClass string) (string, error) {
+	if storageClass == "" {
+		storageClass = meta.STANDARD_CLASS_STORAGE
+	}
+	ss := storage.GetStorageService()
+	if ss == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get storage service")
+		return "", errors.New("failed to get storage service")
+	}
+	scs := ss.GetStoragesByClass(storageClass)
+	if len(scs) == 0 {
+		logger.GetLogger("dedups3").Errorf("no storage class %s", storageClass)
+		return "", xhttp.ToError(xhttp.ErrInvalidStorageClass)
+	}
+	return scs[0].ID, nil
+}
+
+// ReadChunks 按对象中的顺序读出chunk，want 返回 false 的chunk不读取数据，回调时 data 为 nil
+func (o *ObjectService) ReadChunks(obj *meta.Object, want func(hash string) bool, fn func(ck *meta.Chunk, data []byte) error) error {
+	cs := chunk.GetChunkService()
+	if cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get chunk service")
+		return errors.New("failed to get chunk service")
+	}
+	bs := block.GetBlockService()
+	if bs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get block service")
+		return errors.New("failed to get block service")
+	}
+	chunks, err := cs.BatchGet(obj.DataLocation, obj.Chunks)
+	if err != nil || len(chunks) != len(obj.Chunks) {
+		logger.GetLogger("dedups3").Errorf("failed to get the object %s/%s %d chunks", obj.Bucket, obj.Key, len(obj.Chunks))
+		return fmt.Errorf("failed to get the object %s/%s chunks", obj.Bucket, obj.Key)
+	}
+
+	// 为了防止内存爆炸，只保留最近使用的少量 block 数据
+	blockDatas := make(map[string]*meta.BlockData)
+	blockLoaded := make([]string, 0)
+	for _, _chunk := range chunks {
+		if !want(_chunk.Hash) {
+			if err := fn(_chunk, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_blockdata := blockDatas[_chunk.BlockID]
+		if _blockdata == nil {
+			if len(blockLoaded) > 20 {
+				delete(blockDatas, blockLoaded[0])
+				blockLoaded = blockLoaded[1:]
+			}
+			_bd, err := bs.ReadBlock(obj.DataLocation, _chunk.BlockID)
+			if err != nil || _bd == nil || len(_bd.Data) == 0 {
+				logger.GetLogger("dedups3").Errorf("failed to get the block %s data: %v", _chunk.BlockID, err)
+				return fmt.Errorf("failed to get the block %s data", _chunk.BlockID)
+			}
+			_blockdata = _bd
+			blockDatas[_chunk.BlockID] = _blockdata
+			blockLoaded = append(blockLoaded, _chunk.BlockID)
+		}
+
+		var chunkData []byte
+		blockOffset := int64(0)
+		for _, item := range _blockdata.ChunkList {
+			if item.Hash == _chunk.Hash {
+				chunkData = _blockdata.Data[blockOffset : blockOffset+int64(item.Size)]
+				break
+			}
+			blockOffset += int64(item.Size)
+		}
+		if len(chunkData) == 0 {
+			logger.GetLogger("dedups3").Errorf("chunk %s not found in block %s", _chunk.Hash, _chunk.BlockID)
+			return fmt.Errorf("chunk %s not found in block %s", _chunk.Hash, _chunk.BlockID)
+		}
+		if err := fn(_chunk, chunkData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutReplica 写入对端复制过来的对象，next 依次返回对象的chunk
+// 数据写入本地同一存储类别的存储点，本地对象不比复制的对象旧时返回 chunk.ErrReplicaStale
+func (o *ObjectService) PutReplica(accountID string, obj *meta.Object, next func() (*meta.Chunk, error)) error {
+	if _, err := o.getBucket(accountID, obj.Bucket); err != nil {
+		return err
+	}
+	storageID, err := o.GetStorageID(obj.StorageClass)
+	if err != nil {
+		return err
+	}
+	cs := chunk.GetChunkService()
+	if cs == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get chunk service")
+		return errors.New("failed to get chunk service")
+	}
+
+	obj.DataLocation = storageID
+	// 复制状态只对本站点有意义
+	obj.ReplicationStatus = ""
+	if obj.ChunksInline != nil || len(obj.Chunks) == 0 {
+		obj.Chunks = make([]string, 0)
+		return cs.WriteReplica(context.Background(), accountID, nil, nil, obj)
+	}
+
+	var writeErr error
+	err = cs.Ingest(next, meta.ObjectToBaseObject(obj), func(cs *chunk.ChunkService, chunks []*meta.Chunk, blocks map[string]*meta.Block, base *meta.BaseObject) error {
+		writeErr = cs.WriteReplica(context.Background(), accountID, chunks, blocks, meta.BaseObjectToObject(base))
+		return writeErr
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// DeleteReplica 删除对端已经删除的对象，按 LastModified 后写者胜
+// 本地对象在 deletedAt 之后被修改过时不删除，返回是否执行了删除
+func (o *ObjectService) DeleteReplica(accountID, bucketName, key string, deletedAt time.Time) (bool, error) {
+	bucket, err := o.getBucket(accountID, bucketName)
+	if err != nil {
+		return false, err
+	}
+	current, err := o.GetCurrentObject(accountID, bucketName, key)
+	if err != nil {
+		return false, err
+	}
+	if current == nil || current.DeleteMarker {
+		return false, nil
+	}
+	if !current.LastModified.Before(deletedAt) {
+		logger.GetLogger("dedups3").Infof("%s/%s modified at %s after site delete %s", bucketName, key, current.LastModified, deletedAt)
+		return false, nil
+	}
+	_, err = o.deleteObject(bucket, bucket.Owner, &BaseObjectParams{
+		BucketName: bucketName,
+		ObjKey:     key,
+		IfMatch:    string(current.ETag),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
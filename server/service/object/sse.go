@@ -0,0 +1,342 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/kms"
+)
+
+// SSERequest 请求指定的服务端加密方式
+type SSERequest struct {
+	Algorithm string // AES256 或 aws:kms
+	KMSKeyID  string // SSE-KMS 使用的密钥ID，为空时使用账户默认密钥
+}
+
+// ObjectKey 对象的加密方式和数据密钥
+type ObjectKey struct {
+	Algorithm string
+	KMSKeyID  string
+	SSE       *meta.ObjectSSE // 包装后的数据密钥，和对象元数据一起保存
+	Plain     []byte          // 数据密钥明文，仅仅存在内存中
+}
+
+// Apply 把加密信息写入对象，k 为 nil 时清除加密信息
+func (k *ObjectKey) Apply(obj *meta.Object) {
+	if k == nil {
+		obj.EncryptionType, obj.KMSKeyID, obj.SSE, obj.SSEKey = "", "", nil, nil
+		return
+	}
+	obj.EncryptionType = k.Algorithm
+	obj.KMSKeyID = k.KMSKeyID
+	obj.SSE = k.SSE
+	obj.SSEKey = k.Plain
+}
+
+// ParseSSEHeaders 解析 x-amz-server-side-encryption* 请求头
+// 没有对应的请求头时返回 nil
+func ParseSSEHeaders(headers http.Header) (*SSERequest, error) {
+	algorithm := strings.TrimSpace(headers.Get(xhttp.AmzServerSideEncryption))
+	keyID := strings.TrimSpace(headers.Get(xhttp.AmzServerSideEncryptionKmsID))
+	switch algorithm {
+	case "":
+		if keyID != "" {
+			logger.GetLogger("dedups3").Errorf("kms key id %s requires server side encryption aws:kms", keyID)
+			return nil, xhttp.ToError(xhttp.ErrInvalidEncryptionMethod)
+		}
+		return nil, nil
+	case xhttp.AmzEncryptionAES:
+		if keyID != "" {
+			logger.GetLogger("dedups3").Errorf("kms key id %s requires server side encryption aws:kms", keyID)
+			return nil, xhttp.ToError(xhttp.ErrInvalidEncryptionMethod)
+		}
+	case xhttp.AmzEncryptionKMS:
+		if keyID != "" {
+			id, err := kms.NormalizeKeyID(keyID)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("invalid kms key id %s: %v", keyID, err)
+				return nil, xhttp.ToError(xhttp.ErrInvalidEncryptionKeyID)
+			}
+			keyID = id
+		}
+	default:
+		logger.GetLogger("dedups3").Errorf("unsupported server side encryption %s", algorithm)
+		return nil, xhttp.ToError(xhttp.ErrInvalidEncryptionAlgorithmError)
+	}
+	return &SSERequest{Algorithm: algorithm, KMSKeyID: keyID}, nil
+}
+
+// CustomerKey SSE-C 请求中客户提供的密钥
+type CustomerKey struct {
+	Algorithm string
+	Key       []byte
+}
+
+// ParseCustomerKeyHeaders 解析 x-amz-server-side-encryption-customer-* 请求头
+// 没有对应的请求头时返回 nil
+func ParseCustomerKeyHeaders(headers http.Header) (*CustomerKey, error) {
+	return parseCustomerKey(headers, xhttp.AmzServerSideEncryptionCustomerAlgorithm,
+		xhttp.AmzServerSideEncryptionCustomerKey, xhttp.AmzServerSideEncryptionCustomerKeyMD5)
+}
+
+// ParseCopySourceCustomerKeyHeaders 解析复制源对象的 x-amz-copy-source-server-side-encryption-customer-* 请求头
+func ParseCopySourceCustomerKeyHeaders(headers http.Header) (*CustomerKey, error) {
+	return parseCustomerKey(headers, xhttp.AmzServerSideEncryptionCopyCustomerAlgorithm,
+		xhttp.AmzServerSideEncryptionCopyCustomerKey, xhttp.AmzServerSideEncryptionCopyCustomerKeyMD5)
+}
+
+func parseCustomerKey(headers http.Header, algorithmHeader, keyHeader, keyMD5Header string) (*CustomerKey, error) {
+	algorithm := strings.TrimSpace(headers.Get(algorithmHeader))
+	key := strings.TrimSpace(headers.Get(keyHeader))
+	keyMD5 := strings.TrimSpace(headers.Get(keyMD5Header))
+	if algorithm == "" && key == "" && keyMD5 == "" {
+		return nil, nil
+	}
+	if algorithm != xhttp.AmzEncryptionAES {
+		logger.GetLogger("dedups3").Errorf("unsupported sse-c algorithm %s", algorithm)
+		return nil, xhttp.ToError(xhttp.ErrInvalidSSECustomerAlgorithm)
+	}
+	if key == "" {
+		return nil, xhttp.ToError(xhttp.ErrMissingSSECustomerKey)
+	}
+	if keyMD5 == "" {
+		return nil, xhttp.ToError(xhttp.ErrMissingSSECustomerKeyMD5)
+	}
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != 32 {
+		logger.GetLogger("dedups3").Errorf("invalid sse-c key length %d: %v", len(rawKey), err)
+		return nil, xhttp.ToError(xhttp.ErrInvalidSSECustomerKey)
+	}
+	sum := md5.Sum(rawKey)
+	if base64.StdEncoding.EncodeToString(sum[:]) != keyMD5 {
+		return nil, xhttp.ToError(xhttp.ErrSSECustomerKeyMD5Mismatch)
+	}
+	return &CustomerKey{Algorithm: algorithm, Key: rawKey}, nil
+}
+
+// customerKeyHMAC 客户密钥加盐后的 HMAC，服务端只保存这个值
+func customerKeyHMAC(key, salt []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(key)
+	return mac.Sum(nil)
+}
+
+// CheckCustomerKey 校验请求的客户密钥和对象的加密方式是否匹配
+// SSE-C 对象必须提供加密时使用的密钥，其他对象不能提供客户密钥
+func CheckCustomerKey(sse *meta.ObjectSSE, ck *CustomerKey) error {
+	if !sse.IsCustomerKey() {
+		if ck != nil {
+			return xhttp.ToError(xhttp.ErrInvalidEncryptionParameters)
+		}
+		return nil
+	}
+	if ck == nil {
+		return xhttp.ToError(xhttp.ErrSSEEncryptedObject)
+	}
+	if ck.Algorithm != sse.CustomerAlgorithm || !hmac.Equal(customerKeyHMAC(ck.Key, sse.KeySalt), sse.KeyHMAC) {
+		logger.GetLogger("dedups3").Errorf("sse-c key does not match the object key")
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	return nil
+}
+
+// resolveSSE 请求没有指定加密方式时使用桶的默认加密配置，都没有时返回 nil
+func resolveSSE(bucket *meta.BucketMetadata, req *SSERequest) *SSERequest {
+	if req != nil {
+		return req
+	}
+	if bucket == nil || !bucket.SSE.IsEnabled() {
+		return nil
+	}
+	return &SSERequest{Algorithm: bucket.SSE.Algorithm(), KMSKeyID: bucket.SSE.KMSKeyID()}
+}
+
+// sseContext 数据密钥的附加认证数据，复制和重命名对象不改变账户，数据密钥可以直接复用
+func sseContext(accountID string) string {
+	return "object/" + accountID
+}
+
+// kmsError 把密钥管理的错误转换为 S3 错误
+func kmsError(err error) error {
+	switch {
+	case errors.Is(err, kms.ErrKeyNotFound):
+		return xhttp.ToError(xhttp.ErrKMSNotFoundException)
+	case errors.Is(err, kms.ErrKeyDisabled):
+		return xhttp.ToError(xhttp.ErrKMSDisabledException)
+	case errors.Is(err, kms.ErrInvalidKey):
+		return xhttp.ToError(xhttp.ErrInvalidEncryptionKeyID)
+	}
+	return err
+}
+
+// NewObjectKey 按请求或桶的默认加密配置生成对象的数据密钥，不需要加密时返回 nil
+// 提供了客户密钥时使用 SSE-C，不能同时指定其他加密方式
+func NewObjectKey(accountID string, bucket *meta.BucketMetadata, req *SSERequest, ck *CustomerKey) (*ObjectKey, error) {
+	if ck != nil {
+		if req != nil {
+			return nil, xhttp.ToError(xhttp.ErrIncompatibleEncryptionMethod)
+		}
+		return wrapCustomerKey(accountID, ck, nil)
+	}
+	return wrapObjectKey(accountID, resolveSSE(bucket, req), nil)
+}
+
+// wrapCustomerKey 用客户密钥包装数据密钥，plain 为 nil 时生成新的数据密钥
+// 每个对象的数据密钥都是随机的，SSE-C 对象的 chunk 不会和其他对象去重
+func wrapCustomerKey(accountID string, ck *CustomerKey, plain []byte) (*ObjectKey, error) {
+	if plain == nil {
+		plain = make([]byte, 32)
+		if _, err := rand.Read(plain); err != nil {
+			return nil, err
+		}
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	wrapped, err := utils.EncryptWithKey(plain, ck.Key, []byte(sseContext(accountID)))
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to wrap sse-c data key for account %s: %v", accountID, err)
+		return nil, err
+	}
+	return &ObjectKey{
+		SSE: &meta.ObjectSSE{
+			DataKey:           wrapped,
+			CustomerAlgorithm: ck.Algorithm,
+			KeySalt:           salt,
+			KeyHMAC:           customerKeyHMAC(ck.Key, salt),
+		},
+		Plain: plain,
+	}, nil
+}
+
+// wrapObjectKey 按 req 指定的方式包装数据密钥，plain 为 nil 时生成新的数据密钥
+func wrapObjectKey(accountID string, req *SSERequest, plain []byte) (*ObjectKey, error) {
+	if req == nil {
+		return nil, nil
+	}
+	ks := kms.GetKMSService()
+	if ks == nil {
+		logger.GetLogger("dedups3").Errorf("kms service not initialized")
+		return nil, xhttp.ToError(xhttp.ErrKMSNotConfigured)
+	}
+
+	key := &ObjectKey{Algorithm: req.Algorithm, SSE: &meta.ObjectSSE{}}
+	var err error
+	switch req.Algorithm {
+	case xhttp.AmzEncryptionAES:
+		if plain == nil {
+			key.Plain, key.SSE.KeyID, key.SSE.DataKey, err = ks.GenerateDataKey(sseContext(accountID))
+		} else {
+			key.Plain = plain
+			key.SSE.KeyID, key.SSE.DataKey, err = ks.WrapDataKey(plain, sseContext(accountID))
+		}
+	case xhttp.AmzEncryptionKMS:
+		key.KMSKeyID = req.KMSKeyID
+		if key.KMSKeyID == "" {
+			key.KMSKeyID = kms.DefaultKeyID
+		}
+		key.SSE.KeyID = key.KMSKeyID
+		if plain == nil {
+			key.Plain, key.SSE.KeyVersion, key.SSE.DataKey, err = ks.GenerateObjectKey(accountID, key.KMSKeyID, sseContext(accountID))
+		} else {
+			key.Plain = plain
+			key.SSE.KeyVersion, key.SSE.DataKey, err = ks.EncryptObjectKey(accountID, key.KMSKeyID, plain, sseContext(accountID))
+		}
+	default:
+		return nil, xhttp.ToError(xhttp.ErrInvalidEncryptionAlgorithmError)
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to generate %s data key for account %s: %v", req.Algorithm, accountID, err)
+		return nil, kmsError(err)
+	}
+	return key, nil
+}
+
+// DecryptObjectKey 解开对象的数据密钥，对象没有加密时返回 nil
+// SSE-KMS 的密钥被禁用后返回 KMS.DisabledException，SSE-C 对象需要提供匹配的客户密钥
+func DecryptObjectKey(accountID, algorithm string, sse *meta.ObjectSSE, ck *CustomerKey) ([]byte, error) {
+	if err := CheckCustomerKey(sse, ck); err != nil {
+		return nil, err
+	}
+	if sse == nil {
+		return nil, nil
+	}
+	if sse.IsCustomerKey() {
+		plain, err := utils.DecryptWithKey(sse.DataKey, ck.Key, []byte(sseContext(accountID)))
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to decrypt sse-c data key for account %s: %v", accountID, err)
+			return nil, xhttp.ToError(xhttp.ErrAccessDenied)
+		}
+		return plain, nil
+	}
+	ks := kms.GetKMSService()
+	if ks == nil {
+		logger.GetLogger("dedups3").Errorf("kms service not initialized")
+		return nil, xhttp.ToError(xhttp.ErrKMSNotConfigured)
+	}
+
+	var plain []byte
+	var err error
+	if algorithm == xhttp.AmzEncryptionKMS {
+		plain, err = ks.DecryptObjectKey(accountID, sse.KeyID, sse.KeyVersion, sse.DataKey, sseContext(accountID))
+	} else {
+		plain, err = ks.UnwrapDataKey(sse.KeyID, sse.DataKey, sseContext(accountID))
+	}
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to decrypt %s data key %s for account %s: %v", algorithm, sse.KeyID, accountID, err)
+		return nil, kmsError(err)
+	}
+	return plain, nil
+}
+
+// objectKey 解开对象的数据密钥，对象没有加密时返回 nil
+// 已经解开过的直接使用 obj.SSEKey，SSE-C 对象由请求处理时用客户密钥解开
+func objectKey(obj *meta.Object, ck *CustomerKey) ([]byte, error) {
+	if obj.SSEKey != nil {
+		return obj.SSEKey, nil
+	}
+	return DecryptObjectKey(obj.Owner.ID, obj.EncryptionType, obj.SSE, ck)
+}
+
+// sealInline 用数据密钥加密内联数据，key 为 nil 时原样返回
+func sealInline(data, key []byte) ([]byte, error) {
+	if key == nil {
+		return data, nil
+	}
+	return utils.EncryptWithKey(data, key, nil)
+}
+
+// openInline 用数据密钥解密内联数据，key 为 nil 时原样返回
+func openInline(data, key []byte) ([]byte, error) {
+	if key == nil {
+		return data, nil
+	}
+	return utils.DecryptWithKey(data, key, nil)
+}
@@ -0,0 +1,462 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/utils"
+	"github.com/mageg-x/dedups3/meta"
+	xcache "github.com/mageg-x/dedups3/plugs/cache"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/gc"
+	"github.com/mageg-x/dedups3/service/iam"
+)
+
+// ListVersionsResult 对应 S3 ListObjectVersions 响应
+type ListVersionsResult struct {
+	XMLName xml.Name `xml:"ListVersionsResult" json:"-"`
+	// 命名空间属性 - 注意：根据S3规范，必须包含命名空间，因此不使用omitempty标签
+	XMLNS string `xml:"xmlns,attr"`
+	Name  string `xml:"Name"` // Bucket 名称
+
+	Prefix              string `xml:"Prefix"`
+	KeyMarker           string `xml:"KeyMarker"`
+	VersionIdMarker     string `xml:"VersionIdMarker"`
+	NextKeyMarker       string `xml:"NextKeyMarker,omitempty"`
+	NextVersionIdMarker string `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int    `xml:"MaxKeys"`
+	Delimiter           string `xml:"Delimiter,omitempty"`
+	IsTruncated         bool   `xml:"IsTruncated"`
+	EncodingType        string `xml:"EncodingType,omitempty"`
+
+	Versions       []ObjectVersion     `xml:"Version,omitempty"`
+	DeleteMarkers  []DeleteMarkerEntry `xml:"DeleteMarker,omitempty"`
+	CommonPrefixes []CommonPrefix      `xml:"CommonPrefixes,omitempty"`
+}
+
+// ObjectVersion 表示一个对象版本条目
+type ObjectVersion struct {
+	Key          string       `xml:"Key"`
+	VersionId    string       `xml:"VersionId"`
+	IsLatest     bool         `xml:"IsLatest"`
+	LastModified time.Time    `xml:"LastModified"`
+	ETag         meta.Etag    `xml:"ETag"`
+	Size         int64        `xml:"Size"`
+	StorageClass string       `xml:"StorageClass"`
+	Owner        *meta.Owner  `xml:"Owner"`
+	UserMetadata UserMetadata `xml:"UserMetadata,omitempty"`
+}
+
+// DeleteMarkerEntry 表示一个删除标记条目
+type DeleteMarkerEntry struct {
+	Key          string      `xml:"Key"`
+	VersionId    string      `xml:"VersionId"`
+	IsLatest     bool        `xml:"IsLatest"`
+	LastModified time.Time   `xml:"LastModified"`
+	Owner        *meta.Owner `xml:"Owner"`
+}
+
+// UserMetadata 用户自定义元数据，序列化为 <UserMetadata><X-Amz-Meta-Key>value</X-Amz-Meta-Key></UserMetadata>
+type UserMetadata map[string]string
+
+// MarshalXML 自定义XML序列化
+func (m UserMetadata) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(m) == 0 {
+		return nil
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for k, v := range m {
+		if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: xhttp.AMZMetPrefix + k}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(xml.EndElement{Name: start.Name})
+}
+
+// versionCursor 按存储顺序遍历当前版本或历史版本
+type versionCursor struct {
+	txn     kv.Txn
+	prefix  string
+	next    string
+	items   []*meta.Object
+	drained bool
+}
+
+func newVersionCursor(txn kv.Txn, prefix, startKey string) *versionCursor {
+	return &versionCursor{txn: txn, prefix: prefix, next: startKey}
+}
+
+// peek 返回下一个对象但不移动游标，没有更多对象时返回 nil
+func (c *versionCursor) peek() (*meta.Object, error) {
+	for len(c.items) == 0 && !c.drained {
+		keys, next, err := c.txn.Scan(c.prefix, c.next, 100)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("scan %s failed: %v", c.prefix, err)
+			return nil, err
+		}
+		if next == "" || len(keys) == 0 {
+			c.drained = true
+		}
+		c.next = next
+		if len(keys) == 0 {
+			break
+		}
+		values, err := c.txn.BatchGet(keys)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to batch get objects: %v", err)
+			return nil, fmt.Errorf("failed to batch get objects: %w", err)
+		}
+		for _, k := range keys {
+			data, ok := values[k]
+			if !ok {
+				continue
+			}
+			var _obj meta.Object
+			if err := json.Unmarshal(data, &_obj); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to unmarshal object %s: %v", k, err)
+				return nil, fmt.Errorf("failed to unmarshal object %s: %w", k, err)
+			}
+			c.items = append(c.items, &_obj)
+		}
+	}
+	if len(c.items) == 0 {
+		return nil, nil
+	}
+	return c.items[0], nil
+}
+
+func (c *versionCursor) pop() {
+	if len(c.items) > 0 {
+		c.items = c.items[1:]
+	}
+}
+
+// seek 把游标移动到 startKey
+func (c *versionCursor) seek(startKey string) {
+	c.items = nil
+	c.next = startKey
+	c.drained = false
+}
+
+// getBucket 获取桶元数据
+func (o *ObjectService) getBucket(accountID, bucketName string) (*meta.BucketMetadata, error) {
+	key := meta.GenBucketKey(accountID, bucketName)
+	if cache, err := xcache.GetCache(); err == nil && cache != nil {
+		_bucket, ok, e := xcache.Get[meta.BucketMetadata](cache, context.Background(), key)
+		if e == nil && ok && _bucket != nil {
+			return _bucket, nil
+		}
+	}
+	var bucket meta.BucketMetadata
+	exist, err := o.kvstore.Get(key, &bucket)
+	if !exist || err != nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s does not exist", bucketName)
+		return nil, xhttp.ToError(xhttp.ErrNoSuchBucket)
+	}
+	if cache, e := xcache.GetCache(); e == nil && cache != nil {
+		_ = cache.Set(context.Background(), key, &bucket, time.Second*600)
+	}
+	return &bucket, nil
+}
+
+// getObjectVersion 获取对象的指定版本
+// 版本是删除标记时返回 ErrMethodNotAllowed
+func (o *ObjectService) getObjectVersion(accountID, bucket, key, versionID string) (*meta.Object, error) {
+	objkey := "aws:object:" + accountID + ":" + bucket + "/" + key
+	var current meta.Object
+	exists, err := o.kvstore.Get(objkey, &current)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to fetch object %s: %v", objkey, err)
+		return nil, err
+	}
+	if exists && current.GetVersionID() == versionID {
+		return &current, nil
+	}
+
+	txn, err := o.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer txn.Rollback()
+	versionKey, err := chunk.FindVersionKey(txn, accountID, bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	var version meta.Object
+	exists = false
+	if versionKey != "" {
+		exists, err = txn.Get(versionKey, &version)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("failed to fetch object version %s: %v", versionKey, err)
+			return nil, err
+		}
+	}
+	if !exists {
+		logger.GetLogger("dedups3").Infof("object %s/%s version %s does not exist", bucket, key, versionID)
+		return nil, xhttp.ToError(xhttp.ErrNoSuchVersion)
+	}
+	if version.DeleteMarker {
+		logger.GetLogger("dedups3").Infof("object %s/%s version %s is a delete marker", bucket, key, versionID)
+		return &version, xhttp.ToError(xhttp.ErrMethodNotAllowed)
+	}
+	return &version, nil
+}
+
+// deleteVersion 永久删除对象的指定版本，返回被删除的版本和需要回收的chunk
+func (o *ObjectService) deleteVersion(txn kv.Txn, accountID, bucket, key, versionID string, current *meta.Object, bypassGovernance bool) (*meta.Object, []gc.GCItem, error) {
+	objkey := "aws:object:" + accountID + ":" + bucket + "/" + key
+	gcItems := make([]gc.GCItem, 0)
+	var deleted *meta.Object
+	var deletedKey string
+
+	if current != nil && current.GetVersionID() == versionID {
+		deleted = current
+		deletedKey = objkey
+		current = nil
+	} else {
+		versionKey, err := chunk.FindVersionKey(txn, accountID, bucket, key, versionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var version meta.Object
+		exists := false
+		if versionKey != "" {
+			exists, err = txn.Get(versionKey, &version)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to fetch object version %s: %v", versionKey, err)
+				return nil, nil, err
+			}
+		}
+		if !exists {
+			logger.GetLogger("dedups3").Infof("object %s/%s version %s does not exist", bucket, key, versionID)
+			return nil, nil, xhttp.ToError(xhttp.ErrNoSuchVersion)
+		}
+		deleted = &version
+		deletedKey = versionKey
+	}
+
+	// 处于保留期的版本不能被永久删除
+	if err := CheckObjectLock(deleted, bypassGovernance); err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range deleted.Chunks {
+		gcItems = append(gcItems, gc.GCItem{StorageID: deleted.DataLocation, ID: id})
+	}
+	if deletedKey == objkey {
+		if err := txn.Delete(deletedKey); err != nil {
+			logger.GetLogger("dedups3").Errorf("%s/%s delete version %s failed: %v", bucket, key, versionID, err)
+			return nil, nil, fmt.Errorf("%s/%s delete version %s failed: %w", bucket, key, versionID, err)
+		}
+	} else if err := chunk.DeleteVersion(txn, accountID, bucket, key, versionID, deletedKey); err != nil {
+		return nil, nil, err
+	}
+
+	// 没有当前版本时，最新的历史版本如果不是删除标记，要提升为当前版本
+	if current == nil {
+		versionPrefix := meta.GenVersionKey(accountID, bucket, key, "")
+		keys, _, err := txn.Scan(versionPrefix, "", 2)
+		if err != nil {
+			logger.GetLogger("dedups3").Errorf("scan %s versions failed: %v", objkey, err)
+			return nil, nil, fmt.Errorf("scan %s versions failed: %w", objkey, err)
+		}
+		for _, k := range keys {
+			if k == deletedKey {
+				continue
+			}
+			var latest meta.Object
+			exists, err := txn.Get(k, &latest)
+			if err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to fetch object version %s: %v", k, err)
+				return nil, nil, err
+			}
+			if exists && !latest.DeleteMarker {
+				if err := chunk.DeleteVersion(txn, accountID, bucket, key, latest.GetVersionID(), k); err != nil {
+					return nil, nil, err
+				}
+				if err := txn.Set(objkey, &latest); err != nil {
+					logger.GetLogger("dedups3").Errorf("failed to promote object version %s: %v", k, err)
+					return nil, nil, err
+				}
+				logger.GetLogger("dedups3").Debugf("promote %s/%s version %s to current", bucket, key, latest.VersionID)
+			}
+			break
+		}
+	}
+	return deleted, gcItems, nil
+}
+
+// ListObjectVersions 列出桶中对象的所有版本
+// 同一个对象先返回当前版本，再按从新到旧返回历史版本
+func (o *ObjectService) ListObjectVersions(ctx context.Context, bucket, accessKeyID, prefix, keyMarker, versionIDMarker, delimiter string, maxKeys int) (versions []*meta.Object, latest map[*meta.Object]bool, commonPrefixes []string, isTruncated bool, nextKeyMarker, nextVersionIDMarker string, err error) {
+	// 设置 maxKeys 上限
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+	logger.GetLogger("dedups3").Debugf(
+		"ListObjectVersions request: bucket=%s, prefix=%s, keyMarker=%s, versionIdMarker=%s, delimiter=%s, maxKeys=%d",
+		bucket, prefix, keyMarker, versionIDMarker, delimiter, maxKeys,
+	)
+
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return nil, nil, nil, false, "", "", errors.New("failed to get iam service")
+	}
+	accountID, err := iamService.GetRequestAccountID(ctx, accessKeyID)
+	if err != nil {
+		return nil, nil, nil, false, "", "", err
+	}
+	if _, err := o.getBucket(accountID, bucket); err != nil {
+		return nil, nil, nil, false, "", "", err
+	}
+
+	objPrefix := "aws:object:" + accountID + ":" + bucket + "/"
+	verPrefix := meta.GenVersionPrefix(accountID, bucket)
+	// 以 delimiter 结尾的 keyMarker 是上一页返回的 CommonPrefix，整个前缀都要跳过
+	skipPrefix := ""
+	startKey := prefix
+	if keyMarker != "" && keyMarker > startKey {
+		startKey = keyMarker
+		if delimiter != "" && strings.HasSuffix(keyMarker, delimiter) {
+			skipPrefix = keyMarker
+			startKey = utils.NextKey(keyMarker)
+		}
+	}
+
+	txn, err := o.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to begin transaction: %v", err)
+		return nil, nil, nil, false, "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if txn != nil {
+			_ = txn.Rollback()
+		}
+	}()
+
+	curCursor := newVersionCursor(txn, objPrefix+prefix, objPrefix+startKey)
+	verCursor := newVersionCursor(txn, verPrefix+prefix, verPrefix+startKey)
+
+	// next 按 key 升序合并两个游标，同一个 key 当前版本优先
+	next := func() (*meta.Object, error) {
+		cur, err := curCursor.peek()
+		if err != nil {
+			return nil, err
+		}
+		ver, err := verCursor.peek()
+		if err != nil {
+			return nil, err
+		}
+		if cur != nil && (ver == nil || cur.Key <= ver.Key) {
+			curCursor.pop()
+			return cur, nil
+		}
+		if ver != nil {
+			verCursor.pop()
+		}
+		return ver, nil
+	}
+
+	latest = make(map[*meta.Object]bool)
+	seenPrefixes := make(map[string]struct{})
+	lastKey := ""
+	// versionIDMarker 之前(含)的版本都要跳过
+	passedMarker := versionIDMarker == ""
+	collected := 0
+	for {
+		_obj, err := next()
+		if err != nil {
+			return nil, nil, nil, false, "", "", err
+		}
+		if _obj == nil {
+			break
+		}
+		isLatest := _obj.Key != lastKey
+		lastKey = _obj.Key
+
+		if skipPrefix != "" && strings.HasPrefix(_obj.Key, skipPrefix) {
+			continue
+		}
+		if keyMarker != "" && _obj.Key == keyMarker {
+			if passedMarker {
+				// 只给了 keyMarker，跳过该对象的所有版本
+				if versionIDMarker == "" {
+					continue
+				}
+			} else {
+				if _obj.GetVersionID() == versionIDMarker {
+					passedMarker = true
+				}
+				continue
+			}
+		}
+
+		// 处理 delimiter
+		if delimiter != "" {
+			afterPrefix := _obj.Key[len(prefix):]
+			if delimPos := strings.Index(afterPrefix, delimiter); delimPos != -1 {
+				commonPrefix := _obj.Key[:len(prefix)+delimPos+len(delimiter)]
+				if _, exists := seenPrefixes[commonPrefix]; !exists {
+					if collected >= maxKeys {
+						isTruncated = true
+						break
+					}
+					seenPrefixes[commonPrefix] = struct{}{}
+					commonPrefixes = append(commonPrefixes, commonPrefix)
+					collected++
+					nextKeyMarker = commonPrefix
+					nextVersionIDMarker = ""
+				}
+				// 直接跳过该前缀下的所有对象
+				curCursor.seek(objPrefix + utils.NextKey(commonPrefix))
+				verCursor.seek(verPrefix + utils.NextKey(commonPrefix))
+				continue
+			}
+		}
+
+		if collected >= maxKeys {
+			isTruncated = true
+			break
+		}
+		versions = append(versions, _obj)
+		latest[_obj] = isLatest
+		collected++
+		nextKeyMarker = _obj.Key
+		nextVersionIDMarker = _obj.GetVersionID()
+	}
+
+	if !isTruncated {
+		nextKeyMarker = ""
+		nextVersionIDMarker = ""
+	}
+	logger.GetLogger("dedups3").Debugf("list versions %d commonPrefixes %d truncated %v", len(versions), len(commonPrefixes), isTruncated)
+	return versions, latest, commonPrefixes, isTruncated, nextKeyMarker, nextVersionIDMarker, nil
+}
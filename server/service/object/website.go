@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package object
+
+import (
+	"bytes"
+	"io"
+
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+)
+
+// GetWebsiteObject 以桶所有者的身份读取对象的当前版本，供静态网站的匿名访问使用，权限由调用者检查
+// withData 为 false 时只返回元数据（HEAD 请求）
+func (o *ObjectService) GetWebsiteObject(accountID, bucket, key string, rng *xhttp.HTTPRangeSpec, withData bool) (*meta.Object, io.ReadCloser, error) {
+	obj, err := o.GetCurrentObject(accountID, bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if obj == nil || obj.DeleteMarker {
+		return nil, nil, xhttp.ToError(xhttp.ErrNoSuchKey)
+	}
+	if !withData {
+		return obj, nil, nil
+	}
+	if obj.Size == 0 {
+		return obj, io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	start, end := int64(0), obj.Size-1
+	if rng != nil {
+		s, l, err := rng.GetOffsetLength(obj.Size)
+		if err != nil || l <= 0 {
+			logger.GetLogger("dedups3").Errorf("invalid range of website object %s/%s: %v", bucket, key, err)
+			return nil, nil, xhttp.ToError(xhttp.ErrInvalidRange)
+		}
+		start, end = s, s+l-1
+	}
+	reader, err := o.readObject(obj, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return obj, reader, nil
+}
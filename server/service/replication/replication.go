@@ -0,0 +1,668 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/queue"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/chunk"
+	"github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/object"
+)
+
+const (
+	maxBytesPerFile = 64 << 20 // 64MB
+	minMsgSize      = 8
+	maxMsgSize      = 64 << 10 // 64KB
+	syncEvery       = 100
+	syncTimeout     = 1 * time.Second
+
+	replicationQueueName = "replication-queue"
+	retryQueueName       = "replication-retry-queue"
+
+	// DefaultReplicationWorkers 并发复制的协程数
+	DefaultReplicationWorkers = 4
+	// DefaultReplicationMaxAttempts 单个任务最多尝试的次数，超过后对象标记为 FAILED
+	DefaultReplicationMaxAttempts = 10
+	// DefaultReplicationRetryBase 第一次重试的等待时间，之后每次翻倍
+	DefaultReplicationRetryBase = 2 * time.Second
+	// DefaultReplicationRetryMax 重试等待时间的上限
+	DefaultReplicationRetryMax = 10 * time.Minute
+	// DefaultResyncBatchSize 重新同步时每批扫描的对象数
+	DefaultResyncBatchSize = 1000
+)
+
+var (
+	instance *ReplicationService
+	mu       = sync.Mutex{}
+
+	// errNoTarget 复制规则找不到对应的目标端点，重试没有意义
+	errNoTarget = errors.New("replication target not found")
+)
+
+// Task 复制任务，只记录对象 key，执行时把对象的当前状态同步到目标桶
+// 这样任务乱序或者重复执行都不会把旧数据写到目标桶
+type Task struct {
+	AccountID   string    `json:"accountId"`
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"`
+	Attempts    int       `json:"attempts"`
+	NextRetryAt time.Time `json:"nextRetryAt,omitempty"`
+	CreateAt    time.Time `json:"createAt"`
+}
+
+// ResyncStatus 存量对象重新同步的进度
+type ResyncStatus struct {
+	Bucket   string    `json:"bucket"`
+	Running  bool      `json:"running"`
+	Scanned  int64     `json:"scanned"`
+	Queued   int64     `json:"queued"`
+	Error    string    `json:"error,omitempty"`
+	StartAt  time.Time `json:"startAt"`
+	FinishAt time.Time `json:"finishAt,omitempty"`
+}
+
+// Stats 复制服务的运行统计
+type Stats struct {
+	Pending    int64 `json:"pending"`    // 待复制的任务数
+	Retrying   int64 `json:"retrying"`   // 等待重试的任务数
+	Replicated int64 `json:"replicated"` // 复制成功的对象数
+	Deleted    int64 `json:"deleted"`    // 同步删除的对象数
+	Failed     int64 `json:"failed"`     // 重试多次后仍失败的对象数
+}
+
+// remoteClient 目标端点的 S3 客户端
+type remoteClient struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+}
+
+type ReplicationService struct {
+	running atomic.Bool
+	kvstore kv.KVStore
+	queue   queue.Queue
+	retry   queue.Queue
+	clients map[string]*remoteClient
+	resyncs map[string]*ResyncStatus
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	mutex   sync.Mutex // 保护启动和停止
+	lock    sync.Mutex // 保护 clients 和 resyncs
+
+	replicated atomic.Int64
+	deleted    atomic.Int64
+	failed     atomic.Int64
+}
+
+// GetReplicationService 获取全局复制服务实例
+func GetReplicationService() *ReplicationService {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance
+	}
+	logger.GetLogger("dedups3").Infof("initializing replication service")
+	kvStore, err := kv.GetKvStore()
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to get kv store for replication: %v", err)
+		return nil
+	}
+	instance = &ReplicationService{
+		kvstore: kvStore,
+		running: atomic.Bool{},
+		clients: make(map[string]*remoteClient),
+		resyncs: make(map[string]*ResyncStatus),
+		mutex:   sync.Mutex{},
+		lock:    sync.Mutex{},
+	}
+	logger.GetLogger("dedups3").Infof("replication service initialized successfully")
+	return instance
+}
+
+// Start 启动复制服务
+func (r *ReplicationService) Start() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.running.Load() {
+		logger.GetLogger("dedups3").Infof("replication service is already running")
+		return nil
+	}
+
+	cfg := xconf.Get()
+	dir := filepath.Join(cfg.Node.LocalDir, "queue")
+	r.queue = queue.NewDiskQueue(replicationQueueName, dir, maxBytesPerFile, minMsgSize, maxMsgSize, syncEvery, syncTimeout)
+	if r.queue == nil {
+		logger.GetLogger("dedups3").Errorf("failed to create replication queue")
+		return errors.New("failed to create replication queue")
+	}
+	r.retry = queue.NewDiskQueue(retryQueueName, dir, maxBytesPerFile, minMsgSize, maxMsgSize, syncEvery, syncTimeout)
+	if r.retry == nil {
+		logger.GetLogger("dedups3").Errorf("failed to create replication retry queue")
+		_ = r.queue.Close()
+		return errors.New("failed to create replication retry queue")
+	}
+
+	r.stopCh = make(chan struct{})
+	r.running.Store(true)
+	for i := 0; i < DefaultReplicationWorkers; i++ {
+		r.wg.Add(1)
+		go r.worker()
+	}
+	r.wg.Add(1)
+	go r.retryWorker()
+
+	logger.GetLogger("dedups3").Infof("replication service started successfully")
+	return nil
+}
+
+// Stop 停止复制服务，未处理的任务保留在磁盘队列中，下次启动后继续
+func (r *ReplicationService) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.running.Load() {
+		return
+	}
+	r.running.Store(false)
+	close(r.stopCh)
+	r.wg.Wait()
+	_ = r.queue.Close()
+	_ = r.retry.Close()
+	logger.GetLogger("dedups3").Infof("replication service stopped successfully")
+}
+
+// GetStats 获取复制服务的运行统计
+func (r *ReplicationService) GetStats() *Stats {
+	stats := &Stats{
+		Replicated: r.replicated.Load(),
+		Deleted:    r.deleted.Load(),
+		Failed:     r.failed.Load(),
+	}
+	if r.running.Load() {
+		stats.Pending = r.queue.Depth()
+		stats.Retrying = r.retry.Depth()
+	}
+	return stats
+}
+
+// Schedule 对象写入或删除后调用，对象匹配复制规则时加入复制队列
+// 写入的对象会先被标记为 PENDING
+func (r *ReplicationService) Schedule(accessKeyID, bucketName, key string) {
+	if !r.running.Load() {
+		return
+	}
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return
+	}
+	ak, err := iamService.GetAccessKey(accessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", accessKeyID)
+		return
+	}
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get object service")
+		return
+	}
+	bucket, err := objSvc.GetBucketMeta(ak.AccountID, bucketName)
+	if err != nil || bucket.Replication == nil {
+		return
+	}
+	// 桶的所有者才是复制的发起方
+	if _, err := r.schedule(objSvc, bucket, key); err != nil {
+		logger.GetLogger("dedups3").Errorf("schedule replication %s/%s failed: %v", bucketName, key, err)
+	}
+}
+
+// schedule 判断对象当前状态是否需要复制，需要时加入复制队列
+func (r *ReplicationService) schedule(objSvc *object.ObjectService, bucket *meta.BucketMetadata, key string) (bool, error) {
+	accountID := bucket.Owner.ID
+	obj, err := objSvc.GetCurrentObject(accountID, bucket.Name, key)
+	if err != nil {
+		return false, err
+	}
+	if obj != nil {
+		if ok, _ := bucket.Replication.ShouldReplicate(key, obj.Tags, obj.EncryptionType == "aws:kms", false); !ok {
+			return false, nil
+		}
+		// 服务端没有 SSE-C 对象的客户密钥，不能读出数据复制
+		if obj.SSE.IsCustomerKey() {
+			logger.GetLogger("dedups3").Warnf("%s/%s is encrypted with customer key, skip replication", bucket.Name, key)
+			return false, nil
+		}
+		// 对象已被再次覆盖时由新的写入负责调度
+		if err := objSvc.SetReplicationStatus(accountID, obj, meta.ReplicationStatusPending); err != nil && !errors.Is(err, chunk.ErrObjectChanged) {
+			return false, err
+		}
+	} else if ok, _ := bucket.Replication.ShouldReplicate(key, nil, false, true); !ok {
+		return false, nil
+	}
+
+	task := &Task{
+		AccountID: accountID,
+		Bucket:    bucket.Name,
+		Key:       key,
+		CreateAt:  time.Now().UTC(),
+	}
+	return true, r.enqueue(r.queue, task)
+}
+
+// enqueue 把任务写入磁盘队列
+func (r *ReplicationService) enqueue(q queue.Queue, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to marshal replication task: %v", err)
+		return fmt.Errorf("failed to marshal replication task: %w", err)
+	}
+	if err := q.Put(data); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to put replication task %s/%s: %v", task.Bucket, task.Key, err)
+		return fmt.Errorf("failed to put replication task: %w", err)
+	}
+	return nil
+}
+
+// worker 从复制队列中取任务执行
+func (r *ReplicationService) worker() {
+	defer r.wg.Done()
+	readChan := r.queue.ReadChan()
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case msg := <-readChan:
+			task := &Task{}
+			if err := json.Unmarshal(msg, task); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to unmarshal replication task: %v", err)
+				continue
+			}
+			r.handle(task)
+		}
+	}
+}
+
+// retryWorker 按顺序取出重试任务，等到重试时间后执行
+func (r *ReplicationService) retryWorker() {
+	defer r.wg.Done()
+	readChan := r.retry.ReadChan()
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case msg := <-readChan:
+			task := &Task{}
+			if err := json.Unmarshal(msg, task); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to unmarshal replication task: %v", err)
+				continue
+			}
+			if wait := time.Until(task.NextRetryAt); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-r.stopCh:
+					timer.Stop()
+					// 放回队列，下次启动后继续
+					_ = r.enqueue(r.retry, task)
+					return
+				case <-timer.C:
+				}
+			}
+			r.handle(task)
+		}
+	}
+}
+
+// handle 执行任务，失败时按指数退避重试
+func (r *ReplicationService) handle(task *Task) {
+	err := r.replicate(task)
+	if err == nil {
+		return
+	}
+	task.Attempts++
+	if errors.Is(err, errNoTarget) || task.Attempts >= DefaultReplicationMaxAttempts {
+		logger.GetLogger("dedups3").Errorf("replicate %s/%s failed after %d attempts: %v", task.Bucket, task.Key, task.Attempts, err)
+		r.failed.Add(1)
+		r.markFailed(task)
+		return
+	}
+
+	backoff := DefaultReplicationRetryBase << (task.Attempts - 1)
+	if backoff <= 0 || backoff > DefaultReplicationRetryMax {
+		backoff = DefaultReplicationRetryMax
+	}
+	task.NextRetryAt = time.Now().UTC().Add(backoff)
+	logger.GetLogger("dedups3").Warnf("replicate %s/%s failed, retry %d after %s: %v", task.Bucket, task.Key, task.Attempts, backoff, err)
+	if e := r.enqueue(r.retry, task); e != nil {
+		r.failed.Add(1)
+		r.markFailed(task)
+	}
+}
+
+// markFailed 把对象的当前版本标记为复制失败
+func (r *ReplicationService) markFailed(task *Task) {
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		return
+	}
+	obj, err := objSvc.GetCurrentObject(task.AccountID, task.Bucket, task.Key)
+	if err != nil || obj == nil {
+		return
+	}
+	_ = objSvc.SetReplicationStatus(task.AccountID, obj, meta.ReplicationStatusFailed)
+}
+
+// replicate 把对象的当前状态同步到目标桶
+func (r *ReplicationService) replicate(task *Task) error {
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		return errors.New("failed to get object service")
+	}
+	bucket, err := objSvc.GetBucketMeta(task.AccountID, task.Bucket)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			logger.GetLogger("dedups3").Infof("bucket %s removed, drop replication task %s", task.Bucket, task.Key)
+			return nil
+		}
+		return err
+	}
+	if bucket.Replication == nil {
+		return nil
+	}
+
+	obj, err := objSvc.GetCurrentObject(task.AccountID, task.Bucket, task.Key)
+	if err != nil {
+		return err
+	}
+
+	isDelete := obj == nil
+	var ok bool
+	var dest meta.Destination
+	if isDelete {
+		ok, dest = bucket.Replication.ShouldReplicate(task.Key, nil, false, true)
+	} else {
+		ok, dest = bucket.Replication.ShouldReplicate(task.Key, obj.Tags, obj.EncryptionType == "aws:kms", false)
+	}
+	if !ok {
+		return nil
+	}
+
+	target, found := bucket.Targets.GetTargetByArn(dest.Bucket)
+	if !found {
+		return fmt.Errorf("%w: %s", errNoTarget, dest.Bucket)
+	}
+	if target.SyncState == "Inactive" {
+		return fmt.Errorf("replication target %s is inactive", target.ID)
+	}
+	rc, err := r.getClient(&target)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if isDelete {
+		_, err = rc.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(target.Bucket),
+			Key:    aws.String(task.Key),
+		})
+		if err != nil {
+			return fmt.Errorf("delete %s from %s failed: %w", task.Key, target.Bucket, err)
+		}
+		r.deleted.Add(1)
+		logger.GetLogger("dedups3").Infof("replicate delete %s/%s to %s", task.Bucket, task.Key, target.Bucket)
+		return nil
+	}
+
+	if err := r.putObject(ctx, rc, objSvc, &target, &dest, obj); err != nil {
+		return err
+	}
+	r.replicated.Add(1)
+	if err := objSvc.SetReplicationStatus(task.AccountID, obj, meta.ReplicationStatusCompleted); err != nil && !errors.Is(err, chunk.ErrObjectChanged) {
+		logger.GetLogger("dedups3").Errorf("set %s/%s replication status failed: %v", task.Bucket, task.Key, err)
+	}
+	logger.GetLogger("dedups3").Infof("replicate object %s/%s version %s to %s", task.Bucket, task.Key, obj.GetVersionID(), target.Bucket)
+	return nil
+}
+
+// putObject 从 chunk 重新组装对象数据并写入目标桶
+func (r *ReplicationService) putObject(ctx context.Context, rc *remoteClient, objSvc *object.ObjectService, target *meta.BucketTarget, dest *meta.Destination, obj *meta.Object) error {
+	reader, err := objSvc.ReadObjectData(obj)
+	if err != nil {
+		return fmt.Errorf("read object %s/%s failed: %w", obj.Bucket, obj.Key, err)
+	}
+	defer reader.Close()
+
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(target.Bucket),
+		Key:           aws.String(obj.Key),
+		Body:          reader,
+		ContentLength: aws.Int64(obj.Size),
+		Metadata:      obj.UserMetadata,
+	}
+	if obj.ContentType != "" {
+		input.ContentType = aws.String(obj.ContentType)
+	}
+	if obj.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(obj.ContentEncoding)
+	}
+	if obj.ContentLanguage != "" {
+		input.ContentLanguage = aws.String(obj.ContentLanguage)
+	}
+	if obj.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(obj.ContentDisposition)
+	}
+	if obj.CacheControl != "" {
+		input.CacheControl = aws.String(obj.CacheControl)
+	}
+	if dest.StorageClass != "" {
+		input.StorageClass = types.StorageClass(dest.StorageClass)
+	}
+	if len(obj.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range obj.Tags {
+			tags.Set(k, v)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+
+	if _, err := rc.uploader.Upload(ctx, input); err != nil {
+		return fmt.Errorf("put %s to %s failed: %w", obj.Key, target.Bucket, err)
+	}
+	return nil
+}
+
+// getClient 获取目标端点的客户端，端点或凭证变化时重新创建
+func (r *ReplicationService) getClient(target *meta.BucketTarget) (*remoteClient, error) {
+	cred := target.Credentials
+	clientKey := strings.Join([]string{target.Endpoint, target.Region, cred.AccessKeyID, cred.SecretKey, cred.SessionToken}, "|")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if rc := r.clients[clientKey]; rc != nil {
+		return rc, nil
+	}
+
+	httpcli := &http.Client{
+		Transport: &xhttp.HttpLoggingTransport{
+			Transport: http.DefaultTransport,
+		},
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(target.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cred.AccessKeyID, cred.SecretKey, cred.SessionToken)),
+		config.WithHTTPClient(httpcli),
+		config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired),
+		// 关闭所有 SDK 日志
+		config.WithLogger(logger.AWSNullLogger{}),
+	)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to load SDK configuration: %v", err)
+		return nil, fmt.Errorf("failed to load SDK configuration: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// 未指定端点时使用 AWS 默认端点，私有服务需要 path style
+		if target.Endpoint != "" {
+			o.BaseEndpoint = aws.String(target.Endpoint)
+			o.UsePathStyle = true
+		}
+		o.RetryMaxAttempts = 1 // 由复制服务负责重试
+	})
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.Concurrency = 4
+		u.PartSize = 16 * 1024 * 1024
+	})
+	uploader.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+
+	rc := &remoteClient{client: client, uploader: uploader}
+	r.clients[clientKey] = rc
+	return rc, nil
+}
+
+// Resync 把桶内已有的对象重新加入复制队列，用于新配置复制或者目标桶数据丢失后的全量同步
+func (r *ReplicationService) Resync(accountID, bucketName string) (*ResyncStatus, error) {
+	if !r.running.Load() {
+		return nil, errors.New("replication service is not running")
+	}
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		return nil, errors.New("failed to get object service")
+	}
+	bucket, err := objSvc.GetBucketMeta(accountID, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if bucket.Replication == nil {
+		logger.GetLogger("dedups3").Errorf("bucket %s has no replication configuration", bucketName)
+		return nil, xhttp.ToError(xhttp.ErrReplicationConfigurationNotFoundError)
+	}
+
+	resyncKey := accountID + ":" + bucketName
+	r.lock.Lock()
+	if status := r.resyncs[resyncKey]; status != nil && status.Running {
+		r.lock.Unlock()
+		return status, nil
+	}
+	status := &ResyncStatus{
+		Bucket:  bucketName,
+		Running: true,
+		StartAt: time.Now().UTC(),
+	}
+	r.resyncs[resyncKey] = status
+	r.lock.Unlock()
+
+	go r.resync(objSvc, bucket, status)
+	logger.GetLogger("dedups3").Infof("start replication resync of bucket %s", bucketName)
+	return status.clone(&r.lock), nil
+}
+
+// GetResyncStatus 获取桶的重新同步进度，没有执行过时返回 nil
+func (r *ReplicationService) GetResyncStatus(accountID, bucketName string) *ResyncStatus {
+	r.lock.Lock()
+	status := r.resyncs[accountID+":"+bucketName]
+	r.lock.Unlock()
+	if status == nil {
+		return nil
+	}
+	return status.clone(&r.lock)
+}
+
+// resync 扫描桶内的当前版本对象并加入复制队列
+func (r *ReplicationService) resync(objSvc *object.ObjectService, bucket *meta.BucketMetadata, status *ResyncStatus) {
+	prefix := "aws:object:" + bucket.Owner.ID + ":" + bucket.Name + "/"
+	nextKey := ""
+	var resyncErr error
+	for r.running.Load() {
+		txn, err := r.kvstore.BeginTxn(context.Background(), &kv.TxnOpt{IsReadOnly: true})
+		if err != nil {
+			resyncErr = fmt.Errorf("failed to begin transaction: %w", err)
+			break
+		}
+		keys, next, err := txn.Scan(prefix, nextKey, DefaultResyncBatchSize)
+		_ = txn.Rollback()
+		if err != nil {
+			resyncErr = fmt.Errorf("scan %s failed: %w", prefix, err)
+			break
+		}
+
+		var scanned, queued int64
+		for _, k := range keys {
+			scanned++
+			ok, err := r.schedule(objSvc, bucket, strings.TrimPrefix(k, prefix))
+			if err != nil {
+				resyncErr = err
+				break
+			}
+			if ok {
+				queued++
+			}
+		}
+
+		r.lock.Lock()
+		status.Scanned += scanned
+		status.Queued += queued
+		r.lock.Unlock()
+
+		if resyncErr != nil || next == "" || len(keys) == 0 {
+			break
+		}
+		nextKey = next
+	}
+
+	r.lock.Lock()
+	status.Running = false
+	status.FinishAt = time.Now().UTC()
+	if resyncErr != nil {
+		status.Error = resyncErr.Error()
+	}
+	scanned, queued := status.Scanned, status.Queued
+	r.lock.Unlock()
+	if resyncErr != nil {
+		logger.GetLogger("dedups3").Errorf("replication resync of bucket %s failed: %v", bucket.Name, resyncErr)
+		return
+	}
+	logger.GetLogger("dedups3").Infof("replication resync of bucket %s finished, scanned %d queued %d", bucket.Name, scanned, queued)
+}
+
+// clone 在锁保护下复制一份进度
+func (s *ResyncStatus) clone(lock *sync.Mutex) *ResyncStatus {
+	lock.Lock()
+	defer lock.Unlock()
+	cp := *s
+	return &cp
+}
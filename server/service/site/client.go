@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/iam"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// 单个请求的超时，对象流可能很大，只限制建立连接和等待响应头
+	responseTimeout = 10 * time.Minute
+)
+
+var (
+	// errPeerNoSuchBucket 对端还没有同步这个桶
+	errPeerNoSuchBucket = errors.New("peer bucket not found")
+)
+
+// peerClient 访问对端站点复制接口的客户端
+type peerClient struct {
+	name     string
+	endpoint string
+	region   string
+	cred     aws.Credentials
+	signer   *v4.Signer
+	httpcli  *http.Client
+}
+
+// remoteError 对端返回的 S3 错误
+type remoteError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func newPeerClient(peer xconf.SitePeerConfig) *peerClient {
+	region := peer.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = responseTimeout
+	return &peerClient{
+		name:     peer.Name,
+		endpoint: strings.TrimRight(peer.Endpoint, "/"),
+		region:   region,
+		cred: aws.Credentials{
+			AccessKeyID:     peer.AccessKey,
+			SecretAccessKey: peer.SecretKey,
+		},
+		signer: v4.NewSigner(),
+		httpcli: &http.Client{
+			Transport: &xhttp.HttpLoggingTransport{
+				Transport: transport,
+			},
+		},
+	}
+}
+
+// checkChunks 查询对端缺少的chunk
+func (p *peerClient) checkChunks(req *CheckChunksRequest) (*CheckChunksResponse, error) {
+	resp := &CheckChunksResponse{}
+	if err := p.doJSON(http.MethodPost, "/chunks", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// putObject 发送对象帧流
+func (p *peerClient) putObject(body io.Reader) (*ApplyResponse, error) {
+	resp := &ApplyResponse{}
+	if err := p.do(http.MethodPut, "/object", body, unsignedPayload, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// deleteObject 同步删除对象
+func (p *peerClient) deleteObject(req *DeleteObjectRequest) (*ApplyResponse, error) {
+	resp := &ApplyResponse{}
+	if err := p.doJSON(http.MethodDelete, "/object", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// putBucket 同步桶配置
+func (p *peerClient) putBucket(bm *meta.BucketMetadata) (*ApplyResponse, error) {
+	resp := &ApplyResponse{}
+	if err := p.doJSON(http.MethodPut, "/bucket", bm, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// putIam 同步 IAM 快照
+func (p *peerClient) putIam(snapshot *iam.IamSnapshot) (*ApplyResponse, error) {
+	resp := &ApplyResponse{}
+	if err := p.doJSON(http.MethodPut, "/iam", snapshot, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// doJSON 发送 JSON 请求，请求体参与签名
+func (p *peerClient) doJSON(method, path string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("marshal site request failed: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return p.do(method, path, bytes.NewReader(data), hex.EncodeToString(sum[:]), out)
+}
+
+// do 签名并发送请求，成功时把 JSON 响应解析到 out
+func (p *peerClient) do(method, path string, body io.Reader, payloadHash string, out any) error {
+	ctx := context.Background()
+	req, err := http.NewRequestWithContext(ctx, method, p.endpoint+SitePathPrefix+path, body)
+	if err != nil {
+		return fmt.Errorf("create site request failed: %w", err)
+	}
+	req.Header.Set(SiteAPIHeader, "1")
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if payloadHash != unsignedPayload {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if err := p.signer.SignHTTP(ctx, p.cred, req, payloadHash, "s3", p.region, time.Now().UTC()); err != nil {
+		return fmt.Errorf("sign site request failed: %w", err)
+	}
+
+	resp, err := p.httpcli.Do(req)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("site %s request %s %s failed: %v", p.name, method, path, err)
+		return fmt.Errorf("site %s request %s failed: %w", p.name, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var re remoteError
+		_ = xml.Unmarshal(data, &re)
+		if re.Code == "NoSuchBucket" {
+			return errPeerNoSuchBucket
+		}
+		logger.GetLogger("dedups3").Errorf("site %s request %s %s status %d code %s: %s", p.name, method, path, resp.StatusCode, re.Code, re.Message)
+		return fmt.Errorf("site %s request %s status %d code %s", p.name, path, resp.StatusCode, re.Code)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode site %s response failed: %w", p.name, err)
+	}
+	return nil
+}
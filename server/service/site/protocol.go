@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package site
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mageg-x/dedups3/meta"
+)
+
+// 站点复制协议，两个集群都运行本服务时只传输对端缺少的chunk:
+//  1. POST /dedups3/site/chunks  发送对象的chunk hash 列表，对端返回缺少的hash
+//  2. PUT  /dedups3/site/object  按对象顺序发送chunk帧，只有缺少的chunk带数据，最后对端写入对象元数据
+//  3. DELETE /dedups3/site/object 同步删除
+//  4. PUT  /dedups3/site/bucket 和 /dedups3/site/iam 同步桶配置和 IAM 数据
+//
+// 所有请求使用对端管理账户根用户的密钥做 SigV4 签名，冲突按修改时间后写者胜
+
+const (
+	SiteAPIHeader  = "x-amz-dedups3-site-api"
+	SitePathPrefix = "/dedups3/site"
+
+	// maxHeaderSize 对象头的上限，大对象的chunk列表可能很长
+	maxHeaderSize = 256 << 20
+	// maxChunkSize chunk 数据的上限
+	maxChunkSize = 64 << 20
+)
+
+var (
+	// ErrChunkHashMismatch 收到的chunk数据与hash不一致
+	ErrChunkHashMismatch = errors.New("chunk hash mismatch")
+)
+
+// CheckChunksRequest 查询对端缺少的chunk
+type CheckChunksRequest struct {
+	StorageClass string   `json:"storageClass"`
+	Hashes       []string `json:"hashes"`
+}
+
+// CheckChunksResponse 对端缺少的chunk
+type CheckChunksResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// ObjectHeader 对象帧流的第一帧
+type ObjectHeader struct {
+	AccountID string       `json:"accountId"`
+	Object    *meta.Object `json:"object"`
+}
+
+// DeleteObjectRequest 同步删除对象
+type DeleteObjectRequest struct {
+	AccountID string    `json:"accountId"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// ApplyResponse 对端是否应用了同步的数据，本地数据更新时不应用
+type ApplyResponse struct {
+	Applied bool `json:"applied"`
+}
+
+// WriteObjectHeader 写入对象头: 4 字节长度 + JSON
+func WriteObjectHeader(w io.Writer, header *ObjectHeader) error {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("marshal object header failed: %w", err)
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadObjectHeader 读取对象头
+func ReadObjectHeader(r io.Reader) (*ObjectHeader, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("read object header failed: %w", err)
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size == 0 || size > maxHeaderSize {
+		return nil, fmt.Errorf("invalid object header size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("read object header failed: %w", err)
+	}
+	header := &ObjectHeader{}
+	if err := json.Unmarshal(data, header); err != nil {
+		return nil, fmt.Errorf("unmarshal object header failed: %w", err)
+	}
+	if header.Object == nil {
+		return nil, errors.New("object header without object")
+	}
+	return header, nil
+}
+
+// WriteChunkFrame 写入一个chunk帧: 4 字节chunk大小 + 1 字节是否带数据 + 数据
+// data 为 nil 时对端已有这个chunk，只传大小
+func WriteChunkFrame(w io.Writer, size int32, data []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[:4], uint32(size))
+	if data != nil {
+		prefix[4] = 1
+	}
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// NewChunkReader 按 hashes 的顺序读取chunk帧，全部读完后返回 io.EOF
+// 带数据的chunk按对象的去重范围 scope 校验hash，只有大小的chunk返回数据为空的引用
+func NewChunkReader(r io.Reader, hashes []string, scope string) func() (*meta.Chunk, error) {
+	index := 0
+	return func() (*meta.Chunk, error) {
+		if index >= len(hashes) {
+			return nil, io.EOF
+		}
+		hash := hashes[index]
+		index++
+
+		var prefix [5]byte
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			return nil, fmt.Errorf("read chunk %s frame failed: %w", hash, err)
+		}
+		size := binary.BigEndian.Uint32(prefix[:4])
+		if size == 0 || size > maxChunkSize {
+			return nil, fmt.Errorf("invalid chunk %s size %d", hash, size)
+		}
+		if prefix[4] == 0 {
+			return &meta.Chunk{Hash: hash, Size: int32(size), Scope: scope}, nil
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("read chunk %s data failed: %w", hash, err)
+		}
+		ck := &meta.Chunk{Size: int32(size), Scope: scope, Data: data}
+		ck.Hash = ck.CalcChunkHash()
+		if ck.Hash != hash {
+			return nil, fmt.Errorf("%w: %s:%s", ErrChunkHashMismatch, hash, ck.Hash)
+		}
+		return ck, nil
+	}
+}
@@ -0,0 +1,596 @@
+/*
+ * Copyright (C) 2025-2025 raochaoxun <raochaoxun@gmail.com>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package site
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	xconf "github.com/mageg-x/dedups3/internal/config"
+	xhttp "github.com/mageg-x/dedups3/internal/http"
+	"github.com/mageg-x/dedups3/internal/logger"
+	"github.com/mageg-x/dedups3/internal/queue"
+	"github.com/mageg-x/dedups3/meta"
+	"github.com/mageg-x/dedups3/service/bucket"
+	"github.com/mageg-x/dedups3/service/iam"
+	"github.com/mageg-x/dedups3/service/object"
+)
+
+const (
+	maxBytesPerFile = 64 << 20 // 64MB
+	minMsgSize      = 8
+	maxMsgSize      = 64 << 10 // 64KB
+	syncEvery       = 100
+	syncTimeout     = 1 * time.Second
+
+	siteQueueName  = "site-queue"
+	retryQueueName = "site-retry-queue"
+
+	// DefaultSiteMaxAttempts 单个任务最多尝试的次数
+	DefaultSiteMaxAttempts = 10
+	// DefaultSiteRetryBase 第一次重试的等待时间，之后每次翻倍
+	DefaultSiteRetryBase = 2 * time.Second
+	// DefaultSiteRetryMax 重试等待时间的上限
+	DefaultSiteRetryMax = 10 * time.Minute
+	// DefaultBucketBatchSize 同步桶配置时每批扫描的桶数
+	DefaultBucketBatchSize = 1000
+)
+
+var (
+	instance *SiteService
+	mu       = sync.Mutex{}
+)
+
+// Task 站点复制任务，只记录对象 key，执行时把对象的当前状态同步到对端
+type Task struct {
+	Peer        string    `json:"peer"`
+	AccountID   string    `json:"accountId"`
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"`
+	Attempts    int       `json:"attempts"`
+	NextRetryAt time.Time `json:"nextRetryAt,omitempty"`
+	CreateAt    time.Time `json:"createAt"`
+}
+
+// Stats 站点复制的运行统计
+type Stats struct {
+	Pending    int64 `json:"pending"`    // 待复制的任务数
+	Retrying   int64 `json:"retrying"`   // 等待重试的任务数
+	Replicated int64 `json:"replicated"` // 复制成功的对象数
+	Deleted    int64 `json:"deleted"`    // 同步删除的对象数
+	Failed     int64 `json:"failed"`     // 重试多次后仍失败的任务数
+	SentBytes  int64 `json:"sentBytes"`  // 实际传输的chunk数据量
+	DedupBytes int64 `json:"dedupBytes"` // 对端已有而不用传输的数据量
+}
+
+// PeerStatus 对端站点的同步状态，不包含密钥
+type PeerStatus struct {
+	Name        string    `json:"name"`
+	Endpoint    string    `json:"endpoint"`
+	IamSyncAt   time.Time `json:"iamSyncAt,omitempty"`
+	BucketSync  time.Time `json:"bucketSyncAt,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+}
+
+type SiteService struct {
+	running atomic.Bool
+	queue   queue.Queue
+	retry   queue.Queue
+	peers   map[string]*peerClient
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	mutex   sync.Mutex // 保护启动和停止
+	lock    sync.Mutex // 保护对端的同步状态
+
+	status     map[string]*PeerStatus
+	iamPushed  map[string]time.Time            // 每个对端已经推送过的 IAM 修改时间
+	bucketPush map[string]map[string]time.Time // 每个对端已经推送过的桶配置修改时间
+
+	replicated atomic.Int64
+	deleted    atomic.Int64
+	failed     atomic.Int64
+	sentBytes  atomic.Int64
+	dedupBytes atomic.Int64
+}
+
+// GetSiteService 获取全局站点复制服务实例
+func GetSiteService() *SiteService {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance
+	}
+	instance = &SiteService{
+		running:    atomic.Bool{},
+		peers:      make(map[string]*peerClient),
+		status:     make(map[string]*PeerStatus),
+		iamPushed:  make(map[string]time.Time),
+		bucketPush: make(map[string]map[string]time.Time),
+		mutex:      sync.Mutex{},
+		lock:       sync.Mutex{},
+	}
+	logger.GetLogger("dedups3").Infof("site replication service initialized successfully")
+	return instance
+}
+
+// Start 启动站点复制服务，没有配置对端时不启动
+func (s *SiteService) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running.Load() {
+		logger.GetLogger("dedups3").Infof("site replication service is already running")
+		return nil
+	}
+
+	cfg := xconf.Get()
+	if len(cfg.Site.Peers) == 0 {
+		logger.GetLogger("dedups3").Infof("no site peer configured, site replication disabled")
+		return nil
+	}
+	for _, peer := range cfg.Site.Peers {
+		if peer.Name == "" || peer.Endpoint == "" || peer.AccessKey == "" || peer.SecretKey == "" {
+			logger.GetLogger("dedups3").Errorf("invalid site peer %s endpoint %s", peer.Name, peer.Endpoint)
+			return fmt.Errorf("invalid site peer %s", peer.Name)
+		}
+		if _, ok := s.peers[peer.Name]; ok {
+			logger.GetLogger("dedups3").Errorf("duplicate site peer %s", peer.Name)
+			return fmt.Errorf("duplicate site peer %s", peer.Name)
+		}
+		s.peers[peer.Name] = newPeerClient(peer)
+		s.status[peer.Name] = &PeerStatus{Name: peer.Name, Endpoint: peer.Endpoint}
+		s.bucketPush[peer.Name] = make(map[string]time.Time)
+	}
+
+	dir := filepath.Join(cfg.Node.LocalDir, "queue")
+	s.queue = queue.NewDiskQueue(siteQueueName, dir, maxBytesPerFile, minMsgSize, maxMsgSize, syncEvery, syncTimeout)
+	if s.queue == nil {
+		logger.GetLogger("dedups3").Errorf("failed to create site queue")
+		return errors.New("failed to create site queue")
+	}
+	s.retry = queue.NewDiskQueue(retryQueueName, dir, maxBytesPerFile, minMsgSize, maxMsgSize, syncEvery, syncTimeout)
+	if s.retry == nil {
+		logger.GetLogger("dedups3").Errorf("failed to create site retry queue")
+		_ = s.queue.Close()
+		return errors.New("failed to create site retry queue")
+	}
+
+	workers := max(cfg.Site.Workers, 1)
+	interval := cfg.Site.SyncInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	s.stopCh = make(chan struct{})
+	s.running.Store(true)
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	s.wg.Add(2)
+	go s.retryWorker()
+	go s.syncLoop(interval)
+
+	logger.GetLogger("dedups3").Infof("site replication service %s started with %d peers", cfg.Site.Name, len(s.peers))
+	return nil
+}
+
+// Stop 停止站点复制服务，未处理的任务保留在磁盘队列中，下次启动后继续
+func (s *SiteService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running.Load() {
+		return
+	}
+	s.running.Store(false)
+	close(s.stopCh)
+	s.wg.Wait()
+	_ = s.queue.Close()
+	_ = s.retry.Close()
+	logger.GetLogger("dedups3").Infof("site replication service stopped successfully")
+}
+
+// GetStats 获取站点复制的运行统计
+func (s *SiteService) GetStats() *Stats {
+	stats := &Stats{
+		Replicated: s.replicated.Load(),
+		Deleted:    s.deleted.Load(),
+		Failed:     s.failed.Load(),
+		SentBytes:  s.sentBytes.Load(),
+		DedupBytes: s.dedupBytes.Load(),
+	}
+	if s.running.Load() {
+		stats.Pending = s.queue.Depth()
+		stats.Retrying = s.retry.Depth()
+	}
+	return stats
+}
+
+// GetPeers 获取对端站点的同步状态
+func (s *SiteService) GetPeers() []PeerStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	peers := make([]PeerStatus, 0, len(s.status))
+	for _, status := range s.status {
+		peers = append(peers, *status)
+	}
+	return peers
+}
+
+// Authorize 检查站点复制请求的密钥，只允许管理账户的根用户调用
+func Authorize(accessKeyID string) error {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return errors.New("failed to get iam service")
+	}
+	ak, err := iamService.GetAccessKey(accessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", accessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	cfg := xconf.Get()
+	if ak.AccountID != meta.GenerateAccountID(cfg.Admin.Username) || !iamService.IsRootUser(ak.AccountID, ak.Username) {
+		logger.GetLogger("dedups3").Errorf("access key %s is not allowed to call site api", accessKeyID)
+		return xhttp.ToError(xhttp.ErrAccessDenied)
+	}
+	return nil
+}
+
+// Schedule 对象写入或删除后调用，为每个对端加入一个复制任务
+func (s *SiteService) Schedule(accessKeyID, bucketName, key string) {
+	if !s.running.Load() {
+		return
+	}
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get iam service")
+		return
+	}
+	ak, err := iamService.GetAccessKey(accessKeyID)
+	if err != nil || ak == nil {
+		logger.GetLogger("dedups3").Errorf("failed to get access key %s", accessKeyID)
+		return
+	}
+	now := time.Now().UTC()
+	for name := range s.peers {
+		task := &Task{
+			Peer:      name,
+			AccountID: ak.AccountID,
+			Bucket:    bucketName,
+			Key:       key,
+			CreateAt:  now,
+		}
+		if err := s.enqueue(s.queue, task); err != nil {
+			logger.GetLogger("dedups3").Errorf("schedule site replication %s/%s to %s failed: %v", bucketName, key, name, err)
+		}
+	}
+}
+
+// enqueue 把任务写入磁盘队列
+func (s *SiteService) enqueue(q queue.Queue, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to marshal site task: %v", err)
+		return fmt.Errorf("failed to marshal site task: %w", err)
+	}
+	if err := q.Put(data); err != nil {
+		logger.GetLogger("dedups3").Errorf("failed to put site task %s/%s: %v", task.Bucket, task.Key, err)
+		return fmt.Errorf("failed to put site task: %w", err)
+	}
+	return nil
+}
+
+// worker 从复制队列中取任务执行
+func (s *SiteService) worker() {
+	defer s.wg.Done()
+	readChan := s.queue.ReadChan()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case msg := <-readChan:
+			task := &Task{}
+			if err := json.Unmarshal(msg, task); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to unmarshal site task: %v", err)
+				continue
+			}
+			s.handle(task)
+		}
+	}
+}
+
+// retryWorker 按顺序取出重试任务，等到重试时间后执行
+func (s *SiteService) retryWorker() {
+	defer s.wg.Done()
+	readChan := s.retry.ReadChan()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case msg := <-readChan:
+			task := &Task{}
+			if err := json.Unmarshal(msg, task); err != nil {
+				logger.GetLogger("dedups3").Errorf("failed to unmarshal site task: %v", err)
+				continue
+			}
+			if wait := time.Until(task.NextRetryAt); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-s.stopCh:
+					timer.Stop()
+					// 放回队列，下次启动后继续
+					_ = s.enqueue(s.retry, task)
+					return
+				case <-timer.C:
+				}
+			}
+			s.handle(task)
+		}
+	}
+}
+
+// handle 执行任务，失败时按指数退避重试
+func (s *SiteService) handle(task *Task) {
+	peer := s.peers[task.Peer]
+	if peer == nil {
+		logger.GetLogger("dedups3").Warnf("site peer %s removed, drop task %s/%s", task.Peer, task.Bucket, task.Key)
+		return
+	}
+	err := s.syncObject(peer, task)
+	if err == nil {
+		return
+	}
+	s.setError(task.Peer, err)
+	task.Attempts++
+	if task.Attempts >= DefaultSiteMaxAttempts {
+		logger.GetLogger("dedups3").Errorf("site replicate %s/%s to %s failed after %d attempts: %v", task.Bucket, task.Key, task.Peer, task.Attempts, err)
+		s.failed.Add(1)
+		return
+	}
+
+	backoff := DefaultSiteRetryBase << (task.Attempts - 1)
+	if backoff <= 0 || backoff > DefaultSiteRetryMax {
+		backoff = DefaultSiteRetryMax
+	}
+	task.NextRetryAt = time.Now().UTC().Add(backoff)
+	logger.GetLogger("dedups3").Warnf("site replicate %s/%s to %s failed, retry %d after %s: %v", task.Bucket, task.Key, task.Peer, task.Attempts, backoff, err)
+	if e := s.enqueue(s.retry, task); e != nil {
+		s.failed.Add(1)
+	}
+}
+
+// syncObject 把对象的当前状态同步到对端，对端没有这个桶时先同步桶配置
+func (s *SiteService) syncObject(peer *peerClient, task *Task) error {
+	objSvc := object.GetObjectService()
+	if objSvc == nil {
+		return errors.New("failed to get object service")
+	}
+	bm, err := objSvc.GetBucketMeta(task.AccountID, task.Bucket)
+	if err != nil {
+		if errors.Is(err, xhttp.ToError(xhttp.ErrNoSuchBucket)) {
+			logger.GetLogger("dedups3").Infof("bucket %s removed, drop site task %s", task.Bucket, task.Key)
+			return nil
+		}
+		return err
+	}
+	obj, err := objSvc.GetCurrentObject(task.AccountID, task.Bucket, task.Key)
+	if err != nil {
+		return err
+	}
+
+	err = s.pushObject(peer, objSvc, task, obj)
+	if errors.Is(err, errPeerNoSuchBucket) {
+		if err := s.pushBucket(peer, bm); err != nil {
+			return err
+		}
+		err = s.pushObject(peer, objSvc, task, obj)
+	}
+	return err
+}
+
+// pushObject 对象存在时只传输对端缺少的chunk，不存在时同步删除
+func (s *SiteService) pushObject(peer *peerClient, objSvc *object.ObjectService, task *Task, obj *meta.Object) error {
+	if obj == nil || obj.DeleteMarker {
+		req := &DeleteObjectRequest{
+			AccountID: task.AccountID,
+			Bucket:    task.Bucket,
+			Key:       task.Key,
+			DeletedAt: task.CreateAt,
+		}
+		if obj != nil {
+			req.DeletedAt = obj.LastModified
+		}
+		resp, err := peer.deleteObject(req)
+		if err != nil {
+			return err
+		}
+		if resp.Applied {
+			s.deleted.Add(1)
+			logger.GetLogger("dedups3").Infof("site replicate delete %s/%s to %s", task.Bucket, task.Key, peer.name)
+		}
+		return nil
+	}
+
+	missing := make(map[string]bool)
+	if obj.ChunksInline == nil && len(obj.Chunks) > 0 {
+		hashes := make([]string, 0, len(obj.Chunks))
+		seen := make(map[string]bool, len(obj.Chunks))
+		for _, hash := range obj.Chunks {
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+		resp, err := peer.checkChunks(&CheckChunksRequest{StorageClass: obj.StorageClass, Hashes: hashes})
+		if err != nil {
+			return err
+		}
+		for _, hash := range resp.Missing {
+			missing[hash] = true
+		}
+	}
+
+	var sent, deduped int64
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := WriteObjectHeader(pw, &ObjectHeader{AccountID: task.AccountID, Object: obj})
+		if err == nil && obj.ChunksInline == nil {
+			// 同一个chunk在对象中出现多次时只传一次数据
+			err = objSvc.ReadChunks(obj, func(hash string) bool {
+				return missing[hash]
+			}, func(ck *meta.Chunk, data []byte) error {
+				if data != nil {
+					delete(missing, ck.Hash)
+					sent += int64(len(data))
+				} else {
+					deduped += int64(ck.Size)
+				}
+				return WriteChunkFrame(pw, ck.Size, data)
+			})
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	resp, err := peer.putObject(pr)
+	_ = pr.Close()
+	<-done
+	if err != nil {
+		return err
+	}
+	s.sentBytes.Add(sent)
+	s.dedupBytes.Add(deduped)
+	if resp.Applied {
+		s.replicated.Add(1)
+		logger.GetLogger("dedups3").Infof("site replicate object %s/%s version %s to %s, sent %d dedup %d bytes",
+			obj.Bucket, obj.Key, obj.GetVersionID(), peer.name, sent, deduped)
+	}
+	return nil
+}
+
+// pushBucket 把桶配置推送到对端
+func (s *SiteService) pushBucket(peer *peerClient, bm *meta.BucketMetadata) error {
+	if _, err := peer.putBucket(bm); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.bucketPush[peer.name][bm.GenBucketKey()] = bm.UpdatedAt
+	s.lock.Unlock()
+	return nil
+}
+
+// syncLoop 定期把 IAM 数据和桶配置推送到对端
+func (s *SiteService) syncLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for name, peer := range s.peers {
+			if err := s.syncIam(peer); err != nil {
+				logger.GetLogger("dedups3").Errorf("sync iam to site %s failed: %v", name, err)
+				s.setError(name, err)
+			}
+			if err := s.syncBuckets(peer); err != nil {
+				logger.GetLogger("dedups3").Errorf("sync buckets to site %s failed: %v", name, err)
+				s.setError(name, err)
+			}
+		}
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncIam IAM 数据有修改时推送完整快照
+func (s *SiteService) syncIam(peer *peerClient) error {
+	iamService := iam.GetIamService()
+	if iamService == nil {
+		return errors.New("failed to get iam service")
+	}
+	snapshot, err := iamService.ExportSnapshot()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	pushed, ok := s.iamPushed[peer.name]
+	s.lock.Unlock()
+	if ok && !snapshot.UpdatedAt.After(pushed) {
+		return nil
+	}
+	if _, err := peer.putIam(snapshot); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.iamPushed[peer.name] = snapshot.UpdatedAt
+	s.status[peer.name].IamSyncAt = time.Now().UTC()
+	s.lock.Unlock()
+	return nil
+}
+
+// syncBuckets 推送修改过的桶配置，桶的删除不同步
+func (s *SiteService) syncBuckets(peer *peerClient) error {
+	bs := bucket.GetBucketService()
+	if bs == nil {
+		return errors.New("failed to get bucket service")
+	}
+	nextKey := ""
+	for s.running.Load() {
+		buckets, next, err := bs.ScanBuckets(nextKey, DefaultBucketBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, bm := range buckets {
+			s.lock.Lock()
+			pushed, ok := s.bucketPush[peer.name][bm.GenBucketKey()]
+			s.lock.Unlock()
+			if ok && !bm.UpdatedAt.After(pushed) {
+				continue
+			}
+			if err := s.pushBucket(peer, bm); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			break
+		}
+		nextKey = next
+	}
+	s.lock.Lock()
+	s.status[peer.name].BucketSync = time.Now().UTC()
+	s.lock.Unlock()
+	return nil
+}
+
+// setError 记录对端最近一次的错误
+func (s *SiteService) setError(name string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if status := s.status[name]; status != nil {
+		status.LastError = err.Error()
+		status.LastErrorAt = time.Now().UTC()
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	xhttp "github.com/mageg-x/dedups3/internal/http"
 	"github.com/mageg-x/dedups3/plugs/kv"
+	"github.com/mageg-x/dedups3/service/gc"
 	"github.com/mageg-x/dedups3/service/iam"
 	"sync"
 	"sync/atomic"
@@ -55,6 +56,7 @@ type StatsOfGlobal struct {
 	ChunkSize    int64 `json:"chunkSize"`
 	BlockSize1   int64 `json:"blockSize1"` //没有压缩后根据block 统计的大小
 	BlockSize2   int64 `json:"blockSize2"` //压缩后的block 统计大小
+	BlockSkip    int64 `json:"blockSkip"`  //开启压缩时没有压缩存储的block 数据大小
 }
 
 type StatsOfAccount struct {
@@ -69,6 +71,7 @@ type StatsOfAccount struct {
 	SizeOfChunk       int64 `json:"sizeOfChunk"`       // 根据chunk统计 ==  去重后的数据大小
 	SizeofBlock1      int64 `json:"sizeofBlock1"`      // 没有压缩后根据block 统计的大小  ==== 近似 去重后的数据大小
 	SizeOfBlock2      int64 `json:"sizeOfBlock2"`      // 压缩后的block 统计大小
+	SizeOfBlockSkip   int64 `json:"sizeOfBlockSkip"`   // block 中开启压缩时没有压缩存储的数据大小
 }
 
 type StatsOfBucket struct {
@@ -82,10 +85,11 @@ type StatsOfBucket struct {
 }
 
 type Stats struct {
-	AccountStats        *StatsOfAccount `json:"accountStats"`
-	LastMonAccountStats *StatsOfAccount `json:"lastMonAccountStats,omitempty"`
-	GlobalStats         *StatsOfGlobal  `json:"globalStats"`
-	LastGlobalStats     *StatsOfGlobal  `json:"lastGlobalStats,omitempty"`
+	AccountStats        *StatsOfAccount    `json:"accountStats"`
+	LastMonAccountStats *StatsOfAccount    `json:"lastMonAccountStats,omitempty"`
+	GlobalStats         *StatsOfGlobal     `json:"globalStats"`
+	LastGlobalStats     *StatsOfGlobal     `json:"lastGlobalStats,omitempty"`
+	Integrity           *gc.IntegrityStats `json:"integrity,omitempty"` // 本节点读取时的数据完整性校验统计
 }
 
 type StatsService struct {
@@ -187,7 +191,8 @@ func (s *StatsService) GetAccountStats(accountID string) (*Stats, error) {
 		g_premon_stats = nil
 	}
 
-	return &Stats{AccountStats: today_stats, LastMonAccountStats: premon_stats, GlobalStats: g_stats, LastGlobalStats: g_premon_stats}, nil
+	return &Stats{AccountStats: today_stats, LastMonAccountStats: premon_stats, GlobalStats: g_stats, LastGlobalStats: g_premon_stats,
+		Integrity: gc.GetIntegrityStats()}, nil
 }
 
 func (s *StatsService) RefreshAccountStats(accountID string) {
@@ -426,6 +431,7 @@ func (s *StatsService) doStats4Account(accountID string) error {
 	const blockBatchSize = 100
 	SizeOfBlock1 := int64(0)
 	SizeOfBlock2 := int64(0)
+	SizeOfBlockSkip := int64(0)
 	// 分批处理block
 	for i := 0; i < len(myBlocks); i += blockBatchSize {
 		end := i + blockBatchSize
@@ -457,10 +463,12 @@ func (s *StatsService) doStats4Account(accountID string) error {
 			logger.GetLogger("dedups3").Debugf("block info %#v", block)
 			SizeOfBlock1 += block.TotalSize
 			SizeOfBlock2 += block.RealSize
+			SizeOfBlockSkip += block.SkipSize
 		}
 	}
 	myStats.SizeofBlock1 = SizeOfBlock1
 	myStats.SizeOfBlock2 = SizeOfBlock2
+	myStats.SizeOfBlockSkip = SizeOfBlockSkip
 
 	// 把结果写入kv 存储
 	errMsg := utils.RetryCall(10, func() error {
@@ -730,6 +738,7 @@ func (s *StatsService) doStats4Global() error {
 							if err := json.Unmarshal(data, &block); err == nil {
 								globalStats.BlockSize1 += block.TotalSize
 								globalStats.BlockSize2 += block.RealSize
+								globalStats.BlockSkip += block.SkipSize
 							}
 						}
 					}
@@ -747,6 +756,7 @@ func (s *StatsService) doStats4Global() error {
 						if err := json.Unmarshal(data, &block); err == nil {
 							globalStats.BlockSize1 += block.TotalSize
 							globalStats.BlockSize2 += block.RealSize
+							globalStats.BlockSkip += block.SkipSize
 						}
 					}
 				}
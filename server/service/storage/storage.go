@@ -164,6 +164,7 @@ func (s *StorageService) AddStorage(strType, strClass string, conf xconf.Storage
 		FixSize:   false,
 		Encrypt:   true,
 		Compress:  true,
+		Verify:    true,
 	}
 	// 创建并存储新的 Storage 对象
 	storage := &meta.Storage{
@@ -346,6 +347,7 @@ func (s *StorageService) ListChunkConfig(storageID string) (map[string]*meta.Chu
 		FixSize:   false,
 		Encrypt:   true,
 		Compress:  true,
+		Verify:    true,
 	}
 
 	storages := s.ListStorages()
@@ -365,6 +367,10 @@ func (s *StorageService) SetChunkConfig(storageID string, chunk *meta.ChunkConfi
 		logger.GetLogger("dedups3").Debugf("chunk is nil for storage %s", storageID)
 		return errors.New("chunk is nil")
 	}
+	if err := chunk.Validate(); err != nil {
+		logger.GetLogger("dedups3").Errorf("invalid chunk config for storage %s: %v", storageID, err)
+		return err
+	}
 
 	txn, err := s.conf.TxnBegin()
 	if err != nil || txn == "" {